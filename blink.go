@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+
+	"github.com/xperimental/flowercare-exporter/internal/config"
+)
+
+const blinkCommand = "blink"
+
+// runBlink makes the LED of a single sensor blink, so that it can be told apart from identical sensors.
+func runBlink(args []string) {
+	cfg, err := config.ParseBlink(args)
+	if err != nil {
+		log.Fatalf("Error in blink configuration: %s", err)
+	}
+
+	b, err := commandBackend(cfg.WorkerSocket, cfg.Device, cfg.BLE)
+	if err != nil {
+		log.Fatalf("Error creating device: %s", err)
+	}
+	defer b.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+
+	if err := b.Blink(ctx, cfg.Sensor); err != nil {
+		b.Close()
+		log.Fatalf("Error blinking sensor %s: %s", cfg.Sensor.MacAddress, err)
+	}
+
+	log.Infof("Sensor %s is blinking.", cfg.Sensor.MacAddress)
+}
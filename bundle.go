@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/xperimental/flowercare-exporter/internal/adapter"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/support"
+	"github.com/xperimental/flowercare-exporter/pkg/apiclient"
+)
+
+const (
+	bundleCommand = "bundle"
+
+	logBufferSize = 500
+)
+
+// runBundle collects information about the system and the running exporter into an archive.
+func runBundle(args []string) {
+	now := time.Now()
+	cfg, err := config.ParseBundle(args, now)
+	if err != nil {
+		log.Fatalf("Error in bundle configuration: %s", err)
+	}
+
+	bundle := support.Bundle{
+		Version: support.NewVersion(version, commit, date),
+	}
+
+	adapters, err := adapter.List()
+	if err != nil {
+		bundle.Notes = append(bundle.Notes, fmt.Sprintf("Can not list adapters: %s", err))
+	}
+	bundle.Adapters = adapters
+
+	report, err := fetchReport(cfg)
+	if err != nil {
+		log.Warnf("Can not get report from exporter, bundle only contains local information: %s", err)
+		bundle.Notes = append(bundle.Notes, fmt.Sprintf("Can not get report from exporter at %s: %s", cfg.URL, err))
+	}
+	bundle.Report = report
+
+	file, err := os.OpenFile(cfg.Output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		log.Fatalf("Error creating bundle: %s", err)
+	}
+	defer file.Close()
+
+	if err := bundle.WriteArchive(file, now); err != nil {
+		log.Fatalf("Error writing bundle: %s", err)
+	}
+
+	log.Infof("Bundle written to %s. Please check its contents before attaching it to an issue.", cfg.Output)
+}
+
+func fetchReport(cfg config.BundleConfig) (*support.Report, error) {
+	var report support.Report
+	if err := apiclient.New(cfg.URL, cfg.Token).Support(context.Background(), &report); err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
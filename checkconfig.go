@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/xperimental/flowercare-exporter/internal/config"
+)
+
+const checkConfigCommand = "check-config"
+
+// runCheckConfig parses the flags of the exporter and prints all problems found in the configuration, without
+// starting the exporter. It exits with an error if the configuration is invalid.
+func runCheckConfig(args []string) {
+	os.Args = append([]string{os.Args[0]}, args...)
+
+	cfg, err := config.Parse(log)
+	var validation *config.ValidationError
+	switch {
+	case errors.As(err, &validation):
+		for _, p := range validation.Problems {
+			fmt.Printf("Error: %s\n", p)
+		}
+	case err != nil:
+		// The flags could not be parsed, so the configuration can not be checked any further.
+		fmt.Printf("Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	warnings := cfg.Lint()
+	for _, w := range warnings {
+		fmt.Printf("Warning: %s\n  Suggestion: %s\n", w.Problem, w.Suggestion)
+	}
+
+	if validation != nil {
+		fmt.Printf("Configuration is invalid, %d errors, %d warnings.\n", len(validation.Problems), len(warnings))
+		os.Exit(1)
+	}
+
+	fmt.Printf("Configuration is valid, %d sensors, %d warnings.\n", len(cfg.Sensors), len(warnings))
+}
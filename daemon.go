@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/xperimental/flowercare-exporter/internal/atomicfile"
+)
+
+// readyFDEnv contains the file descriptor the daemon uses for telling the starting process that it is ready.
+const readyFDEnv = "FLOWERCARE_EXPORTER_READY_FD"
+
+// isDaemon returns true if the process has been started in the background by daemonize.
+func isDaemon() bool {
+	return os.Getenv(readyFDEnv) != ""
+}
+
+// notifyReady tells the starting process that the daemon is ready.
+func notifyReady() {
+	value := os.Getenv(readyFDEnv)
+	if value == "" {
+		return
+	}
+	os.Unsetenv(readyFDEnv)
+
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		log.Errorf("Invalid file descriptor in %s: %q", readyFDEnv, value)
+		return
+	}
+
+	f := os.NewFile(uintptr(fd), "ready")
+	defer f.Close()
+
+	if _, err := f.Write([]byte{1}); err != nil {
+		log.Errorf("Can not notify starting process: %s", err)
+	}
+}
+
+// checkPIDFile returns an error if the PID file belongs to another running process.
+func checkPIDFile(fileName string) error {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid == os.Getpid() {
+		return nil
+	}
+
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return nil
+	}
+
+	if err := process.Signal(syscall.Signal(0)); err == nil {
+		return fmt.Errorf("exporter is already running with PID %d", pid)
+	}
+
+	return nil
+}
+
+// writePIDFile writes the ID of the current process to the file.
+func writePIDFile(fileName string) error {
+	if err := checkPIDFile(fileName); err != nil {
+		return err
+	}
+
+	return atomicfile.Write(fileName, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644)
+}
+
+// removePIDFile removes the file if it still contains the ID of the current process. It might have been replaced by a
+// new exporter taking over.
+func removePIDFile(fileName string) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return
+	}
+
+	if strings.TrimSpace(string(data)) == strconv.Itoa(os.Getpid()) {
+		os.Remove(fileName)
+	}
+}
@@ -0,0 +1,51 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// daemonize starts the exporter again in a new session in the background and waits until it is ready. It exits
+// the current process, successfully only if the daemon has started.
+func daemonize(logFile string) {
+	executable, err := os.Executable()
+	if err != nil {
+		log.Fatalf("Can not find executable: %s", err)
+	}
+
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		log.Fatalf("Can not create pipe: %s", err)
+	}
+
+	null, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		log.Fatalf("Can not open %s: %s", os.DevNull, err)
+	}
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), readyFDEnv+"=3")
+	cmd.Stdin = null
+	cmd.Stdout = null
+	cmd.Stderr = null
+	cmd.ExtraFiles = []*os.File{readyWriter}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setsid: true,
+	}
+	if err := cmd.Start(); err != nil {
+		log.Fatalf("Can not start daemon: %s", err)
+	}
+	readyWriter.Close()
+
+	// The pipe is closed without data if the daemon exits during startup.
+	buf := make([]byte, 1)
+	if n, _ := ready.Read(buf); n == 0 {
+		log.Fatalf("Exporter exited during startup, see %s for details.", logFile)
+	}
+
+	log.Infof("Exporter started in background with PID %d.", cmd.Process.Pid)
+	os.Exit(0)
+}
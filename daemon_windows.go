@@ -0,0 +1,6 @@
+package main
+
+// daemonize is not supported on Windows, use the service subcommand instead.
+func daemonize(_ string) {
+	log.Fatal("Running as daemon is not supported on Windows, install a service instead.")
+}
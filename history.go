@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/pkg/apiclient"
+)
+
+const historyCommand = "history"
+
+// runHistory downloads the values stored on a sensor using the running exporter and writes them to stdout.
+func runHistory(args []string) {
+	cfg, err := config.ParseHistory(args)
+	if err != nil {
+		log.Fatalf("Error in history configuration: %s", err)
+	}
+
+	client := apiclient.New(cfg.URL, cfg.Token)
+	client.HTTPClient.Timeout = cfg.Timeout
+
+	ctx := context.Background()
+	if cfg.Format == "csv" {
+		if err := client.HistoryCSV(ctx, cfg.MacAddress, cfg.Limit, os.Stdout); err != nil {
+			log.Fatalf("Error downloading history: %s", err)
+		}
+		return
+	}
+
+	readings, err := client.History(ctx, cfg.MacAddress, cfg.Limit)
+	if err != nil {
+		log.Fatalf("Error downloading history: %s", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(readings); err != nil {
+		log.Fatalf("Error writing history: %s", err)
+	}
+}
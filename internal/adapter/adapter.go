@@ -0,0 +1,83 @@
+// Package adapter lists the Bluetooth adapters of the system and resolves the adapter selected by the user.
+//
+// Adapters can be selected by their kernel name (hci0), their MAC address or their local name. Using the
+// MAC address or local name is more stable than the index, which can change between reboots when USB
+// dongles are used.
+package adapter
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var kernelNameRegex = regexp.MustCompile(`^hci(\d+)$`)
+
+// Adapter contains information about a Bluetooth adapter.
+type Adapter struct {
+	// ID is the index of the adapter used by the kernel.
+	ID int
+	// KernelName is the name used by the kernel, for example hci0.
+	KernelName string
+	// Address contains the MAC address of the adapter.
+	Address string
+	// Name contains the local name of the adapter. It is empty if it could not be read.
+	Name string
+	// Up is true if the adapter is enabled.
+	Up bool
+}
+
+func (a Adapter) String() string {
+	if a.Name == "" {
+		return fmt.Sprintf("%s (%s)", a.KernelName, a.Address)
+	}
+
+	return fmt.Sprintf("%s (%s, %s)", a.KernelName, a.Address, a.Name)
+}
+
+// Resolve returns the adapter identified by the selector, which can be a kernel name, MAC address or local name.
+func Resolve(selector string) (Adapter, error) {
+	if m := kernelNameRegex.FindStringSubmatch(selector); m != nil {
+		id, err := strconv.Atoi(m[1])
+		if err != nil {
+			return Adapter{}, fmt.Errorf("can not parse adapter index: %s", err)
+		}
+
+		adapters, err := List()
+		if err != nil {
+			// Fall back to the index, listing might not be possible, but opening the adapter could still work.
+			return Adapter{
+				ID:         id,
+				KernelName: selector,
+			}, nil
+		}
+
+		for _, a := range adapters {
+			if a.ID == id {
+				return a, nil
+			}
+		}
+
+		return Adapter{}, fmt.Errorf("adapter not found: %s", selector)
+	}
+
+	adapters, err := List()
+	if err != nil {
+		return Adapter{}, fmt.Errorf("can not list adapters: %s", err)
+	}
+
+	_, macErr := net.ParseMAC(selector)
+	for _, a := range adapters {
+		if macErr == nil && strings.EqualFold(a.Address, selector) {
+			return a, nil
+		}
+
+		if macErr != nil && a.Name == selector {
+			return a, nil
+		}
+	}
+
+	return Adapter{}, fmt.Errorf("adapter not found: %s", selector)
+}
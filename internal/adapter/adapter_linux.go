@@ -0,0 +1,182 @@
+package adapter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	maxDevices = 16
+
+	flagUp = 1 << 0
+
+	// ioctl requests of the HCI socket, see linux/net/bluetooth/hci_sock.h.
+	ioctlGetDeviceList = 2<<30 | 4<<16 | 'H'<<8 | 210
+	ioctlGetDeviceInfo = 2<<30 | 4<<16 | 'H'<<8 | 211
+
+	hciChannelRaw        = 0
+	hciCommandPacket     = 0x01
+	hciEventPacket       = 0x04
+	eventCommandComplete = 0x0e
+	opReadLocalName      = 0x0c14
+	localNameLength      = 248
+	solHCI               = 0
+	optHCIFilter         = 2
+)
+
+type deviceRequest struct {
+	ID     uint16
+	_      uint16
+	Option uint32
+}
+
+type deviceListRequest struct {
+	Count   uint16
+	_       uint16
+	Devices [maxDevices]deviceRequest
+}
+
+type deviceInfo struct {
+	ID         uint16
+	Name       [8]byte
+	Address    [6]byte
+	Flags      uint32
+	Type       uint8
+	Features   [8]uint8
+	PacketType uint32
+	LinkPolicy uint32
+	LinkMode   uint32
+	ACLMTU     uint16
+	ACLPackets uint16
+	SCOMTU     uint16
+	SCOPackets uint16
+	Stats      [10]uint32
+}
+
+type eventFilter struct {
+	TypeMask  uint32
+	EventMask [2]uint32
+	Opcode    uint16
+}
+
+// List returns all Bluetooth adapters known to the kernel.
+func List() ([]Adapter, error) {
+	fd, err := unix.Socket(unix.AF_BLUETOOTH, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.BTPROTO_HCI)
+	if err != nil {
+		return nil, fmt.Errorf("can not open HCI socket: %s", err)
+	}
+	defer unix.Close(fd)
+
+	list := deviceListRequest{
+		Count: maxDevices,
+	}
+	if err := ioctl(fd, ioctlGetDeviceList, unsafe.Pointer(&list)); err != nil {
+		return nil, fmt.Errorf("can not get device list: %s", err)
+	}
+
+	result := make([]Adapter, 0, list.Count)
+	for i := 0; i < int(list.Count) && i < maxDevices; i++ {
+		info := deviceInfo{
+			ID: list.Devices[i].ID,
+		}
+		if err := ioctl(fd, ioctlGetDeviceInfo, unsafe.Pointer(&info)); err != nil {
+			return nil, fmt.Errorf("can not get info of device %d: %s", info.ID, err)
+		}
+
+		a := Adapter{
+			ID:         int(info.ID),
+			KernelName: strings.TrimRight(string(info.Name[:]), "\x00"),
+			Address:    formatAddress(info.Address),
+			Up:         info.Flags&flagUp != 0,
+		}
+		if a.Up {
+			// Errors are ignored, the name is optional.
+			a.Name, _ = readLocalName(a.ID)
+		}
+
+		result = append(result, a)
+	}
+
+	return result, nil
+}
+
+func ioctl(fd int, req uint, arg unsafe.Pointer) error {
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), uintptr(req), uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+func formatAddress(b [6]byte) string {
+	// The address is stored in little-endian order.
+	return fmt.Sprintf("%02X:%02X:%02X:%02X:%02X:%02X", b[5], b[4], b[3], b[2], b[1], b[0])
+}
+
+// readLocalName sends the "Read Local Name" command to the adapter and waits for the result.
+func readLocalName(id int) (string, error) {
+	fd, err := unix.Socket(unix.AF_BLUETOOTH, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.BTPROTO_HCI)
+	if err != nil {
+		return "", err
+	}
+	defer unix.Close(fd)
+
+	if err := unix.Bind(fd, &unix.SockaddrHCI{Dev: uint16(id), Channel: hciChannelRaw}); err != nil {
+		return "", err
+	}
+
+	filter := eventFilter{
+		TypeMask: 1 << hciEventPacket,
+		Opcode:   opReadLocalName,
+	}
+	filter.EventMask[0] = 1 << eventCommandComplete
+	if _, _, errno := unix.Syscall6(unix.SYS_SETSOCKOPT, uintptr(fd), solHCI, optHCIFilter,
+		uintptr(unsafe.Pointer(&filter)), unsafe.Sizeof(filter), 0); errno != 0 {
+		return "", errno
+	}
+
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &unix.Timeval{Sec: 1}); err != nil {
+		return "", err
+	}
+
+	command := []byte{hciCommandPacket, opReadLocalName & 0xff, opReadLocalName >> 8, 0}
+	if _, err := unix.Write(fd, command); err != nil {
+		return "", err
+	}
+
+	deadline := time.Now().Add(time.Second)
+	buf := make([]byte, 512)
+	for time.Now().Before(deadline) {
+		n, err := unix.Read(fd, buf)
+		if err != nil {
+			return "", err
+		}
+
+		// packet type, event code, length, number of packets, opcode (2), status, name
+		if n < 7+localNameLength || buf[1] != eventCommandComplete {
+			continue
+		}
+
+		if opcode := uint16(buf[4]) | uint16(buf[5])<<8; opcode != opReadLocalName {
+			continue
+		}
+
+		if status := buf[6]; status != 0 {
+			return "", fmt.Errorf("command failed with status 0x%02x", status)
+		}
+
+		name := buf[7 : 7+localNameLength]
+		if i := strings.IndexByte(string(name), 0); i >= 0 {
+			name = name[:i]
+		}
+		return string(name), nil
+	}
+
+	return "", errors.New("timeout waiting for local name")
+}
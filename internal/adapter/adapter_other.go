@@ -0,0 +1,10 @@
+//go:build !linux
+
+package adapter
+
+import "errors"
+
+// List returns all Bluetooth adapters known to the kernel.
+func List() ([]Adapter, error) {
+	return nil, errors.New("listing adapters is only supported on Linux")
+}
@@ -0,0 +1,98 @@
+package adapter
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// listInterval is the interval between two enumerations of the adapters. Adapters are rarely added or removed, so
+// the sockets needed for listing them are not opened on every scrape.
+const listInterval = 5 * time.Minute
+
+var adapterInfoDesc = prometheus.NewDesc(
+	"flowercare_adapter_info",
+	"Lists the Bluetooth adapters detected on the system. Value set to 1.",
+	[]string{"adapter", "address", "name", "up", "selected"}, nil)
+
+// Collector exports information about all detected adapters. The adapters are listed when starting the collector
+// and again every listInterval.
+type Collector struct {
+	Log logrus.FieldLogger
+	// Selected contains the adapters used by the exporter.
+	Selected []Adapter
+
+	lock     sync.RWMutex
+	adapters []Adapter
+}
+
+// Start lists the adapters and starts updating the list periodically.
+func (c *Collector) Start(ctx context.Context, wg *sync.WaitGroup) {
+	c.list()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(listInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.list()
+			}
+		}
+	}()
+}
+
+func (c *Collector) list() {
+	adapters, err := List()
+	if err != nil {
+		c.Log.Debugf("Can not list adapters: %s", err)
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.adapters = adapters
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- adapterInfoDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	for _, a := range c.adapters {
+		m, err := prometheus.NewConstMetric(adapterInfoDesc, prometheus.GaugeValue, 1,
+			a.KernelName, a.Address, a.Name, strconv.FormatBool(a.Up), strconv.FormatBool(c.isSelected(a)))
+		if err != nil {
+			c.Log.Errorf("can not create metric %q: %s", adapterInfoDesc, err)
+			continue
+		}
+
+		ch <- m
+	}
+}
+
+func (c *Collector) isSelected(a Adapter) bool {
+	for _, s := range c.Selected {
+		if s.KernelName != "" && s.ID == a.ID {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,110 @@
+// Package anonymize replaces identifying information like MAC addresses and sensor names with stable pseudonyms,
+// so that logs and outputs can be shared publicly.
+//
+// All methods can be called on a nil Anonymizer, in which case the values are returned unchanged.
+package anonymize
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/xperimental/flowercare-exporter/internal/config"
+)
+
+// defaultKey is used if no key is provided. The pseudonyms are still stable, but could be reversed by someone
+// guessing the MAC addresses.
+const defaultKey = "flowercare-exporter"
+
+var macPattern = regexp.MustCompile(`(?i)\b[0-9a-f]{2}(:[0-9a-f]{2}){5}\b`)
+
+// Anonymizer derives pseudonyms from a key.
+type Anonymizer struct {
+	key []byte
+}
+
+// New creates a new Anonymizer. The same key always produces the same pseudonyms.
+func New(key string) *Anonymizer {
+	if key == "" {
+		key = defaultKey
+	}
+
+	return &Anonymizer{
+		key: []byte(key),
+	}
+}
+
+func (a *Anonymizer) hash(kind, value string) []byte {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(kind))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// MAC returns the pseudonym of a MAC address. It is a locally administered address, so it can not be mistaken
+// for a real device.
+func (a *Anonymizer) MAC(macAddress string) string {
+	if a == nil || macAddress == "" {
+		return macAddress
+	}
+
+	b := a.hash("mac", strings.ToUpper(macAddress))[:6]
+	b[0] = (b[0] | 0x02) &^ 0x01
+	return fmt.Sprintf("%02X:%02X:%02X:%02X:%02X:%02X", b[0], b[1], b[2], b[3], b[4], b[5])
+}
+
+// Name returns the pseudonym of a sensor name.
+func (a *Anonymizer) Name(name string) string {
+	if a == nil || name == "" {
+		return name
+	}
+
+	return "plant-" + hex.EncodeToString(a.hash("name", name)[:3])
+}
+
+// Sensor returns a copy of the sensor with the identifying information replaced.
+func (a *Anonymizer) Sensor(sensor config.Sensor) config.Sensor {
+	if a == nil {
+		return sensor
+	}
+
+	sensor = sensor.Redacted()
+	sensor.MacAddress = a.MAC(sensor.MacAddress)
+	sensor.Name = a.Name(sensor.Name)
+	return sensor
+}
+
+// String replaces all MAC addresses and the names of the sensors in a text.
+func (a *Anonymizer) String(text string, sensors []config.Sensor) string {
+	if a == nil {
+		return text
+	}
+
+	text = macPattern.ReplaceAllStringFunc(text, a.MAC)
+
+	names := make([]string, 0, len(sensors))
+	for _, s := range sensors {
+		if s.Name != "" {
+			names = append(names, s.Name)
+		}
+	}
+	if len(names) == 0 {
+		return text
+	}
+
+	// Replace longer names first, in case one name contains another.
+	sort.Slice(names, func(i, j int) bool {
+		return len(names[i]) > len(names[j])
+	})
+	pairs := make([]string, 0, 2*len(names))
+	for _, n := range names {
+		pairs = append(pairs, n, a.Name(n))
+	}
+
+	return strings.NewReplacer(pairs...).Replace(text)
+}
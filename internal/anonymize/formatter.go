@@ -0,0 +1,36 @@
+package anonymize
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+)
+
+// Formatter replaces identifying information in log entries before passing them to the base formatter.
+type Formatter struct {
+	Base       logrus.Formatter
+	Anonymizer *Anonymizer
+	Sensors    func() []config.Sensor
+}
+
+// Format implements logrus.Formatter
+func (f *Formatter) Format(entry *logrus.Entry) ([]byte, error) {
+	sensors := f.Sensors()
+
+	masked := *entry
+	masked.Message = f.Anonymizer.String(entry.Message, sensors)
+	masked.Data = make(logrus.Fields, len(entry.Data))
+	for k, v := range entry.Data {
+		switch value := v.(type) {
+		case error:
+			masked.Data[k] = f.Anonymizer.String(value.Error(), sensors)
+		case string, fmt.Stringer:
+			masked.Data[k] = f.Anonymizer.String(fmt.Sprint(value), sensors)
+		default:
+			masked.Data[k] = v
+		}
+	}
+
+	return f.Base.Format(&masked)
+}
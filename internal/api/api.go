@@ -0,0 +1,735 @@
+// Package api provides the HTTP control API, which can be used to inspect and change the exporter at runtime.
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/anonymize"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+	"github.com/xperimental/flowercare-exporter/internal/events"
+	"github.com/xperimental/flowercare-exporter/internal/notify"
+	"github.com/xperimental/flowercare-exporter/internal/support"
+)
+
+const (
+	// Prefix is the path prefix of all API endpoints.
+	Prefix = "/api/v1/"
+
+	sensorsPath  = Prefix + "sensors"
+	eventsPath   = Prefix + "events"
+	alertsPath   = Prefix + "alerts"
+	silencesPath = Prefix + "silences"
+	// SupportPath is the path of the support report used by the bundle command.
+	SupportPath = Prefix + "support"
+)
+
+// Provider contains the functions of the exporter which are used by the API.
+type Provider interface {
+	Sensors() []config.Sensor
+	GetData(macAddress string) (driver.Reading, error)
+	Refresh(macAddress string) error
+	AddSensor(sensor config.Sensor)
+	RemoveSensor(macAddress string) bool
+}
+
+// AlertManager contains the functions of the notifications which are used by the API.
+type AlertManager interface {
+	Alerts() []notify.Alert
+	Acknowledge(id, by string) (notify.Alert, error)
+	Silences() []notify.Silence
+	AddSilence(s notify.Silence) (notify.Silence, error)
+	RemoveSilence(id, by string) error
+}
+
+// SensorWriter persists the changes of sensors made using the API.
+type SensorWriter interface {
+	Save(sensor config.Sensor, author string) error
+	Delete(macAddress, author string) error
+}
+
+// SilenceRequest is used for creating a silence. Either the duration or the end time needs to be set.
+type SilenceRequest struct {
+	Sensor   string    `json:"sensor"`
+	Type     string    `json:"type"`
+	Duration string    `json:"duration"`
+	EndsAt   time.Time `json:"endsAt"`
+	Comment  string    `json:"comment"`
+}
+
+// SensorStatus contains a sensor and its latest data.
+type SensorStatus struct {
+	Sensor config.Sensor   `json:"sensor"`
+	Data   *driver.Reading `json:"data,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// API serves the control API.
+type API struct {
+	log        logrus.FieldLogger
+	provider   Provider
+	tokens     []config.APIToken
+	anonymizer *anonymize.Anonymizer
+
+	// Support returns the current support report. The endpoint is disabled if it is nil.
+	Support func() support.Report
+	// Events contains the recent events. Changes made using the API are recorded in it as well.
+	Events *events.Log
+	// Alerts provides the active alerts. The endpoints are disabled if it is nil.
+	Alerts AlertManager
+	// Writer persists added and removed sensors if set. Changes are rejected if they can not be written.
+	Writer SensorWriter
+	// History reads the values stored on a sensor. The endpoint is disabled if it is nil.
+	History func(ctx context.Context, macAddress string, limit int) ([]driver.Reading, error)
+	// Authenticate identifies requests without one of the tokens, for example using OpenID Connect or the headers
+	// of a proxy. It returns nil if the request has no known user.
+	Authenticate func(r *http.Request) *config.APIToken
+}
+
+// tokenKey is the context key of the token identified for a request.
+type tokenKey struct{}
+
+// New creates a new API. Every request needs to provide one of the tokens.
+// If the anonymizer is not nil, the sensors are only shown using their pseudonyms.
+func New(log logrus.FieldLogger, provider Provider, tokens []config.APIToken, anonymizer *anonymize.Anonymizer) *API {
+	return &API{
+		log:        log,
+		provider:   provider,
+		tokens:     tokens,
+		anonymizer: anonymizer,
+	}
+}
+
+// Register adds the API endpoints to the provided mux.
+func (a *API) Register(mux *http.ServeMux) {
+	mux.HandleFunc(sensorsPath, a.identify(a.handleSensors))
+	mux.HandleFunc(sensorsPath+"/", a.identify(a.handleSensor))
+	mux.HandleFunc(SupportPath, a.identify(a.handleSupport))
+	mux.HandleFunc(eventsPath, a.identify(a.handleEvents))
+	mux.HandleFunc(alertsPath, a.identify(a.handleAlerts))
+	mux.HandleFunc(alertsPath+"/", a.identify(a.handleAlert))
+	mux.HandleFunc(silencesPath, a.identify(a.handleSilences))
+	mux.HandleFunc(silencesPath+"/", a.identify(a.handleSilence))
+}
+
+// identify looks up the token of the request once, so that users authenticated using OpenID Connect are not
+// verified again by every check of the handler.
+func (a *API) identify(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := a.lookupToken(r)
+		if token == nil && a.Authenticate != nil {
+			token = a.Authenticate(r)
+		}
+
+		handler(w, r.WithContext(context.WithValue(r.Context(), tokenKey{}, token)))
+	}
+}
+
+// authorize checks that the request carries a token with at least the required scope.
+// It writes an error response and returns false otherwise.
+func (a *API) authorize(w http.ResponseWriter, r *http.Request, required config.Scope) bool {
+	token := a.token(r)
+	if token == nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	if !token.Scope.Allows(required) {
+		a.log.Warnf("Token %q with scope %q tried %s %s", token.Name, token.Scope, r.Method, r.URL.Path)
+		http.Error(w, "scope "+string(required)+" required", http.StatusForbidden)
+		return false
+	}
+
+	a.log.Debugf("Token %q: %s %s", token.Name, r.Method, r.URL.Path)
+	return true
+}
+
+// token returns the token identified for the request or nil if it is unknown.
+func (a *API) token(r *http.Request) *config.APIToken {
+	token, _ := r.Context().Value(tokenKey{}).(*config.APIToken)
+	return token
+}
+
+// lookupToken returns the token of the token file used by the request or nil if it is unknown.
+func (a *API) lookupToken(r *http.Request) *config.APIToken {
+	value := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	var token *config.APIToken
+	for i, t := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(value), []byte(t.Token)) == 1 {
+			token = &a.tokens[i]
+		}
+	}
+
+	return token
+}
+
+func (a *API) handleSensors(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if !a.authorize(w, r, config.ScopeRead) {
+			return
+		}
+
+		result := []SensorStatus{}
+		for _, s := range a.sensors(r) {
+			result = append(result, a.sensorStatus(s))
+		}
+
+		writeJSON(w, http.StatusOK, result)
+	case http.MethodPost:
+		if !a.authorize(w, r, config.ScopeAdmin) {
+			return
+		}
+
+		var sensor config.Sensor
+		if err := json.NewDecoder(r.Body).Decode(&sensor); err != nil {
+			http.Error(w, "can not decode sensor: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if sensor.MacAddress == "" {
+			http.Error(w, "sensor needs a MAC address", http.StatusBadRequest)
+			return
+		}
+
+		if err := sensor.Validate(); err != nil {
+			http.Error(w, "invalid sensor: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if a.Writer != nil {
+			if err := a.Writer.Save(sensor, a.token(r).Name); err != nil {
+				a.log.Errorf("Error writing sensor %q: %s", sensor, err)
+				http.Error(w, "can not write sensor: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		a.provider.AddSensor(sensor)
+		a.log.Infof("Added sensor %q using API.", sensor)
+		a.recordEvent(events.TypeSensorAdded, sensor, "added using API")
+		if err := a.provider.Refresh(sensor.MacAddress); err != nil {
+			a.log.Debugf("Not refreshing new sensor: %s", err)
+		}
+
+		writeJSON(w, http.StatusCreated, a.sensorStatus(sensor))
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSensor handles the requests for a single sensor: /api/v1/sensors/<mac>, /api/v1/sensors/<mac>/refresh and
+// /api/v1/sensors/<mac>/history
+func (a *API) handleSensor(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, sensorsPath+"/"), "/")
+	macAddress := strings.ToUpper(path[0])
+
+	switch {
+	case len(path) == 1 && r.Method == http.MethodGet:
+		if !a.authorize(w, r, config.ScopeRead) {
+			return
+		}
+
+		sensor, ok := a.findSensor(r, macAddress)
+		if !ok {
+			http.Error(w, "sensor not found", http.StatusNotFound)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, a.sensorStatus(sensor))
+	case len(path) == 1 && r.Method == http.MethodDelete:
+		if !a.authorize(w, r, config.ScopeAdmin) {
+			return
+		}
+
+		sensor, ok := a.findSensor(r, macAddress)
+		if !ok {
+			http.Error(w, "sensor not found", http.StatusNotFound)
+			return
+		}
+
+		if a.Writer != nil {
+			if err := a.Writer.Delete(sensor.MacAddress, a.token(r).Name); err != nil {
+				a.log.Errorf("Error removing sensor %q: %s", sensor, err)
+				http.Error(w, "can not remove sensor: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if !a.provider.RemoveSensor(sensor.MacAddress) {
+			http.Error(w, "sensor not found", http.StatusNotFound)
+			return
+		}
+		a.log.Infof("Removed sensor %q using API.", sensor)
+		a.recordEvent(events.TypeSensorRemoved, sensor, "removed using API")
+
+		w.WriteHeader(http.StatusNoContent)
+	case len(path) == 2 && path[1] == "refresh" && r.Method == http.MethodPost:
+		if !a.authorize(w, r, config.ScopeTrigger) {
+			return
+		}
+
+		sensor, ok := a.findSensor(r, macAddress)
+		if !ok {
+			http.Error(w, "sensor not found", http.StatusNotFound)
+			return
+		}
+
+		if err := a.provider.Refresh(sensor.MacAddress); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	case len(path) == 2 && path[1] == "history" && r.Method == http.MethodGet:
+		a.handleHistory(w, r, macAddress)
+	case len(path) <= 2:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleHistory downloads the values stored on a sensor as JSON or CSV. Reading the history keeps the adapter busy,
+// so it needs the trigger scope.
+func (a *API) handleHistory(w http.ResponseWriter, r *http.Request, macAddress string) {
+	if !a.authorize(w, r, config.ScopeTrigger) {
+		return
+	}
+
+	if a.History == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "":
+		format = "json"
+	case "json", "csv":
+	default:
+		http.Error(w, "invalid format: "+format, http.StatusBadRequest)
+		return
+	}
+
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			http.Error(w, "invalid limit: "+value, http.StatusBadRequest)
+			return
+		}
+	}
+
+	sensor, ok := a.findSensor(r, macAddress)
+	if !ok {
+		http.Error(w, "sensor not found", http.StatusNotFound)
+		return
+	}
+
+	readings, err := a.History(r.Context(), sensor.MacAddress, limit)
+	if err != nil {
+		a.log.Errorf("Error reading history of %q: %s", sensor, err)
+		http.Error(w, "can not read history: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	a.log.Infof("Read %d history entries of %q using API.", len(readings), sensor)
+
+	if format == "csv" {
+		writeCSV(w, readings)
+		return
+	}
+
+	if readings == nil {
+		readings = []driver.Reading{}
+	}
+	writeJSON(w, http.StatusOK, readings)
+}
+
+func (a *API) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !a.authorize(w, r, config.ScopeRead) {
+		return
+	}
+
+	if a.Events == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var types []events.Type
+	if value := r.URL.Query().Get("type"); value != "" {
+		for _, t := range strings.Split(value, ",") {
+			types = append(types, events.Type(t))
+		}
+	}
+
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			http.Error(w, "invalid limit: "+value, http.StatusBadRequest)
+			return
+		}
+	}
+
+	sensors := a.provider.Sensors()
+	token := a.token(r)
+	result := []events.Event{}
+	for _, e := range a.Events.List(types, limit) {
+		if token.User != "" && (e.Sensor == nil || !token.Allows(*e.Sensor)) {
+			continue
+		}
+
+		if e.Sensor != nil {
+			sensor := a.anonymizer.Sensor(e.Sensor.Redacted())
+			e.Sensor = &sensor
+		}
+		e.Message = a.anonymizer.String(e.Message, sensors)
+		result = append(result, e)
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (a *API) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !a.authorize(w, r, config.ScopeRead) {
+		return
+	}
+
+	if a.Alerts == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	token := a.token(r)
+	result := []notify.Alert{}
+	for _, alert := range a.Alerts.Alerts() {
+		if token.Allows(alert.Sensor) {
+			result = append(result, a.anonymizeAlert(alert))
+		}
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleAlert handles acknowledging an alert: /api/v1/alerts/<id>/ack
+func (a *API) handleAlert(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, alertsPath+"/"), "/")
+	if len(path) != 2 || path[1] != "ack" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !a.authorize(w, r, config.ScopeTrigger) {
+		return
+	}
+
+	if a.Alerts == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	id, ok := a.findAlert(r, path[0])
+	if !ok {
+		http.Error(w, "alert not found", http.StatusNotFound)
+		return
+	}
+
+	alert, err := a.Alerts.Acknowledge(id, a.token(r).Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, a.anonymizeAlert(alert))
+}
+
+func (a *API) handleSilences(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if !a.authorize(w, r, config.ScopeRead) {
+			return
+		}
+
+		if a.Alerts == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		result := []notify.Silence{}
+		for _, s := range a.Alerts.Silences() {
+			if a.allowsSilence(r, s) {
+				result = append(result, a.anonymizeSilence(s))
+			}
+		}
+
+		writeJSON(w, http.StatusOK, result)
+	case http.MethodPost:
+		if !a.authorize(w, r, config.ScopeTrigger) {
+			return
+		}
+
+		if a.Alerts == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		var req SilenceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "can not decode silence: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		silence := notify.Silence{
+			Type:      req.Type,
+			EndsAt:    req.EndsAt,
+			CreatedBy: a.token(r).Name,
+			Comment:   req.Comment,
+		}
+
+		if req.Duration != "" {
+			duration, err := time.ParseDuration(req.Duration)
+			if err != nil {
+				http.Error(w, "invalid duration: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			silence.EndsAt = time.Now().Add(duration)
+		}
+
+		if req.Sensor != "" {
+			sensor, ok := a.findSensor(r, req.Sensor)
+			if !ok {
+				http.Error(w, "sensor not found", http.StatusBadRequest)
+				return
+			}
+			silence.Sensor = sensor.MacAddress
+		}
+
+		if silence.Sensor == "" && a.token(r).User != "" {
+			http.Error(w, "silences of users need a sensor", http.StatusBadRequest)
+			return
+		}
+
+		silence, err := a.Alerts.AddSilence(silence)
+		if err != nil {
+			http.Error(w, "invalid silence: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, a.anonymizeSilence(silence))
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSilence handles removing a silence: /api/v1/silences/<id>
+func (a *API) handleSilence(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, silencesPath+"/")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !a.authorize(w, r, config.ScopeTrigger) {
+		return
+	}
+
+	if a.Alerts == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	for _, s := range a.Alerts.Silences() {
+		if s.ID == id && !a.allowsSilence(r, s) {
+			http.Error(w, "silence not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	if err := a.Alerts.RemoveSilence(id, a.token(r).Name); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// allowsSilence returns true if the token of the request can access the silence. Silences of all sensors are only
+// accessible using tokens without a user.
+func (a *API) allowsSilence(r *http.Request, s notify.Silence) bool {
+	token := a.token(r)
+	if token.User == "" {
+		return true
+	}
+
+	if s.Sensor == "" {
+		return false
+	}
+
+	_, ok := a.findSensor(r, s.Sensor)
+	return ok
+}
+
+func (a *API) anonymizeSilence(s notify.Silence) notify.Silence {
+	if s.Sensor != "" {
+		s.Sensor = a.anonymizer.MAC(s.Sensor)
+	}
+
+	return s
+}
+
+// findAlert looks up an active alert accessible using the token of the request by its ID or the ID shown when
+// anonymizing.
+func (a *API) findAlert(r *http.Request, id string) (string, bool) {
+	token := a.token(r)
+	for _, alert := range a.Alerts.Alerts() {
+		if !token.Allows(alert.Sensor) {
+			continue
+		}
+
+		if strings.EqualFold(alert.ID, id) || strings.EqualFold(a.anonymizeAlert(alert).ID, id) {
+			return alert.ID, true
+		}
+	}
+
+	return "", false
+}
+
+func (a *API) anonymizeAlert(alert notify.Alert) notify.Alert {
+	if a.anonymizer != nil {
+		alert.ID = strings.Replace(alert.ID, notify.SensorID(alert.Sensor.MacAddress), notify.SensorID(a.anonymizer.MAC(alert.Sensor.MacAddress)), 1)
+	}
+	alert.Sensor = a.anonymizer.Sensor(alert.Sensor.Redacted())
+
+	return alert
+}
+
+func (a *API) recordEvent(t events.Type, sensor config.Sensor, message string) {
+	if a.Events == nil {
+		return
+	}
+
+	a.Events.Record(t, sensor, message)
+}
+
+func (a *API) handleSupport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !a.authorize(w, r, config.ScopeAdmin) {
+		return
+	}
+
+	if a.Support == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, a.Support())
+}
+
+// sensors returns the sensors accessible using the token of the request.
+func (a *API) sensors(r *http.Request) []config.Sensor {
+	token := a.token(r)
+
+	var result []config.Sensor
+	for _, s := range a.provider.Sensors() {
+		if token.Allows(s) {
+			result = append(result, s)
+		}
+	}
+
+	return result
+}
+
+// findSensor looks up a sensor accessible using the token of the request by its MAC address or its pseudonym
+// ignoring the case.
+func (a *API) findSensor(r *http.Request, macAddress string) (config.Sensor, bool) {
+	for _, s := range a.sensors(r) {
+		if strings.EqualFold(s.MacAddress, macAddress) || strings.EqualFold(a.anonymizer.MAC(s.MacAddress), macAddress) {
+			return s, true
+		}
+	}
+
+	return config.Sensor{}, false
+}
+
+func (a *API) sensorStatus(sensor config.Sensor) SensorStatus {
+	status := SensorStatus{
+		Sensor: a.anonymizer.Sensor(sensor.Redacted()),
+	}
+
+	data, err := a.provider.GetData(sensor.MacAddress)
+	if err != nil {
+		status.Error = err.Error()
+	} else {
+		status.Data = &data
+	}
+
+	return status
+}
+
+// historyFields contains the values included in the CSV of the history.
+var historyFields = []string{"temperature", "moisture", "light", "conductivity"}
+
+func writeCSV(w http.ResponseWriter, readings []driver.Reading) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.WriteHeader(http.StatusOK)
+
+	out := csv.NewWriter(w)
+	out.Write(append([]string{"time"}, historyFields...))
+	for _, reading := range readings {
+		record := []string{reading.Time.UTC().Format(time.RFC3339)}
+		for _, name := range historyFields {
+			value := ""
+			if v := *reading.Field(name); v != nil {
+				value = strconv.FormatFloat(*v, 'f', -1, 64)
+			}
+			record = append(record, value)
+		}
+		out.Write(record)
+	}
+	out.Flush()
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,112 @@
+// Package auth identifies the users of the control API, which are authenticated by an OpenID Connect provider or
+// a proxy in front of the exporter instead of using a token of the token file.
+package auth
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+)
+
+// Authenticator identifies users using the OpenID Connect tokens and proxy headers enabled in the configuration.
+type Authenticator struct {
+	log      logrus.FieldLogger
+	cfg      config.APIConfig
+	verifier *Verifier
+}
+
+// New creates an Authenticator. The transport is used for fetching the keys of the OpenID Connect provider.
+func New(log logrus.FieldLogger, cfg config.APIConfig, transport http.RoundTripper) *Authenticator {
+	a := &Authenticator{
+		log: log,
+		cfg: cfg,
+	}
+
+	if cfg.OIDC.Issuer != "" {
+		a.verifier = NewVerifier(cfg.OIDC.Issuer, cfg.OIDC.ClientID, transport)
+	}
+
+	return a
+}
+
+// Authenticate returns a token for the user of the request, with the scope of its groups. Users with the admin
+// scope can access all sensors, other users only their own. It returns nil if the request has no known user.
+func (a *Authenticator) Authenticate(r *http.Request) *config.APIToken {
+	if value := r.Header.Get("Authorization"); a.verifier != nil && strings.HasPrefix(value, "Bearer ") {
+		claims, err := a.verifier.Verify(r.Context(), strings.TrimPrefix(value, "Bearer "))
+		if err != nil {
+			a.log.Debugf("Rejected OpenID Connect token: %s", err)
+			return nil
+		}
+
+		user, _ := claims[a.cfg.OIDC.UserClaim].(string)
+		return a.token("oidc", user, stringList(claims[a.cfg.OIDC.GroupsClaim]))
+	}
+
+	if a.cfg.ProxyAuth.UserHeader != "" {
+		user := r.Header.Get(a.cfg.ProxyAuth.UserHeader)
+		if user == "" {
+			return nil
+		}
+
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil || !a.cfg.ProxyAuth.Trusts(net.ParseIP(host)) {
+			a.log.Warnf("Ignored header %s from untrusted address %s", a.cfg.ProxyAuth.UserHeader, r.RemoteAddr)
+			return nil
+		}
+
+		var groups []string
+		if a.cfg.ProxyAuth.GroupsHeader != "" {
+			for _, g := range strings.Split(r.Header.Get(a.cfg.ProxyAuth.GroupsHeader), ",") {
+				if g = strings.TrimSpace(g); g != "" {
+					groups = append(groups, g)
+				}
+			}
+		}
+
+		return a.token("proxy", user, groups)
+	}
+
+	return nil
+}
+
+func (a *Authenticator) token(method, user string, groups []string) *config.APIToken {
+	if user == "" {
+		a.log.Debugf("Rejected %s authentication without user", method)
+		return nil
+	}
+
+	// Users without a mapped group get no scope and are rejected when authorizing the request.
+	scope, _ := a.cfg.Scope(groups)
+	token := &config.APIToken{
+		Name:  method + ":" + user,
+		Scope: scope,
+		User:  user,
+	}
+	if scope.Allows(config.ScopeAdmin) {
+		token.User = ""
+	}
+
+	return token
+}
+
+// stringList returns the claim as a list. Providers use a single string for claims with only one value.
+func stringList(claim interface{}) []string {
+	switch c := claim.(type) {
+	case string:
+		return []string{c}
+	case []interface{}:
+		var result []string
+		for _, value := range c {
+			if s, ok := value.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+
+	return nil
+}
@@ -0,0 +1,423 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	// Register the hash functions used by the signatures.
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+const (
+	fetchTimeout = 10 * time.Second
+	// refreshInterval limits how often the keys are fetched again for tokens signed using an unknown key.
+	refreshInterval = 5 * time.Minute
+	// retryInterval limits how often the keys are fetched again after fetching them failed.
+	retryInterval = 30 * time.Second
+	// leeway allows for differences between the clocks of the provider and the exporter.
+	leeway = time.Minute
+)
+
+// curveHashes contains the hash used with each curve: ES256 needs P-256, ES384 P-384 and ES512 P-521.
+var curveHashes = map[string]crypto.Hash{
+	"P-256": crypto.SHA256,
+	"P-384": crypto.SHA384,
+	"P-521": crypto.SHA512,
+}
+
+// discovery contains the fields of the discovery document of the provider used by the verifier.
+type discovery struct {
+	Issuer  string `json:"issuer"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+type jwk struct {
+	KeyID   string `json:"kid"`
+	KeyType string `json:"kty"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// Verifier checks the signatures and claims of the ID tokens issued by an OpenID Connect provider. The keys of
+// the provider are fetched on first use, so that the exporter starts even if the provider is not available.
+type Verifier struct {
+	issuer   string
+	clientID string
+	client   *http.Client
+
+	// jwksURL is only used by the single running fetch.
+	jwksURL string
+
+	lock sync.Mutex
+	keys map[string]crypto.PublicKey
+	// fetched is the time of the last attempt of fetching the keys and fetchErr its error.
+	fetched  time.Time
+	fetchErr error
+	// fetching is closed when the running fetch is done. It is nil if no fetch is running.
+	fetching chan struct{}
+}
+
+// NewVerifier creates a Verifier for tokens of the issuer with the client ID as audience. The transport is used
+// for fetching the keys of the provider.
+func NewVerifier(issuer, clientID string, transport http.RoundTripper) *Verifier {
+	return &Verifier{
+		issuer:   strings.TrimSuffix(issuer, "/"),
+		clientID: clientID,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   fetchTimeout,
+		},
+	}
+}
+
+// Verify checks the token and returns its claims.
+func (v *Verifier) Verify(ctx context.Context, token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("token is not a JWT")
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("can not decode header: %s", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("can not decode signature: %s", err)
+	}
+
+	key, err := v.key(ctx, h.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifySignature(h.Algorithm, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("can not decode claims: %s", err)
+	}
+
+	if err := v.checkClaims(claims, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (v *Verifier) checkClaims(claims map[string]interface{}, now time.Time) error {
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != v.issuer {
+		return fmt.Errorf("token has wrong issuer: %s", iss)
+	}
+
+	if !audienceContains(claims["aud"], v.clientID) {
+		return fmt.Errorf("token is not issued for client %q", v.clientID)
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("token has no expiry")
+	}
+	if now.Add(-leeway).After(time.Unix(int64(exp), 0)) {
+		return errors.New("token has expired")
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(leeway).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("token is not valid yet")
+	}
+
+	return nil
+}
+
+func audienceContains(aud interface{}, clientID string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == clientID
+	case []interface{}:
+		for _, value := range a {
+			if value == clientID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// key returns the key with the ID. The keys are fetched again if the key is unknown, as providers rotate their
+// keys regularly. Only one fetch runs at a time and fetches are rate-limited, also after failures, so that tokens
+// using made-up key IDs do not cause requests to the provider.
+func (v *Verifier) key(ctx context.Context, id string) (crypto.PublicKey, error) {
+	v.lock.Lock()
+	for v.fetching != nil {
+		if key, ok := v.keys[id]; ok {
+			v.lock.Unlock()
+			return key, nil
+		}
+
+		wait := v.fetching
+		v.lock.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-wait:
+		}
+		v.lock.Lock()
+	}
+
+	if key, ok := v.keys[id]; ok {
+		v.lock.Unlock()
+		return key, nil
+	}
+
+	if err := v.fetchAllowed(id, time.Now()); err != nil {
+		v.lock.Unlock()
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	v.fetching = done
+	v.fetched = time.Now()
+	v.lock.Unlock()
+
+	// The fetch is not bound to the request, as a cancelled request should not count as failed fetch.
+	keys, err := v.fetchKeys(context.Background())
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	v.fetching = nil
+	close(done)
+	v.fetchErr = err
+	if err != nil {
+		return nil, fmt.Errorf("error fetching keys of provider: %s", err)
+	}
+	v.keys = keys
+
+	if key, ok := v.keys[id]; ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unknown key: %q", id)
+}
+
+// fetchAllowed returns an error if the keys have been fetched too recently. Needs to be called with the lock held.
+func (v *Verifier) fetchAllowed(id string, now time.Time) error {
+	switch {
+	case v.fetched.IsZero():
+		return nil
+	case v.fetchErr != nil && now.Sub(v.fetched) < retryInterval:
+		return fmt.Errorf("error fetching keys of provider: %s", v.fetchErr)
+	case v.fetchErr == nil && now.Sub(v.fetched) < refreshInterval:
+		return fmt.Errorf("unknown key: %q", id)
+	}
+
+	return nil
+}
+
+func (v *Verifier) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	if v.jwksURL == "" {
+		var doc discovery
+		if err := v.get(ctx, v.issuer+"/.well-known/openid-configuration", &doc); err != nil {
+			return nil, err
+		}
+
+		if strings.TrimSuffix(doc.Issuer, "/") != v.issuer {
+			return nil, fmt.Errorf("discovery document is for a different issuer: %s", doc.Issuer)
+		}
+
+		if !strings.HasPrefix(doc.JWKSURI, "https://") {
+			return nil, fmt.Errorf("key set needs to use HTTPS: %s", doc.JWKSURI)
+		}
+		v.jwksURL = doc.JWKSURI
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := v.get(ctx, v.jwksURL, &set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		// Keys of unsupported types are skipped, tokens signed using them are rejected as signed by an unknown key.
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.KeyID] = key
+	}
+
+	return keys, nil
+}
+
+func (v *Verifier) get(ctx context.Context, url string, value interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status for %s: %s", url, res.Status)
+	}
+
+	return json.NewDecoder(res.Body).Decode(value)
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{
+			N: n,
+			E: int(e.Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %s", k.Curve)
+		}
+
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     x,
+			Y:     y,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", k.KeyType)
+	}
+}
+
+func verifySignature(algorithm string, key crypto.PublicKey, signed string, signature []byte) error {
+	if len(algorithm) != 5 {
+		return fmt.Errorf("unsupported algorithm: %s", algorithm)
+	}
+
+	var hash crypto.Hash
+	switch algorithm[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	}
+	if hash == 0 {
+		return fmt.Errorf("unsupported algorithm: %s", algorithm)
+	}
+
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		var err error
+		switch algorithm[:2] {
+		case "RS":
+			err = rsa.VerifyPKCS1v15(k, hash, digest, signature)
+		case "PS":
+			err = rsa.VerifyPSS(k, hash, digest, signature, nil)
+		default:
+			return fmt.Errorf("algorithm %s does not match RSA key", algorithm)
+		}
+		if err != nil {
+			return errors.New("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if algorithm[:2] != "ES" || curveHashes[k.Curve.Params().Name] != hash || len(signature) != 2*size {
+			return fmt.Errorf("algorithm %s does not match EC key", algorithm)
+		}
+
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported key: %T", key)
+	}
+
+	return nil
+}
+
+func decodeSegment(segment string, value interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, value)
+}
+
+func decodeInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
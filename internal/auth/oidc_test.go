@@ -0,0 +1,411 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testClientID = "flowercare"
+
+var (
+	testRSAKey = mustGenerateRSA()
+	testECKey  = mustGenerateEC()
+)
+
+func mustGenerateRSA() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	return key
+}
+
+func mustGenerateEC() *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	return key
+}
+
+// testProvider is an OpenID Connect provider publishing testRSAKey as "rsa" and testECKey as "ec".
+type testProvider struct {
+	server *httptest.Server
+
+	lock      sync.Mutex
+	fail      bool
+	block     chan struct{}
+	discovery int
+	jwks      int
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	p := &testProvider{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		p.lock.Lock()
+		p.discovery++
+		fail, block := p.fail, p.block
+		p.lock.Unlock()
+
+		if block != nil {
+			<-block
+		}
+		if fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		json.NewEncoder(w).Encode(discovery{
+			Issuer:  p.server.URL,
+			JWKSURI: p.server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		p.lock.Lock()
+		p.jwks++
+		p.lock.Unlock()
+
+		json.NewEncoder(w).Encode(map[string][]jwk{
+			"keys": {
+				{
+					KeyID:   "rsa",
+					KeyType: "RSA",
+					Use:     "sig",
+					N:       encodeInt(testRSAKey.N, 0),
+					E:       encodeInt(big.NewInt(int64(testRSAKey.E)), 0),
+				},
+				{
+					KeyID:   "ec",
+					KeyType: "EC",
+					Curve:   "P-256",
+					X:       encodeInt(testECKey.X, 32),
+					Y:       encodeInt(testECKey.Y, 32),
+				},
+			},
+		})
+	})
+
+	p.server = httptest.NewTLSServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *testProvider) verifier() *Verifier {
+	return NewVerifier(p.server.URL, testClientID, p.server.Client().Transport)
+}
+
+func (p *testProvider) requests() (int, int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.discovery, p.jwks
+}
+
+func (p *testProvider) claims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":                p.server.URL,
+		"aud":                testClientID,
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"preferred_username": "alice",
+	}
+}
+
+func encodeInt(value *big.Int, size int) string {
+	b := value.Bytes()
+	if len(b) < size {
+		b = append(make([]byte, size-len(b)), b...)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func encodeSegment(t *testing.T, value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("can not encode segment: %s", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// signToken creates a token with the header and claims, signed using the function.
+func signToken(t *testing.T, alg, kid string, claims map[string]interface{}, sign func(signed []byte) []byte) string {
+	signed := encodeSegment(t, header{Algorithm: alg, KeyID: kid}) + "." + encodeSegment(t, claims)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func signRSA(hash crypto.Hash) func([]byte) []byte {
+	return func(signed []byte) []byte {
+		h := hash.New()
+		h.Write(signed)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, testRSAKey, hash, h.Sum(nil))
+		if err != nil {
+			panic(err)
+		}
+
+		return signature
+	}
+}
+
+func signEC(hash crypto.Hash) func([]byte) []byte {
+	return func(signed []byte) []byte {
+		h := hash.New()
+		h.Write(signed)
+		r, s, err := ecdsa.Sign(rand.Reader, testECKey, h.Sum(nil))
+		if err != nil {
+			panic(err)
+		}
+
+		signature := make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+		return signature
+	}
+}
+
+func TestVerify(t *testing.T) {
+	p := newTestProvider(t)
+	v := p.verifier()
+
+	withClaim := func(name string, value interface{}) map[string]interface{} {
+		claims := p.claims()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	for _, tc := range []struct {
+		desc    string
+		token   string
+		wantErr bool
+	}{
+		{
+			desc:  "RS256",
+			token: signToken(t, "RS256", "rsa", p.claims(), signRSA(crypto.SHA256)),
+		},
+		{
+			desc:  "ES256",
+			token: signToken(t, "ES256", "ec", p.claims(), signEC(crypto.SHA256)),
+		},
+		{
+			desc:  "audience list",
+			token: signToken(t, "RS256", "rsa", withClaim("aud", []string{"other", testClientID}), signRSA(crypto.SHA256)),
+		},
+		{
+			desc:    "alg none",
+			token:   signToken(t, "none", "rsa", p.claims(), func([]byte) []byte { return nil }),
+			wantErr: true,
+		},
+		{
+			desc: "HS256 using the public key as secret",
+			token: signToken(t, "HS256", "rsa", p.claims(), func(signed []byte) []byte {
+				mac := hmac.New(sha256.New, testRSAKey.N.Bytes())
+				mac.Write(signed)
+				return mac.Sum(nil)
+			}),
+			wantErr: true,
+		},
+		{
+			desc:    "ES256 with RSA key",
+			token:   signToken(t, "ES256", "rsa", p.claims(), signRSA(crypto.SHA256)),
+			wantErr: true,
+		},
+		{
+			desc:    "RS256 with EC key",
+			token:   signToken(t, "RS256", "ec", p.claims(), signEC(crypto.SHA256)),
+			wantErr: true,
+		},
+		{
+			desc:    "ES384 with P-256 key",
+			token:   signToken(t, "ES384", "ec", p.claims(), signEC(crypto.SHA384)),
+			wantErr: true,
+		},
+		{
+			desc:    "algorithm not used for signing",
+			token:   signToken(t, "RS512", "rsa", p.claims(), signRSA(crypto.SHA256)),
+			wantErr: true,
+		},
+		{
+			desc:    "modified claims",
+			token:   modifyClaims(t, signToken(t, "RS256", "rsa", p.claims(), signRSA(crypto.SHA256))),
+			wantErr: true,
+		},
+		{
+			desc:    "wrong audience",
+			token:   signToken(t, "RS256", "rsa", withClaim("aud", "other"), signRSA(crypto.SHA256)),
+			wantErr: true,
+		},
+		{
+			desc:    "missing audience",
+			token:   signToken(t, "RS256", "rsa", withClaim("aud", nil), signRSA(crypto.SHA256)),
+			wantErr: true,
+		},
+		{
+			desc:    "wrong issuer",
+			token:   signToken(t, "RS256", "rsa", withClaim("iss", "https://evil.example.com"), signRSA(crypto.SHA256)),
+			wantErr: true,
+		},
+		{
+			desc:    "expired",
+			token:   signToken(t, "RS256", "rsa", withClaim("exp", time.Now().Add(-2*leeway).Unix()), signRSA(crypto.SHA256)),
+			wantErr: true,
+		},
+		{
+			desc:    "missing expiry",
+			token:   signToken(t, "RS256", "rsa", withClaim("exp", nil), signRSA(crypto.SHA256)),
+			wantErr: true,
+		},
+		{
+			desc:    "not valid yet",
+			token:   signToken(t, "RS256", "rsa", withClaim("nbf", time.Now().Add(2*leeway).Unix()), signRSA(crypto.SHA256)),
+			wantErr: true,
+		},
+		{
+			desc:    "unknown key",
+			token:   signToken(t, "RS256", "other", p.claims(), signRSA(crypto.SHA256)),
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			claims, err := v.Verify(context.Background(), tc.token)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("got claims %v, want error", claims)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %q", err)
+			}
+
+			if user := claims["preferred_username"]; user != "alice" {
+				t.Errorf("got user %v, want alice", user)
+			}
+		})
+	}
+}
+
+// modifyClaims replaces the claims of the token, keeping the signature.
+func modifyClaims(t *testing.T, token string) string {
+	parts := strings.Split(token, ".")
+	parts[1] = encodeSegment(t, map[string]interface{}{
+		"aud":                testClientID,
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"preferred_username": "admin",
+	})
+
+	return strings.Join(parts, ".")
+}
+
+func TestVerifyUnknownKeyRateLimited(t *testing.T) {
+	p := newTestProvider(t)
+	v := p.verifier()
+
+	for i := 0; i < 3; i++ {
+		if _, err := v.Verify(context.Background(), signToken(t, "RS256", "other", p.claims(), signRSA(crypto.SHA256))); err == nil {
+			t.Fatal("token using unknown key accepted")
+		}
+	}
+
+	if _, jwks := p.requests(); jwks != 1 {
+		t.Errorf("got %d requests for the keys, want 1", jwks)
+	}
+
+	// Known keys are still accepted without fetching the keys again.
+	if _, err := v.Verify(context.Background(), signToken(t, "RS256", "rsa", p.claims(), signRSA(crypto.SHA256))); err != nil {
+		t.Errorf("got error %q", err)
+	}
+}
+
+func TestVerifyProviderUnavailable(t *testing.T) {
+	p := newTestProvider(t)
+	p.fail = true
+	v := p.verifier()
+	token := signToken(t, "RS256", "rsa", p.claims(), signRSA(crypto.SHA256))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, err := v.Verify(context.Background(), token); err == nil {
+				t.Error("token accepted without keys")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if discovery, _ := p.requests(); discovery != 1 {
+		t.Errorf("got %d discovery requests after failure, want 1", discovery)
+	}
+
+	// The keys are fetched again once the retry interval has passed.
+	p.lock.Lock()
+	p.fail = false
+	p.lock.Unlock()
+	v.lock.Lock()
+	v.fetched = v.fetched.Add(-retryInterval)
+	v.lock.Unlock()
+
+	if _, err := v.Verify(context.Background(), token); err != nil {
+		t.Errorf("got error %q", err)
+	}
+}
+
+func TestVerifyFetchDoesNotBlock(t *testing.T) {
+	p := newTestProvider(t)
+	block := make(chan struct{})
+	p.block = block
+	v := p.verifier()
+	token := signToken(t, "RS256", "rsa", p.claims(), signRSA(crypto.SHA256))
+
+	fetched := make(chan error, 1)
+	go func() {
+		_, err := v.Verify(context.Background(), token)
+		fetched <- err
+	}()
+
+	// Wait until the fetch is running.
+	for {
+		if discovery, _ := p.requests(); discovery > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Other requests give up when their context is done instead of waiting for the lock.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := v.Verify(ctx, token); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(block)
+	if err := <-fetched; err != nil {
+		t.Errorf("got error %q", err)
+	}
+}
@@ -0,0 +1,67 @@
+package backend
+
+import (
+	"github.com/go-ble/ble"
+)
+
+// Advertisement is a serializable copy of a ble.Advertisement, used to transfer advertisements from the worker.
+type Advertisement struct {
+	Address        string
+	Name           string
+	Manufacturer   []byte
+	Service        []ble.ServiceData
+	ServiceUUIDs   []ble.UUID
+	OverflowUUIDs  []ble.UUID
+	SolicitedUUIDs []ble.UUID
+	TxPower        int
+	IsConnectable  bool
+	SignalStrength int
+}
+
+var _ ble.Advertisement = &Advertisement{}
+
+// CopyAdvertisement creates a copy of the advertisement.
+func CopyAdvertisement(a ble.Advertisement) *Advertisement {
+	return &Advertisement{
+		Address:        a.Addr().String(),
+		Name:           a.LocalName(),
+		Manufacturer:   a.ManufacturerData(),
+		Service:        a.ServiceData(),
+		ServiceUUIDs:   a.Services(),
+		OverflowUUIDs:  a.OverflowService(),
+		SolicitedUUIDs: a.SolicitedService(),
+		TxPower:        a.TxPowerLevel(),
+		IsConnectable:  a.Connectable(),
+		SignalStrength: a.RSSI(),
+	}
+}
+
+// LocalName implements ble.Advertisement
+func (a *Advertisement) LocalName() string { return a.Name }
+
+// ManufacturerData implements ble.Advertisement
+func (a *Advertisement) ManufacturerData() []byte { return a.Manufacturer }
+
+// ServiceData implements ble.Advertisement
+func (a *Advertisement) ServiceData() []ble.ServiceData { return a.Service }
+
+// Services implements ble.Advertisement
+func (a *Advertisement) Services() []ble.UUID { return a.ServiceUUIDs }
+
+// OverflowService implements ble.Advertisement
+func (a *Advertisement) OverflowService() []ble.UUID { return a.OverflowUUIDs }
+
+// TxPowerLevel implements ble.Advertisement
+func (a *Advertisement) TxPowerLevel() int { return a.TxPower }
+
+// Connectable implements ble.Advertisement
+func (a *Advertisement) Connectable() bool { return a.IsConnectable }
+
+// SolicitedService implements ble.Advertisement
+func (a *Advertisement) SolicitedService() []ble.UUID { return a.SolicitedUUIDs }
+
+// RSSI implements ble.Advertisement
+func (a *Advertisement) RSSI() int { return a.SignalStrength }
+
+// Addr implements ble.Advertisement
+func (a *Advertisement) Addr() ble.Addr { return ble.NewAddr(a.Address) }
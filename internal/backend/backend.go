@@ -0,0 +1,31 @@
+// Package backend performs the Bluetooth operations of the exporter.
+//
+// The Local backend uses a Bluetooth adapter of the current process. The Remote backend forwards all
+// operations to a worker process over a local socket, so that only the worker needs the privileges
+// to access the adapter.
+package backend
+
+import (
+	"context"
+
+	"github.com/go-ble/ble"
+	"github.com/xperimental/flowercare-exporter/internal/adapter"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+// Backend reads data from sensors and scans for advertisements.
+type Backend interface {
+	// Adapter returns information about the Bluetooth adapter in use.
+	Adapter() adapter.Adapter
+	// Read connects to the sensor and reads its data using the driver of the sensor.
+	Read(ctx context.Context, sensor config.Sensor, opts driver.Options) (driver.Reading, error)
+	// History reads at most limit of the values stored on the sensor using the driver of the sensor.
+	History(ctx context.Context, sensor config.Sensor, limit int) ([]driver.Reading, error)
+	// Blink connects to the sensor and makes its LED blink using the driver of the sensor.
+	Blink(ctx context.Context, sensor config.Sensor) error
+	// Scan passes all advertisements received until the context is done to the handler.
+	Scan(ctx context.Context, handler ble.AdvHandler) error
+	// Close releases the resources of the backend.
+	Close() error
+}
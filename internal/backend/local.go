@@ -0,0 +1,190 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-ble/ble"
+	"github.com/go-ble/ble/linux"
+	"github.com/go-ble/ble/linux/hci/cmd"
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/adapter"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+	"github.com/xperimental/flowercare-exporter/internal/rawdump"
+)
+
+// Local uses a Bluetooth adapter of the current process.
+type Local struct {
+	log     logrus.FieldLogger
+	adapter adapter.Adapter
+	dumper  *rawdump.Dumper
+
+	lock   sync.Mutex
+	device ble.Device
+}
+
+var _ Backend = &Local{}
+
+// NewLocal opens the Bluetooth adapter, which is selected using its kernel name, MAC address or local name.
+// The raw data received from the devices is written to the dumper if it is set.
+func NewLocal(log logrus.FieldLogger, deviceName string, bleConfig config.BLEConfig, dumper *rawdump.Dumper) (*Local, error) {
+	a, err := adapter.Resolve(deviceName)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Using adapter %s", a)
+
+	opts := append(deviceOptions(bleConfig), ble.OptDeviceID(a.ID))
+	device, err := linux.NewDeviceWithName("flowercare-exporter", opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Local{
+		log:     log,
+		adapter: a,
+		dumper:  dumper,
+		device:  device,
+	}, nil
+}
+
+// deviceOptions converts the configuration to the options of the HCI device.
+func deviceOptions(cfg config.BLEConfig) []ble.Option {
+	addressType := uint8(0x00)
+	if cfg.AddressType == "random" {
+		addressType = 0x01
+	}
+
+	return []ble.Option{
+		ble.OptConnParams(cmd.LECreateConnection{
+			LEScanInterval:        toUnits(cfg.ScanInterval, 625*time.Microsecond),
+			LEScanWindow:          toUnits(cfg.ScanWindow, 625*time.Microsecond),
+			InitiatorFilterPolicy: 0x00,
+			PeerAddressType:       addressType,
+			OwnAddressType:        0x00,
+			ConnIntervalMin:       toUnits(cfg.ConnIntervalMin, 1250*time.Microsecond),
+			ConnIntervalMax:       toUnits(cfg.ConnIntervalMax, 1250*time.Microsecond),
+			ConnLatency:           0x0000,
+			SupervisionTimeout:    toUnits(cfg.SupervisionTimeout, 10*time.Millisecond),
+		}),
+		ble.OptScanParams(cmd.LESetScanParameters{
+			LEScanType:     0x01,
+			LEScanInterval: toUnits(cfg.ScanInterval, 625*time.Microsecond),
+			LEScanWindow:   toUnits(cfg.ScanWindow, 625*time.Microsecond),
+			OwnAddressType: 0x00,
+		}),
+	}
+}
+
+func toUnits(d, unit time.Duration) uint16 {
+	return uint16(d / unit)
+}
+
+// Adapter implements Backend
+func (l *Local) Adapter() adapter.Adapter {
+	return l.adapter
+}
+
+// Read implements Backend
+func (l *Local) Read(ctx context.Context, sensor config.Sensor, opts driver.Options) (driver.Reading, error) {
+	d, err := driver.Get(sensor.Driver)
+	if err != nil {
+		return driver.Reading{}, err
+	}
+
+	if d.Read == nil {
+		return driver.Reading{}, fmt.Errorf("driver %q does not support reading data actively", d.Name)
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.log.Debugf("Reading data for %q on %q using %q", sensor.MacAddress, l.adapter.KernelName, d.Name)
+	device := &trackingDevice{
+		Device: l.dumper.Device(l.device, sensor.MacAddress),
+	}
+	reading, err := d.ReadDevice(ctx, l.log, device, sensor.MacAddress, opts)
+	switch {
+	case err != nil && device.dialErr != nil:
+		return reading, &driver.ConnectError{Err: err}
+	case device.rssi != 0:
+		reading.RSSI = driver.Float(float64(device.rssi))
+	}
+
+	return reading, err
+}
+
+// trackingDevice records the outcome of connecting to a device, so that failed connections can be told apart
+// from failures later on and the signal strength of the connection can be reported for all drivers.
+type trackingDevice struct {
+	ble.Device
+
+	dialErr error
+	rssi    int
+}
+
+func (d *trackingDevice) Dial(ctx context.Context, addr ble.Addr) (ble.Client, error) {
+	c, err := d.Device.Dial(ctx, addr)
+	if err != nil {
+		d.dialErr = err
+		return nil, err
+	}
+
+	d.rssi = c.ReadRSSI()
+	return c, nil
+}
+
+// History implements Backend
+func (l *Local) History(ctx context.Context, sensor config.Sensor, limit int) ([]driver.Reading, error) {
+	d, err := driver.Get(sensor.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.log.Debugf("Reading history of %q on %q using %q", sensor.MacAddress, l.adapter.KernelName, d.Name)
+	return d.ReadHistory(ctx, l.log, l.dumper.Device(l.device, sensor.MacAddress), sensor.MacAddress, limit)
+}
+
+// Blink implements Backend
+func (l *Local) Blink(ctx context.Context, sensor config.Sensor) error {
+	d, err := driver.Get(sensor.Driver)
+	if err != nil {
+		return err
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.log.Debugf("Blinking %q on %q using %q", sensor.MacAddress, l.adapter.KernelName, d.Name)
+	return d.BlinkDevice(ctx, l.log, l.dumper.Device(l.device, sensor.MacAddress), sensor.MacAddress)
+}
+
+// Scan implements Backend
+func (l *Local) Scan(ctx context.Context, handler ble.AdvHandler) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	trace, ok := l.log.(logrus.Ext1FieldLogger)
+	if !ok && l.dumper == nil {
+		return l.device.Scan(ctx, true, handler)
+	}
+
+	return l.device.Scan(ctx, true, func(a ble.Advertisement) {
+		if ok {
+			trace.Tracef("Advertisement from %s (RSSI %d): %q", a.Addr(), a.RSSI(), a.LocalName())
+		}
+		l.dumper.Advertisement(a)
+		handler(a)
+	})
+}
+
+// Close implements Backend
+func (l *Local) Close() error {
+	return l.device.Stop()
+}
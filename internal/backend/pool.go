@@ -0,0 +1,381 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-ble/ble"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/adapter"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+const (
+	// maxConsecutiveFailures is the number of failed reads after which an adapter is considered unhealthy.
+	maxConsecutiveFailures = 3
+	// unhealthyDuration is the time an unhealthy adapter is skipped before it is tried again.
+	unhealthyDuration = 5 * time.Minute
+)
+
+var (
+	adapterHealthyDesc = prometheus.NewDesc(
+		"flowercare_adapter_healthy",
+		"Contains 1 if the adapter is used for reading sensors and 0 if it is skipped after repeated failures.",
+		[]string{"adapter"}, nil)
+	adapterReadsDesc = prometheus.NewDesc(
+		"flowercare_adapter_reads_total",
+		"Number of reads done using the adapter, including failed reads.",
+		[]string{"adapter"}, nil)
+	adapterReadErrorsDesc = prometheus.NewDesc(
+		"flowercare_adapter_read_errors_total",
+		"Number of failed reads using the adapter.",
+		[]string{"adapter"}, nil)
+	adapterConsecutiveErrorsDesc = prometheus.NewDesc(
+		"flowercare_adapter_consecutive_read_errors",
+		"Number of failed reads using the adapter since its last successful read.",
+		[]string{"adapter"}, nil)
+)
+
+// member is a backend of the pool together with its health.
+type member struct {
+	backend Backend
+
+	reads          float64
+	errors         float64
+	consecutive    int
+	unhealthyUntil time.Time
+	// active is the number of reads currently using the backend.
+	active int
+}
+
+// Pool distributes the reads across several backends, each using its own adapter. Sensors are read by the
+// backends in turn, preferring backends which are not busy with another read. If a read fails, it is retried using
+// the next backend. Backends failing repeatedly are skipped for a while. Scans are done using all backends at the same
+// time.
+type Pool struct {
+	log logrus.FieldLogger
+
+	lock    sync.Mutex
+	members []*member
+	next    int
+}
+
+var (
+	_ Backend              = &Pool{}
+	_ prometheus.Collector = &Pool{}
+)
+
+// NewPool creates a pool of the backends. The first backend is reported as the adapter of the pool.
+func NewPool(log logrus.FieldLogger, backends []Backend) *Pool {
+	members := make([]*member, len(backends))
+	for i, b := range backends {
+		members[i] = &member{
+			backend: b,
+		}
+	}
+
+	return &Pool{
+		log:     log,
+		members: members,
+	}
+}
+
+// Adapter implements Backend
+func (p *Pool) Adapter() adapter.Adapter {
+	return p.members[0].backend.Adapter()
+}
+
+// Adapters returns the adapters of all backends.
+func (p *Pool) Adapters() []adapter.Adapter {
+	result := make([]adapter.Adapter, len(p.members))
+	for i, m := range p.members {
+		result[i] = m.backend.Adapter()
+	}
+
+	return result
+}
+
+// Read implements Backend
+func (p *Pool) Read(ctx context.Context, sensor config.Sensor, opts driver.Options) (driver.Reading, error) {
+	var err error
+	candidates := p.candidates(time.Now())
+	for i, m := range candidates {
+		if ctx.Err() != nil {
+			break
+		}
+
+		attemptCtx, cancel := attemptContext(ctx, len(candidates)-i)
+		var reading driver.Reading
+		reading, err = p.readMember(attemptCtx, m, sensor, opts)
+		cancel()
+		var partial *driver.PartialError
+		if err == nil || errors.As(err, &partial) {
+			return reading, err
+		}
+
+		p.log.Debugf("Reading %q using %s failed: %s", sensor.MacAddress, m.backend.Adapter().KernelName, err)
+	}
+
+	if err == nil {
+		err = ctx.Err()
+	}
+	return driver.Reading{}, err
+}
+
+// attemptContext splits the remaining time of the context evenly between the remaining attempts, so that a hanging
+// adapter leaves time for trying the others.
+func attemptContext(ctx context.Context, attempts int) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok || attempts <= 1 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithDeadline(ctx, time.Now().Add(time.Until(deadline)/time.Duration(attempts)))
+}
+
+// readMember reads the sensor using a single backend. A backend hanging beyond the deadline of the context is
+// counted as failed, so that the next read can use another backend.
+func (p *Pool) readMember(ctx context.Context, m *member, sensor config.Sensor, opts driver.Options) (driver.Reading, error) {
+	type result struct {
+		reading driver.Reading
+		err     error
+	}
+
+	p.setActive(m, 1)
+	defer p.setActive(m, -1)
+
+	done := make(chan result, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- result{err: fmt.Errorf("panic reading sensor: %v", r)}
+			}
+		}()
+
+		reading, err := m.backend.Read(ctx, sensor, opts)
+		done <- result{reading, err}
+	}()
+
+	var r result
+	select {
+	case r = <-done:
+	case <-ctx.Done():
+		r.err = fmt.Errorf("adapter did not respond: %s", ctx.Err())
+	}
+
+	p.record(m, r.err, time.Now())
+	return r.reading, r.err
+}
+
+// setActive changes the number of reads using the backend.
+func (p *Pool) setActive(m *member, delta int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	m.active += delta
+}
+
+// candidates returns the healthy backends, starting with the next one in turn. Backends busy with fewer reads come
+// first, so that concurrent reads use different adapters. If no backend is healthy, the one which becomes healthy
+// next is returned.
+func (p *Pool) candidates(now time.Time) []*member {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	start := p.next
+	p.next = (p.next + 1) % len(p.members)
+
+	var result []*member
+	var fallback *member
+	for i := range p.members {
+		m := p.members[(start+i)%len(p.members)]
+		if now.Before(m.unhealthyUntil) {
+			if fallback == nil || m.unhealthyUntil.Before(fallback.unhealthyUntil) {
+				fallback = m
+			}
+			continue
+		}
+
+		result = append(result, m)
+	}
+
+	if len(result) == 0 {
+		result = append(result, fallback)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].active < result[j].active
+	})
+	return result
+}
+
+// healthy returns the healthy backends or all backends if none is healthy.
+func (p *Pool) healthy(now time.Time) []*member {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var result []*member
+	for _, m := range p.members {
+		if !now.Before(m.unhealthyUntil) {
+			result = append(result, m)
+		}
+	}
+
+	if len(result) == 0 {
+		return p.members
+	}
+	return result
+}
+
+func (p *Pool) record(m *member, err error, now time.Time) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	m.reads++
+	var partial *driver.PartialError
+	if err == nil || errors.As(err, &partial) {
+		m.consecutive = 0
+		m.unhealthyUntil = time.Time{}
+		return
+	}
+
+	m.errors++
+	m.consecutive++
+	if m.consecutive >= maxConsecutiveFailures && !now.Before(m.unhealthyUntil) {
+		m.unhealthyUntil = now.Add(unhealthyDuration)
+		p.log.Warnf("Adapter %s failed %d times in a row, skipping it for %s.", m.backend.Adapter().KernelName, m.consecutive, unhealthyDuration)
+	}
+}
+
+// History implements Backend. The history is read using the first backend which succeeds. Reading the history does
+// not change the health of the backends.
+func (p *Pool) History(ctx context.Context, sensor config.Sensor, limit int) ([]driver.Reading, error) {
+	var err error
+	for _, m := range p.candidates(time.Now()) {
+		if ctx.Err() != nil {
+			break
+		}
+
+		var readings []driver.Reading
+		readings, err = m.backend.History(ctx, sensor, limit)
+		if err == nil {
+			return readings, nil
+		}
+
+		p.log.Debugf("Reading history of %q using %s failed: %s", sensor.MacAddress, m.backend.Adapter().KernelName, err)
+	}
+
+	if err == nil {
+		err = ctx.Err()
+	}
+	return nil, err
+}
+
+// Blink implements Backend. The sensor is blinked using the first backend which succeeds, so that it only blinks once.
+// Blinking does not change the health of the backends.
+func (p *Pool) Blink(ctx context.Context, sensor config.Sensor) error {
+	var err error
+	for _, m := range p.candidates(time.Now()) {
+		if ctx.Err() != nil {
+			break
+		}
+
+		err = m.backend.Blink(ctx, sensor)
+		if err == nil {
+			return nil
+		}
+
+		p.log.Debugf("Blinking %q using %s failed: %s", sensor.MacAddress, m.backend.Adapter().KernelName, err)
+	}
+
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+// Scan implements Backend. Unhealthy backends are left out, as they might still be busy with a hanging read.
+func (p *Pool) Scan(ctx context.Context, handler ble.AdvHandler) error {
+	members := p.healthy(time.Now())
+
+	var handlerLock sync.Mutex
+	errs := make(chan error, len(members))
+	for _, m := range members {
+		go func(b Backend) {
+			errs <- b.Scan(ctx, func(a ble.Advertisement) {
+				handlerLock.Lock()
+				defer handlerLock.Unlock()
+
+				handler(a)
+			})
+		}(m.backend)
+	}
+
+	var result error
+	for range members {
+		if err := <-errs; err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
+
+// Close implements Backend
+func (p *Pool) Close() error {
+	var result error
+	for _, m := range p.members {
+		if err := m.backend.Close(); err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
+
+// Describe implements prometheus.Collector
+func (p *Pool) Describe(ch chan<- *prometheus.Desc) {
+	ch <- adapterHealthyDesc
+	ch <- adapterReadsDesc
+	ch <- adapterReadErrorsDesc
+	ch <- adapterConsecutiveErrorsDesc
+}
+
+// Collect implements prometheus.Collector
+func (p *Pool) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, m := range p.members {
+		name := m.backend.Adapter().KernelName
+		healthy := 1.0
+		if now.Before(m.unhealthyUntil) {
+			healthy = 0
+		}
+
+		for _, v := range []struct {
+			Desc      *prometheus.Desc
+			ValueType prometheus.ValueType
+			Value     float64
+		}{
+			{adapterHealthyDesc, prometheus.GaugeValue, healthy},
+			{adapterReadsDesc, prometheus.CounterValue, m.reads},
+			{adapterReadErrorsDesc, prometheus.CounterValue, m.errors},
+			{adapterConsecutiveErrorsDesc, prometheus.GaugeValue, float64(m.consecutive)},
+		} {
+			metric, err := prometheus.NewConstMetric(v.Desc, v.ValueType, v.Value, name)
+			if err != nil {
+				p.log.Errorf("can not create metric %q: %s", v.Desc, err)
+				continue
+			}
+
+			ch <- metric
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/rpc"
+	"time"
+
+	"github.com/go-ble/ble"
+	"github.com/xperimental/flowercare-exporter/internal/adapter"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+// scanReplyMargin is subtracted from the duration of a scan in the worker, so that the advertisements arrive
+// before the deadline of the scan.
+const scanReplyMargin = 500 * time.Millisecond
+
+// Remote forwards all operations to a worker process.
+type Remote struct {
+	client  *rpc.Client
+	adapter adapter.Adapter
+}
+
+var _ Backend = &Remote{}
+
+// Dial connects to the worker listening on the unix socket.
+func Dial(socketPath string) (*Remote, error) {
+	client, err := rpc.Dial("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("can not connect to worker: %s", err)
+	}
+
+	r := &Remote{
+		client: client,
+	}
+	if err := client.Call(serviceName+".Adapter", struct{}{}, &r.adapter); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("can not get adapter from worker: %s", err)
+	}
+
+	return r, nil
+}
+
+// Adapter implements Backend
+func (r *Remote) Adapter() adapter.Adapter {
+	return r.adapter
+}
+
+// Read implements Backend
+func (r *Remote) Read(ctx context.Context, sensor config.Sensor, opts driver.Options) (driver.Reading, error) {
+	args := ReadArgs{
+		Sensor:  sensor,
+		Options: opts,
+		Timeout: timeout(ctx),
+	}
+
+	var reply ReadReply
+	if err := r.call(ctx, "Read", args, &reply); err != nil {
+		return driver.Reading{}, err
+	}
+
+	switch {
+	case reply.Err == "":
+		return reply.Reading, nil
+	case len(reply.Failed) > 0:
+		return reply.Reading, &driver.PartialError{
+			Failed: reply.Failed,
+			Err:    errors.New(reply.Err),
+		}
+	case reply.Connect:
+		return driver.Reading{}, &driver.ConnectError{Err: errors.New(reply.Err)}
+	case reply.Panic:
+		return driver.Reading{}, &driver.PanicError{Err: errors.New(reply.Err)}
+	default:
+		return driver.Reading{}, errors.New(reply.Err)
+	}
+}
+
+// History implements Backend
+func (r *Remote) History(ctx context.Context, sensor config.Sensor, limit int) ([]driver.Reading, error) {
+	args := HistoryArgs{
+		Sensor:  sensor,
+		Limit:   limit,
+		Timeout: timeout(ctx),
+	}
+
+	var reply HistoryReply
+	if err := r.call(ctx, "History", args, &reply); err != nil {
+		return nil, err
+	}
+
+	if reply.Err != "" {
+		return nil, errors.New(reply.Err)
+	}
+
+	return reply.Readings, nil
+}
+
+// Blink implements Backend
+func (r *Remote) Blink(ctx context.Context, sensor config.Sensor) error {
+	args := BlinkArgs{
+		Sensor:  sensor,
+		Timeout: timeout(ctx),
+	}
+
+	var reply BlinkReply
+	if err := r.call(ctx, "Blink", args, &reply); err != nil {
+		return err
+	}
+
+	if reply.Err != "" {
+		return errors.New(reply.Err)
+	}
+
+	return nil
+}
+
+// Scan implements Backend
+func (r *Remote) Scan(ctx context.Context, handler ble.AdvHandler) error {
+	duration := timeout(ctx)
+	if duration > 2*scanReplyMargin {
+		duration -= scanReplyMargin
+	} else {
+		duration /= 2
+	}
+
+	var reply ScanReply
+	if err := r.call(ctx, "Scan", ScanArgs{Duration: duration}, &reply); err != nil {
+		return err
+	}
+
+	for _, a := range reply.Advertisements {
+		handler(a)
+	}
+
+	return ctx.Err()
+}
+
+// Close implements Backend
+func (r *Remote) Close() error {
+	return r.client.Close()
+}
+
+func (r *Remote) call(ctx context.Context, method string, args, reply interface{}) error {
+	call := r.client.Go(serviceName+"."+method, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-call.Done:
+		return call.Error
+	}
+}
+
+// timeout returns the time left until the deadline of the context.
+func timeout(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return time.Minute
+	}
+
+	return time.Until(deadline)
+}
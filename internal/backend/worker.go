@@ -0,0 +1,228 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ble/ble"
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/adapter"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+const serviceName = "Worker"
+
+// maxAdvertisements is the number of advertisements per device returned by a scan. Devices sending only some
+// of their values in every advertisement need more than the latest one.
+const maxAdvertisements = 8
+
+// ReadArgs contains the arguments of a read request to the worker.
+type ReadArgs struct {
+	Sensor  config.Sensor
+	Options driver.Options
+	Timeout time.Duration
+}
+
+// ReadReply contains the result of a read request. Errors are transferred as strings, so that partial reads
+// can be reported together with the data.
+type ReadReply struct {
+	Reading driver.Reading
+	Failed  []string
+	Err     string
+	// Connect is set if the connection to the device could not be established.
+	Connect bool
+	// Panic is set if reading the device panicked.
+	Panic bool
+}
+
+// HistoryArgs contains the arguments of a request for the history stored on a sensor.
+type HistoryArgs struct {
+	Sensor  config.Sensor
+	Limit   int
+	Timeout time.Duration
+}
+
+// HistoryReply contains the values stored on the sensor.
+type HistoryReply struct {
+	Readings []driver.Reading
+	Err      string
+}
+
+// BlinkArgs contains the arguments of a request for making the LED of a sensor blink.
+type BlinkArgs struct {
+	Sensor  config.Sensor
+	Timeout time.Duration
+}
+
+// BlinkReply contains the result of a blink request.
+type BlinkReply struct {
+	Err string
+}
+
+// ScanArgs contains the arguments of a scan request to the worker.
+type ScanArgs struct {
+	Duration time.Duration
+}
+
+// ScanReply contains the advertisements received during a scan, only the latest ones per device.
+type ScanReply struct {
+	Advertisements []*Advertisement
+}
+
+// Worker exposes a Backend using RPC.
+type Worker struct {
+	log     logrus.FieldLogger
+	backend Backend
+}
+
+// Serve accepts connections on the listener and serves requests using the backend until the listener is closed.
+func Serve(log logrus.FieldLogger, listener net.Listener, backend Backend) error {
+	server := rpc.NewServer()
+	if err := server.RegisterName(serviceName, &Worker{
+		log:     log,
+		backend: backend,
+	}); err != nil {
+		return err
+	}
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			return err
+		}
+
+		log.Debug("Accepted worker connection.")
+		go server.ServeConn(conn)
+	}
+}
+
+// Adapter returns information about the adapter used by the worker.
+func (w *Worker) Adapter(_ struct{}, reply *adapter.Adapter) error {
+	*reply = w.backend.Adapter()
+	return nil
+}
+
+// recoverPanic needs to be deferred by the RPC methods. It recovers a panic while using the backend and passes it to
+// onPanic, so that a misbehaving driver does not stop the worker and with it the exporter.
+func (w *Worker) recoverPanic(method string, onPanic func(err error)) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	w.log.Errorf("Recovered panic in %s: %v\n%s", method, r, debug.Stack())
+	onPanic(fmt.Errorf("panic: %v", r))
+}
+
+// Read reads the data of a sensor.
+func (w *Worker) Read(args ReadArgs, reply *ReadReply) error {
+	defer w.recoverPanic("Read", func(err error) {
+		*reply = ReadReply{
+			Err:   err.Error(),
+			Panic: true,
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), args.Timeout)
+	defer cancel()
+
+	reading, err := w.backend.Read(ctx, args.Sensor, args.Options)
+	reply.Reading = reading
+	if err != nil {
+		reply.Err = err.Error()
+
+		var partial *driver.PartialError
+		if errors.As(err, &partial) {
+			reply.Failed = partial.Failed
+		}
+
+		var connect *driver.ConnectError
+		reply.Connect = errors.As(err, &connect)
+
+		var panicked *driver.PanicError
+		reply.Panic = errors.As(err, &panicked)
+	}
+
+	return nil
+}
+
+// History reads the values stored on a sensor.
+func (w *Worker) History(args HistoryArgs, reply *HistoryReply) error {
+	defer w.recoverPanic("History", func(err error) {
+		*reply = HistoryReply{Err: err.Error()}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), args.Timeout)
+	defer cancel()
+
+	readings, err := w.backend.History(ctx, args.Sensor, args.Limit)
+	reply.Readings = readings
+	if err != nil {
+		reply.Err = err.Error()
+	}
+
+	return nil
+}
+
+// Blink makes the LED of a sensor blink.
+func (w *Worker) Blink(args BlinkArgs, reply *BlinkReply) error {
+	defer w.recoverPanic("Blink", func(err error) {
+		reply.Err = err.Error()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), args.Timeout)
+	defer cancel()
+
+	if err := w.backend.Blink(ctx, args.Sensor); err != nil {
+		reply.Err = err.Error()
+	}
+
+	return nil
+}
+
+// Scan collects advertisements for the requested duration.
+func (w *Worker) Scan(args ScanArgs, reply *ScanReply) (err error) {
+	defer w.recoverPanic("Scan", func(panicErr error) {
+		err = panicErr
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), args.Duration)
+	defer cancel()
+
+	lock := sync.Mutex{}
+	latest := map[string][]*Advertisement{}
+	err = w.backend.Scan(ctx, func(a ble.Advertisement) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		key := strings.ToUpper(a.Addr().String())
+		advertisements := append(latest[key], CopyAdvertisement(a))
+		if len(advertisements) > maxAdvertisements {
+			advertisements = advertisements[len(advertisements)-maxAdvertisements:]
+		}
+		latest[key] = advertisements
+	})
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	for _, advertisements := range latest {
+		reply.Advertisements = append(reply.Advertisements, advertisements...)
+	}
+
+	return nil
+}
@@ -0,0 +1,233 @@
+// Package backfill pushes the values stored on the sensors to a Prometheus remote-write endpoint, so that gaps in
+// the data, for example while the exporter has not been running, are filled with the history of the sensors.
+package backfill
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+const (
+	// queueSize is the number of gaps waiting to be filled, further gaps are dropped.
+	queueSize   = 20
+	sendTimeout = 30 * time.Second
+	// entryInterval is the interval in which the sensors store their values.
+	entryInterval = time.Hour
+)
+
+// gap describes a time range in which no values of a sensor have been read.
+type gap struct {
+	Sensor config.Sensor
+	From   time.Time
+	To     time.Time
+}
+
+// Backfiller detects gaps in the readings of sensors and fills them using the history stored on the sensors.
+type Backfiller struct {
+	log     logrus.FieldLogger
+	cfg     config.BackfillConfig
+	client  *http.Client
+	history func(ctx context.Context, macAddress string, limit int) ([]driver.Reading, error)
+	metrics func(sensor config.Sensor, data driver.Reading) []prometheus.Metric
+	queue   chan gap
+
+	lock sync.Mutex
+	last map[string]time.Time
+}
+
+// New creates a Backfiller. The history function reads the values stored on a sensor and the metrics function
+// converts a reading to the metrics exported for the sensor.
+func New(log logrus.FieldLogger, cfg config.BackfillConfig, transport http.RoundTripper,
+	history func(ctx context.Context, macAddress string, limit int) ([]driver.Reading, error),
+	metrics func(sensor config.Sensor, data driver.Reading) []prometheus.Metric) *Backfiller {
+	return &Backfiller{
+		log: log,
+		cfg: cfg,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   sendTimeout,
+		},
+		history: history,
+		metrics: metrics,
+		queue:   make(chan gap, queueSize),
+		last:    map[string]time.Time{},
+	}
+}
+
+// Restore sets the time of the last successful read of the sensors, for example from the state of the previous run,
+// so that the downtime of the exporter is detected as gap.
+func (b *Backfiller) Restore(last map[string]time.Time) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for macAddress, t := range last {
+		if !t.IsZero() {
+			b.last[macAddress] = t
+		}
+	}
+}
+
+// Observe queues a backfill if the previous reading of the sensor is older than the minimum gap. It can be used as
+// listener of the updater and does not block.
+func (b *Backfiller) Observe(sensor config.Sensor, data driver.Reading) {
+	if sensor.Passive() {
+		return
+	}
+
+	if d, err := driver.Get(sensor.Driver); err != nil || d.History == nil {
+		return
+	}
+
+	b.lock.Lock()
+	previous := b.last[sensor.MacAddress]
+	b.last[sensor.MacAddress] = data.Time
+	b.lock.Unlock()
+
+	if previous.IsZero() || data.Time.Sub(previous) < b.cfg.MinGap {
+		return
+	}
+
+	b.log.Infof("No readings of %q between %s and %s, backfilling from history.", sensor, previous.Format(time.RFC3339), data.Time.Format(time.RFC3339))
+	select {
+	case b.queue <- gap{
+		Sensor: sensor,
+		From:   previous,
+		To:     data.Time,
+	}:
+	default:
+		b.log.Warnf("Dropping backfill of %q, queue is full.", sensor)
+	}
+}
+
+// Start starts filling the queued gaps one after the other.
+func (b *Backfiller) Start(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		b.log.Debug("Backfiller ready.")
+		for {
+			select {
+			case <-ctx.Done():
+				b.log.Debug("Shutting down backfiller.")
+				return
+			case g := <-b.queue:
+				if err := b.fill(ctx, g); err != nil {
+					b.log.Errorf("Error backfilling %q: %s", g.Sensor, err)
+				}
+			}
+		}
+	}()
+}
+
+// fill downloads the history of the sensor covering the gap and pushes the entries within the gap.
+func (b *Backfiller) fill(ctx context.Context, g gap) error {
+	limit := int(time.Since(g.From)/entryInterval) + 1
+	readings, err := b.history(ctx, g.Sensor.MacAddress, limit)
+	if err != nil {
+		return fmt.Errorf("can not read history: %s", err)
+	}
+
+	index := map[string]*series{}
+	entries := 0
+	for _, r := range readings {
+		if !r.Time.After(g.From) || !r.Time.Before(g.To) {
+			continue
+		}
+
+		families, err := gather(b.metrics(g.Sensor, r))
+		if err != nil {
+			return fmt.Errorf("can not convert history entry: %s", err)
+		}
+
+		appendFamilies(index, families, b.cfg.Labels)
+		entries++
+	}
+
+	if entries == 0 {
+		b.log.Infof("History of %q contains no entries within the gap.", g.Sensor)
+		return nil
+	}
+
+	list := make([]*series, 0, len(index))
+	for _, s := range index {
+		sort.Slice(s.Samples, func(i, j int) bool {
+			return s.Samples[i].Timestamp < s.Samples[j].Timestamp
+		})
+		list = append(list, s)
+	}
+
+	if err := b.send(ctx, list); err != nil {
+		return err
+	}
+
+	b.log.Infof("Backfilled %d history entries of %q.", entries, g.Sensor)
+	return nil
+}
+
+// gather converts the metrics to metric families, which contain the names of the metrics.
+func gather(metrics []prometheus.Metric) ([]*dto.MetricFamily, error) {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(metricList(metrics)); err != nil {
+		return nil, err
+	}
+
+	return registry.Gather()
+}
+
+// metricList is an unchecked collector emitting a fixed list of metrics.
+type metricList []prometheus.Metric
+
+// Describe implements prometheus.Collector
+func (l metricList) Describe(chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector
+func (l metricList) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range l {
+		ch <- m
+	}
+}
+
+func (b *Backfiller) send(ctx context.Context, list []*series) error {
+	body := encodeSnappy(encodeWriteRequest(list))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "flowercare-exporter")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if b.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+b.cfg.Token)
+	}
+
+	res, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("unexpected status: %s: %s", res.Status, strings.TrimSpace(string(message)))
+	}
+	io.Copy(io.Discard, res.Body)
+
+	return nil
+}
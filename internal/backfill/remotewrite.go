@@ -0,0 +1,174 @@
+package backfill
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type label struct {
+	Name  string
+	Value string
+}
+
+type sample struct {
+	Value float64
+	// Timestamp contains the time of the sample in milliseconds since the epoch.
+	Timestamp int64
+}
+
+// series contains the samples of a single time series, in the form sent using the remote-write protocol.
+type series struct {
+	Labels  []label
+	Samples []sample
+}
+
+// appendFamilies adds the samples of the gathered metrics to the series, which are indexed by their labels. The
+// extra labels are added to all series. Only gauges are supported, as the collector only exports gauges.
+func appendFamilies(index map[string]*series, families []*dto.MetricFamily, extra map[string]string) {
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			if m.GetGauge() == nil {
+				continue
+			}
+
+			labels := []label{{Name: "__name__", Value: family.GetName()}}
+			for name, value := range extra {
+				labels = append(labels, label{Name: name, Value: value})
+			}
+			for _, pair := range m.GetLabel() {
+				// Labels with empty values are dropped by Prometheus when scraping as well.
+				if pair.GetValue() == "" {
+					continue
+				}
+				labels = append(labels, label{Name: pair.GetName(), Value: pair.GetValue()})
+			}
+			labels = uniqueLabels(labels)
+
+			key := seriesKey(labels)
+			s, ok := index[key]
+			if !ok {
+				s = &series{
+					Labels: labels,
+				}
+				index[key] = s
+			}
+
+			s.Samples = append(s.Samples, sample{
+				Value:     m.GetGauge().GetValue(),
+				Timestamp: m.GetTimestampMs(),
+			})
+		}
+	}
+}
+
+// uniqueLabels sorts the labels by name, as required by the remote-write protocol. If a label is present more than
+// once, the last one is kept, so that the labels of the metric take precedence over the extra labels.
+func uniqueLabels(labels []label) []label {
+	sort.SliceStable(labels, func(i, j int) bool {
+		return labels[i].Name < labels[j].Name
+	})
+
+	result := labels[:0]
+	for _, l := range labels {
+		if len(result) > 0 && result[len(result)-1].Name == l.Name {
+			result[len(result)-1] = l
+			continue
+		}
+		result = append(result, l)
+	}
+
+	return result
+}
+
+func seriesKey(labels []label) string {
+	var b strings.Builder
+	for _, l := range labels {
+		b.WriteString(l.Name)
+		b.WriteByte(0)
+		b.WriteString(l.Value)
+		b.WriteByte(0)
+	}
+
+	return b.String()
+}
+
+// Field numbers of the messages of the remote-write protocol.
+const (
+	fieldWriteRequestTimeseries = 1
+	fieldTimeseriesLabels       = 1
+	fieldTimeseriesSamples      = 2
+	fieldLabelName              = 1
+	fieldLabelValue             = 2
+	fieldSampleValue            = 1
+	fieldSampleTimestamp        = 2
+)
+
+// encodeWriteRequest encodes the series as protobuf WriteRequest message of the remote-write protocol. The samples
+// of every series need to be sorted by time.
+func encodeWriteRequest(list []*series) []byte {
+	var result []byte
+	for _, s := range list {
+		var ts []byte
+		for _, l := range s.Labels {
+			var lb []byte
+			lb = protowire.AppendTag(lb, fieldLabelName, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.Name)
+			lb = protowire.AppendTag(lb, fieldLabelValue, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.Value)
+
+			ts = protowire.AppendTag(ts, fieldTimeseriesLabels, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, lb)
+		}
+
+		for _, smp := range s.Samples {
+			var sb []byte
+			sb = protowire.AppendTag(sb, fieldSampleValue, protowire.Fixed64Type)
+			sb = protowire.AppendFixed64(sb, math.Float64bits(smp.Value))
+			sb = protowire.AppendTag(sb, fieldSampleTimestamp, protowire.VarintType)
+			sb = protowire.AppendVarint(sb, uint64(smp.Timestamp))
+
+			ts = protowire.AppendTag(ts, fieldTimeseriesSamples, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, sb)
+		}
+
+		result = protowire.AppendTag(result, fieldWriteRequestTimeseries, protowire.BytesType)
+		result = protowire.AppendBytes(result, ts)
+	}
+
+	return result
+}
+
+// maxLiteral is the maximum length of a literal in the snappy block format.
+const maxLiteral = 1 << 16
+
+// encodeSnappy wraps the data in the snappy block format required by the remote-write protocol. The data is stored
+// as literals without compressing it, which is valid for every decoder and avoids another dependency. The requests
+// are small, as they are only sent after a gap in the readings.
+func encodeSnappy(data []byte) []byte {
+	result := binary.AppendUvarint(nil, uint64(len(data)))
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > maxLiteral {
+			chunk = chunk[:maxLiteral]
+		}
+		data = data[len(chunk):]
+
+		n := len(chunk) - 1
+		switch {
+		case n < 60:
+			result = append(result, byte(n)<<2)
+		case n < 1<<8:
+			result = append(result, 60<<2, byte(n))
+		default:
+			result = append(result, 61<<2, byte(n), byte(n>>8))
+		}
+		result = append(result, chunk...)
+	}
+
+	return result
+}
@@ -0,0 +1,120 @@
+// Package battery predicts when the batteries of the sensors will be depleted.
+package battery
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+const (
+	// sampleInterval is the minimum time between two samples of a sensor.
+	sampleInterval = time.Hour
+	// minSpan is the minimum time covered by the samples before a prediction is made.
+	minSpan = 24 * time.Hour
+	// minSamples is the minimum number of samples needed for a prediction.
+	minSamples = 3
+	// replacedIncrease is the increase of the battery level after which the battery is assumed to be replaced.
+	replacedIncrease = 10
+)
+
+type sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// Predictor models the battery level of every sensor over time. The level of the coin cells used by the sensors
+// declines roughly linearly before dropping off quickly at the end, so a linear fit of the recent levels is used.
+type Predictor struct {
+	window time.Duration
+
+	lock    sync.Mutex
+	samples map[string][]sample
+}
+
+// New creates a Predictor using the battery levels of the window for its predictions.
+func New(window time.Duration) *Predictor {
+	return &Predictor{
+		window:  window,
+		samples: map[string][]sample{},
+	}
+}
+
+// Observe records the battery level of a reading. It can be used as an updater.Listener.
+func (p *Predictor) Observe(sensor config.Sensor, reading driver.Reading) {
+	if reading.Battery == nil {
+		return
+	}
+
+	now := reading.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	value := *reading.Battery
+	key := strings.ToUpper(sensor.MacAddress)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	samples := p.samples[key]
+	if len(samples) > 0 {
+		last := samples[len(samples)-1]
+		if value >= last.Value+replacedIncrease {
+			samples = nil
+		} else if now.Sub(last.Time) < sampleInterval {
+			return
+		}
+	}
+
+	samples = append(samples, sample{
+		Time:  now,
+		Value: value,
+	})
+
+	start := 0
+	for start < len(samples) && now.Sub(samples[start].Time) > p.window {
+		start++
+	}
+	p.samples[key] = samples[start:]
+}
+
+// Depletion returns the time at which the battery of the sensor is predicted to be empty. It returns false if
+// there is not enough data yet or the battery level is not declining.
+func (p *Predictor) Depletion(macAddress string) (time.Time, bool) {
+	p.lock.Lock()
+	samples := p.samples[strings.ToUpper(macAddress)]
+	p.lock.Unlock()
+
+	if len(samples) < minSamples || samples[len(samples)-1].Time.Sub(samples[0].Time) < minSpan {
+		return time.Time{}, false
+	}
+
+	// Least squares fit of the level over the seconds since the first sample.
+	start := samples[0].Time
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range samples {
+		x := s.Time.Sub(start).Seconds()
+		sumX += x
+		sumY += s.Value
+		sumXY += x * s.Value
+		sumXX += x * x
+	}
+
+	n := float64(len(samples))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return time.Time{}, false
+	}
+
+	slope := (n*sumXY - sumX*sumY) / denominator
+	if slope >= 0 {
+		return time.Time{}, false
+	}
+
+	intercept := (sumY - slope*sumX) / n
+	seconds := -intercept / slope
+	return start.Add(time.Duration(seconds * float64(time.Second))), true
+}
@@ -0,0 +1,56 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// LastRead returns the time of the most recent reading of all sensors. It returns false if no sensor has been read
+// yet.
+func (c *Flowercare) LastRead() (time.Time, bool) {
+	var result time.Time
+	for _, s := range c.Sensors() {
+		data, err := c.Source(s.MacAddress)
+		if err != nil {
+			continue
+		}
+
+		if data.Time.After(result) {
+			result = data.Time
+		}
+	}
+
+	return result, !result.IsZero()
+}
+
+// CacheHandler sets the Cache-Control and Age headers of the responses of the handler, so that caching proxies and
+// multiple Prometheus servers can tell how current the metrics are. The age is the time since the most recent
+// reading and the responses are considered fresh for one refresh interval after that reading. Responses are not
+// cached as long as no sensor has been read. Responses needing authentication are marked as private, so that shared
+// caches do not serve them to other clients.
+func CacheHandler(next http.Handler, lastRead func() (time.Time, bool), refresh time.Duration, private bool) http.Handler {
+	scope := "public"
+	if private {
+		scope = "private"
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		last, ok := lastRead()
+		if !ok {
+			w.Header().Set("Cache-Control", "no-cache")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		age := time.Since(last)
+		if age < 0 {
+			age = 0
+		}
+
+		w.Header().Set("Cache-Control", fmt.Sprintf("%s, max-age=%d", scope, int(refresh.Seconds())))
+		w.Header().Set("Age", strconv.Itoa(int(age.Seconds())))
+		next.ServeHTTP(w, r)
+	})
+}
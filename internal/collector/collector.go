@@ -1,21 +1,26 @@
 package collector
 
 import (
+	"math"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/anonymize"
 	"github.com/xperimental/flowercare-exporter/internal/config"
-	"github.com/xperimental/flowercare-exporter/pkg/miflora"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+	"github.com/xperimental/flowercare-exporter/internal/events"
+	"github.com/xperimental/flowercare-exporter/internal/extremes"
+	"github.com/xperimental/flowercare-exporter/internal/photoperiod"
+	"github.com/xperimental/flowercare-exporter/internal/trend"
 )
 
 const (
 	// MetricPrefix contains the prefix used by all metrics emitted from this collector.
 	MetricPrefix = "flowercare_"
-
-	// Conversion factor from µS/cm to S/m
-	factorConductivity = 0.0001
 )
 
 var (
@@ -32,71 +37,397 @@ var (
 		"min_light_lux",
 	}
 
-	upDesc = prometheus.NewDesc(
-		MetricPrefix+"up",
-		"Shows if data could be successfully retrieved by the collector.",
-		varLabelNames, nil)
-	updatedTimestampDesc = prometheus.NewDesc(
-		MetricPrefix+"updated_timestamp",
-		"Contains the timestamp when the last communication with the Bluetooth device happened.",
-		varLabelNames, nil)
-	infoDesc = prometheus.NewDesc(
-		MetricPrefix+"info",
-		"Contains information about the Flower Care device.",
-		append(varLabelNames, "version"), nil) // Ensure "version" is still appended if needed
-	batteryDesc = prometheus.NewDesc(
-		MetricPrefix+"battery_percent",
-		"Battery level in percent.",
-		varLabelNames, nil)
-	conductivityDesc = prometheus.NewDesc(
-		MetricPrefix+"conductivity_sm",
-		"Soil conductivity in Siemens/meter.",
-		varLabelNames, nil)
-	lightDesc = prometheus.NewDesc(
-		MetricPrefix+"brightness_lux",
-		"Ambient lighting in lux.",
-		varLabelNames, nil)
-	moistureDesc = prometheus.NewDesc(
-		MetricPrefix+"moisture_percent",
-		"Soil relative moisture in percent.",
-		varLabelNames, nil)
-	temperatureDesc = prometheus.NewDesc(
-		MetricPrefix+"temperature_celsius",
-		"Ambient temperature in celsius.",
-		varLabelNames, nil)
+	// upstreamLabelNames are the labels used by the upstream exporter. They are the first labels of varLabelNames.
+	upstreamLabelNames = varLabelNames[:2:2]
+
+	// deviceLabelNames describe the device and driver of a sensor. They are omitted in the legacy label set.
+	deviceLabelNames = []string{
+		"device_type",
+		"model",
+		"protocol",
+	}
+
+	vpdDesc = prometheus.NewDesc(
+		MetricPrefix+"vapor_pressure_deficit_kilopascals",
+		"Vapor pressure deficit of a plant group, calculated from the ambient sensors in the group.",
+		[]string{"group"}, nil)
+
+	sensorInfoDesc = prometheus.NewDesc(
+		MetricPrefix+"sensor_info",
+		"Contains the firmware version of the sensor as label. Value set to 1.",
+		[]string{"name", "macaddress", "firmware_version"}, nil)
+
+	// extremeMetrics contains the values whose lowest and highest value during the min-max window are exported. The
+	// suffix of the selected unit is appended to the metric name.
+	extremeMetrics = []struct {
+		Field  string
+		Metric string
+		Name   string
+	}{
+		{Field: "temperature", Metric: "temperature_celsius", Name: "temperature"},
+		{Field: "moisture", Metric: "moisture_percent", Name: "soil moisture"},
+		{Field: "light", Metric: "brightness", Name: "light level"},
+		{Field: "conductivity", Metric: "conductivity", Name: "soil conductivity"},
+		{Field: "humidity", Metric: "humidity_percent", Name: "air humidity"},
+	}
+
+	plantLabelNames = []string{
+		"species",
+		"scientific_name",
+		"common_name",
+	}
 )
 
+// descriptors contains the descriptions of all metrics carrying the sensor labels.
+type descriptors struct {
+	Up                *prometheus.Desc
+	UpdatedTimestamp  *prometheus.Desc
+	Info              *prometheus.Desc
+	PlantInfo         *prometheus.Desc
+	Battery           *prometheus.Desc
+	Conductivity      *prometheus.Desc
+	Light             *prometheus.Desc
+	Moisture          *prometheus.Desc
+	Temperature       *prometheus.Desc
+	Humidity          *prometheus.Desc
+	BatteryVoltage    *prometheus.Desc
+	RSSI              *prometheus.Desc
+	Compensated       *prometheus.Desc
+	BatteryDepletion  *prometheus.Desc
+	MoistureForecast  *prometheus.Desc
+	WateringDue       *prometheus.Desc
+	DryRate           *prometheus.Desc
+	WateringEvents    *prometheus.Desc
+	LastWatered       *prometheus.Desc
+	Photoperiod       *prometheus.Desc
+	PhotoperiodPrev   *prometheus.Desc
+	Degradation       *prometheus.Desc
+	MoistureMin       *prometheus.Desc
+	MoistureMax       *prometheus.Desc
+	ConductivityMin   *prometheus.Desc
+	ConductivityMax   *prometheus.Desc
+	LightMin          *prometheus.Desc
+	LightMax          *prometheus.Desc
+	MoistureRange     *prometheus.Desc
+	ConductivityRange *prometheus.Desc
+	LightRange        *prometheus.Desc
+	// Lowest and Highest contain the descriptions of the extremes by the name of the value.
+	Lowest  map[string]*prometheus.Desc
+	Highest map[string]*prometheus.Desc
+}
+
+// metricName appends the suffix of the unit to the name of a metric.
+func metricName(name string, unit config.Unit) string {
+	if unit.Suffix == "" {
+		return MetricPrefix + name
+	}
+
+	return MetricPrefix + name + "_" + unit.Suffix
+}
+
+// newDescriptors creates the descriptions of the metrics. The metrics also exported by the upstream exporter use the
+// coreLabelNames if they are set.
+func newDescriptors(units config.UnitsConfig, labelNames, temperatureLabelNames, rssiLabelNames, coreLabelNames []string) *descriptors {
+	coreNames, coreTemperatureNames := labelNames, temperatureLabelNames
+	if coreLabelNames != nil {
+		coreNames, coreTemperatureNames = coreLabelNames, coreLabelNames
+	}
+
+	light := units.Unit("light")
+	conductivity := units.Unit("conductivity")
+
+	lowest := map[string]*prometheus.Desc{}
+	highest := map[string]*prometheus.Desc{}
+	for _, m := range extremeMetrics {
+		names := labelNames
+		if m.Field == "temperature" {
+			names = temperatureLabelNames
+		}
+
+		lowest[m.Field] = prometheus.NewDesc(
+			metricName("lowest_"+m.Metric, units.Unit(m.Field)),
+			"Lowest "+m.Name+" of the sensor during the min-max window.",
+			names, nil)
+		highest[m.Field] = prometheus.NewDesc(
+			metricName("highest_"+m.Metric, units.Unit(m.Field)),
+			"Highest "+m.Name+" of the sensor during the min-max window.",
+			names, nil)
+	}
+
+	return &descriptors{
+		Lowest:  lowest,
+		Highest: highest,
+		Up: prometheus.NewDesc(
+			MetricPrefix+"up",
+			"Shows if data could be successfully retrieved by the collector.",
+			coreNames, nil),
+		UpdatedTimestamp: prometheus.NewDesc(
+			MetricPrefix+"updated_timestamp",
+			"Contains the timestamp when the last communication with the Bluetooth device happened.",
+			coreNames, nil),
+		Info: prometheus.NewDesc(
+			MetricPrefix+"info",
+			"Contains information about the Flower Care device.",
+			append(coreNames[:len(coreNames):len(coreNames)], "version"), nil),
+		PlantInfo: prometheus.NewDesc(
+			MetricPrefix+"plant_info",
+			"Contains the species of the plant monitored by the sensor. Only present if the species is configured.",
+			append(labelNames[:len(labelNames):len(labelNames)], plantLabelNames...), nil),
+		Battery: prometheus.NewDesc(
+			MetricPrefix+"battery_percent",
+			"Battery level in percent.",
+			coreNames, nil),
+		Conductivity: prometheus.NewDesc(
+			metricName("conductivity", conductivity),
+			"Soil conductivity in "+conductivity.Description+".",
+			coreNames, nil),
+		Light: prometheus.NewDesc(
+			metricName("brightness", light),
+			"Ambient lighting in "+light.Description+".",
+			coreNames, nil),
+		Moisture: prometheus.NewDesc(
+			MetricPrefix+"moisture_percent",
+			"Soil relative moisture in percent.",
+			coreNames, nil),
+		Temperature: prometheus.NewDesc(
+			MetricPrefix+"temperature_celsius",
+			"Temperature in celsius. The measurement label shows if it is the temperature of the soil or the air, if the placement of the sensor is configured.",
+			coreTemperatureNames, nil),
+		Humidity: prometheus.NewDesc(
+			MetricPrefix+"humidity_percent",
+			"Relative air humidity in percent.",
+			labelNames, nil),
+		BatteryVoltage: prometheus.NewDesc(
+			MetricPrefix+"battery_volts",
+			"Battery voltage in volts.",
+			labelNames, nil),
+		RSSI: prometheus.NewDesc(
+			MetricPrefix+"rssi_dbm",
+			"Signal strength of the sensor in dBm, observed while connecting to it or receiving its advertisements. The via label shows the receiver of the advertisement, it is empty for connections.",
+			rssiLabelNames, nil),
+		Compensated: prometheus.NewDesc(
+			metricName("conductivity_compensated", conductivity),
+			"Soil conductivity in "+conductivity.Description+" corrected to the reference temperature. Only present if the compensate step of the pipeline is used.",
+			labelNames, nil),
+		BatteryDepletion: prometheus.NewDesc(
+			MetricPrefix+"battery_depletion_timestamp_seconds",
+			"Predicted time at which the battery will be empty, based on the decline of the battery level.",
+			labelNames, nil),
+		MoistureForecast: prometheus.NewDesc(
+			MetricPrefix+"moisture_forecast_percent",
+			"Soil moisture in percent predicted for the horizon after the last reading, based on the drying curve since the last watering.",
+			append(labelNames[:len(labelNames):len(labelNames)], "horizon"), nil),
+		WateringDue: prometheus.NewDesc(
+			MetricPrefix+"watering_due_timestamp_seconds",
+			"Predicted time at which the soil moisture falls below the minimum of the plant.",
+			labelNames, nil),
+		DryRate: prometheus.NewDesc(
+			MetricPrefix+"moisture_dry_rate_percent_per_hour",
+			"Decrease of the soil moisture in percentage points per hour, fitted over the dry-out rate window. Negative while the moisture increases.",
+			labelNames, nil),
+		WateringEvents: prometheus.NewDesc(
+			MetricPrefix+"watering_events_total",
+			"Number of times the plant has been watered, detected by a sharp increase of the soil moisture.",
+			labelNames, nil),
+		LastWatered: prometheus.NewDesc(
+			MetricPrefix+"last_watered_timestamp_seconds",
+			"Time at which the plant has last been watered, detected by a sharp increase of the soil moisture.",
+			labelNames, nil),
+		Photoperiod: prometheus.NewDesc(
+			MetricPrefix+"photoperiod_hours",
+			"Hours of the current day during which the light level was above the photoperiod threshold.",
+			labelNames, nil),
+		PhotoperiodPrev: prometheus.NewDesc(
+			MetricPrefix+"photoperiod_previous_day_hours",
+			"Hours of the previous day during which the light level was above the photoperiod threshold. Only present if the sensor has been observed during the whole day.",
+			labelNames, nil),
+		Degradation: prometheus.NewDesc(
+			MetricPrefix+"sensor_degradation_percent_per_week",
+			"Decline of the values per week, which is attributed to the degradation of the sensor instead of changes of the plant. Values above zero suggest maintenance of the sensor.",
+			append(labelNames[:len(labelNames):len(labelNames)], "reason"), nil),
+		MoistureMin: prometheus.NewDesc(
+			MetricPrefix+"param_soil_moisture_min",
+			"Minimum soil moisture of the plant in percent, as configured in the parameters of the sensor.",
+			labelNames, nil),
+		MoistureMax: prometheus.NewDesc(
+			MetricPrefix+"param_soil_moisture_max",
+			"Maximum soil moisture of the plant in percent, as configured in the parameters of the sensor.",
+			labelNames, nil),
+		ConductivityMin: prometheus.NewDesc(
+			MetricPrefix+"param_soil_conductivity_min",
+			"Minimum soil conductivity of the plant in "+conductivity.Description+", as configured in the parameters of the sensor.",
+			labelNames, nil),
+		ConductivityMax: prometheus.NewDesc(
+			MetricPrefix+"param_soil_conductivity_max",
+			"Maximum soil conductivity of the plant in "+conductivity.Description+", as configured in the parameters of the sensor.",
+			labelNames, nil),
+		LightMin: prometheus.NewDesc(
+			MetricPrefix+"param_light_min",
+			"Minimum light level of the plant in "+light.Description+", as configured in the parameters of the sensor.",
+			labelNames, nil),
+		LightMax: prometheus.NewDesc(
+			MetricPrefix+"param_light_max",
+			"Maximum light level of the plant in "+light.Description+", as configured in the parameters of the sensor.",
+			labelNames, nil),
+		MoistureRange: prometheus.NewDesc(
+			MetricPrefix+"moisture_out_of_range",
+			"Contains 1 if the soil moisture is outside of the range configured for the plant and 0 otherwise.",
+			labelNames, nil),
+		ConductivityRange: prometheus.NewDesc(
+			MetricPrefix+"conductivity_out_of_range",
+			"Contains 1 if the soil conductivity is outside of the range configured for the plant and 0 otherwise.",
+			labelNames, nil),
+		LightRange: prometheus.NewDesc(
+			MetricPrefix+"light_out_of_range",
+			"Contains 1 if the light level is outside of the range configured for the plant and 0 otherwise.",
+			labelNames, nil),
+	}
+}
+
 // Flowercare implements a Prometheus collector that emits metrics of a Miflora sensor.
 type Flowercare struct {
 	Log           logrus.FieldLogger
-	Source        func(macAddress string) (miflora.Data, error)
-	Sensors       []config.Sensor
+	Source        func(macAddress string) (driver.Reading, error)
+	Sensors       func() []config.Sensor
 	StaleDuration time.Duration
+	// StaleDurations overrides the StaleDuration for single values, for example for values changing slowly.
+	StaleDurations map[string]time.Duration
+	// LegacyLabels omits the device labels, so that existing dashboards keep working.
+	LegacyLabels bool
+	// Discovery adds the discovered label, showing which sensors have been found by scanning.
+	Discovery bool
+	// Anonymizer replaces the MAC address and name labels with pseudonyms if set.
+	Anonymizer *anonymize.Anonymizer
+	// BatteryDepletion returns the predicted depletion time of the battery of a sensor if set.
+	BatteryDepletion func(macAddress string) (time.Time, bool)
+	// MoistureForecast returns the predicted moisture of a sensor after the horizon if set.
+	MoistureForecast func(macAddress string, horizon time.Duration) (float64, bool)
+	// ForecastHorizons contains the horizons of the exported moisture forecasts.
+	ForecastHorizons []time.Duration
+	// WateringDue returns the time at which the moisture of a sensor is predicted to fall below the threshold if set.
+	WateringDue func(macAddress string, threshold float64) (time.Time, bool)
+	// DryRate returns the decrease of the moisture of a sensor per hour if set.
+	DryRate func(macAddress string) (float64, bool)
+	// Watering returns the waterings detected for a sensor if set.
+	Watering func(macAddress string) (events.WateringStats, bool)
+	// Photoperiod returns the time with light of a sensor on the current and the previous day if set.
+	Photoperiod func(macAddress string, now time.Time) (photoperiod.Day, bool)
+	// Degradation returns the decline of the values of a sensor attributed to its degradation by reason if set.
+	Degradation func(macAddress string) (map[string]float64, bool)
+	// Extremes returns the lowest and highest values of a sensor during the min-max window by value if set.
+	Extremes func(macAddress string, now time.Time) (map[string]extremes.Range, bool)
+	// Units contains the units and precision of the values.
+	Units config.UnitsConfig
+	// Compat selects a compatibility mode for the names and labels of the metrics. It is empty for the native metrics.
+	Compat string
+
+	descsOnce sync.Once
+	descs     *descriptors
+}
+
+func (c *Flowercare) descriptors() *descriptors {
+	c.descsOnce.Do(func() {
+		labelNames := varLabelNames
+		if !c.LegacyLabels {
+			labelNames = append(labelNames[:len(labelNames):len(labelNames)], deviceLabelNames...)
+		}
+		if c.Discovery {
+			labelNames = append(labelNames[:len(labelNames):len(labelNames)], "discovered")
+		}
+
+		temperatureLabelNames := labelNames
+		rssiLabelNames := labelNames
+		if !c.LegacyLabels {
+			temperatureLabelNames = append(labelNames[:len(labelNames):len(labelNames)], "measurement")
+			rssiLabelNames = append(labelNames[:len(labelNames):len(labelNames)], "via")
+		}
+
+		var coreLabelNames []string
+		if c.Compat == config.CompatXperimental {
+			coreLabelNames = upstreamLabelNames
+		}
+
+		c.descs = newDescriptors(c.Units, labelNames, temperatureLabelNames, rssiLabelNames, coreLabelNames)
+	})
+
+	return c.descs
 }
 
 // Describe implements prometheus.Collector
 func (c *Flowercare) Describe(ch chan<- *prometheus.Desc) {
-	ch <- upDesc
-	ch <- updatedTimestampDesc
-	ch <- infoDesc
-	ch <- batteryDesc
-	ch <- conductivityDesc
-	ch <- lightDesc
-	ch <- moistureDesc
-	ch <- temperatureDesc
+	descs := c.descriptors()
+	ch <- descs.Up
+	ch <- descs.UpdatedTimestamp
+	ch <- descs.Info
+	ch <- descs.PlantInfo
+	ch <- descs.Battery
+	ch <- descs.Conductivity
+	ch <- descs.Light
+	ch <- descs.Moisture
+	ch <- descs.Temperature
+	ch <- descs.Humidity
+	ch <- descs.BatteryVoltage
+	ch <- descs.RSSI
+	ch <- descs.Compensated
+	ch <- descs.BatteryDepletion
+	ch <- descs.MoistureForecast
+	ch <- descs.WateringDue
+	ch <- descs.DryRate
+	ch <- descs.WateringEvents
+	ch <- descs.LastWatered
+	ch <- descs.Photoperiod
+	ch <- descs.PhotoperiodPrev
+	ch <- descs.Degradation
+	ch <- descs.MoistureMin
+	ch <- descs.MoistureMax
+	ch <- descs.ConductivityMin
+	ch <- descs.ConductivityMax
+	ch <- descs.LightMin
+	ch <- descs.LightMax
+	ch <- descs.MoistureRange
+	ch <- descs.ConductivityRange
+	ch <- descs.LightRange
+	for _, m := range extremeMetrics {
+		ch <- descs.Lowest[m.Field]
+		ch <- descs.Highest[m.Field]
+	}
+	ch <- vpdDesc
+	ch <- sensorInfoDesc
 }
 
 // Collect implements prometheus.Collector
 func (c *Flowercare) Collect(ch chan<- prometheus.Metric) {
-	for _, s := range c.Sensors {
-		c.collectSensor(ch, s)
+	groups := map[string][]float64{}
+	for _, s := range c.Sensors() {
+		data, ok := c.collectSensor(ch, s)
+		if !ok || s.Group == "" || data.Temperature == nil || data.Humidity == nil {
+			continue
+		}
+
+		groups[s.Group] = append(groups[s.Group], vaporPressureDeficit(*data.Temperature, *data.Humidity))
 	}
+
+	for group, values := range groups {
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+
+		c.sendMetric(ch, vpdDesc, sum/float64(len(values)), []string{group})
+	}
+}
+
+// vaporPressureDeficit calculates the VPD in kPa using the Tetens equation for the saturation vapor pressure.
+func vaporPressureDeficit(temperature, humidity float64) float64 {
+	saturation := 0.6108 * math.Exp(17.27*temperature/(temperature+237.3))
+	return saturation * (1 - humidity/100)
 }
 
-func (c *Flowercare) collectSensor(ch chan<- prometheus.Metric, s config.Sensor) {
+// sensorLabels returns the label values of the metrics of a sensor and of its temperature.
+func (c *Flowercare) sensorLabels(s config.Sensor) ([]string, []string) {
 	labels := []string{
-		s.MacAddress,
-		s.Name,
+		c.Anonymizer.MAC(s.MacAddress),
+		c.Anonymizer.Name(s.Name),
 		s.Type,
 		strconv.Itoa(s.MaxSoilMoist), // Convert int to string
 		strconv.Itoa(s.MinSoilMoist), // Convert int to string
@@ -105,59 +436,372 @@ func (c *Flowercare) collectSensor(ch chan<- prometheus.Metric, s config.Sensor)
 		strconv.Itoa(s.MaxLightLux),  // Convert int to string
 		strconv.Itoa(s.MinLightLux),  // Convert int to string
 	}
+	if !c.LegacyLabels {
+		labels = append(labels, deviceLabels(s)...)
+	}
+	if c.Discovery {
+		labels = append(labels, strconv.FormatBool(s.Discovered))
+	}
+
+	temperatureLabels := labels
+	if !c.LegacyLabels {
+		temperatureLabels = append(labels[:len(labels):len(labels)], s.TemperatureMeasurement())
+	}
+
+	return labels, temperatureLabels
+}
+
+// ReadingMetrics returns the metrics of the values of a reading, as they would be exported for the sensor. The
+// metrics carry the time of the reading as timestamp, so that they can be used for backfilling.
+func (c *Flowercare) ReadingMetrics(s config.Sensor, data driver.Reading) []prometheus.Metric {
+	labels, temperatureLabels := c.sensorLabels(s)
+
+	ch := make(chan prometheus.Metric, len(driver.FieldNames))
+	c.collectData(ch, data, labels, temperatureLabels)
+	close(ch)
+
+	var result []prometheus.Metric
+	for m := range ch {
+		result = append(result, prometheus.NewMetricWithTimestamp(data.Time, m))
+	}
 
+	return result
+}
+
+// collectSensor emits the metrics of a single sensor and returns the values which are not stale.
+func (c *Flowercare) collectSensor(ch chan<- prometheus.Metric, s config.Sensor) (driver.Reading, bool) {
+	labels, temperatureLabels := c.sensorLabels(s)
+	descs := c.descriptors()
+	if s.Species != "" || s.ScientificName != "" || s.CommonName != "" {
+		c.sendMetric(ch, descs.PlantInfo, 1, append(labels[:len(labels):len(labels)], s.Species, s.ScientificName, s.CommonName))
+	}
+	c.collectParameters(ch, s, labels)
+
+	core := c.coreLabels(labels)
 	data, err := c.Source(s.MacAddress)
 	if err != nil {
 		c.Log.Errorf("Error getting data for %q: %s", s, err)
-		c.sendMetric(ch, upDesc, 0, labels)
+		c.sendMetric(ch, descs.Up, 0, core)
 
-		return
+		return driver.Reading{}, false
 	}
-	c.sendMetric(ch, upDesc, 1, labels)
-	c.sendMetric(ch, updatedTimestampDesc, float64(data.Time.Unix()), labels)
-	c.sendMetric(ch, infoDesc, 1, append(labels, data.Firmware.Version))
+	c.sendMetric(ch, descs.Up, 1, core)
+	c.sendMetric(ch, descs.UpdatedTimestamp, float64(data.Time.Unix()), core)
+	c.sendMetric(ch, descs.Info, 1, append(core[:len(core):len(core)], data.Firmware))
+	if data.Firmware != "" {
+		c.sendMetric(ch, sensorInfoDesc, 1, []string{c.Anonymizer.Name(s.Name), c.Anonymizer.MAC(s.MacAddress), data.Firmware})
+	}
+	if c.BatteryDepletion != nil {
+		if depletion, ok := c.BatteryDepletion(s.MacAddress); ok {
+			c.sendMetric(ch, descs.BatteryDepletion, float64(depletion.Unix()), labels)
+		}
+	}
+	c.collectForecast(ch, s, labels)
+	c.collectWatering(ch, s, data, labels)
+	c.collectPhotoperiod(ch, s, labels)
+	c.collectDegradation(ch, s, labels)
+	c.collectExtremes(ch, s, labels, temperatureLabels)
 
 	age := time.Since(data.Time)
 	if age >= c.StaleDuration {
 		c.Log.Debugf("Data for %q is stale: %s > %s", s, age, c.StaleDuration)
+	}
+
+	data = c.freshReading(data, age)
+	c.collectData(ch, data, labels, temperatureLabels)
+	c.collectRanges(ch, s, data, labels)
+	return data, true
+}
+
+// collectRanges emits whether the values are outside of the ranges configured for the plant. A minimum or maximum of
+// zero is treated as not configured. Stale values are left out.
+func (c *Flowercare) collectRanges(ch chan<- prometheus.Metric, s config.Sensor, data driver.Reading, labels []string) {
+	descs := c.descriptors()
+	for _, r := range []struct {
+		Desc  *prometheus.Desc
+		Value *float64
+		Min   int
+		Max   int
+	}{
+		{descs.MoistureRange, data.Moisture, s.MinSoilMoist, s.MaxSoilMoist},
+		{descs.ConductivityRange, data.Conductivity, s.MinSoilEc, s.MaxSoilEc},
+		{descs.LightRange, data.Light, s.MinLightLux, s.MaxLightLux},
+	} {
+		if r.Value == nil || (r.Min == 0 && r.Max == 0) {
+			continue
+		}
+
+		outOfRange := 0.0
+		if (r.Min != 0 && *r.Value < float64(r.Min)) || (r.Max != 0 && *r.Value > float64(r.Max)) {
+			outOfRange = 1
+		}
+
+		c.sendMetric(ch, r.Desc, outOfRange, labels)
+	}
+}
+
+// collectParameters emits the configured ranges of the plant, so that they can be compared with the readings. A range
+// is left out if neither its minimum nor its maximum is configured.
+func (c *Flowercare) collectParameters(ch chan<- prometheus.Metric, s config.Sensor, labels []string) {
+	descs := c.descriptors()
+	for _, param := range []struct {
+		MinDesc *prometheus.Desc
+		MaxDesc *prometheus.Desc
+		Min     int
+		Max     int
+		Field   string
+	}{
+		{descs.MoistureMin, descs.MoistureMax, s.MinSoilMoist, s.MaxSoilMoist, "moisture"},
+		{descs.ConductivityMin, descs.ConductivityMax, s.MinSoilEc, s.MaxSoilEc, "conductivity"},
+		{descs.LightMin, descs.LightMax, s.MinLightLux, s.MaxLightLux, "light"},
+	} {
+		if param.Min == 0 && param.Max == 0 {
+			continue
+		}
+
+		// The parameters are configured values, so they are converted but not rounded.
+		factor := c.Units.Unit(param.Field).Factor
+		c.sendMetric(ch, param.MinDesc, float64(param.Min)*factor, labels)
+		c.sendMetric(ch, param.MaxDesc, float64(param.Max)*factor, labels)
+	}
+}
+
+// collectForecast emits the moisture forecasts of a sensor, the time it needs to be watered and how fast it dries out.
+func (c *Flowercare) collectForecast(ch chan<- prometheus.Metric, s config.Sensor, labels []string) {
+	descs := c.descriptors()
+	if c.MoistureForecast != nil {
+		for _, horizon := range c.ForecastHorizons {
+			if moisture, ok := c.MoistureForecast(s.MacAddress, horizon); ok {
+				c.sendMetric(ch, descs.MoistureForecast, moisture, append(labels[:len(labels):len(labels)], formatHorizon(horizon)))
+			}
+		}
+	}
+
+	if c.WateringDue != nil {
+		if due, ok := c.WateringDue(s.MacAddress, float64(s.MinSoilMoist)); ok {
+			c.sendMetric(ch, descs.WateringDue, float64(due.Unix()), labels)
+		}
+	}
+
+	if c.DryRate != nil {
+		if rate, ok := c.DryRate(s.MacAddress); ok {
+			c.sendMetric(ch, descs.DryRate, rate, labels)
+		}
+	}
+}
+
+// collectWatering emits the waterings detected for a sensor measuring the soil moisture.
+func (c *Flowercare) collectWatering(ch chan<- prometheus.Metric, s config.Sensor, data driver.Reading, labels []string) {
+	if c.Watering == nil {
+		return
+	}
+
+	stats, ok := c.Watering(s.MacAddress)
+	if !ok && data.Moisture == nil {
+		return
+	}
+
+	descs := c.descriptors()
+	c.send(ch, descs.WateringEvents, prometheus.CounterValue, float64(stats.Count), labels)
+	if ok {
+		c.sendMetric(ch, descs.LastWatered, float64(stats.Last.Unix()), labels)
+	}
+}
+
+// collectPhotoperiod emits the light hours of a sensor of the current and the previous day.
+func (c *Flowercare) collectPhotoperiod(ch chan<- prometheus.Metric, s config.Sensor, labels []string) {
+	if c.Photoperiod == nil {
+		return
+	}
+
+	day, ok := c.Photoperiod(s.MacAddress, time.Now())
+	if !ok {
 		return
 	}
 
-	c.collectData(ch, data, labels)
+	descs := c.descriptors()
+	c.sendMetric(ch, descs.Photoperiod, day.Today.Hours(), labels)
+	if day.YesterdayComplete {
+		c.sendMetric(ch, descs.PhotoperiodPrev, day.Yesterday.Hours(), labels)
+	}
+}
+
+// collectDegradation emits the decline of the values of a sensor attributed to its degradation.
+func (c *Flowercare) collectDegradation(ch chan<- prometheus.Metric, s config.Sensor, labels []string) {
+	if c.Degradation == nil {
+		return
+	}
+
+	degradation, ok := c.Degradation(s.MacAddress)
+	if !ok {
+		return
+	}
+
+	descs := c.descriptors()
+	for _, reason := range trend.Reasons {
+		c.sendMetric(ch, descs.Degradation, degradation[reason], append(labels[:len(labels):len(labels)], reason))
+	}
+}
+
+// collectExtremes emits the lowest and highest values of a sensor during the min-max window.
+func (c *Flowercare) collectExtremes(ch chan<- prometheus.Metric, s config.Sensor, labels, temperatureLabels []string) {
+	if c.Extremes == nil {
+		return
+	}
+
+	ranges, ok := c.Extremes(s.MacAddress, time.Now())
+	if !ok {
+		return
+	}
+
+	descs := c.descriptors()
+	for _, m := range extremeMetrics {
+		r, ok := ranges[m.Field]
+		if !ok {
+			continue
+		}
+
+		metricLabels := labels
+		if m.Field == "temperature" {
+			metricLabels = temperatureLabels
+		}
+
+		c.sendMetric(ch, descs.Lowest[m.Field], c.convert(m.Field, r.Min), metricLabels)
+		c.sendMetric(ch, descs.Highest[m.Field], c.convert(m.Field, r.Max), metricLabels)
+	}
+}
+
+// formatHorizon returns the duration without trailing zero units, for example "12h" instead of "12h0m0s".
+func formatHorizon(d time.Duration) string {
+	result := d.String()
+	if strings.HasSuffix(result, "m0s") {
+		result = strings.TrimSuffix(result, "0s")
+	}
+	if strings.HasSuffix(result, "h0m") {
+		result = strings.TrimSuffix(result, "0m")
+	}
+
+	return result
+}
+
+// freshReading returns a copy of the data only containing the values which are not stale yet.
+func (c *Flowercare) freshReading(data driver.Reading, age time.Duration) driver.Reading {
+	for _, name := range driver.FieldNames {
+		staleDuration, ok := c.StaleDurations[name]
+		if !ok {
+			staleDuration = c.StaleDuration
+		}
+
+		if age >= staleDuration {
+			*data.Field(name) = nil
+		}
+	}
+
+	return data
+}
+
+func deviceLabels(s config.Sensor) []string {
+	d, err := driver.Get(s.Driver)
+	if err != nil {
+		return []string{"", "", ""}
+	}
+
+	protocol := d.Protocol
+	if protocol == driver.ProtocolGATT && s.Passive() {
+		protocol = driver.ProtocolAdvertisement
+	}
+
+	return []string{d.DeviceType, d.Model, protocol}
 }
 
-func (c *Flowercare) collectData(ch chan<- prometheus.Metric, data miflora.Data, labels []string) {
+func (c *Flowercare) collectData(ch chan<- prometheus.Metric, data driver.Reading, labels, temperatureLabels []string) {
+	descs := c.descriptors()
+	rssiLabels := labels
+	if !c.LegacyLabels {
+		rssiLabels = append(labels[:len(labels):len(labels)], data.Via)
+	}
+	core := c.coreLabels(labels)
+	coreTemperature := temperatureLabels
+	if c.Compat == config.CompatXperimental {
+		coreTemperature = core
+	}
 	for _, metric := range []struct {
-		Desc  *prometheus.Desc
-		Value float64
+		Desc   *prometheus.Desc
+		Value  *float64
+		Field  string
+		Labels []string
 	}{
 		{
-			Desc:  batteryDesc,
-			Value: float64(data.Firmware.Battery),
+			Desc:   descs.Battery,
+			Value:  data.Battery,
+			Field:  "battery",
+			Labels: core,
 		},
 		{
-			Desc:  conductivityDesc,
-			Value: float64(data.Sensors.Conductivity) * factorConductivity,
+			Desc:   descs.Conductivity,
+			Value:  data.Conductivity,
+			Field:  "conductivity",
+			Labels: core,
 		},
 		{
-			Desc:  lightDesc,
-			Value: float64(data.Sensors.Light),
+			Desc:   descs.Light,
+			Value:  data.Light,
+			Field:  "light",
+			Labels: core,
 		},
 		{
-			Desc:  moistureDesc,
-			Value: float64(data.Sensors.Moisture),
+			Desc:   descs.Moisture,
+			Value:  data.Moisture,
+			Field:  "moisture",
+			Labels: core,
 		},
 		{
-			Desc:  temperatureDesc,
-			Value: data.Sensors.Temperature,
+			Desc:   descs.Temperature,
+			Value:  data.Temperature,
+			Field:  "temperature",
+			Labels: coreTemperature,
+		},
+		{
+			Desc:  descs.Humidity,
+			Value: data.Humidity,
+			Field: "humidity",
+		},
+		{
+			Desc:  descs.BatteryVoltage,
+			Value: data.BatteryVoltage,
+			Field: "battery_voltage",
+		},
+		{
+			Desc:   descs.RSSI,
+			Value:  data.RSSI,
+			Field:  "rssi",
+			Labels: rssiLabels,
+		},
+		{
+			Desc:  descs.Compensated,
+			Value: data.ConductivityCompensated,
+			Field: "conductivity_compensated",
 		},
 	} {
-		c.sendMetric(ch, metric.Desc, metric.Value, labels)
+		if metric.Value == nil {
+			continue
+		}
+
+		metricLabels := labels
+		if metric.Labels != nil {
+			metricLabels = metric.Labels
+		}
+
+		c.sendMetric(ch, metric.Desc, c.convert(metric.Field, *metric.Value), metricLabels)
 	}
 }
 
 func (c *Flowercare) sendMetric(ch chan<- prometheus.Metric, desc *prometheus.Desc, value float64, labels []string) {
-	m, err := prometheus.NewConstMetric(desc, prometheus.GaugeValue, value, labels...)
+	c.send(ch, desc, prometheus.GaugeValue, value, labels)
+}
+
+func (c *Flowercare) send(ch chan<- prometheus.Metric, desc *prometheus.Desc, valueType prometheus.ValueType, value float64, labels []string) {
+	m, err := prometheus.NewConstMetric(desc, valueType, value, labels...)
 	if err != nil {
 		c.Log.Errorf("can not create metric %q: %s", desc, err)
 		return
@@ -165,3 +809,30 @@ func (c *Flowercare) sendMetric(ch chan<- prometheus.Metric, desc *prometheus.De
 
 	ch <- m
 }
+
+// coreLabels returns the label values of the metrics also exported by the upstream exporter. In the compatibility
+// mode, they only carry the MAC address and the name.
+func (c *Flowercare) coreLabels(labels []string) []string {
+	if c.Compat != config.CompatXperimental {
+		return labels
+	}
+
+	return labels[:len(upstreamLabelNames):len(upstreamLabelNames)]
+}
+
+// convert returns the value in the unit selected for it, rounded to the selected precision.
+func (c *Flowercare) convert(field string, value float64) float64 {
+	unit := field
+	if field == "conductivity_compensated" {
+		unit = "conductivity"
+	}
+	value *= c.Units.Unit(unit).Factor
+
+	places, ok := c.Units.Precision[field]
+	if !ok {
+		return value
+	}
+
+	scale := math.Pow(10, float64(places))
+	return math.Round(value*scale) / scale
+}
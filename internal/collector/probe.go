@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+// scrapeTimeoutOffset is subtracted from the scrape timeout sent by Prometheus, so that the response arrives before
+// Prometheus gives up.
+const scrapeTimeoutOffset = 500 * time.Millisecond
+
+var (
+	probeSuccessDesc = prometheus.NewDesc(
+		MetricPrefix+"probe_success",
+		"Contains 1 if the sensor could be read during the probe.",
+		nil, nil)
+	probeDurationDesc = prometheus.NewDesc(
+		MetricPrefix+"probe_duration_seconds",
+		"Time it took to read the sensor during the probe.",
+		nil, nil)
+)
+
+// ProbeFunc reads the sensor with the MAC address and returns the sensor together with its values.
+type ProbeFunc func(ctx context.Context, macAddress string) (config.Sensor, driver.Reading, error)
+
+// metricList is a collector returning a fixed list of metrics.
+type metricList []prometheus.Metric
+
+// Describe implements prometheus.Collector
+func (l metricList) Describe(chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector
+func (l metricList) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range l {
+		ch <- m
+	}
+}
+
+// ProbeHandler returns a handler implementing the multi-target exporter pattern. The sensor passed using the target
+// parameter is read during the request and its values are returned as metrics. Reading the sensor is stopped after
+// the timeout or the scrape timeout of Prometheus, whichever is shorter.
+func (c *Flowercare) ProbeHandler(probe ProbeFunc, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := r.URL.Query().Get("target")
+		if _, err := net.ParseMAC(target); err != nil {
+			http.Error(w, "target needs to be the MAC address of a sensor", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), probeTimeout(r, timeout))
+		defer cancel()
+
+		start := time.Now()
+		sensor, data, err := probe(ctx, strings.ToUpper(target))
+		duration := time.Since(start)
+
+		metrics := make(chan prometheus.Metric, len(driver.FieldNames)+3)
+		success := 0.0
+		if err != nil {
+			c.Log.Debugf("Probing %q failed: %s", target, err)
+		} else {
+			success = 1
+			labels, temperatureLabels := c.sensorLabels(sensor)
+			core := c.coreLabels(labels)
+			c.sendMetric(metrics, c.descriptors().Info, 1, append(core[:len(core):len(core)], data.Firmware))
+			c.collectData(metrics, data, labels, temperatureLabels)
+		}
+		c.sendMetric(metrics, probeSuccessDesc, success, nil)
+		c.sendMetric(metrics, probeDurationDesc, duration.Seconds(), nil)
+		close(metrics)
+
+		var list metricList
+		for m := range metrics {
+			list = append(list, m)
+		}
+
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(list)
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})
+}
+
+// probeTimeout returns the time available for reading the sensor.
+func probeTimeout(r *http.Request, timeout time.Duration) time.Duration {
+	seconds, err := strconv.ParseFloat(r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"), 64)
+	if err != nil || seconds <= 0 {
+		return timeout
+	}
+
+	scrapeTimeout := time.Duration(seconds*float64(time.Second)) - scrapeTimeoutOffset
+	if scrapeTimeout > 0 && scrapeTimeout < timeout {
+		return scrapeTimeout
+	}
+
+	return timeout
+}
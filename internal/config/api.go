@@ -0,0 +1,237 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// Scope defines what a token is allowed to do with the control API. Each scope includes the permissions of the
+// scopes before it.
+type Scope string
+
+const (
+	// ScopeRead allows reading the sensors and their data.
+	ScopeRead Scope = "read"
+	// ScopeTrigger additionally allows triggering reads of sensors.
+	ScopeTrigger Scope = "trigger"
+	// ScopeAdmin additionally allows changing the configuration, for example adding and removing sensors.
+	ScopeAdmin Scope = "admin"
+)
+
+var scopeLevels = map[Scope]int{
+	ScopeRead:    1,
+	ScopeTrigger: 2,
+	ScopeAdmin:   3,
+}
+
+// Allows returns true if the scope includes the permissions of the required scope.
+func (s Scope) Allows(required Scope) bool {
+	return scopeLevels[s] >= scopeLevels[required]
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (s *Scope) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	if _, ok := scopeLevels[Scope(value)]; !ok {
+		return fmt.Errorf("unknown scope: %q", value)
+	}
+
+	*s = Scope(value)
+	return nil
+}
+
+// APIConfig contains the configuration of the control API.
+type APIConfig struct {
+	Enabled   bool
+	TokenFile string
+	Tokens    []APIToken
+	// WriteSensors writes sensors added or removed using the API back to the sensor directory.
+	WriteSensors bool
+	// Backups is the number of previous versions kept of every changed sensor file.
+	Backups int
+	// GitCommit commits every change to the sensor directory, which needs to be inside a Git repository.
+	GitCommit bool
+	// OIDC contains the settings for accepting the tokens of an OpenID Connect provider.
+	OIDC OIDCConfig
+	// ProxyAuth contains the settings for trusting the users authenticated by a proxy.
+	ProxyAuth ProxyAuthConfig
+	// GroupScopes maps the groups of users authenticated using OpenID Connect or a proxy to scopes. Users get the
+	// highest scope of their groups and are rejected if none of their groups is mapped.
+	GroupScopes map[string]Scope
+}
+
+// OIDCConfig contains the settings for accepting the tokens of an OpenID Connect provider.
+type OIDCConfig struct {
+	// Issuer is the URL of the provider. Tokens are only accepted if it is set.
+	Issuer string
+	// ClientID is the audience the tokens need to be issued for.
+	ClientID string
+	// UserClaim is the claim containing the name of the user.
+	UserClaim string
+	// GroupsClaim is the claim containing the groups of the user.
+	GroupsClaim string
+}
+
+// ProxyAuthConfig contains the settings for trusting the users authenticated by a proxy in front of the exporter.
+type ProxyAuthConfig struct {
+	// UserHeader is the header containing the name of the user. Disabled if it is empty.
+	UserHeader string
+	// GroupsHeader is the header containing the comma-separated groups of the user.
+	GroupsHeader string
+	// TrustedProxies are the networks the headers are accepted from. Requests from other addresses are only
+	// authenticated using tokens, so that clients can not pretend to be any user.
+	TrustedProxies []string
+
+	trusted []*net.IPNet
+}
+
+// Trusts returns true if the headers of requests from the address can be trusted.
+func (p ProxyAuthConfig) Trusts(ip net.IP) bool {
+	for _, n := range p.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Scope returns the highest scope of the groups. It returns false if none of the groups is mapped to a scope.
+func (c APIConfig) Scope(groups []string) (Scope, bool) {
+	var result Scope
+	for _, g := range groups {
+		if s, ok := c.GroupScopes[g]; ok && scopeLevels[s] > scopeLevels[result] {
+			result = s
+		}
+	}
+
+	return result, result != ""
+}
+
+func (c *APIConfig) validate() error {
+	if c.OIDC.Issuer != "" {
+		if !strings.HasPrefix(c.OIDC.Issuer, "https://") {
+			return fmt.Errorf("OpenID Connect issuer needs to use HTTPS: %s", c.OIDC.Issuer)
+		}
+
+		if c.OIDC.ClientID == "" {
+			return errors.New("need a client ID for accepting OpenID Connect tokens")
+		}
+
+		if c.OIDC.UserClaim == "" {
+			return errors.New("need a claim containing the user for accepting OpenID Connect tokens")
+		}
+	}
+
+	if c.ProxyAuth.UserHeader != "" {
+		if len(c.ProxyAuth.TrustedProxies) == 0 {
+			return errors.New("need the trusted proxies for accepting users authenticated by a proxy")
+		}
+
+		c.ProxyAuth.trusted = nil
+		for _, value := range c.ProxyAuth.TrustedProxies {
+			if !strings.Contains(value, "/") {
+				if strings.Contains(value, ":") {
+					value += "/128"
+				} else {
+					value += "/32"
+				}
+			}
+
+			_, n, err := net.ParseCIDR(value)
+			if err != nil {
+				return fmt.Errorf("can not parse trusted proxy: %s", err)
+			}
+			c.ProxyAuth.trusted = append(c.ProxyAuth.trusted, n)
+		}
+	}
+
+	if c.TokenFile == "" && c.OIDC.Issuer == "" && c.ProxyAuth.UserHeader == "" {
+		return errors.New("need to provide a token file, an OpenID Connect issuer or a proxy user header when the control API is enabled")
+	}
+
+	if (c.OIDC.Issuer != "" || c.ProxyAuth.UserHeader != "") && len(c.GroupScopes) == 0 {
+		return errors.New("need to map groups to scopes for users authenticated using OpenID Connect or a proxy")
+	}
+
+	return nil
+}
+
+func parseGroupScopes(values map[string]string) (map[string]Scope, error) {
+	result := map[string]Scope{}
+	for group, value := range values {
+		scope := Scope(value)
+		if _, ok := scopeLevels[scope]; !ok {
+			return nil, fmt.Errorf("unknown scope for group %q: %s", group, value)
+		}
+		result[group] = scope
+	}
+
+	return result, nil
+}
+
+// APIToken is a token which can be used to access the control API.
+type APIToken struct {
+	// Name identifies the token in logs without revealing it.
+	Name  string `json:"name"`
+	Token string `json:"token"`
+	Scope Scope  `json:"scope"`
+	// User restricts the token to the sensors owned by the user. Tokens without a user can access all sensors.
+	User string `json:"user"`
+}
+
+// Allows returns true if the token can access the sensor.
+func (t APIToken) Allows(sensor Sensor) bool {
+	return t.User == "" || sensor.OwnedBy(t.User)
+}
+
+func readTokens(fileName string) ([]APIToken, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var tokens []APIToken
+	if err := json.NewDecoder(file).Decode(&tokens); err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return nil, errors.New("need at least one token")
+	}
+
+	seen := map[string]bool{}
+	for i, t := range tokens {
+		if len(t.Name) == 0 {
+			return nil, fmt.Errorf("token %d has no name", i)
+		}
+
+		if len(t.Token) < 16 {
+			return nil, fmt.Errorf("token %q needs to be at least 16 characters long", t.Name)
+		}
+
+		if len(t.Scope) == 0 {
+			return nil, fmt.Errorf("token %q has no scope", t.Name)
+		}
+
+		if len(t.User) != 0 && t.Scope.Allows(ScopeAdmin) {
+			return nil, fmt.Errorf("token %q of user %q can not have scope %q", t.Name, t.User, ScopeAdmin)
+		}
+
+		if seen[t.Token] {
+			return nil, fmt.Errorf("token %q is not unique", t.Name)
+		}
+		seen[t.Token] = true
+	}
+
+	return tokens, nil
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/xperimental/flowercare-exporter/internal/feature"
+)
+
+// BackfillConfig contains the settings for pushing the history of sensors to a Prometheus remote-write endpoint.
+type BackfillConfig struct {
+	// URL is the remote-write endpoint. Backfilling is disabled if it is empty.
+	URL       string
+	TokenFile string
+	// Token is read from TokenFile. No authorization is sent if it is empty.
+	Token string
+	// MinGap is the minimum time without a reading of a sensor which is filled using its history.
+	MinGap time.Duration
+	// Labels are added to all series, for example the job and instance labels added by Prometheus when scraping.
+	Labels map[string]string
+}
+
+func (b *BackfillConfig) validate(features feature.Set) error {
+	if b.URL == "" {
+		return nil
+	}
+
+	if !features.Enabled(feature.HistoryDownload) {
+		return fmt.Errorf("backfilling needs the history of the sensors, enable it using --enable-feature=%s", feature.HistoryDownload)
+	}
+
+	if b.MinGap < time.Hour {
+		return fmt.Errorf("minimum gap for backfilling needs to be at least one hour: %s", b.MinGap)
+	}
+
+	for name := range b.Labels {
+		if name == "" || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("invalid label name for backfilling: %q", name)
+		}
+	}
+
+	if b.TokenFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(b.TokenFile)
+	if err != nil {
+		return fmt.Errorf("can not read backfill token: %s", err)
+	}
+
+	b.Token = strings.TrimSpace(string(data))
+	if b.Token == "" {
+		return errors.New("backfill token file is empty")
+	}
+
+	return nil
+}
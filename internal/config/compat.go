@@ -0,0 +1,27 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CompatXperimental exports the metrics shared with the upstream exporter github.com/xperimental/flowercare-exporter
+// using its names and labels.
+const CompatXperimental = "xperimental"
+
+// validateCompat checks the compatibility mode and the settings which would change the names of the shared metrics.
+func (c Config) validateCompat() error {
+	switch c.Compat {
+	case "":
+		return nil
+	case CompatXperimental:
+	default:
+		return fmt.Errorf("unknown compatibility mode %q, needs to be %q", c.Compat, CompatXperimental)
+	}
+
+	if len(c.Units.Units) > 0 {
+		return errors.New("--metric-unit changes the names of metrics shared with the upstream exporter, it can not be used with --compat")
+	}
+
+	return nil
+}
@@ -1,16 +1,28 @@
 package config
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
+	// The time zone database is embedded, because containers often do not contain it.
+	_ "time/tzdata"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+	"github.com/xperimental/flowercare-exporter/internal/egress"
+	"github.com/xperimental/flowercare-exporter/internal/feature"
+	"github.com/xperimental/flowercare-exporter/internal/logging"
 )
 
 type SensorList []Sensor
@@ -37,6 +49,7 @@ func (s *SensorList) Set(value string) error {
 		return fmt.Errorf("can not parse sensor: %s", err)
 	}
 
+	sensor.Source = sourceFlag
 	*s = append(*s, sensor)
 	return nil
 }
@@ -45,28 +58,133 @@ type Sensor struct {
 	Name         string `json:"name"`
 	MacAddress   string `json:"sensor"`
 	Type         string `json:"type"`
+	Driver       string `json:"driver"`
+	Key          string `json:"key"`
+	Group        string `json:"group"`
+	Quirks       Quirks `json:"quirks"`
+	Placement    string `json:"placement"`
+	Mode         string `json:"mode"`
 	MaxSoilMoist int    `json:"-"`
 	MinSoilMoist int    `json:"-"`
 	MaxSoilEc    int    `json:"-"`
 	MinSoilEc    int    `json:"-"`
 	MaxLightLux  int    `json:"-"`
 	MinLightLux  int    `json:"-"`
+
+	// Species identifies the plant, using the identifiers of the Flower Care plant database.
+	Species string `json:"pid"`
+	// ScientificName is the botanical name of the plant, including the cultivar.
+	ScientificName string `json:"display_pid"`
+	// CommonName is the name the plant is commonly known by.
+	CommonName string `json:"common_name"`
+	// Position is the location of the sensor on a floor or greenhouse plan, used for the heatmap.
+	Position *Position `json:"position"`
+	// Owners contains the users the plant is assigned to. Tokens and notification channels of other users do
+	// not see the sensor.
+	Owners []string `json:"owners"`
+	// Discovered is set for sensors which have been found by scanning instead of being configured.
+	Discovered bool `json:"-"`
+	// Source describes where the sensor has been configured, for example the sensor file it has been read from.
+	Source string `json:"-"`
 }
 
-func (s *Sensor) UnmarshalJSON(data []byte) error {
-	var raw struct {
-		Name       string `json:"name"`
-		MacAddress string `json:"sensor"`
-		Type       string `json:"type"`
-		Parameter  struct {
-			MaxSoilMoist int `json:"max_soil_moist"`
-			MinSoilMoist int `json:"min_soil_moist"`
-			MaxSoilEc    int `json:"max_soil_ec"`
-			MinSoilEc    int `json:"min_soil_ec"`
-			MaxLightLux  int `json:"max_light_lux"`
-			MinLightLux  int `json:"min_light_lux"`
-		} `json:"parameter"`
+// Quirks contains per-sensor corrections, which override the built-in quirk table.
+type Quirks struct {
+	// Disable turns off the built-in corrections for this sensor.
+	Disable bool `json:"disable,omitempty"`
+	// Scale contains factors applied to the values, by value name.
+	Scale map[string]float64 `json:"scale,omitempty"`
+	// Offset contains offsets added to the values after scaling, by value name.
+	Offset map[string]float64 `json:"offset,omitempty"`
+	// IgnoreBattery drops the battery values of the sensor, overriding the built-in table if set.
+	IgnoreBattery *bool `json:"ignore_battery,omitempty"`
+}
+
+// Position is a location on a plan. The units are arbitrary, but need to be the same for all sensors. Y grows
+// downwards, like on a screen.
+type Position struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+func (q Quirks) orNil() *Quirks {
+	if !q.Disable && len(q.Scale) == 0 && len(q.Offset) == 0 && q.IgnoreBattery == nil {
+		return nil
+	}
+
+	return &q
+}
+
+func (q Quirks) validate() error {
+	for _, values := range []map[string]float64{q.Scale, q.Offset} {
+		for name := range values {
+			var r driver.Reading
+			if r.Field(name) == nil {
+				return fmt.Errorf("unknown value in quirks: %s", name)
+			}
+		}
 	}
+
+	return nil
+}
+
+type sensorParameter struct {
+	MaxSoilMoist int `json:"max_soil_moist"`
+	MinSoilMoist int `json:"min_soil_moist"`
+	MaxSoilEc    int `json:"max_soil_ec"`
+	MinSoilEc    int `json:"min_soil_ec"`
+	MaxLightLux  int `json:"max_light_lux"`
+	MinLightLux  int `json:"min_light_lux"`
+}
+
+type sensorJSON struct {
+	Name       string          `json:"name"`
+	MacAddress string          `json:"sensor"`
+	Type       string          `json:"type"`
+	Driver     string          `json:"driver,omitempty"`
+	Key        string          `json:"key,omitempty"`
+	Group      string          `json:"group,omitempty"`
+	Quirks     *Quirks         `json:"quirks,omitempty"`
+	Placement  string          `json:"placement,omitempty"`
+	Mode       string          `json:"mode,omitempty"`
+	Species    string          `json:"pid,omitempty"`
+	Scientific string          `json:"display_pid,omitempty"`
+	CommonName string          `json:"common_name,omitempty"`
+	Position   *Position       `json:"position,omitempty"`
+	Owners     []string        `json:"owners,omitempty"`
+	Parameter  sensorParameter `json:"parameter"`
+}
+
+// MarshalJSON writes the sensor using the same structure as the sensor JSON files.
+func (s Sensor) MarshalJSON() ([]byte, error) {
+	return json.Marshal(sensorJSON{
+		Name:       s.Name,
+		MacAddress: s.MacAddress,
+		Type:       s.Type,
+		Driver:     s.Driver,
+		Key:        s.Key,
+		Group:      s.Group,
+		Quirks:     s.Quirks.orNil(),
+		Placement:  s.Placement,
+		Mode:       s.Mode,
+		Species:    s.Species,
+		Scientific: s.ScientificName,
+		CommonName: s.CommonName,
+		Position:   s.Position,
+		Owners:     s.Owners,
+		Parameter: sensorParameter{
+			MaxSoilMoist: s.MaxSoilMoist,
+			MinSoilMoist: s.MinSoilMoist,
+			MaxSoilEc:    s.MaxSoilEc,
+			MinSoilEc:    s.MinSoilEc,
+			MaxLightLux:  s.MaxLightLux,
+			MinLightLux:  s.MinLightLux,
+		},
+	})
+}
+
+func (s *Sensor) UnmarshalJSON(data []byte) error {
+	var raw sensorJSON
 	// Set the default value for Type before unmarshalling
 	raw.Type = "normie"
 	if err := json.Unmarshal(data, &raw); err != nil {
@@ -76,6 +194,19 @@ func (s *Sensor) UnmarshalJSON(data []byte) error {
 	s.Name = raw.Name
 	s.MacAddress = raw.MacAddress
 	s.Type = raw.Type // Assign the Type, which will be "normie" if not provided in JSON
+	s.Driver = raw.Driver
+	s.Key = raw.Key
+	s.Group = raw.Group
+	if raw.Quirks != nil {
+		s.Quirks = *raw.Quirks
+	}
+	s.Placement = raw.Placement
+	s.Mode = raw.Mode
+	s.Species = raw.Species
+	s.ScientificName = raw.Scientific
+	s.CommonName = raw.CommonName
+	s.Position = raw.Position
+	s.Owners = raw.Owners
 	s.MaxSoilMoist = raw.Parameter.MaxSoilMoist
 	s.MinSoilMoist = raw.Parameter.MinSoilMoist
 	s.MaxSoilEc = raw.Parameter.MaxSoilEc
@@ -106,12 +237,166 @@ func readSensorsFromDir(dirPath string, log logrus.FieldLogger) ([]Sensor, error
 				log.Printf("Error unmarshalling JSON from file %s: %v", filePath, err)
 				continue
 			}
+			sensor.Source = sensorFileSource(filePath)
 			sensors = append(sensors, sensor)
 		}
 	}
 	return sensors, nil
 }
 
+// LoadSensors reads the configured sensors again from the flags, the sensor directory and the configuration file.
+func (c Config) LoadSensors(log logrus.FieldLogger) ([]Sensor, error) {
+	dirSensors, err := c.readSensorDir(log)
+	if err != nil {
+		return nil, fmt.Errorf("error reading sensors from directory: %s", err)
+	}
+
+	var fileSensors []Sensor
+	if len(c.ConfigFile) != 0 {
+		fileSensors, err = readFileSensors(c.ConfigFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading configuration file: %s", err)
+		}
+	}
+
+	sensors, overrides, errs := mergeSensors(c.flagSensors, dirSensors, fileSensors)
+	if len(errs) > 0 {
+		return nil, &ValidationError{Problems: errs}
+	}
+	for _, o := range overrides {
+		log.Warn(o.warning())
+	}
+
+	for _, s := range sensors {
+		if err := c.validateSensor(s); err != nil {
+			return nil, fmt.Errorf("sensor %s: %s", s, err)
+		}
+	}
+
+	return sensors, nil
+}
+
+// validateSensor checks the sensor and whether the features it needs are enabled.
+func (c Config) validateSensor(s Sensor) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	if s.Mode == ModePassive && !c.Features.Enabled(feature.PassiveMode) {
+		return fmt.Errorf("mode %q is experimental, enable it using --enable-feature=%s", ModePassive, feature.PassiveMode)
+	}
+
+	return nil
+}
+
+// DriverOptions returns the device-specific settings passed to the driver of the sensor.
+func (s Sensor) DriverOptions() driver.Options {
+	key, _ := hex.DecodeString(s.Key)
+	return driver.Options{
+		Key: key,
+	}
+}
+
+// Placements of a sensor, describing where the temperature is measured. The placement is empty if unknown.
+const (
+	// PlacementBuried is used for sensors whose temperature probe is buried in the soil.
+	PlacementBuried = "buried"
+	// PlacementSurface is used for sensors measuring the temperature of the air above the soil.
+	PlacementSurface = "surface"
+)
+
+// TemperatureMeasurement returns what the temperature of the sensor describes, "soil" or "air", based on its
+// placement. It is empty if the placement is not configured.
+func (s Sensor) TemperatureMeasurement() string {
+	switch s.Placement {
+	case PlacementBuried:
+		return "soil"
+	case PlacementSurface:
+		return "air"
+	default:
+		return ""
+	}
+}
+
+// Validate checks that the driver and options of the sensor are valid.
+func (s Sensor) Validate() error {
+	switch s.Placement {
+	case "", PlacementBuried, PlacementSurface:
+	default:
+		return fmt.Errorf("unknown placement %q, needs to be %q or %q", s.Placement, PlacementBuried, PlacementSurface)
+	}
+
+	d, err := driver.Get(s.Driver)
+	if err != nil {
+		return err
+	}
+
+	switch s.Mode {
+	case "":
+	case ModeActive:
+		if d.Read == nil {
+			return fmt.Errorf("driver %s only supports mode %q", d.Name, ModePassive)
+		}
+	case ModePassive:
+		if d.Decode == nil {
+			return fmt.Errorf("driver %s only supports mode %q", d.Name, ModeActive)
+		}
+	default:
+		return fmt.Errorf("unknown mode %q, needs to be %q or %q", s.Mode, ModeActive, ModePassive)
+	}
+
+	key, err := hex.DecodeString(s.Key)
+	if err != nil {
+		return fmt.Errorf("key is not hex-encoded: %s", err)
+	}
+
+	if len(key) != 0 && len(key) != keyLength {
+		return fmt.Errorf("key needs to be %d bytes, got %d", keyLength, len(key))
+	}
+
+	if p := s.Position; p != nil && !(isFinite(p.X) && isFinite(p.Y)) {
+		return fmt.Errorf("position needs finite coordinates: %v, %v", p.X, p.Y)
+	}
+
+	return s.Quirks.validate()
+}
+
+// OwnedBy returns true if the plant is assigned to the user.
+func (s Sensor) OwnedBy(user string) bool {
+	for _, owner := range s.Owners {
+		if owner == user {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// keyLength is the length of the AES-128 keys used for decrypting the data sent by the devices.
+const keyLength = 16
+
+// Modes of reading a sensor.
+const (
+	// ModeActive connects to the sensor for reading it. It is the default for drivers supporting it.
+	ModeActive = "active"
+	// ModePassive decodes the values from the advertisements of the sensor.
+	ModePassive = "passive"
+)
+
+// Passive reports whether the sensor is read from its advertisements instead of connecting to it.
+func (s Sensor) Passive() bool {
+	d, err := driver.Get(s.Driver)
+	if err != nil || d.Decode == nil {
+		return false
+	}
+
+	return d.Read == nil || s.Mode == ModePassive
+}
+
 func (s Sensor) String() string {
 	if s.Name == "" {
 		return s.MacAddress
@@ -138,6 +423,25 @@ func parseSensor(value string) (Sensor, error) {
 	}, nil
 }
 
+// LogLevels contains the log levels of the modules.
+type LogLevels struct {
+	logging.Levels
+}
+
+func (l *LogLevels) Type() string {
+	return "levels"
+}
+
+func (l *LogLevels) Set(val string) error {
+	levels, err := logging.ParseLevels(val)
+	if err != nil {
+		return err
+	}
+
+	l.Levels = levels
+	return nil
+}
+
 type LogLevel logrus.Level
 
 func (l *LogLevel) Type() string {
@@ -159,15 +463,350 @@ func (l *LogLevel) Set(val string) error {
 }
 
 type Config struct {
-	LogLevel        LogLevel
-	ListenAddr      string
-	Sensors         SensorList
-	Device          string
+	LogLevel   LogLevels
+	ListenAddr string
+	// Web contains the settings of the HTTP server.
+	Web     WebConfig
+	Sensors SensorList
+	// Devices contains the Bluetooth adapters used for reading the sensors.
+	Devices         []string
 	RefreshDuration time.Duration
 	RefreshTimeout  time.Duration
 	StaleDuration   time.Duration
+	StaleDurations  map[string]time.Duration
 	Retry           RetryConfig
 	SensorDir       string
+	Edge            EdgeConfig
+	Scan            ScanConfig
+	ESPHome         ESPHomeConfig
+	Probe           ProbeConfig
+	Discover        bool
+	LegacyLabels    bool
+	Compat          string
+	BLE             BLEConfig
+	Dump            DumpConfig
+	Privsep         PrivsepConfig
+	Sandbox         bool
+	API             APIConfig
+	Egress          egress.Policy
+	Anonymize       AnonymizeConfig
+	ErrorLogWindow  time.Duration
+	EventLogSize    int
+	Features        feature.Set
+	Notify          NotifyConfig
+	// BatteryWindow is the duration of battery levels used for predicting the depletion. Zero disables the prediction.
+	BatteryWindow time.Duration
+	// EnergyEstimate enables estimating the energy used by the sensors from the connections to them.
+	EnergyEstimate bool
+	// ForecastWindow is the maximum duration of moisture values used for the forecast. Zero disables the forecast.
+	ForecastWindow   time.Duration
+	ForecastHorizons []time.Duration
+	// DryRateWindow is the duration over which the dry-out rate is calculated.
+	DryRateWindow time.Duration
+	// WateringThreshold is the increase of the moisture between two readings detected as watering.
+	WateringThreshold float64
+	// PhotoperiodLux is the light level above which the time is counted for the photoperiod. Zero disables it.
+	PhotoperiodLux float64
+	// Histograms contains the values recorded as histograms resetting at midnight.
+	Histograms []string
+	// TrendWindow is the duration of daily values used for detecting the degradation of sensors. Zero disables it.
+	TrendWindow time.Duration
+	// ExtremesWindow is the duration over which the lowest and highest values are exported. Zero disables them.
+	ExtremesWindow time.Duration
+	// Timezone is the name of the time zone used for the boundaries of days. The local time zone is used if empty.
+	Timezone string
+	// Location is the time zone loaded from Timezone.
+	Location *time.Location `json:"-"`
+	// FirmwareInterval is the interval in which the firmware version and battery level are read. Zero reads them with
+	// every read.
+	FirmwareInterval time.Duration
+	// StateFile keeps the reliability statistics and latest readings of the sensors across restarts if set.
+	StateFile string
+	// Daemon starts the exporter in the background and exits once it is ready.
+	Daemon  bool
+	PIDFile string
+	LogFile string
+	// WaitForFirstRead delays reporting the exporter as ready until a sensor has been read, for at most this duration.
+	WaitForFirstRead time.Duration
+	// WaitForFirstReadExit exits the exporter if no sensor could be read within WaitForFirstRead.
+	WaitForFirstReadExit bool
+	// StartupPing scans for the advertisements of the sensors on startup for at most this duration, to check that they
+	// are in range. Zero disables the ping.
+	StartupPing time.Duration
+	// RequireAllSensors exits the exporter if a sensor has not been heard during the StartupPing.
+	RequireAllSensors bool
+	// WatchSensorDir reloads the sensors when files in the sensor directory are added, changed or removed.
+	WatchSensorDir bool
+	// WatchDebounce is the time waited after the last change in the sensor directory before reloading.
+	WatchDebounce time.Duration
+	// ConcurrentReads is the maximum number of sensors read at the same time.
+	ConcurrentReads int
+	// RefreshSpread spreads the reads of the sensors evenly across the refresh interval instead of reading all at once.
+	RefreshSpread bool
+	// RefreshJitter is the maximum random delay added to the reads of every refresh.
+	RefreshJitter time.Duration
+	// ShutdownTimeout is the time allowed for finishing reads and HTTP responses after a shutdown signal.
+	ShutdownTimeout time.Duration
+	// Resources contains the memory limits of the exporter.
+	Resources ResourceConfig
+	Pipeline  PipelineConfig
+	Grafana   GrafanaConfig
+	MQTT      MQTTConfig
+	Backfill  BackfillConfig
+	InfluxDB  InfluxDBConfig
+	OTLP      OTLPConfig
+	Rounding  RoundingConfig
+	Units     UnitsConfig
+	Handoff   HandoffConfig
+	// ConfigFile is the YAML file the configuration has been read from, if any.
+	ConfigFile string
+	// Deprecations contains the deprecated settings in use.
+	Deprecations []Deprecation
+
+	// flagSensors contains the sensors passed using flags.
+	flagSensors SensorList
+	// sensorDirSet is true if the sensor directory has been set explicitly instead of using the default.
+	sensorDirSet bool
+	// sensorOverrides contains the sensors which are configured in more than one source.
+	sensorOverrides []SensorOverride
+}
+
+// AnonymizeConfig contains the settings for replacing identifying information with pseudonyms.
+type AnonymizeConfig struct {
+	Enabled bool
+	// Key is used for deriving the pseudonyms.
+	Key string
+}
+
+const redacted = "<redacted>"
+
+// Redacted returns a copy of the sensor with the key removed.
+func (s Sensor) Redacted() Sensor {
+	if s.Key != "" {
+		s.Key = redacted
+	}
+
+	return s
+}
+
+// Redacted returns a copy of the configuration with all secrets removed, which can be shared.
+func (c Config) Redacted() Config {
+	sensors := make([]Sensor, len(c.Sensors))
+	for i, s := range c.Sensors {
+		sensors[i] = s.Redacted()
+	}
+	c.Sensors = sensors
+
+	tokens := make([]APIToken, len(c.API.Tokens))
+	for i, t := range c.API.Tokens {
+		t.Token = redacted
+		tokens[i] = t
+	}
+	c.API.Tokens = tokens
+
+	if c.Anonymize.Key != "" {
+		c.Anonymize.Key = redacted
+	}
+
+	if c.Grafana.Token != "" {
+		c.Grafana.Token = redacted
+	}
+
+	if c.MQTT.Password != "" {
+		c.MQTT.Password = redacted
+	}
+
+	if c.Backfill.Token != "" {
+		c.Backfill.Token = redacted
+	}
+
+	if c.InfluxDB.Token != "" {
+		c.InfluxDB.Token = redacted
+	}
+
+	if len(c.OTLP.Headers) > 0 {
+		headers := make(map[string]string, len(c.OTLP.Headers))
+		for k := range c.OTLP.Headers {
+			headers[k] = redacted
+		}
+		c.OTLP.Headers = headers
+	}
+
+	if c.Web.BearerToken != "" {
+		c.Web.BearerToken = redacted
+	}
+
+	if len(c.Web.BasicAuthUsers) > 0 {
+		users := make(map[string]string, len(c.Web.BasicAuthUsers))
+		for user := range c.Web.BasicAuthUsers {
+			users[user] = redacted
+		}
+		c.Web.BasicAuthUsers = users
+	}
+
+	if c.Edge.PushToken != "" {
+		c.Edge.PushToken = redacted
+	}
+
+	if u, err := url.Parse(c.Edge.PushURL); err == nil && u.User != nil {
+		u.User = url.User(redacted)
+		c.Edge.PushURL = u.String()
+	}
+
+	// Webhook URLs and headers often contain credentials, only keep the host.
+	channels := make([]NotifyChannel, len(c.Notify.Channels))
+	for i, ch := range c.Notify.Channels {
+		if u, err := url.Parse(ch.URL); err == nil {
+			ch.URL = u.Scheme + "://" + u.Host + "/" + redacted
+		}
+
+		headers := make(map[string]string, len(ch.Headers))
+		for k := range ch.Headers {
+			headers[k] = redacted
+		}
+		ch.Headers = headers
+		channels[i] = ch
+	}
+	c.Notify.Channels = channels
+
+	return c
+}
+
+// EgressDestinations returns all outbound connections configured.
+func (c Config) EgressDestinations() []egress.Destination {
+	var result []egress.Destination
+	if c.Edge.PushURL != "" {
+		result = append(result, egress.Destination{
+			Feature: "edge push",
+			URL:     c.Edge.PushURL,
+		})
+	}
+
+	if c.Grafana.URL != "" {
+		result = append(result, egress.Destination{
+			Feature: "grafana annotations",
+			URL:     c.Grafana.URL,
+		})
+	}
+
+	if c.MQTT.Broker != "" {
+		result = append(result, egress.Destination{
+			Feature: "mqtt",
+			URL:     c.MQTT.Broker,
+		})
+	}
+
+	if c.Backfill.URL != "" {
+		result = append(result, egress.Destination{
+			Feature: "backfill",
+			URL:     c.Backfill.URL,
+		})
+	}
+
+	if c.InfluxDB.URL != "" {
+		result = append(result, egress.Destination{
+			Feature: "influxdb",
+			URL:     c.InfluxDB.URL,
+		})
+	}
+
+	if c.OTLP.Endpoint != "" {
+		result = append(result, egress.Destination{
+			Feature: "otlp",
+			URL:     c.OTLP.Endpoint,
+		})
+	}
+
+	for _, addr := range c.ESPHome.Proxies {
+		result = append(result, egress.Destination{
+			Feature: "esphome proxy",
+			URL:     "esphome://" + addr,
+		})
+	}
+
+	if c.API.Enabled && c.API.OIDC.Issuer != "" {
+		result = append(result, egress.Destination{
+			Feature: "openid connect",
+			URL:     c.API.OIDC.Issuer,
+		})
+	}
+
+	for _, ch := range c.Notify.Channels {
+		result = append(result, egress.Destination{
+			Feature: "notification channel " + ch.Name,
+			URL:     ch.URL,
+		})
+	}
+
+	return result
+}
+
+// PrivsepConfig contains the settings for running the Bluetooth operations in a separate process.
+type PrivsepConfig struct {
+	// WorkerSocket is the path of the socket of an already running worker.
+	WorkerSocket string
+	// User is the unprivileged user the exporter switches to after starting its own worker.
+	User string
+}
+
+// WorkerConfig contains the configuration of the BLE worker process.
+type WorkerConfig struct {
+	LogLevel LogLevel
+	Socket   string
+	// SocketUser is the owner of the socket, so that an unprivileged exporter can connect to it.
+	SocketUser string
+	Device     string
+	BLE        BLEConfig
+	Dump       DumpConfig
+	Sandbox    bool
+}
+
+// DumpConfig contains the settings for writing the raw data received from the devices to files.
+type DumpConfig struct {
+	// Dir is the directory the dumps are written to. Dumping is disabled if it is empty.
+	Dir string
+	// Interval is the minimum time between two dumps of the same kind of data of a device.
+	Interval time.Duration
+}
+
+// BLEConfig contains advanced Bluetooth LE parameters used when scanning and connecting.
+type BLEConfig struct {
+	ConnIntervalMin    time.Duration
+	ConnIntervalMax    time.Duration
+	SupervisionTimeout time.Duration
+	ScanInterval       time.Duration
+	ScanWindow         time.Duration
+	// AddressType is either "public" or "random".
+	AddressType string
+}
+
+// ScanConfig contains the settings for listening to advertisements of passive sensors.
+type ScanConfig struct {
+	Interval time.Duration
+	Duration time.Duration
+}
+
+// ProbeConfig contains the settings of the endpoint reading sensors on demand during a scrape.
+type ProbeConfig struct {
+	Enabled bool
+	Timeout time.Duration
+}
+
+// EdgeConfig contains the settings for pushing readings to an aggregator and for receiving them.
+type EdgeConfig struct {
+	PushURL string
+	// PushTokenFile contains the bearer token sent to the aggregator.
+	PushTokenFile string
+	// PushToken is read from PushTokenFile. No authorization is sent if it is empty, unless the URL contains a user
+	// and password for basic authentication.
+	PushToken    string
+	NodeID       string
+	BufferSize   int
+	PushInterval time.Duration
+	PushTimeout  time.Duration
+	Aggregator   bool
+	// MaxAge is the age after which readings are not pushed anymore. Zero pushes all readings.
+	MaxAge time.Duration
 }
 
 type RetryConfig struct {
@@ -176,76 +815,1120 @@ type RetryConfig struct {
 	Factor      float64
 }
 
+// ValidationError is returned by Parse when the configuration is invalid. It contains every problem found.
+type ValidationError struct {
+	Problems []error
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Problems) == 1 {
+		return e.Problems[0].Error()
+	}
+
+	messages := make([]string, 0, len(e.Problems))
+	for _, p := range e.Problems {
+		messages = append(messages, p.Error())
+	}
+
+	return fmt.Sprintf("%d problems: %s", len(e.Problems), strings.Join(messages, "; "))
+}
+
+// Parse parses the command line of the exporter. Problems of the configuration are returned as ValidationError.
 func Parse(log logrus.FieldLogger) (Config, error) {
+	return parse(log, pflag.CommandLine, os.Args[1:])
+}
+
+// ParseArgs parses the arguments of the exporter like Parse, but without using the global flags, so that the
+// configuration can be read again while the exporter is running.
+func ParseArgs(log logrus.FieldLogger, args []string) (Config, error) {
+	fs := pflag.NewFlagSet(os.Args[0], pflag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return parse(log, fs, args)
+}
+
+func parse(log logrus.FieldLogger, fs *pflag.FlagSet, args []string) (Config, error) {
 	result := Config{
-		LogLevel:        LogLevel(logrus.InfoLevel),
-		ListenAddr:      ":9294",
-		Device:          "hci0",
-		SensorDir:       "sensorData",
-		RefreshDuration: 2 * time.Minute,
-		RefreshTimeout:  time.Minute,
-		StaleDuration:   5 * time.Minute,
+		LogLevel: LogLevels{
+			Levels: logging.Levels{
+				Default: logrus.InfoLevel,
+			},
+		},
+		ListenAddr:        ":9294",
+		Devices:           []string{"hci0"},
+		SensorDir:         DefaultSensorDir(),
+		WatchDebounce:     2 * time.Second,
+		ConcurrentReads:   1,
+		RefreshDuration:   2 * time.Minute,
+		RefreshTimeout:    time.Minute,
+		ShutdownTimeout:   10 * time.Second,
+		FirmwareInterval:  time.Hour,
+		StaleDuration:     5 * time.Minute,
+		ErrorLogWindow:    10 * time.Minute,
+		EventLogSize:      100,
+		BatteryWindow:     30 * 24 * time.Hour,
+		ForecastWindow:    72 * time.Hour,
+		WateringThreshold: 5,
+		DryRateWindow:     6 * time.Hour,
+		PhotoperiodLux:    1000,
+		TrendWindow:       28 * 24 * time.Hour,
+		ExtremesWindow:    24 * time.Hour,
+		ForecastHorizons: []time.Duration{
+			12 * time.Hour,
+			24 * time.Hour,
+		},
 		Retry: RetryConfig{
 			MinDuration: 30 * time.Second,
 			MaxDuration: 30 * time.Minute,
 			Factor:      2,
 		},
+		API: APIConfig{
+			Backups: 5,
+			OIDC: OIDCConfig{
+				UserClaim:   "preferred_username",
+				GroupsClaim: "groups",
+			},
+		},
+		Probe: ProbeConfig{
+			Timeout: 30 * time.Second,
+		},
+		Rounding: RoundingConfig{
+			Outputs: []string{RoundingMetrics},
+		},
+		Grafana: GrafanaConfig{
+			Events: DefaultGrafanaEvents,
+		},
+		Backfill: BackfillConfig{
+			MinGap: 2 * time.Hour,
+		},
+		InfluxDB: InfluxDBConfig{
+			Measurement:   "flowercare",
+			BatchSize:     500,
+			BufferSize:    10000,
+			FlushInterval: 10 * time.Second,
+			Timeout:       10 * time.Second,
+		},
+		OTLP: OTLPConfig{
+			Protocol: OTLPProtocolHTTP,
+			Interval: time.Minute,
+			Timeout:  10 * time.Second,
+		},
+		Handoff: HandoffConfig{
+			Timeout: time.Minute,
+		},
+		MQTT: MQTTConfig{
+			Topic:               DefaultMQTTTopic,
+			HomeAssistantPrefix: DefaultHomeAssistantPrefix,
+		},
+		Edge: EdgeConfig{
+			BufferSize:   10000,
+			PushInterval: 10 * time.Second,
+			PushTimeout:  10 * time.Second,
+		},
+	}
+	result.Edge.NodeID, _ = os.Hostname()
+	result.BLE = defaultBLEConfig()
+	result.Dump = defaultDumpConfig()
+	result.Scan = ScanConfig{
+		Interval: time.Minute,
+		Duration: 10 * time.Second,
+	}
+	result.ESPHome = ESPHomeConfig{
+		DiscoveryInterval: 5 * time.Minute,
+	}
+
+	fs.StringVarP(&result.SensorDir, "sensordir", "z", result.SensorDir, "Directory containing sensor JSON files.")
+	fs.BoolVar(&result.WatchSensorDir, "watch-sensordir", result.WatchSensorDir, "Reload the sensors when JSON files in the sensor directory are added, changed or removed.")
+	fs.DurationVar(&result.WatchDebounce, "watch-debounce", result.WatchDebounce, "Time to wait after the last change in the sensor directory before reloading the sensors.")
+	fs.VarP(&result.Sensors, "sensor", "s", "MAC-address of sensor to collect data from, optionally prefixed with \"name=\". Can be specified multiple times and overrides sensors with the same address in the sensor directory or configuration file.")
+	fs.Var(&result.LogLevel, "log-level", "Minimum log level to show. Can be overridden per module, for example \"info,ble=trace,http=warn\".")
+	fs.StringVarP(&result.ListenAddr, "addr", "a", result.ListenAddr, "Address to listen on for connections.")
+	fs.StringVar(&result.Web.File, "web.config.file", result.Web.File, "Web configuration file in the format of the Prometheus exporter-toolkit, for serving HTTPS with further TLS settings and requiring basic auth.")
+	fs.StringVar(&result.Web.TLS.CertFile, "web.tls-cert", result.Web.TLS.CertFile, "Certificate file for serving HTTPS. Renewed certificates are used without a restart.")
+	fs.StringVar(&result.Web.TLS.KeyFile, "web.tls-key", result.Web.TLS.KeyFile, "Key file of the certificate for serving HTTPS.")
+	fs.StringVar(&result.Web.TLS.ClientCAFile, "web.tls-client-ca", result.Web.TLS.ClientCAFile, "File containing the certificate authorities of the client certificates. Clients need a valid certificate if set.")
+	fs.StringVar(&result.Web.BearerTokenFile, "web.bearer-token-file", result.Web.BearerTokenFile, "File containing a bearer token needed for accessing the endpoints, except the control API which uses its own tokens.")
+	fs.BoolVar(&result.Web.EnableLifecycle, "web.enable-lifecycle", result.Web.EnableLifecycle, "Enable reloading and shutting down the exporter using the /-/reload and /-/quit endpoints.")
+	fs.StringSliceVarP(&result.Devices, "adapter", "i", result.Devices, "Bluetooth adapter to use for communication, selected by kernel name (hci0), MAC address or local name. Can be repeated to distribute the reads across several adapters.")
+	fs.DurationVarP(&result.RefreshDuration, "refresh-duration", "r", result.RefreshDuration, "Interval used for refreshing data from bluetooth devices.")
+	fs.DurationVar(&result.RefreshTimeout, "refresh-timeout", result.RefreshTimeout, "Timeout for reading data from a sensor.")
+	fs.BoolVar(&result.RefreshSpread, "refresh-spread", result.RefreshSpread, "Spread the reads of the sensors evenly across the refresh interval instead of reading all sensors at the start of the interval.")
+	fs.DurationVar(&result.RefreshJitter, "refresh-jitter", result.RefreshJitter, "Maximum random delay added to the read of every sensor, so that reads of several exporters do not happen at the same time.")
+	fs.IntVar(&result.ConcurrentReads, "max-concurrent-reads", result.ConcurrentReads, "Maximum number of sensors read at the same time. Reads using the same adapter wait for each other.")
+	fs.DurationVar(&result.FirmwareInterval, "firmware-read-interval", result.FirmwareInterval, "Interval in which the firmware version and battery level are read from sensors supporting it, to save battery. Zero reads them with every read.")
+	fs.DurationVar(&result.StaleDuration, "stale-duration", result.StaleDuration, "Duration after which data is considered stale and is not used for metrics anymore.")
+	fs.DurationVar(&result.ErrorLogWindow, "error-log-window", result.ErrorLogWindow, "Identical read errors of a sensor are only logged once in this window and then summarized. Zero logs every error.")
+	var staleDurations map[string]string
+	fs.StringToStringVar(&staleDurations, "stale-duration-override", nil, "Stale duration for single values, for example \"battery=24h\". Values: "+strings.Join(driver.FieldNames, ", "))
+	var maxAges map[string]string
+	fs.StringToStringVar(&maxAges, "max-age", nil, "Maximum age of the readings published by an output, older readings are skipped, for example \"mqtt=15m\". Outputs: "+strings.Join(MaxAgeOutputs, ", "))
+	var roundingSteps map[string]string
+	fs.StringToStringVar(&roundingSteps, "round", nil, "Round values to a step on the outputs selected using --round-outputs, for example \"moisture=5,temperature=0.5\". Values: "+strings.Join(driver.FieldNames, ", "))
+	var metricUnits map[string]string
+	fs.StringToStringVar(&metricUnits, "metric-unit", nil, "Unit of the exported metrics by value, which also changes the names of the metrics, for example \"light=klx,conductivity=us/cm\". Units: "+unitNames())
+	var metricPrecision map[string]string
+	fs.StringToStringVar(&metricPrecision, "metric-precision", nil, "Number of decimal places of the exported metrics after converting them to their unit, for example \"temperature=1,light=0\". Values: "+strings.Join(driver.FieldNames, ", "))
+	fs.StringSliceVar(&result.Rounding.Outputs, "round-outputs", result.Rounding.Outputs, "Outputs the values are rounded on, the other outputs keep the full precision. Outputs: "+strings.Join(RoundingOutputs, ", "))
+	fs.DurationVar(&result.Retry.MinDuration, "retry-min-duration", result.Retry.MinDuration, "Minimum wait time between retries on error.")
+	fs.DurationVar(&result.Retry.MaxDuration, "retry-max-duration", result.Retry.MaxDuration, "Maximum wait time between retries on error.")
+	fs.Float64Var(&result.Retry.Factor, "retry-factor", result.Retry.Factor, "Factor used to multiply wait time for subsequent retries.")
+	addBLEFlags(fs, &result.BLE)
+	addDumpFlags(fs, &result.Dump)
+	fs.StringVar(&result.Privsep.WorkerSocket, "ble-worker-socket", result.Privsep.WorkerSocket, "Path of the socket of a separately started BLE worker, which is used instead of a local adapter.")
+	fs.BoolVar(&result.Sandbox, "sandbox", result.Sandbox, "Restrict filesystem access and system calls of the exporter process (Linux only).")
+	fs.StringVar(&result.Privsep.User, "privsep-user", result.Privsep.User, "Start a privileged BLE worker process and run the exporter itself as this unprivileged user.")
+	fs.StringVar(&result.Compat, "compat", result.Compat, "Export the metrics shared with another exporter using its names and labels, so that its dashboards keep working. Modes: "+CompatXperimental)
+	fs.BoolVar(&result.LegacyLabels, "legacy-labels", result.LegacyLabels, "Omit the device_type, model and protocol labels from the metrics, for compatibility with existing dashboards.")
+	fs.DurationVar(&result.Scan.Interval, "scan-interval", result.Scan.Interval, "Interval between scans for advertisements of passive sensors.")
+	fs.DurationVar(&result.Scan.Duration, "scan-duration", result.Scan.Duration, "Duration of a single scan for advertisements.")
+	fs.BoolVar(&result.ESPHome.Discover, "esphome-discover", result.ESPHome.Discover, "Find ESPHome Bluetooth proxies in the local network using mDNS and receive the advertisements of passive sensors from them.")
+	fs.StringSliceVar(&result.ESPHome.Proxies, "esphome-proxy", result.ESPHome.Proxies, "Addresses of ESPHome Bluetooth proxies used in addition to the discovered ones, for example \"garden-proxy.local\". The port defaults to 6053.")
+	fs.DurationVar(&result.ESPHome.DiscoveryInterval, "esphome-discovery-interval", result.ESPHome.DiscoveryInterval, "Interval between searches for new ESPHome Bluetooth proxies.")
+	fs.BoolVar(&result.Probe.Enabled, "probe", result.Probe.Enabled, "Enable the /probe endpoint, which reads the sensor passed as target parameter during the scrape.")
+	fs.DurationVar(&result.Probe.Timeout, "probe-timeout", result.Probe.Timeout, "Maximum time for reading a sensor using the /probe endpoint. Shorter scrape timeouts sent by Prometheus take precedence.")
+	fs.BoolVar(&result.Discover, "discover", result.Discover, "Periodically scan for Flower Care devices and add them as sensors named after their MAC address.")
+	fs.StringVar(&result.Edge.PushURL, "edge-push-url", result.Edge.PushURL, "Base URL of an aggregator to push all readings to.")
+	fs.StringVar(&result.Edge.PushTokenFile, "edge-push-token-file", result.Edge.PushTokenFile, "File containing the bearer token sent to the aggregator.")
+	fs.StringVar(&result.Edge.NodeID, "edge-node-id", result.Edge.NodeID, "Identifier of this exporter used when pushing to an aggregator.")
+	fs.IntVar(&result.Edge.BufferSize, "edge-buffer-size", result.Edge.BufferSize, "Maximum number of readings buffered while the aggregator is unreachable.")
+	fs.DurationVar(&result.Edge.PushInterval, "edge-push-interval", result.Edge.PushInterval, "Interval between pushes to the aggregator.")
+	fs.DurationVar(&result.Edge.PushTimeout, "edge-push-timeout", result.Edge.PushTimeout, "Timeout for a single push to the aggregator.")
+	fs.BoolVar(&result.Edge.Aggregator, "aggregator", result.Edge.Aggregator, "Accept readings pushed by edge exporters.")
+	fs.BoolVar(&result.Egress.Disabled, "no-egress", result.Egress.Disabled, "Disable all outbound connections. Fails if any feature needing one is configured.")
+	fs.StringSliceVar(&result.Egress.Allow, "egress-allow", result.Egress.Allow, "Hosts outbound connections are allowed to, \"*.\" prefix matches subdomains. Allows all hosts if empty.")
+	fs.BoolVar(&result.Anonymize.Enabled, "anonymize", result.Anonymize.Enabled, "Replace MAC addresses and sensor names with stable pseudonyms in logs, metrics and the API, for sharing them publicly.")
+	fs.StringVar(&result.Anonymize.Key, "anonymize-key", result.Anonymize.Key, "Secret used for deriving the pseudonyms. Keeps them from being reversed by guessing MAC addresses.")
+	fs.StringVar(&result.Notify.File, "notify-config", result.Notify.File, "JSON file containing the notification channels for alerts. Notifications are disabled if empty.")
+	fs.DurationVar(&result.BatteryWindow, "battery-prediction-window", result.BatteryWindow, "Duration of battery levels used for predicting when a battery will be empty. Zero disables the prediction.")
+	fs.BoolVar(&result.EnergyEstimate, "energy-estimate", result.EnergyEstimate, "Estimate the energy used by every sensor per day from the connections to it, for tuning the refresh settings against the battery life.")
+	fs.DurationVar(&result.ForecastWindow, "moisture-forecast-window", result.ForecastWindow, "Maximum duration of moisture values since the last watering used for the moisture forecast. Zero disables the forecast.")
+	fs.DurationSliceVar(&result.ForecastHorizons, "moisture-forecast-horizons", result.ForecastHorizons, "Comma-separated list of durations after the last reading the moisture is forecast for.")
+	fs.DurationVar(&result.DryRateWindow, "dry-rate-window", result.DryRateWindow, "Duration of moisture values used for calculating the dry-out rate. Needs to be shorter than the moisture forecast window.")
+	fs.StringVar(&result.Timezone, "timezone", result.Timezone, "Time zone used for the boundaries of days, for example \"Europe/Berlin\". Defaults to the local time zone of the system.")
+	fs.StringSliceVar(&result.Histograms, "histograms", result.Histograms, "Values exported as histograms of the readings since midnight. Values: "+strings.Join(HistogramValues, ", "))
+	fs.Float64Var(&result.PhotoperiodLux, "photoperiod-lux", result.PhotoperiodLux, "Light level in lux above which the time is counted as light hours of the day. Zero disables the photoperiod.")
+	fs.DurationVar(&result.ExtremesWindow, "min-max-window", result.ExtremesWindow, "Duration over which the lowest and highest values of every sensor are exported. Zero disables them.")
+	fs.DurationVar(&result.TrendWindow, "trend-window", result.TrendWindow, "Duration of daily values used for detecting sensors which need maintenance. Zero disables the detection.")
+	fs.Float64Var(&result.WateringThreshold, "watering-threshold", result.WateringThreshold, "Increase of the soil moisture in percentage points between two readings, which is detected as watering.")
+	fs.BoolVar(&result.Daemon, "daemon", result.Daemon, "Start the exporter in the background and exit once it is ready, for init systems expecting daemons. Fails if the exporter does not start.")
+	fs.StringVar(&result.PIDFile, "pidfile", result.PIDFile, "File the process ID is written to once the exporter is ready. It is removed on shutdown.")
+	fs.DurationVar(&result.WaitForFirstRead, "wait-for-first-read", result.WaitForFirstRead, "Only report the exporter as ready once a sensor has been read successfully, waiting at most this duration. Zero reports it as ready right after starting.")
+	fs.BoolVar(&result.WaitForFirstReadExit, "wait-for-first-read-exit", result.WaitForFirstReadExit, "Exit with an error if no sensor could be read within --wait-for-first-read.")
+	fs.DurationVar(&result.StartupPing, "startup-ping", result.StartupPing, "Scan for the advertisements of the configured sensors on startup for at most this duration and report the sensors which are not in range. Zero disables the ping.")
+	fs.BoolVar(&result.RequireAllSensors, "require-all-sensors", result.RequireAllSensors, "Exit with an error if a sensor has not been heard during --startup-ping.")
+	fs.StringVar(&result.Handoff.Socket, "handoff-socket", result.Handoff.Socket, "Socket used for passing the readings and the schedule to a new exporter taking over, for example during an upgrade. A new exporter started with the same socket stops the running one and continues where it left off. Disabled if empty.")
+	fs.DurationVar(&result.Handoff.Timeout, "handoff-timeout", result.Handoff.Timeout, "Maximum time to wait for the running exporter to shut down when taking over.")
+	fs.DurationVar(&result.ShutdownTimeout, "shutdown-timeout", result.ShutdownTimeout, "Maximum time for finishing HTTP responses, stopping in-flight reads and closing the Bluetooth adapter when shutting down.")
+	fs.StringVar(&result.LogFile, "log-file", result.LogFile, "File the log is appended to instead of the standard error output. Needed for keeping the log when running as daemon.")
+	fs.StringVar(&result.StateFile, "state-file", result.StateFile, "File used for keeping the read statistics, recent errors and latest readings of the sensors across restarts. Disabled if empty.")
+	fs.IntVar(&result.EventLogSize, "event-log-size", result.EventLogSize, "Number of recent events kept in memory.")
+	fs.BoolVar(&result.API.Enabled, "api", result.API.Enabled, "Enable the control API.")
+	fs.StringVar(&result.API.TokenFile, "api-token-file", result.API.TokenFile, "JSON file containing the tokens and their scopes allowed to use the control API.")
+	fs.BoolVar(&result.API.WriteSensors, "api-write-sensors", result.API.WriteSensors, "Write sensors added or removed using the control API back to the sensor directory.")
+	fs.IntVar(&result.API.Backups, "api-write-backups", result.API.Backups, "Number of previous versions kept of every sensor file changed using the control API.")
+	fs.BoolVar(&result.API.GitCommit, "api-write-git", result.API.GitCommit, "Commit every change of the sensor directory made using the control API to its Git repository.")
+	fs.StringVar(&result.API.OIDC.Issuer, "api-oidc-issuer", result.API.OIDC.Issuer, "URL of an OpenID Connect provider whose tokens are accepted by the control API. Disabled if empty.")
+	fs.StringVar(&result.API.OIDC.ClientID, "api-oidc-client-id", result.API.OIDC.ClientID, "Client ID the OpenID Connect tokens need to be issued for.")
+	fs.StringVar(&result.API.OIDC.UserClaim, "api-oidc-user-claim", result.API.OIDC.UserClaim, "Claim of the OpenID Connect tokens containing the name of the user.")
+	fs.StringVar(&result.API.OIDC.GroupsClaim, "api-oidc-groups-claim", result.API.OIDC.GroupsClaim, "Claim of the OpenID Connect tokens containing the groups of the user.")
+	fs.StringVar(&result.API.ProxyAuth.UserHeader, "api-proxy-user-header", result.API.ProxyAuth.UserHeader, "Header containing the user authenticated by a proxy in front of the control API, for example \"X-Forwarded-User\". Disabled if empty.")
+	fs.StringVar(&result.API.ProxyAuth.GroupsHeader, "api-proxy-groups-header", result.API.ProxyAuth.GroupsHeader, "Header containing the comma-separated groups of the user authenticated by a proxy.")
+	fs.StringSliceVar(&result.API.ProxyAuth.TrustedProxies, "api-proxy-trusted", result.API.ProxyAuth.TrustedProxies, "Addresses or networks of the proxies whose user headers are trusted.")
+	var apiGroupScopes map[string]string
+	fs.StringToStringVar(&apiGroupScopes, "api-group-scope", nil, "Scopes of the users authenticated using OpenID Connect or a proxy by group, for example \"gardeners=trigger,it=admin\".")
+	fs.StringVar(&result.Grafana.URL, "grafana-url", result.Grafana.URL, "Base URL of Grafana to post events as annotations to. Disabled if empty.")
+	fs.StringVar(&result.Grafana.TokenFile, "grafana-token-file", result.Grafana.TokenFile, "File containing the service account token used for posting annotations to Grafana.")
+	fs.StringVar(&result.Grafana.DashboardUID, "grafana-dashboard-uid", result.Grafana.DashboardUID, "UID of the dashboard the annotations are added to. Annotations are added to the organization if empty.")
+	fs.StringSliceVar(&result.Grafana.Events, "grafana-events", result.Grafana.Events, "Comma-separated list of event types posted as annotations to Grafana.")
+	fs.StringVar(&result.Backfill.URL, "backfill-url", result.Backfill.URL, "Prometheus remote-write endpoint the history of sensors is pushed to after a gap in their readings. Disabled if empty.")
+	fs.StringVar(&result.Backfill.TokenFile, "backfill-token-file", result.Backfill.TokenFile, "File containing the bearer token used for the remote-write endpoint.")
+	fs.DurationVar(&result.Backfill.MinGap, "backfill-min-gap", result.Backfill.MinGap, "Minimum time without a reading of a sensor which is filled using the history of the sensor.")
+	fs.StringToStringVar(&result.Backfill.Labels, "backfill-label", result.Backfill.Labels, "Labels added to all backfilled series, for example \"job=flowercare\". Needs to match the labels added by Prometheus when scraping.")
+	fs.StringVar(&result.InfluxDB.URL, "influxdb-url", result.InfluxDB.URL, "Base URL of an InfluxDB v2 server every reading is written to, for example http://localhost:8086. Disabled if empty.")
+	fs.StringVar(&result.InfluxDB.Org, "influxdb-org", result.InfluxDB.Org, "InfluxDB organization owning the bucket.")
+	fs.StringVar(&result.InfluxDB.Bucket, "influxdb-bucket", result.InfluxDB.Bucket, "InfluxDB bucket the readings are written to.")
+	fs.StringVar(&result.InfluxDB.TokenFile, "influxdb-token-file", result.InfluxDB.TokenFile, "File containing the InfluxDB API token with write access to the bucket.")
+	fs.StringVar(&result.InfluxDB.Measurement, "influxdb-measurement", result.InfluxDB.Measurement, "Measurement the readings are written to.")
+	fs.IntVar(&result.InfluxDB.BatchSize, "influxdb-batch-size", result.InfluxDB.BatchSize, "Maximum number of readings written to InfluxDB in one request.")
+	fs.IntVar(&result.InfluxDB.BufferSize, "influxdb-buffer-size", result.InfluxDB.BufferSize, "Maximum number of readings buffered while InfluxDB is unreachable.")
+	fs.DurationVar(&result.InfluxDB.FlushInterval, "influxdb-flush-interval", result.InfluxDB.FlushInterval, "Interval between writes to InfluxDB.")
+	fs.DurationVar(&result.InfluxDB.Timeout, "influxdb-timeout", result.InfluxDB.Timeout, "Timeout for a single write to InfluxDB.")
+	fs.StringVar(&result.OTLP.Endpoint, "otlp-endpoint", result.OTLP.Endpoint, "Base URL of an OpenTelemetry collector the readings are exported to as metrics, for example http://localhost:4318. Disabled if empty.")
+	fs.StringVar(&result.OTLP.Protocol, "otlp-protocol", result.OTLP.Protocol, "Protocol used for exporting to the OpenTelemetry collector: "+OTLPProtocolHTTP+" or "+OTLPProtocolGRPC+".")
+	fs.StringToStringVar(&result.OTLP.Headers, "otlp-header", result.OTLP.Headers, "Headers sent to the OpenTelemetry collector, for example \"Authorization=Bearer ...\".")
+	fs.DurationVar(&result.OTLP.Interval, "otlp-interval", result.OTLP.Interval, "Interval between exports to the OpenTelemetry collector.")
+	fs.DurationVar(&result.OTLP.Timeout, "otlp-timeout", result.OTLP.Timeout, "Timeout for a single export to the OpenTelemetry collector.")
+	fs.StringVar(&result.MQTT.Broker, "mqtt-broker", result.MQTT.Broker, "URL of the MQTT broker every reading is published to, for example tcp://localhost:1883. Disabled if empty.")
+	fs.StringVar(&result.MQTT.ClientID, "mqtt-client-id", result.MQTT.ClientID, "Client ID used for connecting to the MQTT broker. Derived from the hostname if empty.")
+	fs.StringVar(&result.MQTT.Username, "mqtt-username", result.MQTT.Username, "Username used for connecting to the MQTT broker.")
+	fs.StringVar(&result.MQTT.PasswordFile, "mqtt-password-file", result.MQTT.PasswordFile, "File containing the password used for connecting to the MQTT broker.")
+	fs.StringVar(&result.MQTT.Topic, "mqtt-topic", result.MQTT.Topic, "Topic the readings are published to. {name} and {mac} are replaced with the name and MAC address of the sensor.")
+	fs.IntVar(&result.MQTT.QoS, "mqtt-qos", result.MQTT.QoS, "Quality of service of the published readings (0, 1 or 2).")
+	fs.BoolVar(&result.MQTT.Retain, "mqtt-retain", result.MQTT.Retain, "Publish the readings as retained messages, so that new subscribers receive the last reading immediately.")
+	fs.BoolVar(&result.MQTT.HomeAssistant, "mqtt-homeassistant", result.MQTT.HomeAssistant, "Publish Home Assistant discovery messages for the values of every sensor.")
+	fs.StringVar(&result.MQTT.HomeAssistantPrefix, "mqtt-homeassistant-prefix", result.MQTT.HomeAssistantPrefix, "Discovery prefix configured in Home Assistant.")
+	fs.StringVar(&result.MQTT.TLS.CAFile, "mqtt-tls-ca-file", result.MQTT.TLS.CAFile, "File containing the certificates used for verifying the MQTT broker. Uses the system certificates if empty.")
+	fs.StringVar(&result.MQTT.TLS.CertFile, "mqtt-tls-cert-file", result.MQTT.TLS.CertFile, "File containing the client certificate used for connecting to the MQTT broker.")
+	fs.StringVar(&result.MQTT.TLS.KeyFile, "mqtt-tls-key-file", result.MQTT.TLS.KeyFile, "File containing the key of the client certificate.")
+	fs.BoolVar(&result.MQTT.TLS.InsecureSkipVerify, "mqtt-tls-insecure-skip-verify", result.MQTT.TLS.InsecureSkipVerify, "Do not verify the certificate of the MQTT broker.")
+	fs.StringVar(&result.Pipeline.File, "pipeline-config", result.Pipeline.File, "JSON file containing the steps processing every reading. Only the calibration is applied if empty.")
+	fs.BoolVar(&result.Resources.Low, "low-resource", result.Resources.Low, "Reduce the memory used by the exporter for running on routers. Disables the battery prediction and shrinks buffers, unless they are set explicitly.")
+	fs.IntVar(&result.Resources.MemoryTargetMiB, "memory-target", result.Resources.MemoryTargetMiB, "Memory in MiB the exporter tries to stay below by collecting garbage more often. Zero disables the target. Defaults to 16 in low resource mode.")
+	var featureNames []string
+	fs.StringSliceVar(&featureNames, "enable-feature", nil, "Comma-separated list of experimental features to enable: "+strings.Join(feature.KnownNames(), ", "))
+	var configFile string
+	fs.StringVar(&configFile, configFlag, "", "YAML file containing the configuration. Flags passed on the command line override the settings of the file.")
+	registerRenamedFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return result, err
+	}
+	flagChanged := func(name string) bool {
+		f := fs.Lookup(name)
+		return f != nil && f.Changed
+	}
+
+	// Validation continues after a problem has been found, so that all problems can be reported at once.
+	var problems []error
+	problem := func(err error) {
+		problems = append(problems, err)
 	}
 
-	// if sensordir flag is passed in at runtime, use readSensorsFromDir to populate results.Sensors with that directory's contents
-	// otherwise use the sensors passed in using the -s flag
-	pflag.StringVarP(&result.SensorDir, "sensordir", "z", result.SensorDir, "Directory containing sensor JSON files.")
-	log.Printf("sensordir: %s", result.SensorDir)
+	// Missing sensors are not reported as separate problem if they could not be read.
+	var sensorsFailed bool
+	var fileSensors []Sensor
+	if len(configFile) != 0 {
+		var err error
+		fileSensors, err = loadFile(fs, configFile)
+		if err != nil {
+			problem(fmt.Errorf("error reading configuration file: %s", err))
+			sensorsFailed = true
+		}
+		result.ConfigFile = configFile
+	}
+	result.flagSensors = result.Sensors
+	var dirSensors []Sensor
 	if len(result.SensorDir) != 0 {
-		log.Infof("sensor directory: %s", result.SensorDir)
+		result.sensorDirSet = flagChanged("sensordir")
+		result.prepareSensorDir(log)
+		log.Infof("Sensor directory: %s", result.SensorDir)
 
-		sensors, err := readSensorsFromDir(result.SensorDir, log)
+		var err error
+		dirSensors, err = result.readSensorDir(log)
 		if err != nil {
-			log.Fatalf("Error reading sensors from directory: %s", err)
+			problem(fmt.Errorf("error reading sensors from directory: %s", err))
+			sensorsFailed = true
 		}
-		result.Sensors = sensors
-	} else {
-		pflag.VarP(&result.Sensors, "sensor", "s", "MAC-address of sensor to collect data from. Can be specified multiple times.")
+	}
 
+	sensors, overrides, errs := mergeSensors(result.flagSensors, dirSensors, fileSensors)
+	for _, err := range errs {
+		problem(err)
 	}
-	pflag.Var(&result.LogLevel, "log-level", "Minimum log level to show.")
-	pflag.StringVarP(&result.ListenAddr, "addr", "a", result.ListenAddr, "Address to listen on for connections.")
-	pflag.StringVarP(&result.Device, "adapter", "i", result.Device, "Bluetooth device to use for communication.")
-	pflag.DurationVarP(&result.RefreshDuration, "refresh-duration", "r", result.RefreshDuration, "Interval used for refreshing data from bluetooth devices.")
-	pflag.DurationVar(&result.RefreshTimeout, "refresh-timeout", result.RefreshTimeout, "Timeout for reading data from a sensor.")
-	pflag.DurationVar(&result.StaleDuration, "stale-duration", result.StaleDuration, "Duration after which data is considered stale and is not used for metrics anymore.")
-	pflag.DurationVar(&result.Retry.MinDuration, "retry-min-duration", result.Retry.MinDuration, "Minimum wait time between retries on error.")
-	pflag.DurationVar(&result.Retry.MaxDuration, "retry-max-duration", result.Retry.MaxDuration, "Maximum wait time between retries on error.")
-	pflag.Float64Var(&result.Retry.Factor, "retry-factor", result.Retry.Factor, "Factor used to multiply wait time for subsequent retries.")
-	pflag.Parse()
+	result.Sensors = sensors
+	result.sensorOverrides = overrides
+	result.Deprecations = result.deprecations(fs)
 
-	if len(result.Sensors) == 0 {
-		return result, errors.New("need to provide at least one sensor")
+	durations, err := parseStaleDurations(staleDurations, result.RefreshDuration)
+	if err != nil {
+		problem(err)
 	}
+	result.StaleDurations = durations
 
-	if len(result.Device) == 0 {
-		return result, errors.New("need to provide a bluetooth device")
+	ages, err := parseMaxAges(maxAges)
+	if err != nil {
+		problem(err)
 	}
+	result.MQTT.MaxAge = ages[MaxAgeMQTT]
+	result.Edge.MaxAge = ages[MaxAgeEdgePush]
+	result.InfluxDB.MaxAge = ages[MaxAgeInfluxDB]
 
-	if result.RefreshDuration < time.Minute {
-		log.Warnf("Refresh durations below one minute are discouraged: %s", result.RefreshDuration)
+	steps, err := parseRoundingSteps(roundingSteps)
+	if err != nil {
+		problem(err)
 	}
+	result.Rounding.Steps = steps
 
-	if result.StaleDuration < (2 * result.RefreshDuration) {
-		return result, fmt.Errorf("stale duration needs to be at least %d", 2*result.RefreshDuration)
+	units, err := parseMetricUnits(metricUnits)
+	if err != nil {
+		problem(err)
 	}
+	result.Units.Units = units
 
-	if result.Retry.MinDuration < 30*time.Second {
-		return result, fmt.Errorf("retry time needs to be at least thirty seconds: %s", result.Retry.MinDuration)
+	precision, err := parseMetricPrecision(metricPrecision)
+	if err != nil {
+		problem(err)
 	}
+	result.Units.Precision = precision
 
-	if result.Retry.MaxDuration < result.Retry.MinDuration {
-		return result, fmt.Errorf("maximum retry time needs to be larger or equal to minimum time: %s > %s", result.Retry.MinDuration, result.Retry.MaxDuration)
+	if result.Web.File != "" {
+		if result.Web.TLS.CertFile != "" || result.Web.TLS.KeyFile != "" || result.Web.TLS.ClientCAFile != "" {
+			problem(errors.New("TLS can be configured either using the web configuration file or the flags"))
+		}
+
+		file, err := readWebConfig(result.Web.File)
+		if err != nil {
+			problem(fmt.Errorf("error reading web configuration: %s", err))
+		}
+		result.Web.TLS = file.TLS
+		result.Web.BasicAuthUsers = file.BasicAuthUsers
 	}
 
-	if result.Retry.Factor < 1 {
-		return result, fmt.Errorf("retry factor needs to be equal or larger than one: %v", result.Retry.Factor)
+	if err := result.Web.validate(); err != nil {
+		problem(err)
 	}
 
-	return result, nil
+	if err := result.Rounding.validate(); err != nil {
+		problem(err)
+	}
+
+	if err := result.validateCompat(); err != nil {
+		problem(err)
+	}
+
+	features, err := feature.Parse(featureNames)
+	if err != nil {
+		problem(err)
+	}
+	result.Features = features
+
+	if result.Resources.Low {
+		if err := result.applyLowResource(flagChanged); err != nil {
+			problem(err)
+		}
+	}
+
+	if result.Resources.MemoryTargetMiB < 0 {
+		problem(fmt.Errorf("memory target can not be negative: %d", result.Resources.MemoryTargetMiB))
+	}
+
+	if len(result.Sensors) == 0 && !sensorsFailed && !result.Edge.Aggregator && !result.Discover && !result.Probe.Enabled {
+		problem(fmt.Errorf("no sensors configured: add sensor JSON files to the sensor directory %s, list them in the configuration file passed using --%s, pass them using --sensor, use --discover to find them or --probe to read them on demand", result.SensorDir, configFlag))
+	}
+
+	for _, s := range result.Sensors {
+		if err := result.validateSensor(s); err != nil {
+			problem(fmt.Errorf("sensor %s: %s", s, err))
+		}
+	}
+
+	if len(result.Privsep.WorkerSocket) != 0 && len(result.Privsep.User) != 0 {
+		problem(errors.New("can not use an external BLE worker and start an own worker at the same time"))
+	}
+
+	if len(result.Devices) == 0 && (len(result.Sensors) > 0 || result.Discover) {
+		problem(errors.New("need to provide a bluetooth device"))
+	}
+
+	seenDevices := map[string]bool{}
+	for _, d := range result.Devices {
+		if seenDevices[d] {
+			problem(fmt.Errorf("adapter specified more than once: %s", d))
+		}
+		seenDevices[d] = true
+	}
+
+	if len(result.Devices) > 1 && (result.Privsep.WorkerSocket != "" || result.Privsep.User != "") {
+		problem(errors.New("multiple adapters can not be used together with a BLE worker"))
+	}
+
+	if result.RefreshDuration < time.Minute {
+		log.Warnf("Refresh durations below one minute are discouraged: %s", result.RefreshDuration)
+	}
+
+	if result.StaleDuration < (2 * result.RefreshDuration) {
+		problem(fmt.Errorf("stale duration needs to be at least %d", 2*result.RefreshDuration))
+	}
+
+	if result.EventLogSize < 1 {
+		problem(fmt.Errorf("event log size needs to be at least one: %d", result.EventLogSize))
+	}
+
+	if result.FirmwareInterval < 0 {
+		problem(fmt.Errorf("firmware read interval can not be negative: %s", result.FirmwareInterval))
+	}
+
+	if result.WaitForFirstRead < 0 {
+		problem(fmt.Errorf("wait for first read can not be negative: %s", result.WaitForFirstRead))
+	}
+
+	if result.ShutdownTimeout <= 0 {
+		problem(fmt.Errorf("shutdown timeout needs to be positive: %s", result.ShutdownTimeout))
+	}
+
+	if result.WaitForFirstReadExit && result.WaitForFirstRead == 0 {
+		problem(errors.New("--wait-for-first-read-exit needs --wait-for-first-read"))
+	}
+
+	if result.StartupPing < 0 {
+		problem(fmt.Errorf("startup ping can not be negative: %s", result.StartupPing))
+	}
+
+	if result.RequireAllSensors && result.StartupPing == 0 {
+		problem(errors.New("--require-all-sensors needs --startup-ping"))
+	}
+
+	if result.ConcurrentReads < 1 {
+		problem(fmt.Errorf("maximum of concurrent reads needs to be at least 1: %d", result.ConcurrentReads))
+	}
+
+	if result.RefreshJitter < 0 || result.RefreshJitter >= result.RefreshDuration {
+		problem(fmt.Errorf("refresh jitter needs to be between zero and the refresh interval of %s: %s", result.RefreshDuration, result.RefreshJitter))
+	}
+
+	if result.WatchSensorDir {
+		if result.SensorDir == "" {
+			problem(errors.New("--watch-sensordir needs a sensor directory"))
+		}
+
+		if result.WatchDebounce <= 0 {
+			problem(fmt.Errorf("watch debounce needs to be positive: %s", result.WatchDebounce))
+		}
+	}
+
+	if result.ErrorLogWindow < 0 {
+		problem(fmt.Errorf("error log window can not be negative: %s", result.ErrorLogWindow))
+	}
+
+	if result.Daemon && result.LogFile == "" {
+		problem(errors.New("running as daemon needs a log file, use /dev/null for discarding the log"))
+	}
+
+	if result.BatteryWindow < 0 {
+		problem(fmt.Errorf("battery prediction window can not be negative: %s", result.BatteryWindow))
+	}
+
+	if result.WateringThreshold <= 0 {
+		problem(fmt.Errorf("watering threshold needs to be positive: %v", result.WateringThreshold))
+	}
+
+	if result.ForecastWindow < 0 {
+		problem(fmt.Errorf("moisture forecast window can not be negative: %s", result.ForecastWindow))
+	}
+
+	result.Location = time.Local
+	if result.Timezone != "" {
+		location, err := time.LoadLocation(result.Timezone)
+		if err != nil {
+			problem(fmt.Errorf("can not load time zone: %s", err))
+		}
+		result.Location = location
+	}
+
+	if err := validateHistograms(result.Histograms); err != nil {
+		problem(err)
+	}
+
+	if result.PhotoperiodLux < 0 {
+		problem(fmt.Errorf("photoperiod threshold can not be negative: %v", result.PhotoperiodLux))
+	}
+
+	if result.ExtremesWindow < 0 || (result.ExtremesWindow > 0 && result.ExtremesWindow < time.Hour) {
+		problem(fmt.Errorf("min-max window needs to be at least one hour: %s", result.ExtremesWindow))
+	}
+
+	if result.TrendWindow < 0 {
+		problem(fmt.Errorf("trend window can not be negative: %s", result.TrendWindow))
+	}
+
+	if result.ForecastWindow > 0 && (result.DryRateWindow <= 0 || result.DryRateWindow > result.ForecastWindow) {
+		problem(fmt.Errorf("dry-out rate window needs to be positive and not longer than the moisture forecast window: %s", result.DryRateWindow))
+	}
+
+	for _, h := range result.ForecastHorizons {
+		if h <= 0 {
+			problem(fmt.Errorf("moisture forecast horizon needs to be positive: %s", h))
+		}
+	}
+
+	if result.Retry.MinDuration < 30*time.Second {
+		problem(fmt.Errorf("retry time needs to be at least thirty seconds: %s", result.Retry.MinDuration))
+	}
+
+	if result.Retry.MaxDuration < result.Retry.MinDuration {
+		problem(fmt.Errorf("maximum retry time needs to be larger or equal to minimum time: %s > %s", result.Retry.MinDuration, result.Retry.MaxDuration))
+	}
+
+	if result.Retry.Factor < 1 {
+		problem(fmt.Errorf("retry factor needs to be equal or larger than one: %v", result.Retry.Factor))
+	}
+
+	if err := result.BLE.validate(); err != nil {
+		problem(err)
+	}
+
+	if result.Scan.Duration <= 0 || result.Scan.Duration > result.Scan.Interval {
+		problem(fmt.Errorf("scan duration needs to be positive and not longer than the interval: %s > %s", result.Scan.Duration, result.Scan.Interval))
+	}
+
+	if result.Probe.Enabled && result.Probe.Timeout <= 0 {
+		problem(fmt.Errorf("probe timeout needs to be positive: %s", result.Probe.Timeout))
+	}
+
+	if len(result.Edge.PushURL) != 0 {
+		if len(result.Edge.NodeID) == 0 {
+			problem(errors.New("need to provide a node identifier when pushing to an aggregator"))
+		}
+
+		if result.Edge.BufferSize < 1 {
+			problem(fmt.Errorf("edge buffer size needs to be at least one: %d", result.Edge.BufferSize))
+		}
+		result.Edge.PushURL = strings.TrimSuffix(result.Edge.PushURL, "/")
+
+		if len(result.Edge.PushTokenFile) != 0 {
+			data, err := os.ReadFile(result.Edge.PushTokenFile)
+			if err != nil {
+				problem(fmt.Errorf("can not read edge push token: %s", err))
+			}
+
+			result.Edge.PushToken = strings.TrimSpace(string(data))
+			if err == nil && result.Edge.PushToken == "" {
+				problem(errors.New("edge push token file is empty"))
+			}
+		}
+	}
+
+	if len(result.Notify.File) != 0 {
+		notify, err := readNotifyConfig(result.Notify.File)
+		if err != nil {
+			problem(fmt.Errorf("error reading notification configuration: %s", err))
+		}
+		result.Notify = notify
+	}
+
+	if len(result.Pipeline.File) != 0 {
+		pipeline, err := readPipelineConfig(result.Pipeline.File)
+		if err != nil {
+			problem(fmt.Errorf("error reading pipeline configuration: %s", err))
+		}
+		result.Pipeline = pipeline
+	} else {
+		result.Pipeline.Steps = DefaultPipeline
+	}
+
+	if err := result.Grafana.validate(); err != nil {
+		problem(err)
+	}
+
+	if err := result.MQTT.validate(); err != nil {
+		problem(err)
+	}
+
+	if err := result.Backfill.validate(result.Features); err != nil {
+		problem(err)
+	}
+
+	if err := result.InfluxDB.validate(); err != nil {
+		problem(err)
+	}
+
+	if err := result.OTLP.validate(); err != nil {
+		problem(err)
+	}
+
+	if err := result.Handoff.validate(); err != nil {
+		problem(err)
+	}
+
+	if err := result.ESPHome.validate(result.Features); err != nil {
+		problem(err)
+	}
+
+	if result.ESPHome.Discover && result.Egress.Disabled {
+		problem(errors.New("discovering ESPHome proxies needs outbound connections to them"))
+	}
+
+	for _, d := range result.EgressDestinations() {
+		if err := result.Egress.Check(d); err != nil {
+			problem(err)
+		}
+	}
+
+	if result.API.Enabled {
+		groupScopes, err := parseGroupScopes(apiGroupScopes)
+		if err != nil {
+			problem(err)
+		}
+		result.API.GroupScopes = groupScopes
+
+		if err := result.API.validate(); err != nil {
+			problem(err)
+		}
+
+		if len(result.API.TokenFile) != 0 {
+			tokens, err := readTokens(result.API.TokenFile)
+			if err != nil {
+				problem(fmt.Errorf("error reading API tokens: %s", err))
+			}
+			result.API.Tokens = tokens
+		}
+
+		if result.API.WriteSensors && result.SensorDir == "" {
+			problem(errors.New("need a sensor directory for writing sensors"))
+		}
+
+		if result.API.GitCommit && result.Sandbox {
+			problem(errors.New("committing sensor changes to Git can not be combined with the sandbox"))
+		}
+
+		if result.API.Backups < 0 {
+			problem(fmt.Errorf("number of backups can not be negative: %d", result.API.Backups))
+		}
+	}
+
+	if len(problems) > 0 {
+		return result, &ValidationError{Problems: problems}
+	}
+
+	return result, nil
+}
+
+func parseStaleDurations(values map[string]string, refreshDuration time.Duration) (map[string]time.Duration, error) {
+	result := map[string]time.Duration{}
+	for name, value := range values {
+		var r driver.Reading
+		if r.Field(name) == nil {
+			return nil, fmt.Errorf("unknown value for stale duration: %q", name)
+		}
+
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("can not parse stale duration of %s: %s", name, err)
+		}
+
+		if d < 2*refreshDuration {
+			return nil, fmt.Errorf("stale duration of %s needs to be at least %s", name, 2*refreshDuration)
+		}
+		result[name] = d
+	}
+
+	return result, nil
+}
+
+func defaultBLEConfig() BLEConfig {
+	return BLEConfig{
+		ConnIntervalMin:    7500 * time.Microsecond,
+		ConnIntervalMax:    7500 * time.Microsecond,
+		SupervisionTimeout: 720 * time.Millisecond,
+		ScanInterval:       2500 * time.Microsecond,
+		ScanWindow:         2500 * time.Microsecond,
+		AddressType:        "public",
+	}
+}
+
+func defaultDumpConfig() DumpConfig {
+	return DumpConfig{
+		Interval: time.Minute,
+	}
+}
+
+func addBLEFlags(fs *pflag.FlagSet, cfg *BLEConfig) {
+	fs.DurationVar(&cfg.ConnIntervalMin, "ble-conn-interval-min", cfg.ConnIntervalMin, "Advanced: Minimum connection interval (7.5ms to 4s).")
+	fs.DurationVar(&cfg.ConnIntervalMax, "ble-conn-interval-max", cfg.ConnIntervalMax, "Advanced: Maximum connection interval (7.5ms to 4s).")
+	fs.DurationVar(&cfg.SupervisionTimeout, "ble-supervision-timeout", cfg.SupervisionTimeout, "Advanced: Connection supervision timeout (100ms to 32s).")
+	fs.DurationVar(&cfg.ScanInterval, "ble-scan-interval", cfg.ScanInterval, "Advanced: Interval of the Bluetooth LE scan (2.5ms to 10.24s).")
+	fs.DurationVar(&cfg.ScanWindow, "ble-scan-window", cfg.ScanWindow, "Advanced: Window of the Bluetooth LE scan, needs to be smaller or equal to the scan interval.")
+	fs.StringVar(&cfg.AddressType, "ble-address-type", cfg.AddressType, "Advanced: Address type of the sensors, \"public\" or \"random\".")
+}
+
+func addDumpFlags(fs *pflag.FlagSet, cfg *DumpConfig) {
+	fs.StringVar(&cfg.Dir, "dump-raw-payloads", cfg.Dir, "Debug: Directory to write hex dumps of the raw characteristic data and advertisements of every sensor to. Disabled if empty.")
+	fs.DurationVar(&cfg.Interval, "dump-raw-interval", cfg.Interval, "Debug: Minimum time between two dumps of the same data of a sensor.")
+}
+
+// ParseWorker parses the arguments of the BLE worker process.
+func ParseWorker(args []string) (WorkerConfig, error) {
+	result := WorkerConfig{
+		LogLevel: LogLevel(logrus.InfoLevel),
+		Device:   "hci0",
+		BLE:      defaultBLEConfig(),
+		Dump:     defaultDumpConfig(),
+	}
+
+	fs := pflag.NewFlagSet("ble-worker", pflag.ContinueOnError)
+	fs.Var(&result.LogLevel, "log-level", "Minimum log level to show.")
+	fs.StringVar(&result.Socket, "socket", result.Socket, "Path of the socket to listen on.")
+	fs.StringVar(&result.SocketUser, "socket-user", result.SocketUser, "User owning the socket.")
+	fs.StringVarP(&result.Device, "adapter", "i", result.Device, "Bluetooth adapter to use for communication, selected by kernel name (hci0), MAC address or local name.")
+	fs.BoolVar(&result.Sandbox, "sandbox", result.Sandbox, "Restrict filesystem access and system calls of the worker process (Linux only).")
+	addBLEFlags(fs, &result.BLE)
+	addDumpFlags(fs, &result.Dump)
+	if err := fs.Parse(args); err != nil {
+		return result, err
+	}
+
+	if len(result.Socket) == 0 {
+		return result, errors.New("need to provide a socket path")
+	}
+
+	if len(result.Device) == 0 {
+		return result, errors.New("need to provide a bluetooth device")
+	}
+
+	return result, result.BLE.validate()
+}
+
+// BundleConfig contains the configuration of the bundle command.
+type BundleConfig struct {
+	URL    string
+	Token  string
+	Output string
+}
+
+// ParseBundle parses the arguments of the bundle command.
+func ParseBundle(args []string, now time.Time) (BundleConfig, error) {
+	result := BundleConfig{
+		URL:    "http://localhost:9294",
+		Token:  os.Getenv("FLOWERCARE_API_TOKEN"),
+		Output: fmt.Sprintf("flowercare-bundle-%s.tar.gz", now.Format("20060102-150405")),
+	}
+
+	fs := pflag.NewFlagSet("bundle", pflag.ContinueOnError)
+	fs.StringVar(&result.URL, "url", result.URL, "Base URL of the running exporter.")
+	fs.StringVar(&result.Token, "token", result.Token, "Control API token with admin scope. Can also be set using FLOWERCARE_API_TOKEN.")
+	fs.StringVarP(&result.Output, "output", "o", result.Output, "Path of the archive to create.")
+	if err := fs.Parse(args); err != nil {
+		return result, err
+	}
+
+	if len(result.Output) == 0 {
+		return result, errors.New("need to provide an output path")
+	}
+	result.URL = strings.TrimSuffix(result.URL, "/")
+
+	return result, nil
+}
+
+// HistoryConfig contains the configuration of the history command.
+type HistoryConfig struct {
+	URL        string
+	Token      string
+	MacAddress string
+	Format     string
+	Limit      int
+	Timeout    time.Duration
+}
+
+// ParseHistory parses the arguments of the history command. The MAC address of the sensor is the only positional
+// argument.
+func ParseHistory(args []string) (HistoryConfig, error) {
+	result := HistoryConfig{
+		URL:     "http://localhost:9294",
+		Token:   os.Getenv("FLOWERCARE_API_TOKEN"),
+		Format:  "csv",
+		Timeout: 10 * time.Minute,
+	}
+
+	fs := pflag.NewFlagSet("history", pflag.ContinueOnError)
+	fs.StringVar(&result.URL, "url", result.URL, "Base URL of the running exporter.")
+	fs.StringVar(&result.Token, "token", result.Token, "Control API token with trigger scope. Can also be set using FLOWERCARE_API_TOKEN.")
+	fs.StringVar(&result.Format, "format", result.Format, "Output format, either \"csv\" or \"json\".")
+	fs.IntVar(&result.Limit, "limit", result.Limit, "Maximum number of entries to read, starting with the most recent one. Zero reads all entries.")
+	fs.DurationVar(&result.Timeout, "timeout", result.Timeout, "Maximum time to wait for the download.")
+	if err := fs.Parse(args); err != nil {
+		return result, err
+	}
+
+	if fs.NArg() != 1 {
+		return result, errors.New("need to provide the MAC address of exactly one sensor")
+	}
+	result.MacAddress = fs.Arg(0)
+
+	switch {
+	case result.Format != "csv" && result.Format != "json":
+		return result, fmt.Errorf("unknown format: %s", result.Format)
+	case result.Limit < 0:
+		return result, fmt.Errorf("limit can not be negative: %d", result.Limit)
+	case result.Timeout <= 0:
+		return result, fmt.Errorf("timeout needs to be positive: %s", result.Timeout)
+	}
+	result.URL = strings.TrimSuffix(result.URL, "/")
+
+	return result, nil
+}
+
+// InventoryConfig contains the configuration of the inventory command.
+type InventoryConfig struct {
+	URL    string
+	Token  string
+	Format string
+}
+
+// ParseInventory parses the arguments of the inventory command.
+func ParseInventory(args []string) (InventoryConfig, error) {
+	result := InventoryConfig{
+		URL:    "http://localhost:9294",
+		Token:  os.Getenv("FLOWERCARE_API_TOKEN"),
+		Format: "json",
+	}
+
+	fs := pflag.NewFlagSet("inventory", pflag.ContinueOnError)
+	fs.StringVar(&result.URL, "url", result.URL, "Base URL of the running exporter, as reachable by Prometheus.")
+	fs.StringVar(&result.Token, "token", result.Token, "Control API token with read scope. Can also be set using FLOWERCARE_API_TOKEN.")
+	fs.StringVar(&result.Format, "format", result.Format, "Output format, either \"json\" or \"terraform\".")
+	if err := fs.Parse(args); err != nil {
+		return result, err
+	}
+
+	if fs.NArg() != 0 {
+		return result, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	if result.Format != "json" && result.Format != "terraform" {
+		return result, fmt.Errorf("unknown format: %s", result.Format)
+	}
+	result.URL = strings.TrimSuffix(result.URL, "/")
+
+	return result, nil
+}
+
+// ReadConfig contains the configuration of the read command.
+type ReadConfig struct {
+	Sensor Sensor
+	Device string
+	// WorkerSocket is the path of the socket of a running worker, which is used instead of the adapter if set.
+	WorkerSocket string
+	BLE          BLEConfig
+	Format       string
+	Timeout      time.Duration
+}
+
+// ParseRead parses the arguments of the read command. The MAC address of the sensor is the only positional argument.
+func ParseRead(args []string) (ReadConfig, error) {
+	result := ReadConfig{
+		Device:  "hci0",
+		BLE:     defaultBLEConfig(),
+		Format:  "table",
+		Timeout: time.Minute,
+	}
+
+	fs := pflag.NewFlagSet("read", pflag.ContinueOnError)
+	fs.StringVarP(&result.Device, "adapter", "i", result.Device, "Bluetooth adapter to use for communication, selected by kernel name (hci0), MAC address or local name.")
+	fs.StringVar(&result.WorkerSocket, "ble-worker-socket", result.WorkerSocket, "Path of the socket of a running BLE worker, which is used instead of a local adapter.")
+	fs.StringVar(&result.Sensor.Driver, "driver", result.Sensor.Driver, "Driver used for reading the sensor. Defaults to the driver of Flower Care sensors.")
+	fs.StringVar(&result.Sensor.Key, "key", result.Sensor.Key, "Hex-encoded key of sensors sending encrypted data.")
+	fs.StringVar(&result.Format, "format", result.Format, "Output format, either \"table\" or \"json\".")
+	fs.DurationVar(&result.Timeout, "timeout", result.Timeout, "Maximum time to wait for the reading.")
+	addBLEFlags(fs, &result.BLE)
+	if err := fs.Parse(args); err != nil {
+		return result, err
+	}
+
+	if fs.NArg() != 1 {
+		return result, errors.New("need to provide the MAC address of exactly one sensor")
+	}
+	result.Sensor.MacAddress = strings.ToUpper(fs.Arg(0))
+	result.Sensor.Name = result.Sensor.MacAddress
+
+	if _, err := net.ParseMAC(result.Sensor.MacAddress); err != nil {
+		return result, fmt.Errorf("invalid MAC address: %s", err)
+	}
+
+	if err := result.Sensor.Validate(); err != nil {
+		return result, err
+	}
+
+	switch {
+	case result.Sensor.Passive():
+		return result, fmt.Errorf("driver %s can not connect to sensors, it only decodes advertisements", result.Sensor.Driver)
+	case result.Format != "table" && result.Format != "json":
+		return result, fmt.Errorf("unknown format: %s", result.Format)
+	case result.Timeout <= 0:
+		return result, fmt.Errorf("timeout needs to be positive: %s", result.Timeout)
+	}
+
+	return result, result.BLE.validate()
+}
+
+// BlinkConfig contains the configuration of the blink command.
+type BlinkConfig struct {
+	Sensor Sensor
+	Device string
+	// WorkerSocket is the path of the socket of a running worker, which is used instead of the adapter if set.
+	WorkerSocket string
+	BLE          BLEConfig
+	Timeout      time.Duration
+}
+
+// ParseBlink parses the arguments of the blink command. The MAC address of the sensor is the only positional argument.
+// Blinking changes the state of the sensor, so it needs the actuation feature to be enabled.
+func ParseBlink(args []string) (BlinkConfig, error) {
+	result := BlinkConfig{
+		Device:  "hci0",
+		BLE:     defaultBLEConfig(),
+		Timeout: time.Minute,
+	}
+
+	var featureNames []string
+	fs := pflag.NewFlagSet("blink", pflag.ContinueOnError)
+	fs.StringVarP(&result.Device, "adapter", "i", result.Device, "Bluetooth adapter to use for communication, selected by kernel name (hci0), MAC address or local name.")
+	fs.StringVar(&result.WorkerSocket, "ble-worker-socket", result.WorkerSocket, "Path of the socket of a running BLE worker, which is used instead of a local adapter.")
+	fs.StringVar(&result.Sensor.Driver, "driver", result.Sensor.Driver, "Driver used for connecting to the sensor. Defaults to the driver of Flower Care sensors.")
+	fs.DurationVar(&result.Timeout, "timeout", result.Timeout, "Maximum time to wait for the sensor.")
+	fs.StringSliceVar(&featureNames, "enable-feature", nil, "Comma-separated list of experimental features to enable: "+strings.Join(feature.KnownNames(), ", "))
+	addBLEFlags(fs, &result.BLE)
+	if err := fs.Parse(args); err != nil {
+		return result, err
+	}
+
+	if fs.NArg() != 1 {
+		return result, errors.New("need to provide the MAC address of exactly one sensor")
+	}
+	result.Sensor.MacAddress = strings.ToUpper(fs.Arg(0))
+	result.Sensor.Name = result.Sensor.MacAddress
+
+	features, err := feature.Parse(featureNames)
+	if err != nil {
+		return result, err
+	}
+
+	if !features.Enabled(feature.Actuation) {
+		return result, fmt.Errorf("blinking changes the state of the sensor, enable it using --enable-feature=%s", feature.Actuation)
+	}
+
+	if _, err := net.ParseMAC(result.Sensor.MacAddress); err != nil {
+		return result, fmt.Errorf("invalid MAC address: %s", err)
+	}
+
+	if err := result.Sensor.Validate(); err != nil {
+		return result, err
+	}
+
+	d, err := driver.Get(result.Sensor.Driver)
+	if err != nil {
+		return result, err
+	}
+
+	switch {
+	case d.Blink == nil:
+		return result, fmt.Errorf("driver %s does not support blinking", d.Name)
+	case result.Timeout <= 0:
+		return result, fmt.Errorf("timeout needs to be positive: %s", result.Timeout)
+	}
+
+	return result, result.BLE.validate()
+}
+
+// ScanCommandConfig contains the configuration of the scan command.
+type ScanCommandConfig struct {
+	Device string
+	// WorkerSocket is the path of the socket of a running worker, which is used instead of the adapter if set.
+	WorkerSocket string
+	BLE          BLEConfig
+	Duration     time.Duration
+	// Firmware enables connecting to the found devices for reading their firmware version.
+	Firmware    bool
+	ReadTimeout time.Duration
+	Format      string
+	// SensorDir is the directory the found sensors are written to. Nothing is written if it is empty.
+	SensorDir string
+}
+
+// ParseScan parses the arguments of the scan command.
+func ParseScan(args []string) (ScanCommandConfig, error) {
+	result := ScanCommandConfig{
+		Device:      "hci0",
+		BLE:         defaultBLEConfig(),
+		Duration:    10 * time.Second,
+		Firmware:    true,
+		ReadTimeout: 30 * time.Second,
+		Format:      "table",
+	}
+
+	fs := pflag.NewFlagSet("scan", pflag.ContinueOnError)
+	fs.StringVarP(&result.Device, "adapter", "i", result.Device, "Bluetooth adapter to use for communication, selected by kernel name (hci0), MAC address or local name.")
+	fs.StringVar(&result.WorkerSocket, "ble-worker-socket", result.WorkerSocket, "Path of the socket of a running BLE worker, which is used instead of a local adapter.")
+	fs.DurationVarP(&result.Duration, "duration", "d", result.Duration, "Duration of the scan.")
+	fs.BoolVar(&result.Firmware, "firmware", result.Firmware, "Connect to every found device after the scan for reading its firmware version. Passive devices are not connected to.")
+	fs.DurationVar(&result.ReadTimeout, "read-timeout", result.ReadTimeout, "Maximum time for reading the firmware version of a single device.")
+	fs.StringVar(&result.Format, "format", result.Format, "Output format, either \"table\" or \"json\".")
+	fs.StringVar(&result.SensorDir, "write-sensordir", result.SensorDir, "Sensor directory the found devices are written to as JSON files, unless the directory already contains them.")
+	addBLEFlags(fs, &result.BLE)
+	if err := fs.Parse(args); err != nil {
+		return result, err
+	}
+
+	if fs.NArg() != 0 {
+		return result, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	switch {
+	case result.Duration <= 0:
+		return result, fmt.Errorf("scan duration needs to be positive: %s", result.Duration)
+	case result.ReadTimeout <= 0:
+		return result, fmt.Errorf("read timeout needs to be positive: %s", result.ReadTimeout)
+	case result.Format != "table" && result.Format != "json":
+		return result, fmt.Errorf("unknown format: %s", result.Format)
+	}
+
+	if result.SensorDir != "" {
+		info, err := os.Stat(result.SensorDir)
+		if err != nil {
+			return result, fmt.Errorf("can not use sensor directory: %s", err)
+		}
+
+		if !info.IsDir() {
+			return result, fmt.Errorf("sensor directory is not a directory: %s", result.SensorDir)
+		}
+	}
+
+	return result, result.BLE.validate()
+}
+
+// WorkerArgs returns the arguments for starting a worker process using the same adapter settings.
+func (c Config) WorkerArgs(socket, socketUser string) []string {
+	return []string{
+		"ble-worker",
+		"--socket=" + socket,
+		"--socket-user=" + socketUser,
+		"--log-level=" + c.LogLevel.For(logging.ModuleBLE).String(),
+		"--adapter=" + strings.Join(c.Devices, ","),
+		"--ble-conn-interval-min=" + c.BLE.ConnIntervalMin.String(),
+		"--ble-conn-interval-max=" + c.BLE.ConnIntervalMax.String(),
+		"--ble-supervision-timeout=" + c.BLE.SupervisionTimeout.String(),
+		"--ble-scan-interval=" + c.BLE.ScanInterval.String(),
+		"--ble-scan-window=" + c.BLE.ScanWindow.String(),
+		"--ble-address-type=" + c.BLE.AddressType,
+		"--sandbox=" + strconv.FormatBool(c.Sandbox),
+		"--dump-raw-payloads=" + c.Dump.Dir,
+		"--dump-raw-interval=" + c.Dump.Interval.String(),
+	}
+}
+
+func (c BLEConfig) validate() error {
+	for _, r := range []struct {
+		Name  string
+		Value time.Duration
+		Min   time.Duration
+		Max   time.Duration
+	}{
+		{"connection interval minimum", c.ConnIntervalMin, 7500 * time.Microsecond, 4 * time.Second},
+		{"connection interval maximum", c.ConnIntervalMax, 7500 * time.Microsecond, 4 * time.Second},
+		{"supervision timeout", c.SupervisionTimeout, 100 * time.Millisecond, 32 * time.Second},
+		{"scan interval", c.ScanInterval, 2500 * time.Microsecond, 10240 * time.Millisecond},
+		{"scan window", c.ScanWindow, 2500 * time.Microsecond, 10240 * time.Millisecond},
+	} {
+		if r.Value < r.Min || r.Value > r.Max {
+			return fmt.Errorf("%s needs to be between %s and %s: %s", r.Name, r.Min, r.Max, r.Value)
+		}
+	}
+
+	if c.ConnIntervalMax < c.ConnIntervalMin {
+		return fmt.Errorf("maximum connection interval needs to be larger or equal to minimum: %s < %s", c.ConnIntervalMax, c.ConnIntervalMin)
+	}
+
+	if c.ScanWindow > c.ScanInterval {
+		return fmt.Errorf("scan window needs to be smaller or equal to scan interval: %s > %s", c.ScanWindow, c.ScanInterval)
+	}
+
+	// The supervision timeout needs to be larger than the maximum connection interval times two.
+	if c.SupervisionTimeout <= 2*c.ConnIntervalMax {
+		return fmt.Errorf("supervision timeout needs to be larger than twice the maximum connection interval: %s", c.SupervisionTimeout)
+	}
+
+	switch c.AddressType {
+	case "public", "random":
+	default:
+		return fmt.Errorf("unknown address type: %s", c.AddressType)
+	}
+
+	return nil
 }
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+// renamedFlag is a flag which has been renamed. The old name is still accepted on the command line and in the
+// configuration file and sets the flag using the new name.
+type renamedFlag struct {
+	Name      string
+	Shorthand string
+	// Replacement is the name of the flag replacing it.
+	Replacement string
+}
+
+// renamedFlags contains the flags which have been renamed. Entries are only removed once the old names have been
+// deprecated for a while.
+var renamedFlags = []renamedFlag{
+	// Used by the upstream exporter, the data is not cached anymore but refreshed in the background.
+	{Name: "cache-duration", Shorthand: "c", Replacement: "refresh-duration"},
+}
+
+// Deprecation describes a deprecated setting which is in use.
+type Deprecation struct {
+	// Setting is the deprecated flag or setting.
+	Setting string
+	// Replacement describes what to use instead.
+	Replacement string
+}
+
+func (d Deprecation) warning() Warning {
+	return Warning{
+		Problem:    fmt.Sprintf("%s is deprecated and will be removed in a future version.", d.Setting),
+		Suggestion: fmt.Sprintf("Use %s instead.", d.Replacement),
+	}
+}
+
+// registerRenamedFlags adds the old names of the renamed flags to the flag set. They share the value of the flag
+// replacing them and are hidden from the help.
+func registerRenamedFlags(fs *pflag.FlagSet) {
+	for _, r := range renamedFlags {
+		replacement := fs.Lookup(r.Replacement)
+		if replacement == nil {
+			continue
+		}
+
+		f := fs.VarPF(replacement.Value, r.Name, r.Shorthand, fmt.Sprintf("Deprecated, use --%s instead.", r.Replacement))
+		f.Hidden = true
+	}
+}
+
+// renamedChanged marks the old and new name of a renamed flag as changed if one of them has been changed, so that a
+// flag passed on the command line takes precedence over the configuration file using the other name.
+func renamedChanged(changed map[string]bool) {
+	for _, r := range renamedFlags {
+		if changed[r.Name] || changed[r.Replacement] {
+			changed[r.Name] = true
+			changed[r.Replacement] = true
+		}
+	}
+}
+
+// deprecations returns the deprecated settings in use.
+func (c Config) deprecations(fs *pflag.FlagSet) []Deprecation {
+	var result []Deprecation
+	for _, r := range renamedFlags {
+		if f := fs.Lookup(r.Name); f != nil && f.Changed {
+			result = append(result, Deprecation{
+				Setting:     "--" + r.Name,
+				Replacement: "--" + r.Replacement,
+			})
+		}
+	}
+
+	if c.SensorDir == legacySensorDir && !c.sensorDirSet {
+		// The sensor directory of previous versions is only used if it exists in the working directory.
+		result = append(result, Deprecation{
+			Setting:     "./" + legacySensorDir,
+			Replacement: "--sensordir or the default sensor directory " + defaultSensorDir(),
+		})
+	}
+
+	return result
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/xperimental/flowercare-exporter/internal/feature"
+)
+
+// ESPHomeConfig contains the settings for receiving advertisements from ESPHome Bluetooth proxies.
+type ESPHomeConfig struct {
+	// Discover finds the proxies in the local network using mDNS.
+	Discover bool
+	// Proxies contains the addresses of proxies, which are used in addition to the discovered ones.
+	Proxies []string
+	// DiscoveryInterval is the time between searches for new proxies.
+	DiscoveryInterval time.Duration
+}
+
+// Enabled returns true if advertisements are received from proxies.
+func (c ESPHomeConfig) Enabled() bool {
+	return c.Discover || len(c.Proxies) > 0
+}
+
+func (c ESPHomeConfig) validate(features feature.Set) error {
+	if !c.Enabled() {
+		return nil
+	}
+
+	if !features.Enabled(feature.ESPHomeProxy) {
+		return fmt.Errorf("ESPHome proxies are experimental, enable them using --enable-feature=%s", feature.ESPHomeProxy)
+	}
+
+	if c.Discover && c.DiscoveryInterval < time.Minute {
+		return fmt.Errorf("interval for discovering ESPHome proxies needs to be at least one minute: %s", c.DiscoveryInterval)
+	}
+
+	for _, addr := range c.Proxies {
+		if _, _, err := net.SplitHostPort(addr); err != nil && net.ParseIP(addr) == nil && !validHostname(addr) {
+			return fmt.Errorf("invalid address of ESPHome proxy: %s", addr)
+		}
+	}
+
+	return nil
+}
+
+func validHostname(host string) bool {
+	if host == "" {
+		return false
+	}
+
+	for _, r := range host {
+		if !(r == '.' || r == '-' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+
+	return true
+}
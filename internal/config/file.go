@@ -0,0 +1,161 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// configFlag is the name of the flag selecting the configuration file. It can not be set in the file itself.
+const configFlag = "config"
+
+// loadFile applies the settings of a YAML configuration file. The keys of the file are the names of the flags,
+// nested keys are joined using dashes, so that "retry: {factor: 2}" sets --retry-factor. Flags passed on the
+// command line take precedence over the file. The sensors in the "sensors" list are returned.
+func loadFile(fs *pflag.FlagSet, fileName string) ([]Sensor, error) {
+	values, err := readFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	sensors, err := parseFileSensors(fileName, values["sensors"])
+	if err != nil {
+		return nil, err
+	}
+	delete(values, "sensors")
+
+	changed := map[string]bool{}
+	fs.Visit(func(f *pflag.Flag) {
+		changed[f.Name] = true
+	})
+	renamedChanged(changed)
+
+	return sensors, applyValues(fs, "", values, changed)
+}
+
+// readFileSensors returns the sensors in the "sensors" list of a configuration file.
+func readFileSensors(fileName string) ([]Sensor, error) {
+	values, err := readFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseFileSensors(fileName, values["sensors"])
+}
+
+func readFile(fileName string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("can not parse %s: %s", fileName, err)
+	}
+
+	return values, nil
+}
+
+func applyValues(fs *pflag.FlagSet, prefix string, values map[string]interface{}, changed map[string]bool) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := key
+		if prefix != "" {
+			name = prefix + "-" + key
+		}
+		value := values[key]
+
+		if name == configFlag {
+			return errors.New("the configuration file can not include another file")
+		}
+
+		if fs.Lookup(name) == nil {
+			nested, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("unknown setting: %s", name)
+			}
+
+			if err := applyValues(fs, name, nested, changed); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if changed[name] {
+			continue
+		}
+
+		if err := applyFlag(fs, name, value); err != nil {
+			return fmt.Errorf("invalid value for %s: %s", name, err)
+		}
+	}
+
+	return nil
+}
+
+func applyFlag(fs *pflag.FlagSet, name string, value interface{}) error {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if err := fs.Set(name, fmt.Sprint(item)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		pairs := make([]string, 0, len(v))
+		for _, key := range keys {
+			pairs = append(pairs, fmt.Sprintf("%s=%v", key, v[key]))
+		}
+		return fs.Set(name, strings.Join(pairs, ","))
+	case nil:
+		return errors.New("value is empty")
+	default:
+		return fs.Set(name, fmt.Sprint(v))
+	}
+}
+
+// parseFileSensors converts the sensors of the configuration file using the JSON format of the sensor files.
+// Sensors use the format of the sensor files.
+func parseFileSensors(fileName string, raw interface{}) ([]Sensor, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("can not convert sensors: %s", err)
+	}
+
+	var sensors []Sensor
+	if err := json.Unmarshal(data, &sensors); err != nil {
+		return nil, fmt.Errorf("can not parse sensors: %s", err)
+	}
+
+	for i, s := range sensors {
+		if s.MacAddress == "" {
+			return nil, fmt.Errorf("sensor %d has no MAC address", i)
+		}
+		sensors[i].Source = configFileSource(fileName, i)
+	}
+
+	return sensors, nil
+}
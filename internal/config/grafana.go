@@ -0,0 +1,50 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DefaultGrafanaEvents contains the types of events posted as annotations by default.
+var DefaultGrafanaEvents = []string{"watered", "battery_replaced", "alert", "sensor_added", "sensor_removed"}
+
+// GrafanaConfig contains the settings for posting events as annotations to Grafana.
+type GrafanaConfig struct {
+	// URL is the base URL of Grafana. Annotations are disabled if it is empty.
+	URL       string
+	TokenFile string
+	// Token is read from TokenFile.
+	Token        string
+	DashboardUID string
+	// Events contains the types of events posted as annotations.
+	Events []string
+}
+
+func (g *GrafanaConfig) validate() error {
+	if g.URL == "" {
+		return nil
+	}
+	g.URL = strings.TrimSuffix(g.URL, "/")
+
+	if g.TokenFile == "" {
+		return errors.New("need to provide a token file for Grafana annotations")
+	}
+
+	data, err := os.ReadFile(g.TokenFile)
+	if err != nil {
+		return fmt.Errorf("can not read Grafana token: %s", err)
+	}
+
+	g.Token = strings.TrimSpace(string(data))
+	if g.Token == "" {
+		return errors.New("Grafana token file is empty")
+	}
+
+	if len(g.Events) == 0 {
+		return errors.New("need at least one event type for Grafana annotations")
+	}
+
+	return nil
+}
@@ -0,0 +1,27 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// HandoffConfig contains the settings for passing the state to a new exporter taking over, for example during an
+// upgrade.
+type HandoffConfig struct {
+	// Socket is the path of the socket used for the handoff. Disabled if empty.
+	Socket string
+	// Timeout is the time the new exporter waits for the running exporter to shut down.
+	Timeout time.Duration
+}
+
+func (c HandoffConfig) validate() error {
+	if c.Socket == "" {
+		return nil
+	}
+
+	if c.Timeout <= 0 {
+		return fmt.Errorf("handoff timeout needs to be positive: %s", c.Timeout)
+	}
+
+	return nil
+}
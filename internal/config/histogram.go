@@ -0,0 +1,37 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Values which can be recorded as daily histograms.
+const (
+	HistogramTemperature = "temperature"
+	HistogramLight       = "light"
+	HistogramMoisture    = "moisture"
+	HistogramHumidity    = "humidity"
+)
+
+// HistogramValues contains all values which can be recorded as daily histograms.
+var HistogramValues = []string{
+	HistogramTemperature,
+	HistogramLight,
+	HistogramMoisture,
+	HistogramHumidity,
+}
+
+func validateHistograms(names []string) error {
+	for _, name := range names {
+		known := false
+		for _, v := range HistogramValues {
+			known = known || v == name
+		}
+
+		if !known {
+			return fmt.Errorf("unknown value for histogram %q, needs to be one of: %s", name, strings.Join(HistogramValues, ", "))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// InfluxDBConfig contains the settings for writing readings to InfluxDB v2.
+type InfluxDBConfig struct {
+	// URL is the base URL of the InfluxDB server, for example "http://localhost:8086". Writing is disabled if it is
+	// empty.
+	URL    string
+	Org    string
+	Bucket string
+	// TokenFile contains the API token with write access to the bucket.
+	TokenFile string
+	// Token is read from TokenFile.
+	Token string
+	// Measurement is the name of the measurement the readings are written to.
+	Measurement string
+	// BatchSize is the maximum number of readings written in one request.
+	BatchSize int
+	// BufferSize is the maximum number of readings kept while InfluxDB is unreachable.
+	BufferSize    int
+	FlushInterval time.Duration
+	Timeout       time.Duration
+	// MaxAge is the age after which readings are not written anymore. Zero writes all readings.
+	MaxAge time.Duration
+}
+
+func (c *InfluxDBConfig) validate() error {
+	if c.URL == "" {
+		return nil
+	}
+
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("can not parse InfluxDB URL: %s", err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme of InfluxDB URL: %s", u.Scheme)
+	}
+	c.URL = strings.TrimSuffix(c.URL, "/")
+
+	if c.Org == "" || c.Bucket == "" {
+		return errors.New("need an organization and a bucket for writing to InfluxDB")
+	}
+
+	if c.Measurement == "" {
+		return errors.New("InfluxDB measurement can not be empty")
+	}
+
+	if c.BatchSize < 1 || c.BufferSize < c.BatchSize {
+		return fmt.Errorf("InfluxDB buffer size (%d) needs to be at least the batch size (%d), which needs to be positive", c.BufferSize, c.BatchSize)
+	}
+
+	if c.FlushInterval < time.Second {
+		return fmt.Errorf("InfluxDB flush interval needs to be at least one second: %s", c.FlushInterval)
+	}
+
+	if c.TokenFile == "" {
+		return errors.New("need a token file for writing to InfluxDB")
+	}
+
+	data, err := os.ReadFile(c.TokenFile)
+	if err != nil {
+		return fmt.Errorf("can not read InfluxDB token: %s", err)
+	}
+
+	c.Token = strings.TrimSpace(string(data))
+	if c.Token == "" {
+		return errors.New("InfluxDB token file is empty")
+	}
+
+	return nil
+}
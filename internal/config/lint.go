@@ -0,0 +1,199 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Warning describes a configuration which is valid, but likely does not work as intended.
+type Warning struct {
+	Problem    string
+	Suggestion string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s %s", w.Problem, w.Suggestion)
+}
+
+// publicPrefixes contains the vendor prefixes of sensors which use public addresses looking like random static
+// addresses.
+var publicPrefixes = []string{
+	// Xiaomi Flower Care
+	"C4:7C:8D",
+}
+
+// Lint checks the configuration for settings which are valid, but likely mistakes. It does not repeat the checks done
+// by Parse.
+func (c Config) Lint() []Warning {
+	var result []Warning
+	result = append(result, lintThresholds(c.Sensors)...)
+	result = append(result, lintStaleDuration(c)...)
+	result = append(result, lintNames(c.Sensors)...)
+	result = append(result, lintAddresses(c.Sensors, c.BLE.AddressType)...)
+	result = append(result, lintConcurrentReads(c)...)
+	for _, o := range c.sensorOverrides {
+		result = append(result, o.warning())
+	}
+	for _, d := range c.Deprecations {
+		result = append(result, d.warning())
+	}
+	return result
+}
+
+func lintThresholds(sensors SensorList) []Warning {
+	var result []Warning
+	for _, s := range sensors {
+		for _, t := range []struct {
+			Name     string
+			Min, Max int
+		}{
+			{"soil moisture", s.MinSoilMoist, s.MaxSoilMoist},
+			{"soil conductivity", s.MinSoilEc, s.MaxSoilEc},
+			{"light", s.MinLightLux, s.MaxLightLux},
+		} {
+			if t.Max == 0 || t.Min <= t.Max {
+				continue
+			}
+
+			result = append(result, Warning{
+				Problem:    fmt.Sprintf("Sensor %q has a minimum %s of %d above the maximum of %d, the value is always out of range.", s, t.Name, t.Min, t.Max),
+				Suggestion: fmt.Sprintf("Swap the thresholds, so that the minimum is %d and the maximum is %d.", t.Max, t.Min),
+			})
+		}
+	}
+
+	return result
+}
+
+// lintStaleDuration warns about stale durations which make the metrics of a sensor disappear after a single failed
+// reading, even though Parse only requires the stale duration to cover two refresh intervals.
+func lintStaleDuration(cfg Config) []Warning {
+	var result []Warning
+
+	// A failed reading is only retried after the timeout and the retry delay. The jitter can delay the next reading
+	// further.
+	needed := cfg.RefreshDuration + cfg.RefreshJitter + cfg.RefreshTimeout + cfg.Retry.MinDuration
+	check := func(name, flag string, stale time.Duration) {
+		if stale >= needed {
+			return
+		}
+
+		result = append(result, Warning{
+			Problem:    fmt.Sprintf("The %s of %s is shorter than the refresh interval, jitter, refresh timeout and retry delay combined (%s), a single failed reading makes the metrics flap.", name, stale, needed),
+			Suggestion: fmt.Sprintf("Increase %s to at least %s or decrease --refresh-duration.", flag, needed),
+		})
+	}
+
+	check("stale duration", "--stale-duration", cfg.StaleDuration)
+	for value, stale := range cfg.StaleDurations {
+		check("stale duration of "+value, "--stale-duration-override", stale)
+	}
+
+	for _, s := range cfg.Sensors {
+		if !s.Passive() {
+			continue
+		}
+
+		// Advertisements are only received while scanning, missing one scan needs to be tolerated.
+		if scans := 2 * cfg.Scan.Interval; cfg.StaleDuration < scans {
+			result = append(result, Warning{
+				Problem:    fmt.Sprintf("The stale duration of %s is shorter than two scan intervals, the metrics of passive sensors flap when an advertisement is missed.", cfg.StaleDuration),
+				Suggestion: fmt.Sprintf("Increase --stale-duration to at least %s or decrease --scan-interval.", scans),
+			})
+		}
+		break
+	}
+
+	return result
+}
+
+// lintConcurrentReads warns about more concurrent reads than adapters. The reads beyond the number of adapters wait
+// for a free adapter, which counts against the refresh timeout.
+func lintConcurrentReads(cfg Config) []Warning {
+	adapters := len(cfg.Devices)
+	if cfg.ConcurrentReads <= adapters || len(cfg.Privsep.WorkerSocket) != 0 {
+		return nil
+	}
+
+	return []Warning{{
+		Problem:    fmt.Sprintf("Up to %d sensors are read at the same time using %d adapters, the reads waiting for an adapter can run into the refresh timeout.", cfg.ConcurrentReads, adapters),
+		Suggestion: fmt.Sprintf("Decrease --max-concurrent-reads to %d or add adapters using --adapter.", adapters),
+	}}
+}
+
+func lintNames(sensors SensorList) []Warning {
+	var result []Warning
+	seen := map[string]string{}
+	for _, s := range sensors {
+		if s.Name == "" {
+			continue
+		}
+
+		other, ok := seen[s.Name]
+		if !ok {
+			seen[s.Name] = s.MacAddress
+			continue
+		}
+
+		result = append(result, Warning{
+			Problem:    fmt.Sprintf("Sensors %s and %s share the name %q, their metrics can only be told apart by the MAC address.", other, s.MacAddress, s.Name),
+			Suggestion: "Give every sensor a unique name, for example by adding the location.",
+		})
+	}
+
+	return result
+}
+
+// lintAddresses checks the addresses of the sensors using the address type of the Bluetooth LE connection. The two
+// most significant bits of a random address tell its kind: "11" for static addresses and "01" for resolvable private
+// addresses, which change regularly.
+func lintAddresses(sensors SensorList, addressType string) []Warning {
+	var result []Warning
+	for _, s := range sensors {
+		mac, err := net.ParseMAC(s.MacAddress)
+		if err != nil || len(mac) != 6 {
+			continue
+		}
+
+		kind := mac[0] >> 6
+		switch {
+		case kind == 0b01:
+			result = append(result, Warning{
+				Problem:    fmt.Sprintf("The address of sensor %q looks like a resolvable private address, which changes regularly.", s),
+				Suggestion: "Use the address printed on the sensor or shown by --discover instead of the one shown by a phone.",
+			})
+		case kind != 0b11 && mac[0]&0x01 != 0:
+			// The multicast bit is only meaningful for public addresses, the bits of static addresses are random.
+			result = append(result, Warning{
+				Problem:    fmt.Sprintf("The address of sensor %q is a multicast address, which no sensor uses.", s),
+				Suggestion: "Check the address for typos, for example against the addresses shown by --discover.",
+			})
+		case s.Passive():
+			// Advertisements are received independent of the address type.
+		case addressType == "public" && kind == 0b11 && !hasPublicPrefix(s.MacAddress):
+			result = append(result, Warning{
+				Problem:    fmt.Sprintf("The address of sensor %q looks like a random static address, but connections use public addresses.", s),
+				Suggestion: "Set --ble-address-type=random if the sensor can not be connected.",
+			})
+		case addressType == "random" && kind != 0b11:
+			result = append(result, Warning{
+				Problem:    fmt.Sprintf("The address of sensor %q is not a random static address, but connections use random addresses.", s),
+				Suggestion: "Set --ble-address-type=public if the sensor can not be connected.",
+			})
+		}
+	}
+
+	return result
+}
+
+func hasPublicPrefix(macAddress string) bool {
+	for _, prefix := range publicPrefixes {
+		if strings.HasPrefix(strings.ToUpper(macAddress), prefix) {
+			return true
+		}
+	}
+
+	return false
+}
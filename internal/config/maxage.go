@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Outputs which can skip old readings.
+const (
+	MaxAgeMQTT     = "mqtt"
+	MaxAgeEdgePush = "edge-push"
+	MaxAgeInfluxDB = "influxdb"
+)
+
+// MaxAgeOutputs contains all outputs which can skip old readings.
+var MaxAgeOutputs = []string{
+	MaxAgeMQTT,
+	MaxAgeEdgePush,
+	MaxAgeInfluxDB,
+}
+
+// parseMaxAges parses the maximum age of the readings by output.
+func parseMaxAges(values map[string]string) (map[string]time.Duration, error) {
+	result := map[string]time.Duration{}
+	for output, value := range values {
+		if !isMaxAgeOutput(output) {
+			return nil, fmt.Errorf("unknown output for maximum age %q, needs to be one of: %s", output, strings.Join(MaxAgeOutputs, ", "))
+		}
+
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("can not parse maximum age of %s: %s", output, err)
+		}
+
+		if d <= 0 {
+			return nil, fmt.Errorf("maximum age of %s needs to be positive: %s", output, value)
+		}
+		result[output] = d
+	}
+
+	return result, nil
+}
+
+func isMaxAgeOutput(name string) bool {
+	for _, o := range MaxAgeOutputs {
+		if o == name {
+			return true
+		}
+	}
+
+	return false
+}
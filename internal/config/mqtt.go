@@ -0,0 +1,95 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultMQTTTopic is the topic the readings are published to by default.
+	DefaultMQTTTopic = "flowercare/{name}/state"
+	// DefaultHomeAssistantPrefix is the discovery prefix used by Home Assistant by default.
+	DefaultHomeAssistantPrefix = "homeassistant"
+)
+
+// MQTTConfig contains the settings for publishing readings to an MQTT broker.
+type MQTTConfig struct {
+	// Broker is the URL of the broker, for example "tcp://localhost:1883". Publishing is disabled if it is empty.
+	Broker   string
+	ClientID string
+	Username string
+	// PasswordFile contains the password used together with the username.
+	PasswordFile string
+	// Password is read from PasswordFile.
+	Password string
+	// Topic is the topic of the readings. "{name}" and "{mac}" are replaced with the name and MAC address of
+	// the sensor.
+	Topic  string
+	QoS    int
+	Retain bool
+	TLS    MQTTTLSConfig
+	// HomeAssistant enables publishing discovery messages, so that the sensors appear in Home Assistant.
+	HomeAssistant       bool
+	HomeAssistantPrefix string
+	// MaxAge is the age after which readings are not published anymore. Zero publishes all readings.
+	MaxAge time.Duration
+}
+
+// MQTTTLSConfig contains the TLS settings of the connection to the broker.
+type MQTTTLSConfig struct {
+	// CAFile contains the certificates used for verifying the broker. The system certificates are used if empty.
+	CAFile string
+	// CertFile and KeyFile contain the client certificate, if the broker needs one.
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+}
+
+func (m *MQTTConfig) validate() error {
+	if m.Broker == "" {
+		return nil
+	}
+
+	u, err := url.Parse(m.Broker)
+	if err != nil {
+		return fmt.Errorf("can not parse MQTT broker URL: %s", err)
+	}
+
+	switch u.Scheme {
+	case "tcp", "mqtt", "ssl", "tls", "mqtts", "ws", "wss":
+	default:
+		return fmt.Errorf("unsupported scheme of MQTT broker URL: %s", u.Scheme)
+	}
+
+	if m.QoS < 0 || m.QoS > 2 {
+		return fmt.Errorf("MQTT QoS needs to be 0, 1 or 2: %d", m.QoS)
+	}
+
+	if !strings.Contains(m.Topic, "{name}") && !strings.Contains(m.Topic, "{mac}") {
+		return errors.New("MQTT topic needs to contain {name} or {mac}")
+	}
+
+	if m.HomeAssistant && strings.Trim(m.HomeAssistantPrefix, "/") == "" {
+		return errors.New("need a discovery prefix for Home Assistant")
+	}
+	m.HomeAssistantPrefix = strings.Trim(m.HomeAssistantPrefix, "/")
+
+	if (m.TLS.CertFile == "") != (m.TLS.KeyFile == "") {
+		return errors.New("need to provide both certificate and key file for MQTT client certificate")
+	}
+
+	if m.PasswordFile != "" {
+		data, err := os.ReadFile(m.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("can not read MQTT password: %s", err)
+		}
+
+		m.Password = strings.TrimSpace(string(data))
+	}
+
+	return nil
+}
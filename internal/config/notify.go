@@ -0,0 +1,164 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// NotifyConfig contains the configuration of the notifications sent for alerts.
+type NotifyConfig struct {
+	File string `json:"-"`
+	// Template is the default template for all channels. The built-in template is used if it is empty.
+	Template string `json:"template"`
+	// BatteryThreshold is the battery level in percent below which an alert is raised.
+	BatteryThreshold float64 `json:"battery_threshold"`
+	// BatteryDepletionDays is the number of days before the predicted depletion of a battery an alert is raised.
+	BatteryDepletionDays float64 `json:"battery_depletion_days"`
+	// WateringDueHours is the number of hours before the moisture is predicted to fall below the minimum an
+	// alert is raised. Zero disables the alert.
+	WateringDueHours float64 `json:"watering_due_hours"`
+	// DegradationPercent is the decline per week attributed to a degrading sensor above which an alert suggesting
+	// its maintenance is raised. Zero disables the alert.
+	DegradationPercent float64         `json:"degradation_percent_per_week"`
+	Channels           []NotifyChannel `json:"channels"`
+	// Escalation contains the steps of the escalation policy. Without steps, all channels are notified at once.
+	Escalation []EscalationStep `json:"escalation"`
+}
+
+// EscalationStep notifies the channels if an alert has not been acknowledged after the duration.
+type EscalationStep struct {
+	After    time.Duration `json:"-"`
+	Channels []string      `json:"channels"`
+}
+
+type escalationStepJSON struct {
+	After    string   `json:"after"`
+	Channels []string `json:"channels"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (s EscalationStep) MarshalJSON() ([]byte, error) {
+	return json.Marshal(escalationStepJSON{
+		After:    s.After.String(),
+		Channels: s.Channels,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (s *EscalationStep) UnmarshalJSON(data []byte) error {
+	var raw escalationStepJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	if raw.After != "" {
+		after, err := time.ParseDuration(raw.After)
+		if err != nil {
+			return fmt.Errorf("can not parse escalation delay: %s", err)
+		}
+		s.After = after
+	}
+	s.Channels = raw.Channels
+
+	return nil
+}
+
+// NotifyChannel is a destination notifications are sent to using HTTP.
+type NotifyChannel struct {
+	Name        string            `json:"name"`
+	URL         string            `json:"url"`
+	Method      string            `json:"method"`
+	ContentType string            `json:"content_type"`
+	Headers     map[string]string `json:"headers"`
+	// Template overrides the default template for this channel.
+	Template string `json:"template"`
+	// TemplateFile is read into Template, relative paths are resolved relative to the configuration file.
+	TemplateFile string `json:"template_file"`
+	// User restricts the channel to the alerts of the sensors owned by the user.
+	User string `json:"user"`
+}
+
+func readNotifyConfig(fileName string) (NotifyConfig, error) {
+	result := NotifyConfig{
+		File:                 fileName,
+		BatteryThreshold:     10,
+		BatteryDepletionDays: 14,
+		DegradationPercent:   10,
+	}
+
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return result, err
+	}
+
+	if err := json.Unmarshal(data, &result); err != nil {
+		return result, err
+	}
+
+	if len(result.Channels) == 0 {
+		return result, errors.New("need at least one channel")
+	}
+
+	seen := map[string]bool{}
+	for i, c := range result.Channels {
+		if len(c.Name) == 0 {
+			return result, fmt.Errorf("channel %d has no name", i)
+		}
+
+		if seen[c.Name] {
+			return result, fmt.Errorf("channel name %q is not unique", c.Name)
+		}
+		seen[c.Name] = true
+
+		if len(c.URL) == 0 {
+			return result, fmt.Errorf("channel %q has no URL", c.Name)
+		}
+
+		if len(c.Method) == 0 {
+			c.Method = "POST"
+		}
+
+		if len(c.ContentType) == 0 {
+			c.ContentType = "text/plain; charset=utf-8"
+		}
+
+		if len(c.TemplateFile) != 0 {
+			path := c.TemplateFile
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(filepath.Dir(fileName), path)
+			}
+
+			template, err := os.ReadFile(path)
+			if err != nil {
+				return result, fmt.Errorf("channel %q: can not read template: %s", c.Name, err)
+			}
+			c.Template = string(template)
+		}
+
+		result.Channels[i] = c
+	}
+
+	var previous time.Duration
+	for i, step := range result.Escalation {
+		if step.After < previous {
+			return result, fmt.Errorf("escalation step %d: delay needs to be at least %s", i, previous)
+		}
+		previous = step.After
+
+		if len(step.Channels) == 0 {
+			return result, fmt.Errorf("escalation step %d has no channels", i)
+		}
+
+		for _, name := range step.Channels {
+			if !seen[name] {
+				return result, fmt.Errorf("escalation step %d: unknown channel %q", i, name)
+			}
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Protocols for sending metrics to an OpenTelemetry collector.
+const (
+	OTLPProtocolHTTP = "http/protobuf"
+	OTLPProtocolGRPC = "grpc"
+)
+
+// OTLPConfig contains the settings for exporting the readings to an OpenTelemetry collector.
+type OTLPConfig struct {
+	// Endpoint is the base URL of the collector, for example "http://localhost:4318". Exporting is disabled if it is
+	// empty. Endpoints using "http" connect without TLS, also when using gRPC.
+	Endpoint string
+	Protocol string
+	// Headers are sent with every request, for example for authentication.
+	Headers  map[string]string
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+func (c *OTLPConfig) validate() error {
+	if c.Endpoint == "" {
+		return nil
+	}
+
+	u, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return fmt.Errorf("can not parse OTLP endpoint: %s", err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme of OTLP endpoint: %s", u.Scheme)
+	}
+	c.Endpoint = strings.TrimSuffix(c.Endpoint, "/")
+
+	switch c.Protocol {
+	case OTLPProtocolHTTP:
+	case OTLPProtocolGRPC:
+		if u.Path != "" && u.Path != "/" {
+			return fmt.Errorf("OTLP endpoint for gRPC can not have a path: %s", u.Path)
+		}
+	default:
+		return fmt.Errorf("unknown OTLP protocol %q, needs to be %s or %s", c.Protocol, OTLPProtocolHTTP, OTLPProtocolGRPC)
+	}
+
+	if c.Interval < time.Second {
+		return fmt.Errorf("OTLP export interval needs to be at least one second: %s", c.Interval)
+	}
+
+	if c.Timeout <= 0 || c.Timeout > c.Interval {
+		return fmt.Errorf("OTLP timeout needs to be positive and at most the export interval: %s", c.Timeout)
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// PipelineConfig contains the steps processing every reading, in the order they are applied.
+type PipelineConfig struct {
+	File  string         `json:"-"`
+	Steps []PipelineStep `json:"steps"`
+}
+
+// PipelineStep selects a processing step by its name. The options are passed to the step unchanged.
+type PipelineStep struct {
+	Name    string          `json:"name"`
+	Options json.RawMessage `json:"options,omitempty"`
+}
+
+// DefaultPipeline contains the steps used if no pipeline is configured.
+var DefaultPipeline = []PipelineStep{
+	{Name: "calibrate"},
+}
+
+func readPipelineConfig(fileName string) (PipelineConfig, error) {
+	result := PipelineConfig{
+		File: fileName,
+	}
+
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return result, err
+	}
+
+	if err := json.Unmarshal(data, &result); err != nil {
+		return result, err
+	}
+
+	if len(result.Steps) == 0 {
+		return result, errors.New("need at least one step")
+	}
+
+	for i, s := range result.Steps {
+		if s.Name == "" {
+			return result, fmt.Errorf("step %d has no name", i)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,53 @@
+package config
+
+import "errors"
+
+// Defaults used in low resource mode for settings which have not been set explicitly.
+const (
+	lowResourceEventLogSize    = 10
+	lowResourceEdgeBufferSize  = 500
+	lowResourceMemoryTargetMiB = 16
+)
+
+// ResourceConfig contains the settings for limiting the memory used by the exporter.
+type ResourceConfig struct {
+	// Low reduces the memory used by the exporter for running on routers and similar devices.
+	Low bool
+	// MemoryTargetMiB is the amount of memory the exporter tries to stay below. Zero disables the target.
+	MemoryTargetMiB int
+}
+
+// applyLowResource changes the defaults of memory-intensive settings and checks that no subsystem is enabled,
+// which does not fit into the low resource mode. Settings passed explicitly are kept.
+func (c *Config) applyLowResource(changed func(name string) bool) error {
+	if !changed("event-log-size") {
+		c.EventLogSize = lowResourceEventLogSize
+	}
+
+	if !changed("battery-prediction-window") {
+		c.BatteryWindow = 0
+	}
+
+	if !changed("moisture-forecast-window") {
+		c.ForecastWindow = 0
+	}
+
+	if !changed("edge-buffer-size") {
+		c.Edge.BufferSize = lowResourceEdgeBufferSize
+	}
+
+	if !changed("memory-target") {
+		c.Resources.MemoryTargetMiB = lowResourceMemoryTargetMiB
+	}
+
+	switch {
+	case c.API.Enabled:
+		return errors.New("the control API can not be used in low resource mode")
+	case c.Notify.File != "":
+		return errors.New("notifications can not be used in low resource mode")
+	case c.Edge.Aggregator:
+		return errors.New("the aggregator can not be used in low resource mode, use it on the receiving exporter")
+	}
+
+	return nil
+}
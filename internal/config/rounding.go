@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+// Outputs the values can be rounded on.
+const (
+	RoundingMetrics = "metrics"
+	RoundingHeatmap = "heatmap"
+	RoundingMQTT    = "mqtt"
+)
+
+// RoundingOutputs contains all outputs the values can be rounded on.
+var RoundingOutputs = []string{
+	RoundingMetrics,
+	RoundingHeatmap,
+	RoundingMQTT,
+}
+
+// RoundingConfig contains the settings for rounding the values on outputs which are shared publicly.
+type RoundingConfig struct {
+	// Steps contains the step each value is rounded to, by name of the value. Values without a step are not rounded.
+	Steps map[string]float64
+	// Outputs contains the outputs the values are rounded on. All other outputs keep the full precision.
+	Outputs []string
+}
+
+// Applies returns true if the values are rounded on the output.
+func (r RoundingConfig) Applies(output string) bool {
+	if len(r.Steps) == 0 {
+		return false
+	}
+
+	for _, o := range r.Outputs {
+		if o == output {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r RoundingConfig) validate() error {
+	for _, o := range r.Outputs {
+		if !isRoundingOutput(o) {
+			return fmt.Errorf("unknown output for rounding %q, needs to be one of: %s", o, strings.Join(RoundingOutputs, ", "))
+		}
+	}
+
+	return nil
+}
+
+func isRoundingOutput(name string) bool {
+	for _, o := range RoundingOutputs {
+		if o == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseRoundingSteps(values map[string]string) (map[string]float64, error) {
+	result := map[string]float64{}
+	for name, value := range values {
+		var r driver.Reading
+		if r.Field(name) == nil {
+			return nil, fmt.Errorf("unknown value for rounding: %q", name)
+		}
+
+		step, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("can not parse rounding step of %s: %s", name, err)
+		}
+
+		if !(step > 0) || !isFinite(step) {
+			return nil, fmt.Errorf("rounding step of %s needs to be positive: %s", name, value)
+		}
+		result[name] = step
+	}
+
+	return result, nil
+}
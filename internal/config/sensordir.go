@@ -0,0 +1,96 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// legacySensorDir is the sensor directory used by previous versions, relative to the working directory.
+	legacySensorDir = "sensorData"
+	// systemSensorDir is the sensor directory used when running as root.
+	systemSensorDir = "/etc/flowercare/sensors.d"
+)
+
+// DefaultSensorDir returns the sensor directory used if none is set. This is /etc/flowercare/sensors.d when running
+// as root and flowercare/sensors.d in the configuration directory of the user otherwise, for example
+// $XDG_CONFIG_HOME/flowercare/sensors.d on Linux. The sensorData directory used by previous versions is preferred if
+// it exists in the working directory.
+func DefaultSensorDir() string {
+	if info, err := os.Stat(legacySensorDir); err == nil && info.IsDir() {
+		return legacySensorDir
+	}
+
+	return defaultSensorDir()
+}
+
+// defaultSensorDir returns the sensor directory used if none is set, ignoring the directory of previous versions.
+func defaultSensorDir() string {
+	if os.Geteuid() == 0 {
+		return systemSensorDir
+	}
+
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return systemSensorDir
+	}
+
+	return filepath.Join(configDir, "flowercare", "sensors.d")
+}
+
+// prepareSensorDir creates the default sensor directory if it does not exist yet. Failing to create it is not an
+// error, as sensors can also be configured by other means.
+func (c Config) prepareSensorDir(log logrus.FieldLogger) {
+	if c.SensorDir == "" || c.sensorDirSet {
+		return
+	}
+
+	if _, err := os.Stat(c.SensorDir); !errors.Is(err, os.ErrNotExist) {
+		return
+	}
+
+	if err := os.MkdirAll(c.SensorDir, 0o755); err != nil {
+		log.Debugf("Can not create default sensor directory: %s", err)
+		return
+	}
+
+	log.Infof("Created sensor directory %s.", c.SensorDir)
+}
+
+// readSensorDir reads the sensors from the sensor directory. A missing default directory is treated as empty, only a
+// missing directory set using --sensordir is an error.
+func (c Config) readSensorDir(log logrus.FieldLogger) ([]Sensor, error) {
+	if c.SensorDir == "" {
+		return nil, nil
+	}
+
+	sensors, err := readSensorsFromDir(c.SensorDir, log)
+	if errors.Is(err, os.ErrNotExist) && !c.sensorDirSet {
+		return nil, nil
+	}
+
+	return sensors, err
+}
+
+// CheckSensorFile reads a single file of the sensor directory and checks the sensor it contains.
+func (c Config) CheckSensorFile(fileName string) error {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+
+	var sensor Sensor
+	if err := sensor.UnmarshalJSON(data); err != nil {
+		return fmt.Errorf("can not parse sensor: %s", err)
+	}
+
+	if sensor.MacAddress == "" {
+		return errors.New("sensor has no MAC address")
+	}
+
+	return c.validateSensor(sensor)
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sourceFlag is the Source of sensors passed using --sensor.
+const sourceFlag = "--sensor"
+
+// sensorFileSource returns the Source of a sensor read from a file of the sensor directory.
+func sensorFileSource(fileName string) string {
+	return "sensor file " + fileName
+}
+
+// configFileSource returns the Source of the sensor at the index of the "sensors" list of the configuration file.
+func configFileSource(fileName string, index int) string {
+	return fmt.Sprintf("configuration file %s (sensor %d)", fileName, index)
+}
+
+// SensorOverride describes a sensor which is configured in more than one source. Only the sensor of the source with
+// the higher precedence is used.
+type SensorOverride struct {
+	MacAddress string
+	// Used is the source of the sensor in use.
+	Used string
+	// Ignored is the source of the sensor which has been overridden.
+	Ignored string
+}
+
+// mergeSensors combines the sensors of the sources, which are passed in order of precedence: the sensors passed using
+// --sensor, the sensor directory and the configuration file. A sensor configured in more than one source is taken
+// from the source with the highest precedence and returned as override. A MAC address configured twice in the same
+// source is an error, as there is no way to tell which of the sensors is meant.
+func mergeSensors(sources ...[]Sensor) ([]Sensor, []SensorOverride, []error) {
+	var (
+		sensors   []Sensor
+		overrides []SensorOverride
+		errs      []error
+	)
+
+	used := map[string]Sensor{}
+	for _, source := range sources {
+		seen := map[string]Sensor{}
+		for _, s := range source {
+			key := strings.ToUpper(s.MacAddress)
+			if other, ok := seen[key]; ok {
+				if other.Source == s.Source {
+					errs = append(errs, fmt.Errorf("sensor %s is configured twice in %s", s.MacAddress, s.Source))
+				} else {
+					errs = append(errs, fmt.Errorf("sensor %s is configured twice, in %s and in %s", s.MacAddress, other.Source, s.Source))
+				}
+				continue
+			}
+			seen[key] = s
+
+			if other, ok := used[key]; ok {
+				overrides = append(overrides, SensorOverride{
+					MacAddress: other.MacAddress,
+					Used:       other.Source,
+					Ignored:    s.Source,
+				})
+				continue
+			}
+
+			used[key] = s
+			sensors = append(sensors, s)
+		}
+	}
+
+	return sensors, overrides, errs
+}
+
+func (o SensorOverride) warning() Warning {
+	return Warning{
+		Problem:    fmt.Sprintf("Sensor %s is configured in %s and in %s, only the first one is used.", o.MacAddress, o.Used, o.Ignored),
+		Suggestion: "Remove one of them, the command line takes precedence over the sensor directory, which takes precedence over the configuration file.",
+	}
+}
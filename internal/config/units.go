@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+// Unit describes the unit a value is exported in.
+type Unit struct {
+	// Suffix is appended to the name of the metric, following the Prometheus naming conventions.
+	Suffix string
+	// Description is the unit as used in the help of the metric.
+	Description string
+	// Factor converts the value of the reading to the unit.
+	Factor float64
+}
+
+// NamedUnit is a unit together with the name used for selecting it.
+type NamedUnit struct {
+	Name string
+	Unit Unit
+}
+
+// MetricUnits contains the units the values can be exported in by name of the value. The first unit of every value is
+// the default, the other units can be selected using --metric-unit.
+var MetricUnits = map[string][]NamedUnit{
+	"light": {
+		{"lux", Unit{Suffix: "lux", Description: "lux", Factor: 1}},
+		{"klx", Unit{Suffix: "kilolux", Description: "kilolux", Factor: 0.001}},
+	},
+	"conductivity": {
+		{"s/m", Unit{Suffix: "sm", Description: "Siemens/meter", Factor: 0.0001}},
+		{"us/cm", Unit{Suffix: "microsiemens_per_centimeter", Description: "µS/cm", Factor: 1}},
+		{"ms/cm", Unit{Suffix: "millisiemens_per_centimeter", Description: "mS/cm", Factor: 0.001}},
+	},
+}
+
+// UnitsConfig contains the units and precision of the exported metrics.
+type UnitsConfig struct {
+	// Units contains the selected unit by name of the value. Values without a selected unit use the default unit.
+	Units map[string]string
+	// Precision contains the number of decimal places the metrics are rounded to after converting them to their unit,
+	// by name of the value. Values without a precision are not rounded.
+	Precision map[string]int
+}
+
+// Unit returns the unit the value is exported in. Values whose unit can not be selected keep the unit of the reading,
+// which is already part of the metric name, so the returned unit has no suffix.
+func (c UnitsConfig) Unit(value string) Unit {
+	units, ok := MetricUnits[value]
+	if !ok {
+		return Unit{Factor: 1}
+	}
+
+	for _, u := range units {
+		if u.Name == c.Units[value] {
+			return u.Unit
+		}
+	}
+
+	return units[0].Unit
+}
+
+// Changed returns true if a unit or precision differs from the defaults.
+func (c UnitsConfig) Changed() bool {
+	return len(c.Units) > 0 || len(c.Precision) > 0
+}
+
+func parseMetricUnits(values map[string]string) (map[string]string, error) {
+	result := map[string]string{}
+	for value, unit := range values {
+		units, ok := MetricUnits[value]
+		if !ok {
+			return nil, fmt.Errorf("unknown value for --metric-unit: %q, needs to be one of: %s", value, strings.Join(unitValues(), ", "))
+		}
+
+		var names []string
+		found := false
+		for _, u := range units {
+			names = append(names, u.Name)
+			if strings.EqualFold(u.Name, unit) {
+				found = true
+				unit = u.Name
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown unit for %s: %q, needs to be one of: %s", value, unit, strings.Join(names, ", "))
+		}
+		result[value] = unit
+	}
+
+	return result, nil
+}
+
+func parseMetricPrecision(values map[string]string) (map[string]int, error) {
+	result := map[string]int{}
+	for name, value := range values {
+		var r driver.Reading
+		if r.Field(name) == nil {
+			return nil, fmt.Errorf("unknown value for --metric-precision: %q", name)
+		}
+
+		places, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("can not parse precision of %s: %s", name, err)
+		}
+
+		if places < 0 {
+			return nil, fmt.Errorf("precision of %s can not be negative: %d", name, places)
+		}
+		result[name] = places
+	}
+
+	return result, nil
+}
+
+// unitValues returns the names of the values whose unit can be selected.
+func unitValues() []string {
+	result := make([]string, 0, len(MetricUnits))
+	for value := range MetricUnits {
+		result = append(result, value)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// unitNames returns the units of all values for the help of --metric-unit.
+func unitNames() string {
+	var result []string
+	for _, value := range unitValues() {
+		var names []string
+		for _, u := range MetricUnits[value] {
+			names = append(names, u.Name)
+		}
+		result = append(result, fmt.Sprintf("%s (%s)", value, strings.Join(names, ", ")))
+	}
+
+	return strings.Join(result, ", ")
+}
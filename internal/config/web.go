@@ -0,0 +1,209 @@
+package config
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// Client authentication types of the web configuration file, named like in the Prometheus exporter-toolkit.
+const (
+	ClientAuthNone             = "NoClientCert"
+	ClientAuthRequest          = "RequestClientCert"
+	ClientAuthRequireAny       = "RequireAnyClientCert"
+	ClientAuthVerifyIfGiven    = "VerifyClientCertIfGiven"
+	ClientAuthRequireAndVerify = "RequireAndVerifyClientCert"
+)
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	ClientAuthNone:             tls.NoClientCert,
+	ClientAuthRequest:          tls.RequestClientCert,
+	ClientAuthRequireAny:       tls.RequireAnyClientCert,
+	ClientAuthVerifyIfGiven:    tls.VerifyClientCertIfGiven,
+	ClientAuthRequireAndVerify: tls.RequireAndVerifyClientCert,
+}
+
+var tlsVersions = map[string]uint16{
+	"TLS10": tls.VersionTLS10,
+	"TLS11": tls.VersionTLS11,
+	"TLS12": tls.VersionTLS12,
+	"TLS13": tls.VersionTLS13,
+}
+
+// WebConfig contains the settings of the HTTP server.
+type WebConfig struct {
+	// File is the web configuration file in the format of the Prometheus exporter-toolkit. The TLS settings can be
+	// set either using the file or the flags.
+	File string
+	TLS  TLSConfig
+	// BasicAuthUsers maps the users allowed to access the endpoints to the bcrypt hashes of their passwords.
+	BasicAuthUsers map[string]string
+	// BearerTokenFile contains a token allowed to access the endpoints.
+	BearerTokenFile string
+	// BearerToken is read from BearerTokenFile.
+	BearerToken string
+	// EnableLifecycle enables the endpoints reloading and stopping the exporter.
+	EnableLifecycle bool
+}
+
+// webFile is the web configuration file.
+type webFile struct {
+	TLS            TLSConfig         `yaml:"tls_server_config"`
+	BasicAuthUsers map[string]string `yaml:"basic_auth_users"`
+}
+
+// AuthEnabled returns true if the endpoints need a password or token.
+func (c WebConfig) AuthEnabled() bool {
+	return len(c.BasicAuthUsers) > 0 || c.BearerToken != ""
+}
+
+func (c *WebConfig) validate() error {
+	if err := c.TLS.validate(); err != nil {
+		return err
+	}
+
+	for user, hash := range c.BasicAuthUsers {
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return fmt.Errorf("password of user %q is not a bcrypt hash: %s", user, err)
+		}
+	}
+
+	if c.BearerTokenFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(c.BearerTokenFile)
+	if err != nil {
+		return fmt.Errorf("can not read bearer token: %s", err)
+	}
+
+	c.BearerToken = strings.TrimSpace(string(data))
+	if len(c.BearerToken) < 16 {
+		return errors.New("bearer token needs to be at least 16 characters long")
+	}
+
+	return nil
+}
+
+// TLSConfig contains the settings for serving HTTPS. HTTPS is disabled if no certificate is set.
+type TLSConfig struct {
+	// CertFile and KeyFile are read again when they change, so that renewed certificates are used without a restart.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ClientCAFile contains the certificates of the authorities whose client certificates are accepted.
+	ClientCAFile string `yaml:"client_ca_file"`
+	// ClientAuthType selects whether clients need a certificate. It defaults to RequireAndVerifyClientCert if a
+	// client CA file is set.
+	ClientAuthType string   `yaml:"client_auth_type"`
+	MinVersion     string   `yaml:"min_version"`
+	MaxVersion     string   `yaml:"max_version"`
+	CipherSuites   []string `yaml:"cipher_suites"`
+}
+
+// Enabled returns true if the server uses HTTPS.
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != ""
+}
+
+// ClientAuth returns the type of client authentication.
+func (c TLSConfig) ClientAuth() tls.ClientAuthType {
+	return clientAuthTypes[c.ClientAuthType]
+}
+
+// Version returns the numeric TLS version of a version name. Empty names return zero, which selects the default
+// of the crypto/tls package.
+func (c TLSConfig) Version(name string) uint16 {
+	return tlsVersions[name]
+}
+
+// CipherSuiteIDs returns the IDs of the cipher suites. It returns nil if the default cipher suites are used.
+func (c TLSConfig) CipherSuiteIDs() []uint16 {
+	var result []uint16
+	for _, name := range c.CipherSuites {
+		for _, s := range tls.CipherSuites() {
+			if s.Name == name {
+				result = append(result, s.ID)
+			}
+		}
+	}
+
+	return result
+}
+
+func (c *TLSConfig) validate() error {
+	if c.CertFile == "" && c.KeyFile == "" && c.ClientCAFile == "" {
+		return nil
+	}
+
+	if c.CertFile == "" || c.KeyFile == "" {
+		return errors.New("need both a certificate and a key for serving HTTPS")
+	}
+
+	if c.ClientAuthType == "" {
+		c.ClientAuthType = ClientAuthNone
+		if c.ClientCAFile != "" {
+			c.ClientAuthType = ClientAuthRequireAndVerify
+		}
+	}
+
+	auth, ok := clientAuthTypes[c.ClientAuthType]
+	if !ok {
+		return fmt.Errorf("unknown client auth type: %s", c.ClientAuthType)
+	}
+
+	if c.ClientCAFile == "" && (auth == tls.VerifyClientCertIfGiven || auth == tls.RequireAndVerifyClientCert) {
+		return fmt.Errorf("need a client CA file for client auth type %s", c.ClientAuthType)
+	}
+
+	for _, v := range []string{c.MinVersion, c.MaxVersion} {
+		if _, ok := tlsVersions[v]; v != "" && !ok {
+			return fmt.Errorf("unknown TLS version: %s", v)
+		}
+	}
+
+	for _, name := range c.CipherSuites {
+		known := false
+		for _, s := range tls.CipherSuites() {
+			known = known || s.Name == name
+		}
+
+		if !known {
+			return fmt.Errorf("unknown or insecure cipher suite: %s", name)
+		}
+	}
+
+	return nil
+}
+
+// readWebConfig reads the web configuration file. Settings of the exporter-toolkit, which are not supported by the
+// exporter, are rejected instead of being ignored silently. Relative paths are relative to the file.
+func readWebConfig(fileName string) (webFile, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return webFile{}, err
+	}
+
+	var file webFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return webFile{}, fmt.Errorf("can not parse %s: %s", fileName, err)
+	}
+
+	dir := filepath.Dir(fileName)
+	for _, path := range []*string{&file.TLS.CertFile, &file.TLS.KeyFile, &file.TLS.ClientCAFile} {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(dir, *path)
+		}
+	}
+
+	return file, nil
+}
@@ -0,0 +1,179 @@
+// Package distribution records the distribution of the values of every sensor during the day as histograms, which
+// allows percentile queries and questions like "how many readings were above 30 °C today" without keeping the
+// readings in high resolution.
+package distribution
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/xperimental/flowercare-exporter/internal/anonymize"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+// value describes the histogram of a value of the readings.
+type value struct {
+	Metric  string
+	Help    string
+	Buckets []float64
+}
+
+// values contains the supported values by the name used in the configuration.
+var values = map[string]value{
+	config.HistogramTemperature: {
+		Metric:  "flowercare_daily_temperature_celsius",
+		Help:    "Distribution of the temperature readings since midnight.",
+		Buckets: []float64{-10, -5, 0, 5, 10, 15, 20, 25, 30, 35, 40},
+	},
+	config.HistogramLight: {
+		Metric:  "flowercare_daily_brightness_lux",
+		Help:    "Distribution of the light readings since midnight.",
+		Buckets: []float64{10, 100, 500, 1000, 2000, 5000, 10000, 20000, 50000, 100000},
+	},
+	config.HistogramMoisture: {
+		Metric:  "flowercare_daily_moisture_percent",
+		Help:    "Distribution of the soil moisture readings since midnight.",
+		Buckets: []float64{5, 10, 15, 20, 30, 40, 50, 60, 70},
+	},
+	config.HistogramHumidity: {
+		Metric:  "flowercare_daily_humidity_percent",
+		Help:    "Distribution of the air humidity readings since midnight.",
+		Buckets: []float64{20, 30, 40, 50, 60, 70, 80, 90},
+	},
+}
+
+// histogram contains the observations of a value of a sensor during one day.
+type histogram struct {
+	Sensor config.Sensor
+	// Day is the midnight of the day the observations belong to.
+	Day    time.Time
+	Counts []uint64
+	Count  uint64
+	Sum    float64
+}
+
+// Recorder keeps the histograms of the selected values. It implements prometheus.Collector.
+type Recorder struct {
+	location   *time.Location
+	anonymizer *anonymize.Anonymizer
+	names      []string
+	descs      map[string]*prometheus.Desc
+
+	lock sync.Mutex
+	// histograms contains the histograms by value name and MAC address.
+	histograms map[string]map[string]*histogram
+}
+
+// New creates a Recorder for the values, which need to be in config.HistogramValues. Days start at midnight in the
+// location. Sensors are replaced by their pseudonyms if the anonymizer is set.
+func New(names []string, location *time.Location, anonymizer *anonymize.Anonymizer) *Recorder {
+	r := &Recorder{
+		location:   location,
+		anonymizer: anonymizer,
+		names:      names,
+		descs:      map[string]*prometheus.Desc{},
+		histograms: map[string]map[string]*histogram{},
+	}
+	for _, name := range names {
+		v := values[name]
+		r.descs[name] = prometheus.NewDesc(v.Metric, v.Help, []string{"macaddress", "name"}, nil)
+		r.histograms[name] = map[string]*histogram{}
+	}
+
+	return r
+}
+
+// Observe adds the values of a reading to the histograms. It can be used as an updater.Listener.
+func (r *Recorder) Observe(sensor config.Sensor, reading driver.Reading) {
+	now := reading.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	day := r.midnight(now)
+	key := strings.ToUpper(sensor.MacAddress)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, name := range r.names {
+		v := reading.Field(name)
+		if *v == nil {
+			continue
+		}
+
+		h, ok := r.histograms[name][key]
+		if !ok || day.After(h.Day) {
+			h = &histogram{
+				Day:    day,
+				Counts: make([]uint64, len(values[name].Buckets)),
+			}
+			r.histograms[name][key] = h
+		} else if day.Before(h.Day) {
+			// Late readings of the previous day are not counted for the current day.
+			continue
+		}
+
+		h.Sensor = sensor
+		h.observe(values[name].Buckets, **v)
+	}
+}
+
+func (h *histogram) observe(buckets []float64, v float64) {
+	// The counts are not cumulative, they are summed up when collecting.
+	i := sort.SearchFloat64s(buckets, v)
+	if i < len(buckets) {
+		h.Counts[i]++
+	}
+	h.Count++
+	h.Sum += v
+}
+
+// Describe implements prometheus.Collector
+func (r *Recorder) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range r.descs {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector
+func (r *Recorder) Collect(ch chan<- prometheus.Metric) {
+	today := r.midnight(time.Now())
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, name := range r.names {
+		buckets := values[name].Buckets
+		for key, h := range r.histograms[name] {
+			if today.After(h.Day) {
+				// Sensors without readings today start at zero, so that the histogram resets at midnight even
+				// without new readings.
+				h = &histogram{
+					Sensor: h.Sensor,
+					Day:    today,
+					Counts: make([]uint64, len(buckets)),
+				}
+				r.histograms[name][key] = h
+			}
+
+			cumulative := make(map[float64]uint64, len(buckets))
+			var total uint64
+			for i, upper := range buckets {
+				total += h.Counts[i]
+				cumulative[upper] = total
+			}
+
+			ch <- prometheus.MustNewConstHistogram(r.descs[name], h.Count, h.Sum, cumulative,
+				r.anonymizer.MAC(h.Sensor.MacAddress), r.anonymizer.Name(h.Sensor.Name))
+		}
+	}
+}
+
+func (r *Recorder) midnight(now time.Time) time.Time {
+	year, month, day := now.In(r.location).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, r.location)
+}
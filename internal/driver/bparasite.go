@@ -0,0 +1,48 @@
+package driver
+
+import (
+	"strings"
+	"time"
+
+	"github.com/go-ble/ble"
+	"github.com/xperimental/flowercare-exporter/pkg/bparasite"
+)
+
+func init() {
+	Register(Driver{
+		Name:     "bparasite",
+		Model:    "b-parasite",
+		Protocol: ProtocolAdvertisement,
+		Match:    matchBParasite,
+		Decode:   decodeBParasite,
+	})
+}
+
+func matchBParasite(a ble.Advertisement) bool {
+	if strings.HasPrefix(a.LocalName(), "prst") {
+		return true
+	}
+
+	_, err := bparasite.Decode(a)
+	return err == nil
+}
+
+func decodeBParasite(a ble.Advertisement, _ Options) (Reading, error) {
+	data, err := bparasite.Decode(a)
+	if err != nil {
+		return Reading{}, err
+	}
+
+	reading := Reading{
+		Time:           time.Now(),
+		BatteryVoltage: Float(data.BatteryVoltage),
+		Temperature:    Float(data.Temperature),
+		Humidity:       Float(data.Humidity),
+		Moisture:       Float(data.Moisture),
+	}
+	if data.HasLight {
+		reading.Light = Float(float64(data.Light))
+	}
+
+	return reading, nil
+}
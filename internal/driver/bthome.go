@@ -0,0 +1,57 @@
+package driver
+
+import (
+	"time"
+
+	"github.com/go-ble/ble"
+	"github.com/xperimental/flowercare-exporter/pkg/bthome"
+)
+
+func init() {
+	Register(Driver{
+		Name:     "bthome",
+		Model:    "BTHome",
+		Protocol: ProtocolBTHome,
+		Match:    matchBTHome,
+		Decode:   decodeBTHome,
+	})
+}
+
+func matchBTHome(a ble.Advertisement) bool {
+	for _, s := range a.ServiceData() {
+		if s.UUID.Equal(bthome.ServiceUUID) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func decodeBTHome(a ble.Advertisement, opts Options) (Reading, error) {
+	packet, err := bthome.Decode(a, opts.Key)
+	if err != nil && len(packet.Measurements) == 0 {
+		return Reading{}, err
+	}
+
+	reading := Reading{
+		Time: time.Now(),
+	}
+	for _, field := range []struct {
+		Name   string
+		Target **float64
+	}{
+		{"battery", &reading.Battery},
+		{"temperature", &reading.Temperature},
+		{"humidity", &reading.Humidity},
+		{"moisture", &reading.Moisture},
+		{"illuminance", &reading.Light},
+		{"conductivity", &reading.Conductivity},
+		{"voltage", &reading.BatteryVoltage},
+	} {
+		if value, ok := packet.Value(field.Name); ok {
+			*field.Target = Float(value)
+		}
+	}
+
+	return reading, nil
+}
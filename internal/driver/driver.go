@@ -0,0 +1,336 @@
+// Package driver contains a registry of the Bluetooth LE devices supported by the exporter.
+//
+// Each driver knows how to recognize its devices from their advertisements and how to get measurements
+// from them, either by connecting to the device or by decoding the advertisements. All drivers produce
+// the same Reading type, so scheduling and metrics are shared between all devices.
+package driver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/go-ble/ble"
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/pkg/pipeline"
+)
+
+// Default contains the name of the driver used for sensors which do not specify one.
+const Default = "miflora"
+
+const (
+	// ProtocolGATT is used by drivers connecting to the device and reading GATT characteristics.
+	ProtocolGATT = "gatt"
+	// ProtocolAdvertisement is used by drivers decoding vendor-specific advertisements.
+	ProtocolAdvertisement = "advertisement"
+	// ProtocolBTHome is used by drivers decoding advertisements in the BTHome format.
+	ProtocolBTHome = "bthome"
+)
+
+const (
+	// DeviceTypeSoil is used for devices measuring soil conditions of a single plant.
+	DeviceTypeSoil = "soil"
+	// DeviceTypeClimate is used for devices measuring the ambient climate close to plants.
+	DeviceTypeClimate = "climate"
+)
+
+// Reading contains the values read from a sensor. It is defined in pkg/pipeline, so that the steps of custom builds
+// can use it.
+type Reading = pipeline.Reading
+
+// FieldNames contains the names of all values of a Reading, as accepted by Field.
+var FieldNames = pipeline.FieldNames
+
+// Float returns a pointer to a copy of the value.
+func Float(v float64) *float64 {
+	return pipeline.Float(v)
+}
+
+// Driver describes how to get data from one type of device.
+type Driver struct {
+	// Name is used to select the driver in the sensor configuration.
+	Name string
+	// DeviceType describes what the device measures. Defaults to DeviceTypeSoil.
+	DeviceType string
+	// Model contains the name of the device model supported by this driver.
+	Model string
+	// Protocol describes how the data is transferred from the device.
+	Protocol string
+	// Match reports whether an advertisement has been sent by a device supported by this driver.
+	Match func(a ble.Advertisement) bool
+	// Read connects to the device and reads the current values. It is nil for drivers which only support advertisements.
+	Read func(ctx context.Context, log logrus.FieldLogger, device ble.Device, macAddress string, opts Options) (Reading, error)
+	// History reads the values stored in the memory of the device, at most limit entries starting with the most
+	// recent one. It is nil for drivers of devices without a history.
+	History func(ctx context.Context, log logrus.FieldLogger, device ble.Device, macAddress string, limit int) ([]Reading, error)
+	// Blink makes the LED of the device blink, so that it can be identified. It is nil for drivers of devices without
+	// an LED which can be controlled.
+	Blink func(ctx context.Context, log logrus.FieldLogger, device ble.Device, macAddress string) error
+	// Decode extracts the values from an advertisement. It is nil for drivers which need a connection.
+	Decode func(a ble.Advertisement, opts Options) (Reading, error)
+	// Parts lists the parts of the data which can be read separately using Options.Parts. It is empty for drivers
+	// which always read all values.
+	Parts []string
+	// SlowParts lists the parts containing values which change slowly, like the firmware version and the battery
+	// level. They do not need to be read as often as the other parts.
+	SlowParts []string
+}
+
+// FastParts returns the parts which are not slow. It returns nil if the driver does not support reading parts or
+// if all parts are slow.
+func (d Driver) FastParts() []string {
+	var result []string
+	for _, part := range d.Parts {
+		if !contains(d.SlowParts, part) {
+			result = append(result, part)
+		}
+	}
+
+	return result
+}
+
+// HasSlowParts returns true if reading the parts includes one of the slow parts. Reading no specific parts
+// reads all parts.
+func (d Driver) HasSlowParts(parts []string) bool {
+	if len(parts) == 0 {
+		return len(d.SlowParts) > 0
+	}
+
+	for _, part := range parts {
+		if contains(d.SlowParts, part) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ReadFastParts returns true if one of the parts which are not slow has been read, when reading the parts failed for
+// the failed parts. Reading no specific parts reads all parts. Drivers which do not support reading parts or only have
+// slow parts always read all values.
+func (d Driver) ReadFastParts(parts, failed []string) bool {
+	fast := d.FastParts()
+	if len(fast) == 0 {
+		return true
+	}
+
+	for _, part := range fast {
+		if (len(parts) == 0 || contains(parts, part)) && !contains(failed, part) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Options contains device-specific settings passed to a driver.
+type Options struct {
+	// Key is used to decrypt the data sent by the device.
+	Key []byte
+	// Parts restricts an active read to the listed parts of the data. All parts are read if it is empty.
+	Parts []string
+}
+
+// PartialError is returned by Read when only some parts of the data could be read.
+// The reading returned together with the error contains the values of the successful parts.
+type PartialError struct {
+	// Failed contains the names of the parts which could not be read.
+	Failed []string
+	Err    error
+}
+
+func (e *PartialError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
+
+// ConnectError is returned by Read when the connection to the device could not be established.
+type ConnectError struct {
+	Err error
+}
+
+func (e *ConnectError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConnectError) Unwrap() error {
+	return e.Err
+}
+
+// PanicError is returned by Read when the driver panicked while reading the device. The panic has been recovered.
+type PanicError struct {
+	Err error
+}
+
+func (e *PanicError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PanicError) Unwrap() error {
+	return e.Err
+}
+
+// Passive reports whether the driver gets its data only from advertisements.
+func (d Driver) Passive() bool {
+	return d.Read == nil && d.Decode != nil
+}
+
+// DecodeAdvertisement extracts the values from an advertisement using Decode. Malformed advertisements are
+// reported as errors, even if the decoder panics.
+func (d Driver) DecodeAdvertisement(a ble.Advertisement, opts Options) (reading Reading, err error) {
+	if d.Decode == nil {
+		return Reading{}, fmt.Errorf("driver %q does not support advertisements", d.Name)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			reading = Reading{}
+			err = fmt.Errorf("panic decoding advertisement: %v", r)
+		}
+	}()
+
+	return d.Decode(a, opts)
+}
+
+// ReadDevice reads the current values from the device using Read. A panic of the driver, for example caused by
+// malformed data sent by the device, is reported as error.
+func (d Driver) ReadDevice(ctx context.Context, log logrus.FieldLogger, device ble.Device, macAddress string, opts Options) (reading Reading, err error) {
+	if d.Read == nil {
+		return Reading{}, fmt.Errorf("driver %q does not support reading data actively", d.Name)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			reading = Reading{}
+			err = &PanicError{Err: fmt.Errorf("panic reading device: %v", r)}
+		}
+	}()
+
+	return d.Read(ctx, log, device, macAddress, opts)
+}
+
+// ReadHistory reads the values stored on the device using History. A panic of the driver is reported as error.
+func (d Driver) ReadHistory(ctx context.Context, log logrus.FieldLogger, device ble.Device, macAddress string, limit int) (readings []Reading, err error) {
+	if d.History == nil {
+		return nil, fmt.Errorf("driver %q does not support reading the history", d.Name)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			readings = nil
+			err = fmt.Errorf("panic reading history: %v", r)
+		}
+	}()
+
+	return d.History(ctx, log, device, macAddress, limit)
+}
+
+// BlinkDevice makes the LED of the device blink using Blink. A panic of the driver is reported as error.
+func (d Driver) BlinkDevice(ctx context.Context, log logrus.FieldLogger, device ble.Device, macAddress string) (err error) {
+	if d.Blink == nil {
+		return fmt.Errorf("driver %q does not support blinking", d.Name)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic blinking device: %v", r)
+		}
+	}()
+
+	return d.Blink(ctx, log, device, macAddress)
+}
+
+// matches reports whether the advertisement has been sent by a device supported by the driver. A panic of the
+// driver is treated as no match.
+func (d Driver) matches(a ble.Advertisement) (ok bool) {
+	if d.Match == nil {
+		return false
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			ok = false
+		}
+	}()
+
+	return d.Match(a)
+}
+
+var (
+	registryLock sync.RWMutex
+	registry     = map[string]Driver{}
+)
+
+// Register adds a driver to the registry. It panics if a driver with the same name is already registered.
+func Register(d Driver) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	if _, ok := registry[d.Name]; ok {
+		panic(fmt.Sprintf("driver already registered: %s", d.Name))
+	}
+
+	if d.DeviceType == "" {
+		d.DeviceType = DeviceTypeSoil
+	}
+
+	registry[d.Name] = d
+}
+
+// Get returns the driver with the specified name.
+func Get(name string) (Driver, error) {
+	if name == "" {
+		name = Default
+	}
+
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	d, ok := registry[name]
+	if !ok {
+		return Driver{}, fmt.Errorf("unknown driver: %s", name)
+	}
+
+	return d, nil
+}
+
+// Match returns the driver responsible for the device which sent the advertisement.
+func Match(a ble.Advertisement) (Driver, bool) {
+	for _, d := range All() {
+		if d.matches(a) {
+			return d, true
+		}
+	}
+
+	return Driver{}, false
+}
+
+// All returns all registered drivers sorted by name.
+func All() []Driver {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	result := make([]Driver, 0, len(registry))
+	for _, d := range registry {
+		result = append(result, d)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
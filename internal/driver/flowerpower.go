@@ -0,0 +1,51 @@
+package driver
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-ble/ble"
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/pkg/flowerpower"
+)
+
+func init() {
+	Register(Driver{
+		Name:     "flowerpower",
+		Model:    "Parrot Flower Power",
+		Protocol: ProtocolGATT,
+		Match:    matchFlowerPower,
+		Read:     readFlowerPower,
+	})
+}
+
+func matchFlowerPower(a ble.Advertisement) bool {
+	if strings.HasPrefix(a.LocalName(), "Flower power") {
+		return true
+	}
+
+	for _, u := range a.Services() {
+		if u.Equal(flowerpower.LiveServiceUUID) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func readFlowerPower(ctx context.Context, log logrus.FieldLogger, device ble.Device, macAddress string, _ Options) (Reading, error) {
+	data, err := flowerpower.ReadData(ctx, log, device, macAddress)
+	if err != nil {
+		return Reading{}, err
+	}
+
+	return Reading{
+		Time:         data.Time,
+		Firmware:     data.Firmware,
+		Battery:      Float(float64(data.Battery)),
+		Temperature:  Float(data.Temperature),
+		Moisture:     Float(data.Moisture),
+		Light:        Float(data.Light),
+		Conductivity: Float(data.Conductivity),
+	}, nil
+}
@@ -0,0 +1,150 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-ble/ble"
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/pkg/miflora"
+)
+
+func init() {
+	Register(Driver{
+		Name:     "miflora",
+		Model:    "HHCCJCY01",
+		Protocol: ProtocolGATT,
+		Match:    matchMiflora,
+		Read:     readMiflora,
+		History:  historyMiflora,
+		Blink:    miflora.Blink,
+		Decode:   decodeMiflora,
+		Parts: []string{
+			miflora.PartFirmware,
+			miflora.PartSensors,
+		},
+		SlowParts: []string{
+			miflora.PartFirmware,
+		},
+	})
+}
+
+func matchMiflora(a ble.Advertisement) bool {
+	if strings.EqualFold(a.LocalName(), "Flower care") {
+		return true
+	}
+
+	// The service UUID is used by all Xiaomi devices, like the LYWSD03MMC thermometers.
+	beacon, err := miflora.DecodeBeacon(a)
+	return err == nil && beacon.ProductID == miflora.ProductID
+}
+
+func readMiflora(ctx context.Context, log logrus.FieldLogger, device ble.Device, macAddress string, opts Options) (Reading, error) {
+	parts := opts.Parts
+	if len(parts) == 0 {
+		parts = []string{miflora.PartFirmware, miflora.PartSensors}
+	}
+
+	data, err := miflora.ReadParts(ctx, log, device, macAddress, parts...)
+	var partial *miflora.PartialError
+	if err != nil && !errors.As(err, &partial) {
+		return Reading{}, err
+	}
+
+	reading := Reading{
+		Time: data.Time,
+	}
+	var failed []string
+	for _, part := range parts {
+		if partialFailed(partial, part) {
+			failed = append(failed, part)
+			continue
+		}
+
+		switch part {
+		case miflora.PartFirmware:
+			reading.Firmware = data.Firmware.Version
+			reading.Battery = Float(float64(data.Firmware.Battery))
+		case miflora.PartSensors:
+			reading.Temperature = Float(data.Sensors.Temperature)
+			reading.Moisture = Float(float64(data.Sensors.Moisture))
+			reading.Light = Float(float64(data.Sensors.Light))
+			reading.Conductivity = Float(float64(data.Sensors.Conductivity))
+		}
+	}
+
+	if partial != nil {
+		return reading, &PartialError{
+			Failed: failed,
+			Err:    partial,
+		}
+	}
+
+	return reading, nil
+}
+
+func historyMiflora(ctx context.Context, log logrus.FieldLogger, device ble.Device, macAddress string, limit int) ([]Reading, error) {
+	entries, err := miflora.ReadHistory(ctx, log, device, macAddress, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	readings := make([]Reading, len(entries))
+	for i, e := range entries {
+		readings[i] = Reading{
+			Time:         e.Time,
+			Temperature:  Float(e.Temperature),
+			Moisture:     Float(float64(e.Moisture)),
+			Light:        Float(float64(e.Light)),
+			Conductivity: Float(float64(e.Conductivity)),
+		}
+	}
+
+	return readings, nil
+}
+
+// decodeMiflora extracts the value contained in a MiBeacon advertisement. Every advertisement contains only one
+// of the values, the others are taken from the previous readings.
+func decodeMiflora(a ble.Advertisement, _ Options) (Reading, error) {
+	beacon, err := miflora.DecodeBeacon(a)
+	if err != nil {
+		return Reading{}, err
+	}
+
+	if beacon.ProductID != miflora.ProductID {
+		return Reading{}, fmt.Errorf("advertisement is from another device: product ID %#04x", beacon.ProductID)
+	}
+
+	reading := Reading{
+		Time: time.Now(),
+	}
+	if beacon.Temperature != nil {
+		reading.Temperature = Float(*beacon.Temperature)
+	}
+	if beacon.Light != nil {
+		reading.Light = Float(float64(*beacon.Light))
+	}
+	if beacon.Moisture != nil {
+		reading.Moisture = Float(float64(*beacon.Moisture))
+	}
+	if beacon.Conductivity != nil {
+		reading.Conductivity = Float(float64(*beacon.Conductivity))
+	}
+	if beacon.Battery != nil {
+		reading.Battery = Float(float64(*beacon.Battery))
+	}
+
+	return reading, nil
+}
+
+func partialFailed(partial *miflora.PartialError, part string) bool {
+	if partial == nil {
+		return false
+	}
+
+	_, ok := partial.Failed[part]
+	return ok
+}
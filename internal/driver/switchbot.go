@@ -0,0 +1,38 @@
+package driver
+
+import (
+	"time"
+
+	"github.com/go-ble/ble"
+	"github.com/xperimental/flowercare-exporter/pkg/switchbot"
+)
+
+func init() {
+	Register(Driver{
+		Name:       "switchbot",
+		Model:      "SwitchBot Meter",
+		Protocol:   ProtocolAdvertisement,
+		DeviceType: DeviceTypeClimate,
+		Match:      matchSwitchBot,
+		Decode:     decodeSwitchBot,
+	})
+}
+
+func matchSwitchBot(a ble.Advertisement) bool {
+	_, err := switchbot.Decode(a)
+	return err == nil
+}
+
+func decodeSwitchBot(a ble.Advertisement, _ Options) (Reading, error) {
+	data, err := switchbot.Decode(a)
+	if err != nil {
+		return Reading{}, err
+	}
+
+	return Reading{
+		Time:        time.Now(),
+		Battery:     Float(float64(data.Battery)),
+		Temperature: Float(data.Temperature),
+		Humidity:    Float(data.Humidity),
+	}, nil
+}
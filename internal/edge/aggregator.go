@@ -0,0 +1,127 @@
+package edge
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+type nodeState struct {
+	Epoch int64
+	Ack   uint64
+}
+
+// Aggregator accepts readings pushed by edge exporters.
+type Aggregator struct {
+	log   logrus.FieldLogger
+	store func(config.Sensor, driver.Reading)
+
+	lock  sync.Mutex
+	nodes map[string]nodeState
+}
+
+// NewAggregator creates a new Aggregator, which passes every accepted reading to the store function.
+func NewAggregator(log logrus.FieldLogger, store func(config.Sensor, driver.Reading)) *Aggregator {
+	return &Aggregator{
+		log:   log,
+		store: store,
+		nodes: map[string]nodeState{},
+	}
+}
+
+// Register adds the aggregator endpoints to the provided mux.
+func (a *Aggregator) Register(mux *http.ServeMux) {
+	mux.HandleFunc(PushPath, a.handlePush)
+	mux.HandleFunc(AckPath, a.handleAck)
+}
+
+func (a *Aggregator) handlePush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PushRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "can not decode request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Node == "" {
+		http.Error(w, "node can not be empty", http.StatusBadRequest)
+		return
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	state := a.nodeState(req.Node, req.Epoch)
+	accepted := 0
+	for _, reading := range req.Readings {
+		if reading.Seq <= state.Ack {
+			continue
+		}
+
+		a.store(reading.Sensor, reading.Data)
+		state.Ack = reading.Seq
+		accepted++
+	}
+	a.nodes[req.Node] = state
+	a.log.Debugf("Accepted %d of %d readings from %q, acknowledged %d.", accepted, len(req.Readings), req.Node, state.Ack)
+
+	writeAck(w, state.Ack)
+}
+
+func (a *Aggregator) handleAck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	node := r.URL.Query().Get("node")
+	if node == "" {
+		http.Error(w, "node can not be empty", http.StatusBadRequest)
+		return
+	}
+
+	epoch, err := strconv.ParseInt(r.URL.Query().Get("epoch"), 10, 64)
+	if err != nil {
+		http.Error(w, "can not parse epoch: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	state := a.nodeState(node, epoch)
+	a.nodes[node] = state
+
+	writeAck(w, state.Ack)
+}
+
+// nodeState returns the state of a node, resetting it if the node has started a new epoch. The epochs are random, so
+// every epoch different from the current one is a new one.
+// Needs to be called with the lock held.
+func (a *Aggregator) nodeState(node string, epoch int64) nodeState {
+	state, ok := a.nodes[node]
+	if !ok || state.Epoch != epoch {
+		a.log.Infof("Edge node %q started epoch %d.", node, epoch)
+		return nodeState{
+			Epoch: epoch,
+		}
+	}
+
+	return state
+}
+
+func writeAck(w http.ResponseWriter, ack uint64) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(AckResponse{Ack: ack}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,43 @@
+// Package edge implements a simple acknowledged push protocol between edge exporters and an aggregator.
+//
+// Every reading taken by an edge exporter is assigned a sequence number and kept in a buffer until the
+// aggregator has acknowledged it. The aggregator remembers the highest sequence number it has accepted
+// for each edge node, so readings which are sent again after a lost response are not applied twice.
+// Sequence numbers are scoped to an epoch, a random number chosen every time the edge exporter is started. The
+// buffer is only kept in memory, so readings which have not been acknowledged are lost when the edge exporter is
+// restarted.
+package edge
+
+import (
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+const (
+	// PathPrefix is the common prefix of the paths of the aggregator. The paths are part of the HTTP server of the
+	// exporter, but unlike the control API they need the credentials of the server.
+	PathPrefix = "/api/v1/edge/"
+	// PushPath is the path on the aggregator accepting batches of readings.
+	PushPath = PathPrefix + "push"
+	// AckPath is the path on the aggregator returning the last acknowledged sequence number of a node.
+	AckPath = PathPrefix + "ack"
+)
+
+// Reading contains a single reading taken by an edge exporter.
+type Reading struct {
+	Seq    uint64         `json:"seq"`
+	Sensor config.Sensor  `json:"sensor"`
+	Data   driver.Reading `json:"data"`
+}
+
+// PushRequest is sent by the edge exporter to deliver buffered readings.
+type PushRequest struct {
+	Node     string    `json:"node"`
+	Epoch    int64     `json:"epoch"`
+	Readings []Reading `json:"readings"`
+}
+
+// AckResponse is returned by the aggregator and contains the highest sequence number it has accepted.
+type AckResponse struct {
+	Ack uint64 `json:"ack"`
+}
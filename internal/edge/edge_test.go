@@ -0,0 +1,251 @@
+package edge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+var testSensor = config.Sensor{
+	MacAddress: "C4:7C:8D:6A:00:01",
+	Name:       "tomatoes",
+}
+
+type testAggregator struct {
+	*Aggregator
+	server *httptest.Server
+
+	lock   sync.Mutex
+	stored []float64
+	// failPushes is the number of pushes which are applied, but answered with an error, like a lost response.
+	failPushes int
+}
+
+func newTestAggregator(t *testing.T) *testAggregator {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	a := &testAggregator{}
+	a.Aggregator = NewAggregator(log, func(_ config.Sensor, reading driver.Reading) {
+		a.lock.Lock()
+		defer a.lock.Unlock()
+
+		a.stored = append(a.stored, *reading.Temperature)
+	})
+
+	mux := http.NewServeMux()
+	a.Register(mux)
+	a.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != PushPath {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		a.lock.Lock()
+		fail := a.failPushes > 0
+		if fail {
+			a.failPushes--
+		}
+		a.lock.Unlock()
+
+		if !fail {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		mux.ServeHTTP(httptest.NewRecorder(), r)
+		http.Error(w, "lost response", http.StatusBadGateway)
+	}))
+	t.Cleanup(a.server.Close)
+
+	return a
+}
+
+func (a *testAggregator) storedValues() []float64 {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return append([]float64{}, a.stored...)
+}
+
+func (a *testAggregator) newPusher() *Pusher {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	return NewPusher(log, config.EdgeConfig{
+		PushURL:     a.server.URL,
+		NodeID:      "greenhouse",
+		BufferSize:  100,
+		PushTimeout: time.Second,
+	}, http.DefaultTransport)
+}
+
+func (a *testAggregator) post(t *testing.T, req PushRequest) (int, uint64) {
+	t.Helper()
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("can not encode request: %s", err)
+	}
+
+	res, err := http.Post(a.server.URL+PushPath, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("error pushing: %s", err)
+	}
+	defer res.Body.Close()
+
+	var ack AckResponse
+	if res.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(res.Body).Decode(&ack); err != nil {
+			t.Fatalf("can not decode response: %s", err)
+		}
+	}
+
+	return res.StatusCode, ack.Ack
+}
+
+func addReadings(p *Pusher, values ...float64) {
+	for _, v := range values {
+		p.Add(testSensor, driver.Reading{
+			Time:        time.Now(),
+			Temperature: driver.Float(v),
+		})
+	}
+}
+
+func checkValues(t *testing.T, got []float64, want ...float64) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got stored values %v, want %v", got, want)
+	}
+
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("got stored values %v, want %v", got, want)
+		}
+	}
+}
+
+func TestPusherResend(t *testing.T) {
+	a := newTestAggregator(t)
+	p := a.newPusher()
+	ctx := context.Background()
+
+	addReadings(p, 1, 2)
+	a.failPushes = 1
+	if err := p.flush(ctx); err == nil {
+		t.Fatal("expected error for lost response")
+	}
+	checkValues(t, a.storedValues(), 1, 2)
+
+	// The pusher asks for the acknowledged sequence number instead of sending the readings again.
+	addReadings(p, 3)
+	if err := p.flush(ctx); err != nil {
+		t.Fatalf("got error %q", err)
+	}
+	checkValues(t, a.storedValues(), 1, 2, 3)
+
+	if len(p.nextBatch()) != 0 {
+		t.Error("acknowledged readings are still buffered")
+	}
+}
+
+func TestPusherUnreachable(t *testing.T) {
+	a := newTestAggregator(t)
+	p := a.newPusher()
+	ctx := context.Background()
+
+	a.server.Close()
+	addReadings(p, 1, 2)
+	if err := p.flush(ctx); err == nil {
+		t.Fatal("expected error for unreachable aggregator")
+	}
+
+	b := newTestAggregator(t)
+	p.cfg.PushURL = b.server.URL
+	if err := p.flush(ctx); err != nil {
+		t.Fatalf("got error %q", err)
+	}
+	checkValues(t, b.storedValues(), 1, 2)
+}
+
+func TestAggregatorDuplicate(t *testing.T) {
+	a := newTestAggregator(t)
+	req := PushRequest{
+		Node:  "greenhouse",
+		Epoch: 42,
+		Readings: []Reading{
+			{Seq: 1, Sensor: testSensor, Data: driver.Reading{Temperature: driver.Float(1)}},
+			{Seq: 2, Sensor: testSensor, Data: driver.Reading{Temperature: driver.Float(2)}},
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		status, ack := a.post(t, req)
+		if status != http.StatusOK || ack != 2 {
+			t.Fatalf("push %d: got status %d and ack %d, want %d and 2", i, status, ack, http.StatusOK)
+		}
+	}
+	checkValues(t, a.storedValues(), 1, 2)
+
+	// Overlapping batches only apply the new readings.
+	req.Readings = append(req.Readings, Reading{Seq: 3, Sensor: testSensor, Data: driver.Reading{Temperature: driver.Float(3)}})
+	if _, ack := a.post(t, req); ack != 3 {
+		t.Fatalf("got ack %d, want 3", ack)
+	}
+	checkValues(t, a.storedValues(), 1, 2, 3)
+}
+
+func TestAggregatorEpochChange(t *testing.T) {
+	a := newTestAggregator(t)
+	ctx := context.Background()
+
+	first := a.newPusher()
+	first.epoch = 100
+	addReadings(first, 1, 2)
+	if err := first.flush(ctx); err != nil {
+		t.Fatalf("got error %q", err)
+	}
+
+	// A restarted node uses a new epoch, which can be lower than the previous one, and starts counting again.
+	restarted := a.newPusher()
+	restarted.epoch = 50
+	addReadings(restarted, 3)
+	if err := restarted.flush(ctx); err != nil {
+		t.Fatalf("got error %q", err)
+	}
+	checkValues(t, a.storedValues(), 1, 2, 3)
+
+	ack, err := restarted.fetchAck(ctx)
+	if err != nil {
+		t.Fatalf("got error %q", err)
+	}
+	if ack != 1 {
+		t.Errorf("got ack %d, want 1", ack)
+	}
+}
+
+func TestAggregatorAckMethod(t *testing.T) {
+	a := newTestAggregator(t)
+
+	res, err := http.Post(a.server.URL+AckPath+"?node=greenhouse&epoch=1", "text/plain", nil)
+	if err != nil {
+		t.Fatalf("got error %q", err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("got status %d, want %d", res.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,253 @@
+package edge
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+const maxBatchSize = 100
+
+// Pusher buffers readings and delivers them to an aggregator.
+type Pusher struct {
+	log    logrus.FieldLogger
+	cfg    config.EdgeConfig
+	client *http.Client
+	epoch  int64
+
+	lock    sync.Mutex
+	nextSeq uint64
+	buffer  []Reading
+	resumed bool
+}
+
+// NewPusher creates a new Pusher using the provided configuration. All requests are sent using the transport.
+func NewPusher(log logrus.FieldLogger, cfg config.EdgeConfig, transport http.RoundTripper) *Pusher {
+	return &Pusher{
+		log: log,
+		cfg: cfg,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.PushTimeout,
+		},
+		epoch:   newEpoch(),
+		nextSeq: 1,
+	}
+}
+
+// newEpoch returns a random epoch. A counter or the time could repeat an earlier epoch, for example when the clock
+// of the edge exporter is behind after a restart.
+func newEpoch() int64 {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return time.Now().UnixNano()
+	}
+
+	return int64(binary.LittleEndian.Uint64(b[:]))
+}
+
+// Add puts a new reading into the buffer. It can be used as an updater.Listener. The key of the sensor is redacted, so
+// that it is not sent to the aggregator.
+func (p *Pusher) Add(sensor config.Sensor, data driver.Reading) {
+	if p.tooOld(data.Time, time.Now()) {
+		p.log.Debugf("Skipping reading of %q from %s, it is older than %s.", sensor, data.Time, p.cfg.MaxAge)
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.buffer = append(p.buffer, Reading{
+		Seq:    p.nextSeq,
+		Sensor: sensor.Redacted(),
+		Data:   data,
+	})
+	p.nextSeq++
+
+	if len(p.buffer) > p.cfg.BufferSize {
+		dropped := len(p.buffer) - p.cfg.BufferSize
+		p.log.Warnf("Edge buffer full, dropping %d oldest readings.", dropped)
+		p.buffer = p.buffer[dropped:]
+	}
+}
+
+// Start starts the background loop delivering readings to the aggregator.
+func (p *Pusher) Start(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(p.cfg.PushInterval)
+		defer ticker.Stop()
+
+		p.log.Debug("Edge pusher ready.")
+		for {
+			select {
+			case <-ctx.Done():
+				p.log.Debug("Shutting down edge pusher.")
+				return
+			case <-ticker.C:
+				if err := p.flush(ctx); err != nil {
+					p.log.Errorf("Error pushing readings to aggregator: %s", err)
+				}
+			}
+		}
+	}()
+}
+
+func (p *Pusher) flush(ctx context.Context) error {
+	if !p.isResumed() {
+		ack, err := p.fetchAck(ctx)
+		if err != nil {
+			return fmt.Errorf("can not get acknowledged sequence: %s", err)
+		}
+
+		p.acknowledge(ack)
+		p.setResumed(true)
+	}
+
+	for {
+		batch := p.nextBatch()
+		if len(batch) == 0 {
+			return nil
+		}
+
+		ack, err := p.push(ctx, batch)
+		if err != nil {
+			// Ask the aggregator where to resume, as the request might have been applied.
+			p.setResumed(false)
+			return err
+		}
+
+		p.acknowledge(ack)
+		if ack < batch[len(batch)-1].Seq {
+			return fmt.Errorf("aggregator acknowledged only up to %d of %d", ack, batch[len(batch)-1].Seq)
+		}
+	}
+}
+
+// tooOld returns true if a reading should not be pushed anymore, because it is older than the maximum age.
+func (p *Pusher) tooOld(t, now time.Time) bool {
+	return p.cfg.MaxAge > 0 && now.Sub(t) > p.cfg.MaxAge
+}
+
+func (p *Pusher) nextBatch() []Reading {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	// Readings buffered while the aggregator was unreachable can get too old. Leaving out sequence numbers is fine,
+	// as the aggregator only keeps the highest one.
+	now := time.Now()
+	kept := p.buffer[:0]
+	for _, r := range p.buffer {
+		if !p.tooOld(r.Data.Time, now) {
+			kept = append(kept, r)
+		}
+	}
+	if dropped := len(p.buffer) - len(kept); dropped > 0 {
+		p.log.Debugf("Skipping %d buffered readings older than %s.", dropped, p.cfg.MaxAge)
+	}
+	p.buffer = kept
+
+	size := len(p.buffer)
+	if size > maxBatchSize {
+		size = maxBatchSize
+	}
+
+	batch := make([]Reading, size)
+	copy(batch, p.buffer[:size])
+	return batch
+}
+
+func (p *Pusher) acknowledge(ack uint64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	drop := 0
+	for drop < len(p.buffer) && p.buffer[drop].Seq <= ack {
+		drop++
+	}
+	p.buffer = p.buffer[drop:]
+}
+
+func (p *Pusher) isResumed() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.resumed
+}
+
+func (p *Pusher) setResumed(resumed bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.resumed = resumed
+}
+
+func (p *Pusher) push(ctx context.Context, batch []Reading) (uint64, error) {
+	body, err := json.Marshal(PushRequest{
+		Node:     p.cfg.NodeID,
+		Epoch:    p.epoch,
+		Readings: batch,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("can not encode request: %s", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.PushURL+PushPath, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("can not create request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return p.doAck(req)
+}
+
+func (p *Pusher) fetchAck(ctx context.Context) (uint64, error) {
+	query := url.Values{}
+	query.Set("node", p.cfg.NodeID)
+	query.Set("epoch", strconv.FormatInt(p.epoch, 10))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.PushURL+AckPath+"?"+query.Encode(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("can not create request: %s", err)
+	}
+
+	return p.doAck(req)
+}
+
+func (p *Pusher) doAck(req *http.Request) (uint64, error) {
+	if p.cfg.PushToken != "" {
+		req.Header.Set("Authorization", "Bearer "+p.cfg.PushToken)
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status: %s", res.Status)
+	}
+
+	var ack AckResponse
+	if err := json.NewDecoder(res.Body).Decode(&ack); err != nil {
+		return 0, fmt.Errorf("can not decode response: %s", err)
+	}
+
+	return ack.Ack, nil
+}
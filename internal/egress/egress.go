@@ -0,0 +1,107 @@
+// Package egress keeps track of the outbound connections of the exporter and enforces the egress policy.
+package egress
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Destination is an outbound connection configured by a feature of the exporter.
+type Destination struct {
+	Feature string
+	URL     string
+}
+
+func (d Destination) String() string {
+	return fmt.Sprintf("%s -> %s", d.Feature, d.URL)
+}
+
+// Policy restricts the outbound connections of the exporter.
+type Policy struct {
+	// Disabled denies all outbound connections.
+	Disabled bool
+	// Allow contains the hosts outbound connections are allowed to. An entry starting with "*." matches all
+	// subdomains. If Allow is empty, all hosts are allowed.
+	Allow []string
+}
+
+// Check returns an error if the destination is not allowed by the policy.
+func (p Policy) Check(d Destination) error {
+	u, err := url.Parse(d.URL)
+	if err != nil {
+		return fmt.Errorf("%s: can not parse URL: %s", d.Feature, err)
+	}
+
+	if err := p.checkHost(u.Hostname()); err != nil {
+		return fmt.Errorf("%s: %s", d.Feature, err)
+	}
+
+	return nil
+}
+
+// CheckHost returns an error if connections to the host are not allowed by the policy. It is used for destinations
+// which are only known at runtime, like discovered devices.
+func (p Policy) CheckHost(host string) error {
+	return p.checkHost(host)
+}
+
+func (p Policy) checkHost(host string) error {
+	if p.Disabled {
+		return fmt.Errorf("outbound connections are disabled: %s", host)
+	}
+
+	if len(p.Allow) == 0 {
+		return nil
+	}
+
+	host = strings.ToLower(host)
+	for _, allowed := range p.Allow {
+		allowed = strings.ToLower(allowed)
+		if suffix := strings.TrimPrefix(allowed, "*"); suffix != allowed {
+			if strings.HasSuffix(host, suffix) {
+				return nil
+			}
+			continue
+		}
+
+		if host == allowed {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("host is not in egress allowlist: %s", host)
+}
+
+// Transport wraps the base transport, so that requests to destinations not allowed by the policy fail.
+// If base is nil, http.DefaultTransport is used.
+func (p Policy) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &transport{
+		policy: p,
+		base:   base,
+	}
+}
+
+type transport struct {
+	policy Policy
+	base   http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Hostname()
+	if h, _, err := net.SplitHostPort(req.URL.Host); err == nil {
+		host = h
+	}
+
+	if err := t.policy.checkHost(host); err != nil {
+		return nil, err
+	}
+
+	return t.base.RoundTrip(req)
+}
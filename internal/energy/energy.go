@@ -0,0 +1,178 @@
+// Package energy estimates how much of the battery of the sensors is used, so that the refresh settings can be tuned
+// against the battery life.
+//
+// The estimate is a rough model: a sensor uses a constant amount of energy for measuring and advertising, which the
+// exporter can not change, and draws an additional current while it is connected. The time connected is taken from
+// the duration of the reads, which includes the time for establishing the connection, so the estimate errs on the
+// high side.
+package energy
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/xperimental/flowercare-exporter/internal/anonymize"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+// window is the duration of the connections used for the estimate.
+const window = 24 * time.Hour
+
+// profile describes the energy usage of a device model.
+type profile struct {
+	// BaselinePerDay is the charge in mAh used per day without any connections.
+	BaselinePerDay float64
+	// ConnectedCurrent is the additional current in mA drawn while connected.
+	ConnectedCurrent float64
+	// Capacity is the usable capacity of the battery in mAh.
+	Capacity float64
+}
+
+// profiles contains the energy usage by driver. Sensors using other drivers are not estimated.
+var profiles = map[string]profile{
+	// Flower Care sensors use a CR2032 coin cell, which lasts about a year when the sensor is only read by the app
+	// now and then.
+	driver.Default: {
+		BaselinePerDay:   0.55,
+		ConnectedCurrent: 6,
+		Capacity:         220,
+	},
+}
+
+// profileFor returns the profile of the sensor. It returns false for sensors which are not connected to or whose
+// energy usage is not known.
+func profileFor(sensor config.Sensor) (profile, bool) {
+	if sensor.Passive() {
+		return profile{}, false
+	}
+
+	d, err := driver.Get(sensor.Driver)
+	if err != nil {
+		return profile{}, false
+	}
+
+	p, ok := profiles[d.Name]
+	return p, ok
+}
+
+type connection struct {
+	Time     time.Time
+	Duration time.Duration
+}
+
+// Estimator collects the connections to the sensors and exports the estimated energy usage.
+type Estimator struct {
+	sensors    func() []config.Sensor
+	anonymizer *anonymize.Anonymizer
+	start      time.Time
+
+	lock        sync.Mutex
+	connections map[string][]connection
+
+	usageDesc *prometheus.Desc
+	lifeDesc  *prometheus.Desc
+}
+
+// New creates an Estimator for the sensors returned by sensors.
+func New(sensors func() []config.Sensor, anonymizer *anonymize.Anonymizer) *Estimator {
+	labels := []string{"macaddress", "name"}
+	return &Estimator{
+		sensors:     sensors,
+		anonymizer:  anonymizer,
+		start:       time.Now(),
+		connections: map[string][]connection{},
+		usageDesc: prometheus.NewDesc(
+			"flowercare_energy_estimate_mah_per_day",
+			"Estimated charge used by the sensor per day in mAh, based on the connections of the last day.",
+			labels, nil),
+		lifeDesc: prometheus.NewDesc(
+			"flowercare_energy_estimate_battery_life_days",
+			"Estimated life of a new battery in days, if the sensor keeps being read as during the last day.",
+			labels, nil),
+	}
+}
+
+// Observe records a connection attempt. It can be used as an updater.ConnectListener. Attempts which did not connect
+// are not counted, as the sensor only wakes up its radio for connections it accepts.
+func (e *Estimator) Observe(sensor config.Sensor, duration time.Duration, connected bool) {
+	if !connected {
+		return
+	}
+
+	now := time.Now()
+	key := strings.ToUpper(sensor.MacAddress)
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.connections[key] = append(prune(e.connections[key], now), connection{
+		Time:     now,
+		Duration: duration,
+	})
+}
+
+// prune removes the connections which are older than the window.
+func prune(connections []connection, now time.Time) []connection {
+	for i, c := range connections {
+		if now.Sub(c.Time) < window {
+			return connections[i:]
+		}
+	}
+
+	return nil
+}
+
+// Estimate returns the estimated charge in mAh used by the sensor per day and the resulting life of a new battery in
+// days. It returns false for sensors without a known energy usage.
+func (e *Estimator) Estimate(sensor config.Sensor, now time.Time) (usage, life float64, ok bool) {
+	p, ok := profileFor(sensor)
+	if !ok {
+		return 0, 0, false
+	}
+
+	e.lock.Lock()
+	connections := prune(e.connections[strings.ToUpper(sensor.MacAddress)], now)
+	e.lock.Unlock()
+
+	var connected time.Duration
+	for _, c := range connections {
+		connected += c.Duration
+	}
+
+	// Shortly after the start, the connections are extrapolated to a whole day.
+	span := now.Sub(e.start)
+	if span > window {
+		span = window
+	}
+	if span < time.Minute {
+		span = time.Minute
+	}
+
+	perDay := connected.Hours() * float64(window) / float64(span)
+	usage = p.BaselinePerDay + p.ConnectedCurrent*perDay
+	return usage, p.Capacity / usage, true
+}
+
+// Describe implements prometheus.Collector
+func (e *Estimator) Describe(ch chan<- *prometheus.Desc) {
+	ch <- e.usageDesc
+	ch <- e.lifeDesc
+}
+
+// Collect implements prometheus.Collector
+func (e *Estimator) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now()
+	for _, s := range e.sensors() {
+		usage, life, ok := e.Estimate(s, now)
+		if !ok {
+			continue
+		}
+
+		labels := e.anonymizer.Sensor(s)
+		ch <- prometheus.MustNewConstMetric(e.usageDesc, prometheus.GaugeValue, usage, labels.MacAddress, labels.Name)
+		ch <- prometheus.MustNewConstMetric(e.lifeDesc, prometheus.GaugeValue, life, labels.MacAddress, labels.Name)
+	}
+}
@@ -0,0 +1,152 @@
+package esphome
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// service is the mDNS service announced by all ESPHome devices with the native API.
+	service = "_esphomelib._tcp.local."
+	// encryptionKey is the TXT key announced by devices using the encryption of the native API.
+	encryptionKey = "api_encryption"
+)
+
+var mdnsAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// device is an ESPHome device found using mDNS.
+type device struct {
+	// Name is the instance name of the device, which is also its host name.
+	Name string
+	Host string
+	// Addr is the address of the native API.
+	Addr      string
+	Encrypted bool
+}
+
+// discover queries the ESPHome devices in the local network using mDNS. The query is sent from a random port, so
+// that the devices answer using unicast and the exporter does not need to share port 5353 with other responders.
+func discover(ctx context.Context, timeout time.Duration) ([]device, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	name, err := dnsmessage.NewName(service)
+	if err != nil {
+		return nil, err
+	}
+
+	query := dnsmessage.Message{
+		Questions: []dnsmessage.Question{
+			{
+				Name:  name,
+				Type:  dnsmessage.TypePTR,
+				Class: dnsmessage.ClassINET,
+			},
+		},
+	}
+	packet, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.WriteToUDP(packet, mdnsAddr); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	records := &discoveryRecords{
+		instances: map[string]bool{},
+		srv:       map[string]dnsmessage.SRVResource{},
+		txt:       map[string][]string{},
+		addresses: map[string]net.IP{},
+	}
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			// The responses are collected until the deadline.
+			break
+		}
+
+		var msg dnsmessage.Message
+		if err := msg.Unpack(buf[:n]); err != nil {
+			continue
+		}
+		records.add(msg.Answers)
+		records.add(msg.Additionals)
+	}
+
+	return records.devices(), nil
+}
+
+// discoveryRecords collects the records of the responses, which can be split across several responses.
+type discoveryRecords struct {
+	instances map[string]bool
+	srv       map[string]dnsmessage.SRVResource
+	txt       map[string][]string
+	addresses map[string]net.IP
+}
+
+func (r *discoveryRecords) add(resources []dnsmessage.Resource) {
+	for _, res := range resources {
+		name := strings.ToLower(res.Header.Name.String())
+		switch body := res.Body.(type) {
+		case *dnsmessage.PTRResource:
+			if name == service {
+				r.instances[strings.ToLower(body.PTR.String())] = true
+			}
+		case *dnsmessage.SRVResource:
+			r.srv[name] = *body
+		case *dnsmessage.TXTResource:
+			r.txt[name] = body.TXT
+		case *dnsmessage.AResource:
+			r.addresses[name] = net.IP(body.A[:])
+		}
+	}
+}
+
+func (r *discoveryRecords) devices() []device {
+	var result []device
+	for instance := range r.instances {
+		srv, ok := r.srv[instance]
+		if !ok {
+			continue
+		}
+
+		host := strings.ToLower(srv.Target.String())
+		addr := strings.TrimSuffix(host, ".")
+		if ip, ok := r.addresses[host]; ok {
+			addr = ip.String()
+		}
+
+		d := device{
+			Name: strings.TrimSuffix(instance, "."+service),
+			Host: strings.TrimSuffix(host, "."),
+			Addr: net.JoinHostPort(addr, strconv.Itoa(int(srv.Port))),
+		}
+		for _, txt := range r.txt[instance] {
+			if strings.HasPrefix(txt, encryptionKey+"=") {
+				d.Encrypted = true
+			}
+		}
+
+		result = append(result, d)
+	}
+
+	return result
+}
@@ -0,0 +1,291 @@
+// Package esphome receives Bluetooth LE advertisements from ESPHome Bluetooth proxies, which extend the range of
+// the exporter to sensors out of reach of its own adapters. Proxies are found using mDNS or configured explicitly.
+package esphome
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-ble/ble"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/egress"
+)
+
+const (
+	// DefaultPort is the port of the native API of ESPHome.
+	DefaultPort = 6053
+
+	clientInfo       = "flowercare-exporter"
+	dialTimeout      = 10 * time.Second
+	handshakeTimeout = 10 * time.Second
+	// readTimeout closes connections to proxies which sent neither advertisements nor pings. Proxies ping idle
+	// connections every minute.
+	readTimeout      = 150 * time.Second
+	retryInterval    = 30 * time.Second
+	discoveryTimeout = 3 * time.Second
+)
+
+// errNoProxy is returned for ESPHome devices without a Bluetooth proxy.
+var errNoProxy = errors.New("device has no Bluetooth proxy")
+
+// Manager keeps connections to all proxies and passes their advertisements on.
+type Manager struct {
+	log    logrus.FieldLogger
+	cfg    config.ESPHomeConfig
+	policy egress.Policy
+
+	// Handler is called with every advertisement received from a proxy and the name of the proxy.
+	Handler func(via string, a ble.Advertisement)
+
+	lock    sync.Mutex
+	proxies map[string]*device
+	// ignored contains the discovered devices which are not used, so that the reason is only logged once.
+	ignored map[string]bool
+
+	up             *prometheus.GaugeVec
+	advertisements *prometheus.CounterVec
+	errors         *prometheus.CounterVec
+}
+
+// New creates a Manager. Connections to discovered proxies need to be allowed by the egress policy.
+func New(log logrus.FieldLogger, cfg config.ESPHomeConfig, policy egress.Policy) *Manager {
+	return &Manager{
+		log:     log,
+		cfg:     cfg,
+		policy:  policy,
+		proxies: map[string]*device{},
+		ignored: map[string]bool{},
+		up: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "flowercare_esphome_proxy_up",
+			Help: "Shows whether the ESPHome Bluetooth proxy is connected and forwarding advertisements.",
+		}, []string{"proxy"}),
+		advertisements: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "flowercare_esphome_proxy_advertisements_total",
+			Help: "Number of advertisements received from the ESPHome Bluetooth proxy.",
+		}, []string{"proxy"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "flowercare_esphome_proxy_connection_errors_total",
+			Help: "Number of failed or lost connections to the ESPHome Bluetooth proxy.",
+		}, []string{"proxy"}),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (m *Manager) Describe(ch chan<- *prometheus.Desc) {
+	m.up.Describe(ch)
+	m.advertisements.Describe(ch)
+	m.errors.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (m *Manager) Collect(ch chan<- prometheus.Metric) {
+	m.up.Collect(ch)
+	m.advertisements.Collect(ch)
+	m.errors.Collect(ch)
+}
+
+// Start connects to the configured proxies and starts the discovery if enabled.
+func (m *Manager) Start(ctx context.Context, wg *sync.WaitGroup) {
+	for _, addr := range m.cfg.Proxies {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			host, port = addr, strconv.Itoa(DefaultPort)
+		}
+
+		m.add(ctx, wg, device{
+			Name: host,
+			Host: host,
+			Addr: net.JoinHostPort(host, port),
+		})
+	}
+
+	if !m.cfg.Discover {
+		return
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(m.cfg.DiscoveryInterval)
+		defer ticker.Stop()
+
+		for {
+			m.discover(ctx, wg)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (m *Manager) discover(ctx context.Context, wg *sync.WaitGroup) {
+	devices, err := discover(ctx, discoveryTimeout)
+	if err != nil {
+		m.log.Errorf("Error discovering ESPHome devices: %s", err)
+		return
+	}
+
+	for _, d := range devices {
+		if d.Encrypted {
+			m.ignore(d, "it uses encryption, which is not supported")
+			continue
+		}
+
+		if err := m.policy.CheckHost(d.Host); err != nil {
+			m.ignore(d, err.Error())
+			continue
+		}
+
+		m.add(ctx, wg, d)
+	}
+}
+
+func (m *Manager) ignore(d device, reason string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !m.ignored[d.Name] {
+		m.log.Infof("Ignoring ESPHome device %s: %s", d.Name, reason)
+		m.ignored[d.Name] = true
+	}
+}
+
+// add starts the connection to a new proxy. The address of known proxies is updated, as it can change when the
+// proxy gets a new IP address.
+func (m *Manager) add(ctx context.Context, wg *sync.WaitGroup, d device) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.ignored[d.Name] {
+		return
+	}
+
+	if p, ok := m.proxies[d.Name]; ok {
+		*p = d
+		return
+	}
+
+	m.log.Debugf("Found ESPHome device %s at %s", d.Name, d.Addr)
+	m.proxies[d.Name] = &d
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.run(ctx, d.Name)
+	}()
+}
+
+// run keeps the connection to the proxy, reconnecting after errors until the context is done.
+func (m *Manager) run(ctx context.Context, name string) {
+	for {
+		m.lock.Lock()
+		addr := m.proxies[name].Addr
+		m.lock.Unlock()
+
+		err := m.connect(ctx, name, addr)
+		m.up.WithLabelValues(name).Set(0)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case errors.Is(err, errNoProxy):
+			m.lock.Lock()
+			delete(m.proxies, name)
+			m.lock.Unlock()
+
+			m.up.DeleteLabelValues(name)
+			m.ignore(device{Name: name}, err.Error())
+			return
+		default:
+			m.errors.WithLabelValues(name).Inc()
+			m.log.Warnf("Connection to ESPHome proxy %s failed: %s", name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+func (m *Manager) connect(ctx context.Context, name, addr string) error {
+	dialer := &net.Dialer{
+		Timeout: dialTimeout,
+	}
+	netConn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	c := newConn(netConn)
+	defer c.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-done:
+		}
+	}()
+
+	info, err := c.handshake(clientInfo, handshakeTimeout)
+	if err != nil {
+		return err
+	}
+
+	if info.ProxyVersion == 0 && info.ProxyFeatures == 0 {
+		return errNoProxy
+	}
+
+	if err := c.subscribe(); err != nil {
+		return err
+	}
+
+	m.log.Infof("Connected to ESPHome proxy %s at %s running ESPHome %s", name, addr, info.Version)
+	m.up.WithLabelValues(name).Set(1)
+	advertisements := m.advertisements.WithLabelValues(name)
+	for {
+		msgType, payload, err := c.read(readTimeout)
+		if err != nil {
+			return err
+		}
+
+		switch msgType {
+		case typeBLERawAdvertisement:
+			ads, err := parseRawAdvertisements(payload)
+			if err != nil {
+				m.log.Debugf("Can not parse advertisements from %s: %s", name, err)
+			}
+
+			for _, a := range ads {
+				advertisements.Inc()
+				m.Handler(name, a)
+			}
+		case typeBLEAdvertisement:
+			a, err := parseAdvertisement(payload)
+			if err != nil {
+				m.log.Debugf("Can not parse advertisement from %s: %s", name, err)
+				continue
+			}
+
+			advertisements.Inc()
+			m.Handler(name, a)
+		default:
+			if err := c.answer(msgType); err != nil {
+				return err
+			}
+		}
+	}
+}
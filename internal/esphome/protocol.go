@@ -0,0 +1,442 @@
+package esphome
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-ble/ble"
+	"github.com/xperimental/flowercare-exporter/internal/backend"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Types of the messages of the native API of ESPHome used by the exporter.
+const (
+	typeHelloRequest        = 1
+	typeHelloResponse       = 2
+	typeConnectRequest      = 3
+	typeConnectResponse     = 4
+	typeDisconnectRequest   = 5
+	typeDisconnectResponse  = 6
+	typePingRequest         = 7
+	typePingResponse        = 8
+	typeDeviceInfoRequest   = 9
+	typeDeviceInfoResponse  = 10
+	typeGetTimeRequest      = 36
+	typeGetTimeResponse     = 37
+	typeSubscribeBLERequest = 66
+	typeBLEAdvertisement    = 67
+	typeBLERawAdvertisement = 93
+)
+
+const (
+	// apiVersionMajor and apiVersionMinor are the version of the native API implemented by the exporter.
+	apiVersionMajor = 1
+	apiVersionMinor = 9
+	// subscribeRaw requests the advertisements as raw data instead of decoded by the proxy.
+	subscribeRaw = 1
+	// plaintextIndicator starts every frame of a connection without encryption. Proxies using encryption start
+	// their frames with 1 instead.
+	plaintextIndicator = 0
+	maxMessageSize     = 1 << 16
+)
+
+// errEncrypted is returned for proxies which use the encryption of the native API, which is not supported.
+var errEncrypted = errors.New("proxy uses encryption, which is not supported")
+
+// deviceInfo contains the fields of the device info of the proxy used by the exporter.
+type deviceInfo struct {
+	Name    string
+	MAC     string
+	Version string
+	// ProxyVersion is the version of the Bluetooth proxy of the device. Devices without a proxy report zero.
+	ProxyVersion uint64
+	// ProxyFeatures are the features of the Bluetooth proxy reported by newer versions of ESPHome.
+	ProxyFeatures uint64
+}
+
+// conn is a connection to the native API of a proxy.
+type conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newConn(c net.Conn) *conn {
+	return &conn{
+		conn:   c,
+		reader: bufio.NewReader(c),
+	}
+}
+
+func (c *conn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *conn) write(msgType uint64, payload []byte) error {
+	frame := []byte{plaintextIndicator}
+	frame = protowire.AppendVarint(frame, uint64(len(payload)))
+	frame = protowire.AppendVarint(frame, msgType)
+	frame = append(frame, payload...)
+
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// read returns the next message. Every message extends the deadline of the connection, so that connections to
+// proxies which stopped responding are closed.
+func (c *conn) read(timeout time.Duration) (uint64, []byte, error) {
+	if err := c.conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return 0, nil, err
+	}
+
+	indicator, err := c.reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	switch indicator {
+	case plaintextIndicator:
+	case 1:
+		return 0, nil, errEncrypted
+	default:
+		return 0, nil, fmt.Errorf("unexpected frame indicator: %d", indicator)
+	}
+
+	size, err := binary.ReadUvarint(c.reader)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	msgType, err := binary.ReadUvarint(c.reader)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if size > maxMessageSize {
+		return 0, nil, fmt.Errorf("message too large: %d bytes", size)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return 0, nil, err
+	}
+
+	return msgType, payload, nil
+}
+
+// await returns the payload of the next message of the type, answering the requests of the proxy in between.
+func (c *conn) await(msgType uint64, timeout time.Duration) ([]byte, error) {
+	for {
+		t, payload, err := c.read(timeout)
+		if err != nil {
+			return nil, err
+		}
+
+		if t == msgType {
+			return payload, nil
+		}
+
+		if err := c.answer(t); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// answer responds to the requests of the proxy, which need to be answered for keeping the connection open. Other
+// messages are ignored.
+func (c *conn) answer(msgType uint64) error {
+	switch msgType {
+	case typePingRequest:
+		return c.write(typePingResponse, nil)
+	case typeGetTimeRequest:
+		var payload []byte
+		payload = protowire.AppendTag(payload, 1, protowire.Fixed32Type)
+		payload = protowire.AppendFixed32(payload, uint32(time.Now().Unix()))
+		return c.write(typeGetTimeResponse, payload)
+	case typeDisconnectRequest:
+		// The connection is closed anyway, so errors of the response are not relevant.
+		_ = c.write(typeDisconnectResponse, nil)
+		return errors.New("proxy closed the connection")
+	}
+
+	return nil
+}
+
+// handshake says hello to the proxy, connects without password and returns its device info.
+func (c *conn) handshake(clientInfo string, timeout time.Duration) (deviceInfo, error) {
+	var hello []byte
+	hello = protowire.AppendTag(hello, 1, protowire.BytesType)
+	hello = protowire.AppendString(hello, clientInfo)
+	hello = protowire.AppendTag(hello, 2, protowire.VarintType)
+	hello = protowire.AppendVarint(hello, apiVersionMajor)
+	hello = protowire.AppendTag(hello, 3, protowire.VarintType)
+	hello = protowire.AppendVarint(hello, apiVersionMinor)
+	if err := c.write(typeHelloRequest, hello); err != nil {
+		return deviceInfo{}, err
+	}
+
+	if _, err := c.await(typeHelloResponse, timeout); err != nil {
+		return deviceInfo{}, fmt.Errorf("error during hello: %s", err)
+	}
+
+	if err := c.write(typeConnectRequest, nil); err != nil {
+		return deviceInfo{}, err
+	}
+
+	payload, err := c.await(typeConnectResponse, timeout)
+	if err != nil {
+		return deviceInfo{}, fmt.Errorf("error connecting: %s", err)
+	}
+
+	var invalidPassword bool
+	if err := parseFields(payload, func(num protowire.Number, value uint64, _ []byte) {
+		if num == 1 {
+			invalidPassword = value != 0
+		}
+	}); err != nil {
+		return deviceInfo{}, err
+	}
+	if invalidPassword {
+		return deviceInfo{}, errors.New("proxy needs a password, which is not supported")
+	}
+
+	if err := c.write(typeDeviceInfoRequest, nil); err != nil {
+		return deviceInfo{}, err
+	}
+
+	payload, err = c.await(typeDeviceInfoResponse, timeout)
+	if err != nil {
+		return deviceInfo{}, fmt.Errorf("error getting device info: %s", err)
+	}
+
+	var info deviceInfo
+	err = parseFields(payload, func(num protowire.Number, value uint64, data []byte) {
+		switch num {
+		case 2:
+			info.Name = string(data)
+		case 3:
+			info.MAC = string(data)
+		case 4:
+			info.Version = string(data)
+		case 11:
+			info.ProxyVersion = value
+		case 15:
+			info.ProxyFeatures = value
+		}
+	})
+	return info, err
+}
+
+func (c *conn) subscribe() error {
+	var payload []byte
+	payload = protowire.AppendTag(payload, 1, protowire.VarintType)
+	payload = protowire.AppendVarint(payload, subscribeRaw)
+	return c.write(typeSubscribeBLERequest, payload)
+}
+
+// parseFields calls the function with the number and value of every field of the message. Varint fields are
+// passed as value, length-delimited fields as data.
+func parseFields(payload []byte, field func(num protowire.Number, value uint64, data []byte)) error {
+	for len(payload) > 0 {
+		num, typ, n := protowire.ConsumeTag(payload)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		payload = payload[n:]
+
+		switch typ {
+		case protowire.VarintType:
+			value, n := protowire.ConsumeVarint(payload)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			field(num, value, nil)
+			payload = payload[n:]
+		case protowire.BytesType:
+			data, n := protowire.ConsumeBytes(payload)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			field(num, 0, data)
+			payload = payload[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, payload)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			payload = payload[n:]
+		}
+	}
+
+	return nil
+}
+
+// parseRawAdvertisements returns the advertisements of a BluetoothLERawAdvertisementsResponse.
+func parseRawAdvertisements(payload []byte) ([]*backend.Advertisement, error) {
+	var result []*backend.Advertisement
+	var parseErr error
+	err := parseFields(payload, func(num protowire.Number, _ uint64, data []byte) {
+		if num != 1 {
+			return
+		}
+
+		var address uint64
+		var rssi int64
+		var raw []byte
+		if err := parseFields(data, func(num protowire.Number, value uint64, data []byte) {
+			switch num {
+			case 1:
+				address = value
+			case 2:
+				rssi = protowire.DecodeZigZag(value)
+			case 4:
+				raw = data
+			}
+		}); err != nil {
+			parseErr = err
+			return
+		}
+
+		result = append(result, newAdvertisement(address, int(rssi), raw))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, parseErr
+}
+
+// parseAdvertisement returns the advertisement of a BluetoothLEAdvertisementResponse, which is sent by older
+// proxies not supporting raw advertisements.
+func parseAdvertisement(payload []byte) (*backend.Advertisement, error) {
+	var address uint64
+	var rssi int64
+	var name []byte
+	var fields [][]byte
+	err := parseFields(payload, func(num protowire.Number, value uint64, data []byte) {
+		switch num {
+		case 1:
+			address = value
+		case 2:
+			name = data
+		case 3:
+			rssi = protowire.DecodeZigZag(value)
+		case 5, 6:
+			field, ok := decodedField(num == 6, data)
+			if ok {
+				fields = append(fields, field)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var raw []byte
+	if len(name) > 0 && len(name) < 30 {
+		raw = append(raw, byte(len(name)+1), 0x09)
+		raw = append(raw, name...)
+	}
+	for _, f := range fields {
+		raw = append(raw, f...)
+	}
+
+	return newAdvertisement(address, int(rssi), raw), nil
+}
+
+// decodedField converts service or manufacturer data decoded by the proxy back to an advertising data structure.
+// Only 16-bit UUIDs and company IDs are supported, which are used by all supported sensors.
+func decodedField(manufacturer bool, message []byte) ([]byte, bool) {
+	var uuid string
+	var data []byte
+	if err := parseFields(message, func(num protowire.Number, _ uint64, value []byte) {
+		switch num {
+		case 1:
+			uuid = string(value)
+		case 3:
+			data = value
+		}
+	}); err != nil {
+		return nil, false
+	}
+
+	var id uint64
+	if _, err := fmt.Sscanf(strings.ToLower(uuid), "0x%x", &id); err != nil || id > 0xffff || len(data) > 250 {
+		return nil, false
+	}
+
+	typ := byte(0x16)
+	if manufacturer {
+		typ = 0xff
+	}
+
+	field := []byte{byte(len(data) + 3), typ, byte(id), byte(id >> 8)}
+	return append(field, data...), true
+}
+
+// newAdvertisement decodes the advertising data structures of a raw advertisement. Malformed structures end the
+// decoding, keeping the structures before them.
+func newAdvertisement(address uint64, rssi int, raw []byte) *backend.Advertisement {
+	a := &backend.Advertisement{
+		Address:        formatAddress(address),
+		SignalStrength: rssi,
+	}
+
+	for len(raw) >= 2 {
+		length := int(raw[0])
+		if length == 0 || length >= len(raw) {
+			break
+		}
+		typ, data := raw[1], raw[2:length+1]
+		raw = raw[length+1:]
+
+		switch typ {
+		case 0x02, 0x03:
+			a.ServiceUUIDs = appendUUIDs(a.ServiceUUIDs, data, 2)
+		case 0x04, 0x05:
+			a.ServiceUUIDs = appendUUIDs(a.ServiceUUIDs, data, 4)
+		case 0x06, 0x07:
+			a.ServiceUUIDs = appendUUIDs(a.ServiceUUIDs, data, 16)
+		case 0x08, 0x09:
+			if a.Name == "" || typ == 0x09 {
+				a.Name = string(data)
+			}
+		case 0x0a:
+			if len(data) == 1 {
+				a.TxPower = int(int8(data[0]))
+			}
+		case 0x16, 0x20, 0x21:
+			width := map[byte]int{0x16: 2, 0x20: 4, 0x21: 16}[typ]
+			if len(data) >= width {
+				a.Service = append(a.Service, ble.ServiceData{
+					UUID: ble.UUID(append([]byte{}, data[:width]...)),
+					Data: append([]byte{}, data[width:]...),
+				})
+			}
+		case 0xff:
+			a.Manufacturer = append([]byte{}, data...)
+		}
+	}
+
+	return a
+}
+
+func appendUUIDs(uuids []ble.UUID, data []byte, width int) []ble.UUID {
+	for len(data) >= width {
+		uuids = append(uuids, ble.UUID(append([]byte{}, data[:width]...)))
+		data = data[width:]
+	}
+
+	return uuids
+}
+
+func formatAddress(address uint64) string {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, address)
+	return strings.ToUpper(net.HardwareAddr(b[2:]).String())
+}
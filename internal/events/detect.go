@@ -0,0 +1,88 @@
+package events
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+// replacedIncrease is the increase of the battery level after which the battery is assumed to be replaced.
+const replacedIncrease = 10
+
+// WateringStats contains the waterings detected for a sensor since the exporter has been started.
+type WateringStats struct {
+	Count int
+	Last  time.Time
+}
+
+// Detector records events derived from the readings, like the watering of a plant.
+type Detector struct {
+	log               *Log
+	wateringThreshold float64
+
+	lock     sync.Mutex
+	previous map[string]driver.Reading
+	watering map[string]WateringStats
+}
+
+// NewDetector creates a Detector recording its events in the log. An increase of the moisture between two
+// readings by at least the threshold is detected as watering.
+func NewDetector(log *Log, wateringThreshold float64) *Detector {
+	return &Detector{
+		log:               log,
+		wateringThreshold: wateringThreshold,
+		previous:          map[string]driver.Reading{},
+		watering:          map[string]WateringStats{},
+	}
+}
+
+// Observe compares a reading with the previous reading of the sensor. It can be used as an updater.Listener.
+func (d *Detector) Observe(sensor config.Sensor, reading driver.Reading) {
+	key := strings.ToUpper(sensor.MacAddress)
+	now := reading.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	d.lock.Lock()
+	previous, ok := d.previous[key]
+	d.previous[key] = reading.Merge(previous)
+	watered := ok && increased(previous.Moisture, reading.Moisture, d.wateringThreshold)
+	if watered {
+		stats := d.watering[key]
+		stats.Count++
+		stats.Last = now
+		d.watering[key] = stats
+	}
+	d.lock.Unlock()
+
+	if !ok {
+		return
+	}
+
+	if watered {
+		d.log.Record(TypeWatered, sensor, fmt.Sprintf("moisture increased from %.0f%% to %.0f%%", *previous.Moisture, *reading.Moisture))
+	}
+
+	if increased(previous.Battery, reading.Battery, replacedIncrease) {
+		d.log.Record(TypeBatteryReplaced, sensor, fmt.Sprintf("battery level increased from %.0f%% to %.0f%%", *previous.Battery, *reading.Battery))
+	}
+}
+
+// Watering returns the waterings detected for the sensor. It returns false if none have been detected.
+func (d *Detector) Watering(macAddress string) (WateringStats, bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	stats, ok := d.watering[strings.ToUpper(macAddress)]
+	return stats, ok
+}
+
+// increased returns true if the value increased by at least the threshold.
+func increased(previous, current *float64, threshold float64) bool {
+	return previous != nil && current != nil && *current-*previous >= threshold
+}
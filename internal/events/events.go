@@ -0,0 +1,168 @@
+// Package events keeps the most recent significant events of the exporter in memory.
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/xperimental/flowercare-exporter/internal/config"
+)
+
+// Type describes what kind of event happened.
+type Type string
+
+// Types of events.
+const (
+	TypeRead          Type = "read"
+	TypeFailure       Type = "failure"
+	TypeSensorAdded   Type = "sensor_added"
+	TypeSensorRemoved Type = "sensor_removed"
+	TypeReload        Type = "reload"
+	TypeAlert         Type = "alert"
+	// TypeWatered is recorded when the moisture of a sensor rises sharply.
+	TypeWatered Type = "watered"
+	// TypeBatteryReplaced is recorded when the battery level of a sensor rises sharply.
+	TypeBatteryReplaced Type = "battery_replaced"
+)
+
+// Types contains all types of events.
+var Types = []Type{
+	TypeRead,
+	TypeFailure,
+	TypeSensorAdded,
+	TypeSensorRemoved,
+	TypeReload,
+	TypeAlert,
+	TypeWatered,
+	TypeBatteryReplaced,
+}
+
+// Event is a single event.
+type Event struct {
+	Time time.Time `json:"time"`
+	Type Type      `json:"type"`
+	// Sensor is nil for events not related to a sensor.
+	Sensor  *config.Sensor `json:"sensor,omitempty"`
+	Message string         `json:"message,omitempty"`
+}
+
+// Log keeps the last events in a ring buffer.
+type Log struct {
+	lock   sync.RWMutex
+	events []Event
+	next   int
+	full   bool
+	// last contains the time of the last event by type and sensor, used for throttling.
+	last map[string]time.Time
+
+	subscribersLock sync.RWMutex
+	subscribers     []func(Event)
+}
+
+// NewLog creates a Log keeping up to size events.
+func NewLog(size int) *Log {
+	return &Log{
+		events: make([]Event, size),
+		last:   map[string]time.Time{},
+	}
+}
+
+// Subscribe registers a function which is called for every event added to the log. The function is called
+// synchronously, so it should not block.
+func (l *Log) Subscribe(f func(Event)) {
+	l.subscribersLock.Lock()
+	defer l.subscribersLock.Unlock()
+
+	l.subscribers = append(l.subscribers, f)
+}
+
+// Add adds an event to the log, replacing the oldest event if the log is full.
+func (l *Log) Add(event Event) {
+	l.lock.Lock()
+	l.events[l.next] = event
+	l.next = (l.next + 1) % len(l.events)
+	if l.next == 0 {
+		l.full = true
+	}
+	l.lock.Unlock()
+
+	l.subscribersLock.RLock()
+	defer l.subscribersLock.RUnlock()
+
+	for _, f := range l.subscribers {
+		f(event)
+	}
+}
+
+// Record creates an event with the current time and adds it to the log. The sensor is omitted if it has no
+// MAC address.
+func (l *Log) Record(t Type, sensor config.Sensor, message string) {
+	event := Event{
+		Time:    time.Now(),
+		Type:    t,
+		Message: message,
+	}
+	if sensor.MacAddress != "" {
+		event.Sensor = &sensor
+	}
+
+	l.Add(event)
+}
+
+// RecordThrottled records an event unless an event of the same type has been recorded for the sensor during the
+// interval. This keeps frequent events, like readings from advertisements, from pushing out all other events.
+func (l *Log) RecordThrottled(t Type, sensor config.Sensor, message string, interval time.Duration) {
+	now := time.Now()
+	key := string(t) + "/" + sensor.MacAddress
+
+	l.lock.Lock()
+	if last, ok := l.last[key]; ok && now.Sub(last) < interval {
+		l.lock.Unlock()
+		return
+	}
+	l.last[key] = now
+	l.lock.Unlock()
+
+	l.Record(t, sensor, message)
+}
+
+// List returns the events matching the filter, newest first. If types is empty, events of all types are
+// returned. A limit of zero returns all matching events.
+func (l *Log) List(types []Type, limit int) []Event {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	count := l.next
+	if l.full {
+		count = len(l.events)
+	}
+
+	result := []Event{}
+	for i := 0; i < count; i++ {
+		e := l.events[(l.next-1-i+len(l.events))%len(l.events)]
+		if !matchType(e.Type, types) {
+			continue
+		}
+
+		result = append(result, e)
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+	}
+
+	return result
+}
+
+func matchType(t Type, types []Type) bool {
+	if len(types) == 0 {
+		return true
+	}
+
+	for _, other := range types {
+		if t == other {
+			return true
+		}
+	}
+
+	return false
+}
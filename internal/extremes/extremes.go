@@ -0,0 +1,151 @@
+// Package extremes keeps the lowest and highest values of every sensor during a rolling window, for displays like the
+// overnight low temperature which would otherwise need recording rules.
+package extremes
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+// Fields contains the values of the readings which are tracked.
+var Fields = []string{
+	"temperature",
+	"moisture",
+	"light",
+	"conductivity",
+	"humidity",
+}
+
+// buckets is the number of buckets the window is split into. The values are kept per bucket instead of per reading,
+// so that the memory used does not depend on the number of readings. The window is accurate to one bucket.
+const buckets = 144
+
+// Range contains the lowest and highest value of the window.
+type Range struct {
+	Min float64
+	Max float64
+}
+
+type bucket struct {
+	Start  time.Time
+	Ranges map[string]Range
+}
+
+// Tracker keeps the extremes of the values of every sensor.
+type Tracker struct {
+	window     time.Duration
+	bucketSize time.Duration
+
+	lock sync.Mutex
+	// buckets contains the buckets of every sensor, oldest first.
+	buckets map[string][]*bucket
+}
+
+// New creates a Tracker for the window.
+func New(window time.Duration) *Tracker {
+	return &Tracker{
+		window:     window,
+		bucketSize: window / buckets,
+		buckets:    map[string][]*bucket{},
+	}
+}
+
+// Observe records the values of a reading. It can be used as an updater.Listener.
+func (t *Tracker) Observe(sensor config.Sensor, reading driver.Reading) {
+	now := reading.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	start := now.Truncate(t.bucketSize)
+	key := strings.ToUpper(sensor.MacAddress)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	list := t.prune(t.buckets[key], now)
+	if len(list) > 0 && start.Before(list[len(list)-1].Start) {
+		// Readings older than the latest bucket arrive only rarely, for example from edge exporters.
+		t.buckets[key] = list
+		return
+	}
+
+	if len(list) == 0 || start.After(list[len(list)-1].Start) {
+		list = append(list, &bucket{
+			Start:  start,
+			Ranges: map[string]Range{},
+		})
+	}
+	b := list[len(list)-1]
+	t.buckets[key] = list
+
+	for _, name := range Fields {
+		v := *reading.Field(name)
+		if v == nil {
+			continue
+		}
+
+		r, ok := b.Ranges[name]
+		if !ok {
+			r = Range{Min: *v, Max: *v}
+		}
+		if *v < r.Min {
+			r.Min = *v
+		}
+		if *v > r.Max {
+			r.Max = *v
+		}
+		b.Ranges[name] = r
+	}
+}
+
+// Extremes returns the ranges of the values of the sensor during the window before now, by the name of the value.
+// It returns false if the sensor has no values in the window.
+func (t *Tracker) Extremes(macAddress string, now time.Time) (map[string]Range, bool) {
+	key := strings.ToUpper(macAddress)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	list := t.prune(t.buckets[key], now)
+	if len(list) == 0 {
+		delete(t.buckets, key)
+		return nil, false
+	}
+	t.buckets[key] = list
+
+	result := map[string]Range{}
+	for _, b := range list {
+		for name, r := range b.Ranges {
+			current, ok := result[name]
+			if !ok {
+				result[name] = r
+				continue
+			}
+
+			if r.Min < current.Min {
+				current.Min = r.Min
+			}
+			if r.Max > current.Max {
+				current.Max = r.Max
+			}
+			result[name] = current
+		}
+	}
+
+	return result, true
+}
+
+// prune removes the buckets which ended before the window.
+func (t *Tracker) prune(list []*bucket, now time.Time) []*bucket {
+	start := now.Add(-t.window)
+	drop := 0
+	for drop < len(list) && !list[drop].Start.Add(t.bucketSize).After(start) {
+		drop++
+	}
+
+	return list[drop:]
+}
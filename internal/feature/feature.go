@@ -0,0 +1,80 @@
+// Package feature contains the flags used for enabling experimental features.
+//
+// Experimental features can change or be removed in any release. They need to be enabled explicitly using
+// --enable-feature, so that they can be shipped early without affecting existing installations.
+package feature
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Names of the experimental features.
+const (
+	// PassiveMode reads sensors which support it from their advertisements instead of connecting to them.
+	PassiveMode = "passive-mode"
+	// HistoryDownload downloads the historical data stored on the devices.
+	HistoryDownload = "history-download"
+	// Actuation allows commands which change the state of a device, like making it blink.
+	Actuation = "actuation"
+	// ESPHomeProxy receives advertisements from ESPHome Bluetooth proxies.
+	ESPHomeProxy = "esphome-proxy"
+)
+
+// Known contains the descriptions of all experimental features.
+var Known = map[string]string{
+	PassiveMode:     "Read sensors from their advertisements instead of connecting to them.",
+	HistoryDownload: "Download the historical data stored on the devices.",
+	Actuation:       "Allow commands changing the state of devices.",
+	ESPHomeProxy:    "Receive advertisements from ESPHome Bluetooth proxies.",
+}
+
+// Set contains the enabled features.
+type Set map[string]bool
+
+// Parse creates a Set from a list of feature names. It returns an error for unknown features.
+func Parse(names []string) (Set, error) {
+	result := Set{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		if _, ok := Known[name]; !ok {
+			return nil, fmt.Errorf("unknown feature %q, known features: %s", name, strings.Join(KnownNames(), ", "))
+		}
+
+		result[name] = true
+	}
+
+	return result, nil
+}
+
+// KnownNames returns the names of all experimental features, sorted alphabetically.
+func KnownNames() []string {
+	names := make([]string, 0, len(Known))
+	for name := range Known {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Enabled returns true if the feature has been enabled.
+func (s Set) Enabled(name string) bool {
+	return s[name]
+}
+
+// Names returns the names of the enabled features, sorted alphabetically.
+func (s Set) Names() []string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
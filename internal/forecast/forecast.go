@@ -0,0 +1,213 @@
+// Package forecast predicts the soil moisture of the plants for planning the irrigation.
+package forecast
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+const (
+	// sampleInterval is the minimum time between two samples of a sensor.
+	sampleInterval = 10 * time.Minute
+	// minSpan is the minimum time covered by the samples before a forecast is made.
+	minSpan = 6 * time.Hour
+	// minSamples is the minimum number of samples needed for a forecast.
+	minSamples = 4
+	// minRateSamples is the minimum number of samples needed for the dry-out rate.
+	minRateSamples = 3
+	// minMoisture is the lowest moisture used for the fit, the logarithm of lower values is not usable.
+	minMoisture = 0.5
+)
+
+type sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// Model fits a drying curve to the moisture of every plant since it has last been watered. Soil dries out
+// roughly exponentially, so a line is fitted through the logarithm of the moisture.
+type Model struct {
+	window            time.Duration
+	wateringThreshold float64
+
+	lock    sync.Mutex
+	samples map[string][]sample
+}
+
+// curve is the fitted drying curve: ln(moisture) = intercept + slope * seconds since start.
+type curve struct {
+	start     time.Time
+	last      time.Time
+	intercept float64
+	slope     float64
+}
+
+func (c curve) at(t time.Time) float64 {
+	return math.Exp(c.intercept + c.slope*t.Sub(c.start).Seconds())
+}
+
+// New creates a Model using at most the moisture values of the window for its forecasts. An increase of the
+// moisture by at least the watering threshold starts a new drying curve.
+func New(window time.Duration, wateringThreshold float64) *Model {
+	return &Model{
+		window:            window,
+		wateringThreshold: wateringThreshold,
+		samples:           map[string][]sample{},
+	}
+}
+
+// Observe records the moisture of a reading. It can be used as an updater.Listener.
+func (m *Model) Observe(sensor config.Sensor, reading driver.Reading) {
+	if reading.Moisture == nil {
+		return
+	}
+
+	now := reading.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	value := *reading.Moisture
+	key := strings.ToUpper(sensor.MacAddress)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	samples := m.samples[key]
+	if len(samples) > 0 {
+		last := samples[len(samples)-1]
+		if value >= last.Value+m.wateringThreshold {
+			samples = nil
+		} else if now.Sub(last.Time) < sampleInterval {
+			return
+		}
+	}
+
+	samples = append(samples, sample{
+		Time:  now,
+		Value: value,
+	})
+
+	start := 0
+	for start < len(samples) && now.Sub(samples[start].Time) > m.window {
+		start++
+	}
+	m.samples[key] = samples[start:]
+}
+
+// Forecast returns the moisture of the plant predicted for the time after the horizon has passed since the
+// last reading. It returns false if there is not enough data yet or the soil is not drying out.
+func (m *Model) Forecast(macAddress string, horizon time.Duration) (float64, bool) {
+	c, ok := m.fit(macAddress)
+	if !ok {
+		return 0, false
+	}
+
+	return c.at(c.last.Add(horizon)), true
+}
+
+// DryTime returns the time at which the moisture of the plant is predicted to fall below the threshold. If the
+// moisture is already below the threshold, the time of the last reading is returned.
+func (m *Model) DryTime(macAddress string, threshold float64) (time.Time, bool) {
+	if threshold <= 0 {
+		return time.Time{}, false
+	}
+
+	c, ok := m.fit(macAddress)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	if c.at(c.last) <= threshold {
+		return c.last, true
+	}
+
+	seconds := (math.Log(threshold) - c.intercept) / c.slope
+	return c.start.Add(time.Duration(seconds * float64(time.Second))), true
+}
+
+// DryRate returns the decrease of the moisture in percentage points per hour during the window before the last
+// reading. A line is fitted through the values, so that the noise of single readings is smoothed out. The rate is
+// negative if the moisture is increasing. It returns false if the values since the last watering do not cover at
+// least half of the window.
+func (m *Model) DryRate(macAddress string, window time.Duration) (float64, bool) {
+	m.lock.Lock()
+	samples := m.samples[strings.ToUpper(macAddress)]
+	m.lock.Unlock()
+
+	if len(samples) == 0 {
+		return 0, false
+	}
+
+	last := samples[len(samples)-1].Time
+	start := 0
+	for start < len(samples) && last.Sub(samples[start].Time) > window {
+		start++
+	}
+	samples = samples[start:]
+
+	if len(samples) < minRateSamples || last.Sub(samples[0].Time) < window/2 {
+		return 0, false
+	}
+
+	_, slope, ok := fitLine(samples, func(v float64) float64 { return v })
+	if !ok {
+		return 0, false
+	}
+
+	return -slope * time.Hour.Seconds(), true
+}
+
+func (m *Model) fit(macAddress string) (curve, bool) {
+	m.lock.Lock()
+	var samples []sample
+	for _, s := range m.samples[strings.ToUpper(macAddress)] {
+		if s.Value >= minMoisture {
+			samples = append(samples, s)
+		}
+	}
+	m.lock.Unlock()
+
+	if len(samples) < minSamples || samples[len(samples)-1].Time.Sub(samples[0].Time) < minSpan {
+		return curve{}, false
+	}
+
+	intercept, slope, ok := fitLine(samples, math.Log)
+	if !ok || slope >= 0 {
+		return curve{}, false
+	}
+
+	return curve{
+		start:     samples[0].Time,
+		last:      samples[len(samples)-1].Time,
+		intercept: intercept,
+		slope:     slope,
+	}, true
+}
+
+// fitLine returns the least squares fit of the transformed values over the seconds since the first sample.
+func fitLine(samples []sample, transform func(float64) float64) (intercept, slope float64, ok bool) {
+	start := samples[0].Time
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range samples {
+		x := s.Time.Sub(start).Seconds()
+		y := transform(s.Value)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+
+	n := float64(len(samples))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, 0, false
+	}
+
+	slope = (n*sumXY - sumX*sumY) / denominator
+	return (sumY - slope*sumX) / n, slope, true
+}
@@ -0,0 +1,160 @@
+// Package grafana posts events of the exporter as annotations to Grafana, so that dashboards show markers for
+// events like the watering of a plant aligned with the data.
+package grafana
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/anonymize"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/events"
+)
+
+const (
+	// queueSize is the number of annotations waiting to be posted, further annotations are dropped.
+	queueSize   = 100
+	sendTimeout = 10 * time.Second
+	// tag is added to all annotations, so that they can be selected in the dashboards.
+	tag = "flowercare"
+)
+
+// annotation is the body of a request to the annotations API of Grafana.
+type annotation struct {
+	DashboardUID string   `json:"dashboardUID,omitempty"`
+	Time         int64    `json:"time"`
+	Tags         []string `json:"tags"`
+	Text         string   `json:"text"`
+}
+
+// Annotator posts events as annotations.
+type Annotator struct {
+	log        logrus.FieldLogger
+	cfg        config.GrafanaConfig
+	client     *http.Client
+	types      map[events.Type]bool
+	anonymizer *anonymize.Anonymizer
+	queue      chan annotation
+}
+
+// New creates an Annotator using the transport for posting annotations. Sensors are replaced by their pseudonyms
+// if the anonymizer is set.
+func New(log logrus.FieldLogger, cfg config.GrafanaConfig, transport http.RoundTripper, anonymizer *anonymize.Anonymizer) (*Annotator, error) {
+	known := map[events.Type]bool{}
+	for _, t := range events.Types {
+		known[t] = true
+	}
+
+	types := map[events.Type]bool{}
+	for _, name := range cfg.Events {
+		t := events.Type(name)
+		if !known[t] {
+			return nil, fmt.Errorf("unknown event type: %s", name)
+		}
+		types[t] = true
+	}
+
+	return &Annotator{
+		log: log,
+		cfg: cfg,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   sendTimeout,
+		},
+		types:      types,
+		anonymizer: anonymizer,
+		queue:      make(chan annotation, queueSize),
+	}, nil
+}
+
+// Add queues an annotation for the event if its type is selected. It can be used as a subscriber of the event
+// log and does not block.
+func (a *Annotator) Add(e events.Event) {
+	if !a.types[e.Type] {
+		return
+	}
+
+	text := string(e.Type)
+	tags := []string{tag, string(e.Type)}
+	if e.Sensor != nil {
+		sensor := a.anonymizer.Sensor(*e.Sensor)
+		text = sensor.String() + ": " + text
+		if sensor.Name != "" {
+			tags = append(tags, sensor.Name)
+		}
+	}
+	if e.Message != "" {
+		message := e.Message
+		if e.Sensor != nil {
+			message = a.anonymizer.String(message, []config.Sensor{*e.Sensor})
+		}
+		text += ": " + message
+	}
+
+	select {
+	case a.queue <- annotation{
+		DashboardUID: a.cfg.DashboardUID,
+		Time:         e.Time.UnixMilli(),
+		Tags:         tags,
+		Text:         text,
+	}:
+	default:
+		a.log.Warnf("Dropping annotation, queue is full: %s", text)
+	}
+}
+
+// Start starts posting the queued annotations.
+func (a *Annotator) Start(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		a.log.Debug("Grafana annotator ready.")
+		for {
+			select {
+			case <-ctx.Done():
+				a.log.Debug("Shutting down Grafana annotator.")
+				return
+			case an := <-a.queue:
+				if err := a.send(ctx, an); err != nil {
+					a.log.Errorf("Error posting annotation to Grafana: %s", err)
+				}
+			}
+		}
+	}()
+}
+
+func (a *Annotator) send(ctx context.Context, an annotation) error {
+	body, err := json.Marshal(an)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.cfg.URL+"/api/annotations", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+a.cfg.Token)
+
+	res, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status: %s", res.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+// Package handoff passes the live state of a running exporter to a new exporter taking over from it, for example when
+// upgrading to a new version.
+//
+// The running exporter listens on a local socket. The new exporter connects to it before using the Bluetooth adapter,
+// which makes the running exporter shut down. Once it has released the adapter and its listen address, it sends its
+// state over the connection and exits. The new exporter continues with the latest readings and the schedule of the
+// reads, so that the metrics do not disappear and the sensors are not all read at once.
+package handoff
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+	"github.com/xperimental/flowercare-exporter/internal/updater"
+)
+
+// State contains the state passed to the new exporter.
+type State struct {
+	// Sensors contains the reliability statistics and recent errors by MAC address.
+	Sensors map[string]updater.SensorStats `json:"sensors"`
+	// Readings contains the latest reading of every sensor by MAC address.
+	Readings map[string]driver.Reading `json:"readings"`
+	// Schedule contains the reads waiting in the queue by MAC address.
+	Schedule map[string]updater.ScheduledRead `json:"schedule"`
+	// NextRefresh is the time all sensors would have been scheduled for reading next.
+	NextRefresh time.Time `json:"nextRefresh"`
+}
+
+// Server waits for a new exporter taking over.
+type Server struct {
+	Log logrus.FieldLogger
+	// Stop is called when a new exporter takes over. It needs to shut down the exporter.
+	Stop func()
+
+	listener net.Listener
+
+	lock sync.Mutex
+	conn net.Conn
+}
+
+// Listen creates a Server listening on the socket. A socket left over by an exporter which did not shut down cleanly
+// is replaced.
+func Listen(log logrus.FieldLogger, socket string, stop func()) (*Server, error) {
+	// Take has already made sure that no exporter is listening anymore.
+	if err := os.Remove(socket); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("can not remove old socket: %s", err)
+	}
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("can not listen on handoff socket: %s", err)
+	}
+
+	return &Server{
+		Log:      log,
+		Stop:     stop,
+		listener: listener,
+	}, nil
+}
+
+// Start accepts the connection of a new exporter until the context is done. Only the first connection is kept,
+// further connections are closed.
+func (s *Server) Start(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		<-ctx.Done()
+		s.listener.Close()
+	}()
+
+	go func() {
+		for {
+			conn, err := s.listener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					s.Log.Errorf("Error accepting handoff connection: %s", err)
+				}
+				return
+			}
+
+			s.lock.Lock()
+			first := s.conn == nil
+			if first {
+				s.conn = conn
+			}
+			s.lock.Unlock()
+
+			if !first {
+				conn.Close()
+				continue
+			}
+
+			s.Log.Info("New exporter is taking over, shutting down.")
+			s.Stop()
+		}
+	}()
+}
+
+// Send passes the state to the new exporter, if one is taking over. It needs to be called after the exporter has
+// released the Bluetooth adapter and its listen address.
+func (s *Server) Send(state State) error {
+	s.lock.Lock()
+	conn := s.conn
+	s.lock.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	defer conn.Close()
+
+	return json.NewEncoder(conn).Encode(state)
+}
+
+// Take asks the exporter listening on the socket to shut down and returns its state once it has stopped. It returns
+// false if no exporter is listening.
+func Take(socket string, timeout time.Duration) (State, bool, error) {
+	conn, err := net.DialTimeout("unix", socket, timeout)
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, syscall.ECONNREFUSED):
+		return State{}, false, nil
+	case err != nil:
+		return State{}, false, fmt.Errorf("can not connect to running exporter: %s", err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return State{}, true, err
+	}
+
+	var state State
+	if err := json.NewDecoder(conn).Decode(&state); err != nil {
+		return State{}, true, fmt.Errorf("can not read state of running exporter: %s", err)
+	}
+
+	return state, true, nil
+}
@@ -0,0 +1,264 @@
+// Package heatmap renders the current values of the sensors at their positions on a plan as SVG image, showing
+// dry or warm spots of a room or greenhouse at a glance.
+package heatmap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/anonymize"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+const (
+	// width of the image in pixels, the height follows from the positions of the sensors.
+	width = 800
+	// margin around the plan, which leaves space for the labels of the sensors.
+	margin = 60
+	// cellSize is the size of the squares used for interpolating the values between the sensors.
+	cellSize = 20
+	// legendHeight is the space below the plan used for the legend.
+	legendHeight = 50
+	// noDataColor is used for sensors without a current value.
+	noDataColor = "#999999"
+)
+
+// scale describes how a value is mapped to colors.
+type scale struct {
+	Name  string
+	Unit  string
+	Min   float64
+	Max   float64
+	Stops []rgb
+}
+
+type rgb struct {
+	R, G, B float64
+}
+
+// scales contains the values which can be shown, by the name used in the value parameter.
+var scales = map[string]scale{
+	"moisture": {
+		Name: "Soil moisture",
+		Unit: "%",
+		Min:  0,
+		Max:  60,
+		Stops: []rgb{
+			{160, 82, 45},
+			{230, 210, 90},
+			{30, 100, 200},
+		},
+	},
+	"temperature": {
+		Name: "Temperature",
+		Unit: "°C",
+		Min:  5,
+		Max:  35,
+		Stops: []rgb{
+			{40, 80, 200},
+			{240, 220, 80},
+			{200, 40, 30},
+		},
+	},
+}
+
+// color returns the color of the value, values outside of the range use the color of the closest end.
+func (s scale) color(value float64) string {
+	t := (value - s.Min) / (s.Max - s.Min)
+	t = math.Max(0, math.Min(1, t))
+
+	segments := float64(len(s.Stops) - 1)
+	i := int(math.Min(t*segments, segments-1))
+	f := t*segments - float64(i)
+	a, b := s.Stops[i], s.Stops[i+1]
+
+	return fmt.Sprintf("#%02x%02x%02x",
+		int(a.R+(b.R-a.R)*f),
+		int(a.G+(b.G-a.G)*f),
+		int(a.B+(b.B-a.B)*f))
+}
+
+// point is a sensor placed on the plan.
+type point struct {
+	Name  string
+	X, Y  float64
+	Value *float64
+}
+
+// Handler serves the heatmap. The value parameter selects the value shown, either "moisture" (the default) or
+// "temperature", the group parameter restricts the map to the sensors of a group.
+type Handler struct {
+	Log     logrus.FieldLogger
+	Sensors func() []config.Sensor
+	Source  func(macAddress string) (driver.Reading, error)
+	// StaleDuration is the age after which a value is not shown anymore.
+	StaleDuration time.Duration
+	// Anonymizer replaces the names of the sensors with pseudonyms if set.
+	Anonymizer *anonymize.Anonymizer
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	valueName := r.URL.Query().Get("value")
+	if valueName == "" {
+		valueName = "moisture"
+	}
+
+	sc, ok := scales[valueName]
+	if !ok {
+		http.Error(w, "unknown value: "+valueName, http.StatusBadRequest)
+		return
+	}
+
+	points := h.points(valueName, r.URL.Query().Get("group"), time.Now())
+	if len(points) == 0 {
+		http.Error(w, "no sensors with a position configured", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "no-cache")
+	if _, err := w.Write(render(sc, points)); err != nil {
+		h.Log.Debugf("Error writing heatmap: %s", err)
+	}
+}
+
+// points returns the sensors with a position together with their current value.
+func (h *Handler) points(valueName, group string, now time.Time) []point {
+	var result []point
+	for _, s := range h.Sensors() {
+		if s.Position == nil || (group != "" && s.Group != group) {
+			continue
+		}
+
+		p := point{
+			Name: h.Anonymizer.Name(s.Name),
+			X:    s.Position.X,
+			Y:    s.Position.Y,
+		}
+		if data, err := h.Source(s.MacAddress); err == nil && now.Sub(data.Time) < h.StaleDuration {
+			p.Value = *data.Field(valueName)
+		}
+		result = append(result, p)
+	}
+
+	return result
+}
+
+// render draws the plan. The space between the sensors is colored using inverse distance weighting of the values.
+func render(sc scale, points []point) []byte {
+	minX, maxX, minY, maxY := bounds(points)
+	factor := float64(width-2*margin) / math.Max(maxX-minX, maxY-minY)
+	planWidth := int(math.Ceil((maxX - minX) * factor))
+	planHeight := int(math.Ceil((maxY - minY) * factor))
+	height := planHeight + 2*margin + legendHeight
+
+	toScreen := func(p point) (float64, float64) {
+		return margin + (p.X-minX)*factor, margin + (p.Y-minY)*factor
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`+"\n", width, height, width, height)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#ffffff"/>`+"\n", width, height)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="16">%s</text>`+"\n", margin, margin/2, escape(sc.Name))
+
+	b.WriteString(`<g opacity="0.6">` + "\n")
+	for y := 0; y < planHeight; y += cellSize {
+		for x := 0; x < planWidth; x += cellSize {
+			cx := float64(margin+x) + cellSize/2
+			cy := float64(margin+y) + cellSize/2
+			value, ok := interpolate(points, cx, cy, toScreen)
+			if !ok {
+				continue
+			}
+
+			fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`+"\n", margin+x, margin+y, cellSize, cellSize, sc.color(value))
+		}
+	}
+	b.WriteString("</g>\n")
+
+	for _, p := range points {
+		x, y := toScreen(p)
+		fill := noDataColor
+		label := p.Name + ": no data"
+		if p.Value != nil {
+			fill = sc.color(*p.Value)
+			label = fmt.Sprintf("%s: %.1f %s", p.Name, *p.Value, sc.Unit)
+		}
+
+		fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="8" fill="%s" stroke="#000000"/>`+"\n", x, y, fill)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="middle">%s</text>`+"\n", x, y-14, escape(label))
+	}
+
+	writeLegend(&b, sc, height-legendHeight+10)
+	b.WriteString("</svg>\n")
+	return b.Bytes()
+}
+
+// bounds returns the range of the coordinates. Ranges of zero size are extended, so that a single sensor or sensors
+// on a line can be drawn.
+func bounds(points []point) (minX, maxX, minY, maxY float64) {
+	minX, maxX = points[0].X, points[0].X
+	minY, maxY = points[0].Y, points[0].Y
+	for _, p := range points[1:] {
+		minX, maxX = math.Min(minX, p.X), math.Max(maxX, p.X)
+		minY, maxY = math.Min(minY, p.Y), math.Max(maxY, p.Y)
+	}
+
+	if maxX-minX == 0 && maxY-minY == 0 {
+		return minX - 1, maxX + 1, minY - 1, maxY + 1
+	}
+
+	return minX, maxX, minY, maxY
+}
+
+// interpolate returns the value at a point of the image, weighting the values of the sensors by the inverse of their
+// squared distance. It returns false if no sensor has a value.
+func interpolate(points []point, x, y float64, toScreen func(point) (float64, float64)) (float64, bool) {
+	sum, weights := 0.0, 0.0
+	for _, p := range points {
+		if p.Value == nil {
+			continue
+		}
+
+		px, py := toScreen(p)
+		distance := (px-x)*(px-x) + (py-y)*(py-y)
+		if distance < 1 {
+			return *p.Value, true
+		}
+
+		sum += *p.Value / distance
+		weights += 1 / distance
+	}
+
+	if weights == 0 {
+		return 0, false
+	}
+
+	return sum / weights, true
+}
+
+func writeLegend(b *bytes.Buffer, sc scale, y int) {
+	const steps = 20
+	stepWidth := (width - 2*margin) / steps
+	for i := 0; i < steps; i++ {
+		value := sc.Min + (sc.Max-sc.Min)*(float64(i)+0.5)/steps
+		fmt.Fprintf(b, `<rect x="%d" y="%d" width="%d" height="12" fill="%s"/>`+"\n", margin+i*stepWidth, y, stepWidth, sc.color(value))
+	}
+
+	fmt.Fprintf(b, `<text x="%d" y="%d">%s</text>`+"\n", margin, y+28, escape(fmt.Sprintf("%g %s", sc.Min, sc.Unit)))
+	fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="end">%s</text>`+"\n", margin+steps*stepWidth, y+28, escape(fmt.Sprintf("%g %s", sc.Max, sc.Unit)))
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,334 @@
+// Package influxdb writes the readings of the sensors to InfluxDB v2 using the line protocol, for setups using
+// InfluxDB and Grafana instead of Prometheus.
+package influxdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/anonymize"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+const (
+	writePath = "/api/v2/write"
+	// maxBackoff is the longest time between two attempts while InfluxDB is failing.
+	maxBackoff = 5 * time.Minute
+)
+
+// point is a reading waiting to be written.
+type point struct {
+	// Seq identifies the point in the buffer, as older points can be dropped from the buffer while a batch is
+	// written.
+	Seq     uint64
+	Sensor  config.Sensor
+	Reading driver.Reading
+}
+
+// Writer buffers readings and writes them to InfluxDB in batches. Failed writes are retried with an increasing
+// delay, the readings are kept in the buffer meanwhile.
+type Writer struct {
+	log        logrus.FieldLogger
+	cfg        config.InfluxDBConfig
+	client     *http.Client
+	anonymizer *anonymize.Anonymizer
+
+	lock    sync.Mutex
+	nextSeq uint64
+	buffer  []point
+}
+
+// New creates a Writer. All requests are sent using the transport. Sensors are replaced by their pseudonyms if the
+// anonymizer is set.
+func New(log logrus.FieldLogger, cfg config.InfluxDBConfig, transport http.RoundTripper, anonymizer *anonymize.Anonymizer) *Writer {
+	return &Writer{
+		log: log,
+		cfg: cfg,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.Timeout,
+		},
+		anonymizer: anonymizer,
+	}
+}
+
+// Add puts a new reading into the buffer. It can be used as an updater.Listener.
+func (w *Writer) Add(sensor config.Sensor, data driver.Reading) {
+	if !hasValues(data) {
+		return
+	}
+
+	if w.tooOld(data.Time, time.Now()) {
+		w.log.Debugf("Skipping reading of %q from %s, it is older than %s.", sensor, data.Time, w.cfg.MaxAge)
+		return
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.nextSeq++
+	w.buffer = append(w.buffer, point{
+		Seq:     w.nextSeq,
+		Sensor:  w.anonymizer.Sensor(sensor),
+		Reading: data,
+	})
+
+	if len(w.buffer) > w.cfg.BufferSize {
+		dropped := len(w.buffer) - w.cfg.BufferSize
+		w.log.Warnf("InfluxDB buffer full, dropping %d oldest readings.", dropped)
+		w.buffer = w.buffer[dropped:]
+	}
+}
+
+// Start starts the background loop writing the buffered readings. The remaining readings are written once more when
+// the context is done.
+func (w *Writer) Start(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		delay := w.cfg.FlushInterval
+		w.log.Debug("InfluxDB writer ready.")
+		for {
+			select {
+			case <-ctx.Done():
+				w.log.Debug("Shutting down InfluxDB writer.")
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), w.cfg.Timeout)
+				if err := w.flush(shutdownCtx); err != nil {
+					w.log.Errorf("Error writing remaining readings to InfluxDB: %s", err)
+				}
+				cancel()
+				return
+			case <-time.After(delay):
+			}
+
+			err := w.flush(ctx)
+			switch {
+			case err == nil:
+				delay = w.cfg.FlushInterval
+			case ctx.Err() != nil:
+			default:
+				delay = backoff(delay, err)
+				w.log.Errorf("Error writing readings to InfluxDB, retrying in %s: %s", delay, err)
+			}
+		}
+	}()
+}
+
+// backoff returns the delay before the next attempt, which is doubled after every failure unless InfluxDB asked for
+// a specific delay.
+func backoff(delay time.Duration, err error) time.Duration {
+	if e, ok := err.(*writeError); ok && e.RetryAfter > 0 {
+		delay = e.RetryAfter
+	} else {
+		delay *= 2
+	}
+
+	if delay > maxBackoff {
+		return maxBackoff
+	}
+
+	return delay
+}
+
+// tooOld returns true if a reading should not be written anymore, because it is older than the maximum age.
+func (w *Writer) tooOld(t, now time.Time) bool {
+	return w.cfg.MaxAge > 0 && now.Sub(t) > w.cfg.MaxAge
+}
+
+// flush writes all buffered readings. Readings are only removed from the buffer once they have been written or have
+// been rejected by InfluxDB.
+func (w *Writer) flush(ctx context.Context) error {
+	for {
+		batch := w.nextBatch()
+		if len(batch) == 0 {
+			return nil
+		}
+
+		err := w.write(ctx, batch)
+		if e, ok := err.(*writeError); ok && e.Permanent() {
+			// Retrying a batch which InfluxDB does not accept would block all following readings.
+			w.log.Errorf("InfluxDB rejected %d readings: %s", len(batch), err)
+		} else if err != nil {
+			return err
+		}
+
+		w.drop(batch[len(batch)-1].Seq)
+	}
+}
+
+func (w *Writer) nextBatch() []point {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	// Readings buffered while InfluxDB was unreachable can get too old.
+	now := time.Now()
+	kept := w.buffer[:0]
+	for _, p := range w.buffer {
+		if !w.tooOld(p.Reading.Time, now) {
+			kept = append(kept, p)
+		}
+	}
+	if dropped := len(w.buffer) - len(kept); dropped > 0 {
+		w.log.Debugf("Skipping %d buffered readings older than %s.", dropped, w.cfg.MaxAge)
+	}
+	w.buffer = kept
+
+	size := len(w.buffer)
+	if size > w.cfg.BatchSize {
+		size = w.cfg.BatchSize
+	}
+
+	batch := make([]point, size)
+	copy(batch, w.buffer[:size])
+	return batch
+}
+
+// drop removes the readings up to seq from the buffer after they have been written.
+func (w *Writer) drop(seq uint64) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	count := 0
+	for count < len(w.buffer) && w.buffer[count].Seq <= seq {
+		count++
+	}
+	w.buffer = w.buffer[count:]
+}
+
+func (w *Writer) write(ctx context.Context, batch []point) error {
+	var body bytes.Buffer
+	for _, p := range batch {
+		appendLine(&body, w.cfg.Measurement, p)
+	}
+
+	query := url.Values{}
+	query.Set("org", w.cfg.Org)
+	query.Set("bucket", w.cfg.Bucket)
+	query.Set("precision", "ns")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.URL+writePath+"?"+query.Encode(), &body)
+	if err != nil {
+		return fmt.Errorf("can not create request: %s", err)
+	}
+	req.Header.Set("Authorization", "Token "+w.cfg.Token)
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 == 2 {
+		return nil
+	}
+
+	message, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	result := &writeError{
+		StatusCode: res.StatusCode,
+		Message:    strings.TrimSpace(string(message)),
+	}
+	if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		result.RetryAfter = time.Duration(seconds) * time.Second
+	}
+
+	return result
+}
+
+// writeError is returned for requests which were answered with an error by InfluxDB.
+type writeError struct {
+	StatusCode int
+	Message    string
+	// RetryAfter is the delay requested by InfluxDB, for example when exceeding a rate limit.
+	RetryAfter time.Duration
+}
+
+func (e *writeError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.StatusCode, e.Message)
+}
+
+// Permanent returns true if retrying the request will not help, for example because the data is invalid. Failed
+// authentication is retried, as the token might be fixed without restarting the exporter.
+func (e *writeError) Permanent() bool {
+	switch e.StatusCode {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return true
+	default:
+		return false
+	}
+}
+
+// appendLine adds the reading in line protocol. The values of the reading are written as fields of one point, the
+// sensor is identified by tags.
+func appendLine(b *bytes.Buffer, measurement string, p point) {
+	b.WriteString(escape(measurement, false))
+	writeTag(b, "macaddress", p.Sensor.MacAddress)
+	writeTag(b, "name", p.Sensor.Name)
+	writeTag(b, "group", p.Sensor.Group)
+	writeTag(b, "via", p.Reading.Via)
+
+	separator := byte(' ')
+	for _, name := range driver.FieldNames {
+		v := *p.Reading.Field(name)
+		if v == nil {
+			continue
+		}
+
+		b.WriteByte(separator)
+		separator = ','
+		b.WriteString(escape(name, true))
+		b.WriteByte('=')
+		b.WriteString(strconv.FormatFloat(*v, 'g', -1, 64))
+	}
+
+	fmt.Fprintf(b, " %d\n", p.Reading.Time.UnixNano())
+}
+
+// hasValues returns true if the reading contains a value, as points without fields are rejected by InfluxDB.
+func hasValues(r driver.Reading) bool {
+	for _, name := range driver.FieldNames {
+		if *r.Field(name) != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func writeTag(b *bytes.Buffer, key, value string) {
+	// Tags with empty values are not allowed.
+	if value == "" {
+		return
+	}
+
+	b.WriteByte(',')
+	b.WriteString(escape(key, true))
+	b.WriteByte('=')
+	b.WriteString(escape(value, true))
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	keyEscaper         = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`, "\n", `\n`)
+)
+
+// escape escapes the special characters of measurements, or of tag keys, tag values and field keys if key is set.
+func escape(s string, key bool) string {
+	if key {
+		return keyEscaper.Replace(s)
+	}
+
+	return measurementEscaper.Replace(s)
+}
@@ -0,0 +1,8 @@
+// Package integration contains end-to-end tests running the exporter binary against emulated sensors.
+//
+// The tests need two Bluetooth controllers which can reach each other, usually virtual controllers created by the
+// emulator of bluez (btvirt). One of them is used by the exporter, the other one emulates a Flower Care sensor. The
+// tests are only built using the "integration" build tag and are skipped unless the controllers are set using
+// FLOWERCARE_INTEGRATION_CENTRAL and FLOWERCARE_INTEGRATION_PERIPHERAL. "make integration" creates the controllers
+// and runs the tests, which needs root.
+package integration
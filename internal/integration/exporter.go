@@ -0,0 +1,181 @@
+//go:build integration && linux
+
+package integration
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// pollInterval is the time between two scrapes while waiting for a metric.
+const pollInterval = time.Second
+
+// buildExporter builds the exporter binary into the directory.
+func buildExporter(dir string) (string, error) {
+	binary := filepath.Join(dir, "flowercare-exporter")
+	cmd := exec.Command("go", "build", "-o", binary, "github.com/xperimental/flowercare-exporter")
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("error building exporter: %s", err)
+	}
+
+	return binary, nil
+}
+
+// Exporter is a running exporter binary.
+type Exporter struct {
+	t    *testing.T
+	addr string
+}
+
+// startExporter starts the exporter using the adapter and arguments. It uses an empty sensor directory and is stopped
+// at the end of the test. The log of the exporter is written to the test log if the test fails.
+func startExporter(t *testing.T, binary, adapterName string, args ...string) *Exporter {
+	t.Helper()
+
+	addr, err := freeAddress()
+	if err != nil {
+		t.Fatalf("Can not find free address: %s", err)
+	}
+
+	dir := t.TempDir()
+	logFile, err := os.Create(filepath.Join(dir, "exporter.log"))
+	if err != nil {
+		t.Fatalf("Can not create log file: %s", err)
+	}
+
+	args = append([]string{
+		"--adapter", adapterName,
+		"--addr", addr,
+		"--sensordir", dir,
+		"--log-level", "debug",
+	}, args...)
+	cmd := exec.Command(binary, args...)
+	cmd.Dir = dir
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Can not start exporter: %s", err)
+	}
+
+	t.Cleanup(func() {
+		cmd.Process.Signal(syscall.SIGTERM)
+		cmd.Wait()
+		logFile.Close()
+
+		if t.Failed() {
+			log, _ := os.ReadFile(logFile.Name())
+			t.Logf("Log of the exporter:\n%s", log)
+		}
+	})
+
+	return &Exporter{
+		t:    t,
+		addr: addr,
+	}
+}
+
+// freeAddress returns a local address which is not in use.
+func freeAddress() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+
+	return l.Addr().String(), nil
+}
+
+// Metrics scrapes the metrics of the exporter.
+func (e *Exporter) Metrics() (map[string]*dto.MetricFamily, error) {
+	res, err := http.Get("http://" + e.addr + "/metrics")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", res.Status)
+	}
+
+	var parser expfmt.TextParser
+	return parser.TextToMetricFamilies(res.Body)
+}
+
+// Value returns the value of the metric of the sensor. It returns false if the metric is not exported.
+func (e *Exporter) Value(name, macAddress string) (float64, bool) {
+	families, err := e.Metrics()
+	if err != nil {
+		return 0, false
+	}
+
+	return sensorValue(families[name], macAddress)
+}
+
+// WaitFor scrapes the exporter until the metric of the sensor satisfies the condition and fails the test if it does
+// not within the timeout.
+func (e *Exporter) WaitFor(name, macAddress string, timeout time.Duration, condition func(value float64) bool) float64 {
+	e.t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for {
+		value, ok := e.Value(name, macAddress)
+		if ok && condition(value) {
+			return value
+		}
+
+		if time.Now().After(deadline) {
+			if ok {
+				e.t.Fatalf("Metric %s of %s is %v after %s.", name, macAddress, value, timeout)
+			}
+			e.t.Fatalf("Metric %s of %s not exported after %s.", name, macAddress, timeout)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// sensorValue returns the value of the metric with the MAC address as label, ignoring its case.
+func sensorValue(family *dto.MetricFamily, macAddress string) (float64, bool) {
+	if family == nil {
+		return 0, false
+	}
+
+	for _, m := range family.GetMetric() {
+		if !hasLabel(m, "macaddress", macAddress) {
+			continue
+		}
+
+		switch {
+		case m.GetGauge() != nil:
+			return m.GetGauge().GetValue(), true
+		case m.GetCounter() != nil:
+			return m.GetCounter().GetValue(), true
+		case m.GetUntyped() != nil:
+			return m.GetUntyped().GetValue(), true
+		}
+	}
+
+	return 0, false
+}
+
+func hasLabel(m *dto.Metric, name, value string) bool {
+	for _, l := range m.GetLabel() {
+		if l.GetName() == name && strings.EqualFold(l.GetValue(), value) {
+			return true
+		}
+	}
+
+	return false
+}
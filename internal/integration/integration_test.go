@@ -0,0 +1,173 @@
+//go:build integration && linux
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	centralEnv    = "FLOWERCARE_INTEGRATION_CENTRAL"
+	peripheralEnv = "FLOWERCARE_INTEGRATION_PERIPHERAL"
+
+	// readTimeout is the time allowed for the first read of the sensor, including the start of the exporter.
+	readTimeout = time.Minute
+)
+
+var (
+	exporterBinary string
+
+	testValues = Values{
+		Temperature:  21.5,
+		Moisture:     40,
+		Light:        1000,
+		Conductivity: 350,
+		Battery:      90,
+		Firmware:     "3.2.1",
+	}
+
+	// exporterArgs keep the refresh and retries short, so that the tests do not wait for minutes.
+	exporterArgs = []string{
+		"--refresh-duration", "20s",
+		"--refresh-timeout", "5s",
+		"--stale-duration", "1m",
+		"--retry-min-duration", "5s",
+		"--retry-max-duration", "10s",
+	}
+)
+
+func TestMain(m *testing.M) {
+	// Building the exporter is only worth it if the tests are not skipped.
+	if os.Getenv(centralEnv) == "" || os.Getenv(peripheralEnv) == "" {
+		os.Exit(m.Run())
+	}
+
+	dir, err := os.MkdirTemp("", "flowercare-integration-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can not create directory: %s\n", err)
+		os.Exit(1)
+	}
+
+	exporterBinary, err = buildExporter(dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// setup starts the emulated sensor and returns it together with the adapter used by the exporter. The test is
+// skipped if the controllers are not configured.
+func setup(t *testing.T, mode Mode) (*Peripheral, string) {
+	central, peripheral := os.Getenv(centralEnv), os.Getenv(peripheralEnv)
+	if central == "" || peripheral == "" {
+		t.Skipf("Needs %s and %s.", centralEnv, peripheralEnv)
+	}
+
+	p, err := NewPeripheral(peripheral, testValues)
+	if err != nil {
+		t.Fatalf("Can not start emulated sensor: %s", err)
+	}
+	p.SetMode(mode)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := p.Run(ctx); err != nil {
+			t.Errorf("Error running emulated sensor: %s", err)
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+
+	return p, central
+}
+
+func atLeast(min float64) func(float64) bool {
+	return func(value float64) bool {
+		return value >= min
+	}
+}
+
+func near(want float64) func(float64) bool {
+	return func(value float64) bool {
+		return math.Abs(value-want) < 0.001
+	}
+}
+
+func TestRead(t *testing.T) {
+	p, central := setup(t, ModeNormal)
+	mac := p.Address()
+	e := startExporter(t, exporterBinary, central, append(exporterArgs, "--sensor", "plant="+mac)...)
+
+	e.WaitFor("flowercare_temperature_celsius", mac, readTimeout, near(testValues.Temperature))
+	for _, tc := range []struct {
+		metric string
+		want   float64
+	}{
+		{"flowercare_moisture_percent", float64(testValues.Moisture)},
+		{"flowercare_brightness_lux", float64(testValues.Light)},
+		{"flowercare_conductivity_sm", float64(testValues.Conductivity) * 0.0001},
+		{"flowercare_battery_percent", float64(testValues.Battery)},
+		{"flowercare_up", 1},
+	} {
+		value, ok := e.Value(tc.metric, mac)
+		switch {
+		case !ok:
+			t.Errorf("Metric %s not exported.", tc.metric)
+		case !near(tc.want)(value):
+			t.Errorf("Got %v for %s, want %v", value, tc.metric, tc.want)
+		}
+	}
+
+	// Changed values are picked up by the next refresh.
+	changed := testValues
+	changed.Temperature = 23
+	p.SetValues(changed)
+	e.WaitFor("flowercare_temperature_celsius", mac, readTimeout, near(changed.Temperature))
+}
+
+func TestConnectTimeout(t *testing.T) {
+	p, central := setup(t, ModeSilent)
+	mac := p.Address()
+	e := startExporter(t, exporterBinary, central, append(exporterArgs, "--sensor", "plant="+mac)...)
+
+	e.WaitFor("flowercare_connect_timeouts_total", mac, readTimeout, atLeast(1))
+	if _, ok := e.Value("flowercare_temperature_celsius", mac); ok {
+		t.Error("Sensor which could not be connected to has values.")
+	}
+
+	// The retry reads the sensor once it is in range again.
+	p.SetMode(ModeNormal)
+	e.WaitFor("flowercare_temperature_celsius", mac, readTimeout, near(testValues.Temperature))
+	e.WaitFor("flowercare_consecutive_read_errors", mac, readTimeout, near(0))
+}
+
+func TestDisconnect(t *testing.T) {
+	p, central := setup(t, ModeDisconnect)
+	mac := p.Address()
+	e := startExporter(t, exporterBinary, central, append(exporterArgs, "--sensor", "plant="+mac)...)
+
+	e.WaitFor("flowercare_read_errors_total", mac, readTimeout, atLeast(1))
+	if timeouts, ok := e.Value("flowercare_connect_timeouts_total", mac); ok && timeouts > 0 {
+		t.Errorf("Dropped connection counted as %v connect timeouts.", timeouts)
+	}
+
+	p.SetMode(ModeNormal)
+	e.WaitFor("flowercare_temperature_celsius", mac, readTimeout, near(testValues.Temperature))
+	e.WaitFor("flowercare_consecutive_read_errors", mac, readTimeout, near(0))
+}
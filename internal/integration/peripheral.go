@@ -0,0 +1,279 @@
+//go:build integration && linux
+
+package integration
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/go-ble/ble"
+	"github.com/go-ble/ble/linux"
+	"github.com/xperimental/flowercare-exporter/internal/adapter"
+	"github.com/xperimental/flowercare-exporter/pkg/miflora"
+)
+
+// Value handles of the characteristics of the sensors. The exporter uses them directly instead of discovering the
+// characteristics, so the emulated sensor needs to use the same handles as pkg/miflora.
+const (
+	modeHandle     = 0x33
+	sensorsHandle  = 0x35
+	firmwareHandle = 0x38
+)
+
+// maxPadding limits the number of handles inserted before the characteristics of the sensor.
+const maxPadding = 0x40
+
+// Mode selects how the emulated sensor behaves.
+type Mode int
+
+const (
+	// ModeNormal answers all requests.
+	ModeNormal Mode = iota
+	// ModeSilent stops advertising, so that connecting to the sensor times out.
+	ModeSilent
+	// ModeDisconnect drops the connection on the first request.
+	ModeDisconnect
+)
+
+func (m Mode) String() string {
+	switch m {
+	case ModeNormal:
+		return "normal"
+	case ModeSilent:
+		return "silent"
+	case ModeDisconnect:
+		return "disconnect"
+	default:
+		return fmt.Sprintf("Mode(%d)", int(m))
+	}
+}
+
+// Values are the values returned by the emulated sensor.
+type Values struct {
+	Temperature  float64
+	Moisture     byte
+	Light        uint16
+	Conductivity uint16
+	Battery      byte
+	Firmware     string
+}
+
+// sensors encodes the values like the realtime data of the sensors.
+func (v Values) sensors() []byte {
+	b := make([]byte, 16)
+	binary.LittleEndian.PutUint16(b, uint16(int16(v.Temperature*10)))
+	binary.LittleEndian.PutUint16(b[3:], v.Light)
+	b[7] = v.Moisture
+	binary.LittleEndian.PutUint16(b[8:], v.Conductivity)
+	return b
+}
+
+// firmware encodes the battery level and firmware version.
+func (v Values) firmware() []byte {
+	return append([]byte{v.Battery, 0x2b}, v.Firmware...)
+}
+
+// Peripheral emulates a Flower Care sensor using a Bluetooth controller.
+type Peripheral struct {
+	device *linux.Device
+
+	lock     sync.Mutex
+	mode     Mode
+	values   Values
+	realtime bool
+	changed  chan struct{}
+}
+
+// NewPeripheral opens the controller, which is selected like the adapters of the exporter, and sets up the
+// characteristics of the sensor.
+func NewPeripheral(selector string, values Values) (*Peripheral, error) {
+	a, err := adapter.Resolve(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	device, err := linux.NewDeviceWithName("Flower care", ble.OptDeviceID(a.ID))
+	if err != nil {
+		return nil, fmt.Errorf("can not open %s: %s", a, err)
+	}
+
+	p := &Peripheral{
+		device:  device,
+		values:  values,
+		changed: make(chan struct{}, 1),
+	}
+	if err := p.setServices(); err != nil {
+		device.Stop()
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Address returns the MAC address of the emulated sensor.
+func (p *Peripheral) Address() string {
+	return p.device.Address().String()
+}
+
+// SetMode changes the behavior of the emulated sensor.
+func (p *Peripheral) SetMode(mode Mode) {
+	p.lock.Lock()
+	p.mode = mode
+	p.lock.Unlock()
+
+	select {
+	case p.changed <- struct{}{}:
+	default:
+	}
+}
+
+// SetValues changes the values returned by the emulated sensor.
+func (p *Peripheral) SetValues(values Values) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.values = values
+}
+
+func (p *Peripheral) state() (Mode, Values) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.mode, p.values
+}
+
+// Run advertises the emulated sensor until the context is done, except while it is silent. The controller is closed
+// afterwards.
+func (p *Peripheral) Run(ctx context.Context) error {
+	defer p.device.Stop()
+
+	for {
+		mode, _ := p.state()
+		advCtx, cancel := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		if mode == ModeSilent {
+			close(done)
+		} else {
+			go func() {
+				done <- p.device.AdvertiseNameAndServices(advCtx, "Flower care", miflora.ServiceUUID)
+			}()
+		}
+
+		select {
+		case <-ctx.Done():
+			cancel()
+			<-done
+			return nil
+		case <-p.changed:
+			cancel()
+			if err := <-done; err != nil && !errors.Is(err, context.Canceled) {
+				return fmt.Errorf("error advertising: %s", err)
+			}
+		case err := <-done:
+			cancel()
+			if err != nil {
+				return fmt.Errorf("error advertising: %s", err)
+			}
+
+			// A silent sensor waits for the next change of the mode.
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-p.changed:
+			}
+		}
+	}
+}
+
+// setServices adds the service of the sensor. The go-ble server assigns the handles in order, so padding is inserted
+// until the characteristics end up at the handles of the real sensors.
+func (p *Peripheral) setServices() error {
+	for padding := 0; padding < maxPadding; padding++ {
+		services, mode, sensors, firmware := p.services(padding)
+		if err := p.device.SetServices(services); err != nil {
+			return fmt.Errorf("can not set services: %s", err)
+		}
+
+		if mode.ValueHandle == modeHandle && sensors.ValueHandle == sensorsHandle && firmware.ValueHandle == firmwareHandle {
+			return nil
+		}
+	}
+
+	return errors.New("can not place the characteristics at the handles of the sensor")
+}
+
+// services returns the services of the sensor with the number of padding handles inserted before the
+// characteristics. An empty service takes a single handle, every other padding characteristic two.
+func (p *Peripheral) services(padding int) (services []*ble.Service, mode, sensors, firmware *ble.Characteristic) {
+	if padding%2 == 1 {
+		services = append(services, ble.NewService(ble.UUID16(0xfff0)))
+	}
+
+	svc := ble.NewService(ble.UUID16(0x1204))
+	for i := 0; i < padding/2; i++ {
+		svc.NewCharacteristic(ble.UUID16(uint16(0xfff1 + i))).SetValue([]byte{0})
+	}
+
+	mode = svc.NewCharacteristic(ble.UUID16(0x1a00))
+	mode.HandleWrite(ble.WriteHandlerFunc(p.writeMode))
+
+	sensors = svc.NewCharacteristic(ble.UUID16(0x1a01))
+	sensors.HandleRead(ble.ReadHandlerFunc(p.readSensors))
+	// The descriptor moves the firmware characteristic to the next handle.
+	sensors.NewDescriptor(ble.UUID16(0x2901)).SetValue([]byte("sensors"))
+
+	firmware = svc.NewCharacteristic(ble.UUID16(0x1a02))
+	firmware.HandleRead(ble.ReadHandlerFunc(p.readFirmware))
+
+	return append(services, svc), mode, sensors, firmware
+}
+
+// drop closes the connection of the request if the sensor is in ModeDisconnect.
+func (p *Peripheral) drop(req ble.Request) bool {
+	if mode, _ := p.state(); mode != ModeDisconnect {
+		return false
+	}
+
+	req.Conn().Close()
+	return true
+}
+
+func (p *Peripheral) writeMode(req ble.Request, rsp ble.ResponseWriter) {
+	if p.drop(req) {
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.realtime = string(req.Data()) == "\xa0\x1f"
+}
+
+func (p *Peripheral) readSensors(req ble.Request, rsp ble.ResponseWriter) {
+	if p.drop(req) {
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	// The real sensors return constant data unless the realtime reading has been enabled.
+	if !p.realtime {
+		rsp.Write([]byte{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff, 0x99, 0x88, 0x77, 0x66, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})
+		return
+	}
+
+	rsp.Write(p.values.sensors())
+}
+
+func (p *Peripheral) readFirmware(req ble.Request, rsp ble.ResponseWriter) {
+	if p.drop(req) {
+		return
+	}
+
+	_, values := p.state()
+	rsp.Write(values.firmware())
+}
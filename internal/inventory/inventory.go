@@ -0,0 +1,204 @@
+// Package inventory describes the sensors and endpoints of an exporter in a machine-readable form, which can be used
+// for generating dashboards and alert rules per plant.
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+	"github.com/xperimental/flowercare-exporter/pkg/apiclient"
+)
+
+// Exporter contains the endpoints of the exporter.
+type Exporter struct {
+	URL     string `json:"url"`
+	Metrics string `json:"metrics_url"`
+	Ready   string `json:"ready_url"`
+	API     string `json:"api_url"`
+}
+
+// Sensor describes a sensor and the values it provides.
+type Sensor struct {
+	Name           string `json:"name"`
+	MacAddress     string `json:"mac_address"`
+	Group          string `json:"group"`
+	Driver         string `json:"driver"`
+	Species        string `json:"species"`
+	ScientificName string `json:"scientific_name"`
+	CommonName     string `json:"common_name"`
+	// Selector is a PromQL label selector matching the metrics of the sensor.
+	Selector string `json:"selector"`
+	// Values contains the names of the values reported by the sensor, empty if it has not been read yet.
+	Values    []string            `json:"values"`
+	Parameter apiclient.Parameter `json:"parameter"`
+}
+
+// Inventory contains the exporter and its sensors.
+type Inventory struct {
+	Exporter Exporter `json:"exporter"`
+	Sensors  []Sensor `json:"sensors"`
+}
+
+// New creates the inventory of the exporter at the base URL from the sensors reported by its control API. The
+// sensors are sorted by name.
+func New(baseURL string, sensors []apiclient.SensorStatus) Inventory {
+	result := Inventory{
+		Exporter: Exporter{
+			URL:     baseURL,
+			Metrics: baseURL + "/metrics",
+			Ready:   baseURL + "/-/ready",
+			API:     baseURL + "/api/v1/",
+		},
+		Sensors: []Sensor{},
+	}
+
+	for _, status := range sensors {
+		s := status.Sensor
+		if s.Driver == "" {
+			s.Driver = driver.Default
+		}
+
+		result.Sensors = append(result.Sensors, Sensor{
+			Name:           s.Name,
+			MacAddress:     s.MacAddress,
+			Group:          s.Group,
+			Driver:         s.Driver,
+			Species:        s.Species,
+			ScientificName: s.ScientificName,
+			CommonName:     s.CommonName,
+			Selector:       fmt.Sprintf("{macaddress=%q}", s.MacAddress),
+			Values:         values(status.Data),
+			Parameter:      s.Parameter,
+		})
+	}
+
+	sort.Slice(result.Sensors, func(i, j int) bool {
+		if result.Sensors[i].Name != result.Sensors[j].Name {
+			return result.Sensors[i].Name < result.Sensors[j].Name
+		}
+		return result.Sensors[i].MacAddress < result.Sensors[j].MacAddress
+	})
+	return result
+}
+
+// values returns the names of the values contained in the reading, using the names of the stale duration overrides.
+func values(r *apiclient.Reading) []string {
+	result := []string{}
+	if r == nil {
+		return result
+	}
+
+	for _, v := range []struct {
+		Name  string
+		Value *float64
+	}{
+		{"battery", r.Battery},
+		{"temperature", r.Temperature},
+		{"moisture", r.Moisture},
+		{"light", r.Light},
+		{"conductivity", r.Conductivity},
+		{"humidity", r.Humidity},
+		{"battery_voltage", r.BatteryVoltage},
+		{"conductivity_compensated", r.ConductivityCompensated},
+		{"rssi", r.RSSI},
+	} {
+		if v.Value != nil {
+			result = append(result, v.Name)
+		}
+	}
+
+	return result
+}
+
+// WriteJSON writes the inventory as JSON.
+func (i Inventory) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(i)
+}
+
+// WriteTerraform writes the inventory as Terraform locals, so that it can be added to a configuration and used with
+// for_each. The sensors are keyed by their MAC address. The output is formatted like "terraform fmt" does.
+func (i Inventory) WriteTerraform(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# Generated by flowercare-exporter inventory.\n")
+	b.WriteString("locals {\n")
+	b.WriteString("  flowercare_exporter = {\n")
+	writeAttributes(&b, 4, []attribute{
+		{"url", quote(i.Exporter.URL)},
+		{"metrics_url", quote(i.Exporter.Metrics)},
+		{"ready_url", quote(i.Exporter.Ready)},
+		{"api_url", quote(i.Exporter.API)},
+	})
+	b.WriteString("  }\n\n")
+
+	b.WriteString("  flowercare_sensors = {\n")
+	for _, s := range i.Sensors {
+		values := make([]string, len(s.Values))
+		for j, v := range s.Values {
+			values[j] = quote(v)
+		}
+
+		fmt.Fprintf(&b, "    %s = {\n", quote(s.MacAddress))
+		writeAttributes(&b, 6, []attribute{
+			{"name", quote(s.Name)},
+			{"mac_address", quote(s.MacAddress)},
+			{"group", quote(s.Group)},
+			{"driver", quote(s.Driver)},
+			{"species", quote(s.Species)},
+			{"scientific_name", quote(s.ScientificName)},
+			{"common_name", quote(s.CommonName)},
+			{"selector", quote(s.Selector)},
+			{"values", "[" + strings.Join(values, ", ") + "]"},
+		})
+		b.WriteString("      parameter = {\n")
+		p := s.Parameter
+		writeAttributes(&b, 8, []attribute{
+			{"min_soil_moist", strconv.Itoa(p.MinSoilMoist)},
+			{"max_soil_moist", strconv.Itoa(p.MaxSoilMoist)},
+			{"min_soil_ec", strconv.Itoa(p.MinSoilEc)},
+			{"max_soil_ec", strconv.Itoa(p.MaxSoilEc)},
+			{"min_light_lux", strconv.Itoa(p.MinLightLux)},
+			{"max_light_lux", strconv.Itoa(p.MaxLightLux)},
+		})
+		b.WriteString("      }\n")
+		b.WriteString("    }\n")
+	}
+	b.WriteString("  }\n")
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type attribute struct {
+	Name  string
+	Value string
+}
+
+// writeAttributes writes the attributes of a block with their equal signs aligned.
+func writeAttributes(b *strings.Builder, indent int, attributes []attribute) {
+	width := 0
+	for _, a := range attributes {
+		if len(a.Name) > width {
+			width = len(a.Name)
+		}
+	}
+
+	for _, a := range attributes {
+		fmt.Fprintf(b, "%s%-*s = %s\n", strings.Repeat(" ", indent), width, a.Name, a.Value)
+	}
+}
+
+// quote returns the string as Terraform string literal. Template sequences are escaped, so that names containing
+// them are not interpreted.
+func quote(s string) string {
+	data, _ := json.Marshal(s)
+	quoted := strings.ReplaceAll(string(data), "${", "$${")
+	return strings.ReplaceAll(quoted, "%{", "%%{")
+}
@@ -0,0 +1,160 @@
+// Package logging provides loggers for the modules of the exporter, whose levels can be set independently.
+package logging
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Names of the modules, which can have their own log level.
+const (
+	ModuleMain      = "main"
+	ModuleBLE       = "ble"
+	ModuleScheduler = "scheduler"
+	ModuleCollector = "collector"
+	ModuleHTTP      = "http"
+	ModulePush      = "push"
+	ModuleNotify    = "notify"
+	ModuleGrafana   = "grafana"
+	ModuleMQTT      = "mqtt"
+	ModuleBackfill  = "backfill"
+	ModuleInfluxDB  = "influxdb"
+	ModuleOTLP      = "otlp"
+)
+
+// Modules contains all module names.
+var Modules = []string{
+	ModuleMain,
+	ModuleBLE,
+	ModuleScheduler,
+	ModuleCollector,
+	ModuleHTTP,
+	ModulePush,
+	ModuleNotify,
+	ModuleGrafana,
+	ModuleMQTT,
+	ModuleBackfill,
+	ModuleInfluxDB,
+	ModuleOTLP,
+}
+
+// Levels contains the default log level and overrides for single modules.
+type Levels struct {
+	Default logrus.Level
+	Modules map[string]logrus.Level
+}
+
+// ParseLevels parses a level specification like "info,ble=trace,http=warn". The entry without a module name sets
+// the default level.
+func ParseLevels(value string) (Levels, error) {
+	result := Levels{
+		Default: logrus.InfoLevel,
+		Modules: map[string]logrus.Level{},
+	}
+
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		module, levelName, ok := strings.Cut(part, "=")
+		if !ok {
+			level, err := logrus.ParseLevel(part)
+			if err != nil {
+				return Levels{}, err
+			}
+
+			result.Default = level
+			continue
+		}
+
+		if !isModule(module) {
+			return Levels{}, fmt.Errorf("unknown module %q, known modules: %s", module, strings.Join(Modules, ", "))
+		}
+
+		level, err := logrus.ParseLevel(levelName)
+		if err != nil {
+			return Levels{}, fmt.Errorf("module %s: %s", module, err)
+		}
+		result.Modules[module] = level
+	}
+
+	return result, nil
+}
+
+func isModule(name string) bool {
+	for _, m := range Modules {
+		if m == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (l Levels) String() string {
+	parts := []string{l.Default.String()}
+	for module, level := range l.Modules {
+		parts = append(parts, module+"="+level.String())
+	}
+	sort.Strings(parts[1:])
+
+	return strings.Join(parts, ",")
+}
+
+// For returns the level of a module.
+func (l Levels) For(module string) logrus.Level {
+	if level, ok := l.Modules[module]; ok {
+		return level
+	}
+
+	return l.Default
+}
+
+// Loggers creates the loggers of the modules, which share the output, formatter and hooks of a base logger.
+type Loggers struct {
+	base   *logrus.Logger
+	levels Levels
+}
+
+// New creates Loggers. The level of the base logger is set to the level of the main module.
+func New(base *logrus.Logger, levels Levels) *Loggers {
+	base.SetLevel(levels.For(ModuleMain))
+
+	return &Loggers{
+		base:   base,
+		levels: levels,
+	}
+}
+
+// For returns the logger of a module.
+func (l *Loggers) For(module string) logrus.FieldLogger {
+	if module == ModuleMain {
+		return l.base
+	}
+
+	logger := &logrus.Logger{
+		Out:          l.base.Out,
+		Formatter:    &sharedFormatter{base: l.base},
+		Hooks:        l.base.Hooks,
+		Level:        l.levels.For(module),
+		ExitFunc:     l.base.ExitFunc,
+		ReportCaller: l.base.ReportCaller,
+	}
+
+	return logger.WithField("module", module)
+}
+
+// sharedFormatter uses the current formatter of the base logger, so that formatters set later are used as well.
+type sharedFormatter struct {
+	base *logrus.Logger
+}
+
+// Format implements logrus.Formatter
+func (f *sharedFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	return f.base.Formatter.Format(entry)
+}
@@ -0,0 +1,95 @@
+// Package logsample collapses repeated log messages into periodic summaries.
+package logsample
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type entry struct {
+	level      logrus.Level
+	message    string
+	first      time.Time
+	suppressed int
+}
+
+// Sampler logs the first occurrence of a message and suppresses identical messages for the duration of the
+// window. The number of suppressed messages is logged as a summary when the window has passed.
+type Sampler struct {
+	log    logrus.FieldLogger
+	window time.Duration
+
+	lock    sync.Mutex
+	entries map[string]*entry
+}
+
+// New creates a new Sampler. A window of zero disables the sampling, so all messages are logged.
+func New(log logrus.FieldLogger, window time.Duration) *Sampler {
+	return &Sampler{
+		log:     log,
+		window:  window,
+		entries: map[string]*entry{},
+	}
+}
+
+// Log logs the message unless an identical message with the same key has been logged during the window.
+func (s *Sampler) Log(level logrus.Level, key, message string, now time.Time) {
+	if s.window <= 0 {
+		s.logf(level, "%s", message)
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	id := key + "\x00" + message
+	e, ok := s.entries[id]
+	switch {
+	case !ok:
+		s.entries[id] = &entry{
+			level:   level,
+			message: message,
+			first:   now,
+		}
+		s.logf(level, "%s", message)
+	case now.Sub(e.first) < s.window:
+		e.suppressed++
+	default:
+		s.logf(level, "%s (x%d in last %s)", message, e.suppressed+1, now.Sub(e.first).Round(time.Second))
+		e.first = now
+		e.suppressed = 0
+	}
+}
+
+// Flush logs the summaries of all messages whose window has passed and forgets them, so that the next
+// occurrence is logged immediately again.
+func (s *Sampler) Flush(now time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for id, e := range s.entries {
+		if now.Sub(e.first) < s.window {
+			continue
+		}
+
+		if e.suppressed > 0 {
+			s.logf(e.level, "%s (x%d in last %s)", e.message, e.suppressed, now.Sub(e.first).Round(time.Second))
+		}
+		delete(s.entries, id)
+	}
+}
+
+func (s *Sampler) logf(level logrus.Level, format string, args ...interface{}) {
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel:
+		s.log.Errorf(format, args...)
+	case logrus.WarnLevel:
+		s.log.Warnf(format, args...)
+	case logrus.InfoLevel:
+		s.log.Infof(format, args...)
+	default:
+		s.log.Debugf(format, args...)
+	}
+}
@@ -0,0 +1,153 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+// entity describes how a value of a reading is shown in Home Assistant.
+type entity struct {
+	Field       string
+	Name        string
+	DeviceClass string
+	Unit        string
+	Icon        string
+	Diagnostic  bool
+}
+
+// entities contains the values announced to Home Assistant. Fields refer to the JSON names of driver.Reading.
+var entities = []entity{
+	{Field: "moisture", Name: "Moisture", DeviceClass: "moisture", Unit: "%"},
+	{Field: "temperature", Name: "Temperature", DeviceClass: "temperature", Unit: "°C"},
+	{Field: "conductivity", Name: "Conductivity", DeviceClass: "conductivity", Unit: "µS/cm", Icon: "mdi:flower"},
+	{Field: "light", Name: "Light", DeviceClass: "illuminance", Unit: "lx"},
+	{Field: "humidity", Name: "Humidity", DeviceClass: "humidity", Unit: "%"},
+	{Field: "battery", Name: "Battery", DeviceClass: "battery", Unit: "%", Diagnostic: true},
+	{Field: "rssi", Name: "Signal strength", DeviceClass: "signal_strength", Unit: "dBm", Diagnostic: true},
+}
+
+// discoveryConfig is the payload of a Home Assistant discovery message for a sensor entity.
+type discoveryConfig struct {
+	Name              string          `json:"name"`
+	UniqueID          string          `json:"unique_id"`
+	ObjectID          string          `json:"object_id"`
+	StateTopic        string          `json:"state_topic"`
+	ValueTemplate     string          `json:"value_template"`
+	DeviceClass       string          `json:"device_class,omitempty"`
+	UnitOfMeasurement string          `json:"unit_of_measurement,omitempty"`
+	StateClass        string          `json:"state_class"`
+	Icon              string          `json:"icon,omitempty"`
+	EntityCategory    string          `json:"entity_category,omitempty"`
+	Device            discoveryDevice `json:"device"`
+}
+
+type discoveryDevice struct {
+	Identifiers   []string    `json:"identifiers"`
+	Connections   [][2]string `json:"connections"`
+	Name          string      `json:"name"`
+	Model         string      `json:"model,omitempty"`
+	SWVersion     string      `json:"sw_version,omitempty"`
+	SuggestedArea string      `json:"suggested_area,omitempty"`
+}
+
+// nodeID identifies the sensor in Home Assistant.
+func nodeID(sensor config.Sensor) string {
+	return "flowercare_" + strings.ToLower(strings.ReplaceAll(sensor.MacAddress, ":", ""))
+}
+
+// announce queues discovery messages for the values of the reading which have not been announced yet.
+func (p *Publisher) announce(sensor config.Sensor, data driver.Reading) {
+	node := nodeID(sensor)
+
+	for _, e := range entities {
+		if *data.Field(e.Field) == nil {
+			continue
+		}
+
+		key := node + "/" + e.Field
+		if !p.markAnnounced(key) {
+			continue
+		}
+
+		payload, err := json.Marshal(p.discoveryConfig(sensor, data, node, e))
+		if err != nil {
+			p.log.Errorf("Error encoding discovery message of %q: %s", sensor, err)
+			continue
+		}
+
+		if !p.enqueue(message{
+			topic:   p.cfg.HomeAssistantPrefix + "/sensor/" + node + "/" + e.Field + "/config",
+			payload: payload,
+			retain:  true,
+		}) {
+			p.unmarkAnnounced(key)
+		}
+	}
+}
+
+func (p *Publisher) discoveryConfig(sensor config.Sensor, data driver.Reading, node string, e entity) discoveryConfig {
+	name := sensor.Name
+	if name == "" {
+		name = sensor.MacAddress
+	}
+
+	model := ""
+	if d, err := driver.Get(sensor.Driver); err == nil {
+		model = d.Model
+	}
+
+	result := discoveryConfig{
+		Name:              e.Name,
+		UniqueID:          node + "_" + e.Field,
+		ObjectID:          topicLevel(strings.ToLower(name)) + "_" + e.Field,
+		StateTopic:        Topic(p.cfg.Topic, sensor),
+		ValueTemplate:     "{{ value_json." + e.Field + " }}",
+		DeviceClass:       e.DeviceClass,
+		UnitOfMeasurement: e.Unit,
+		StateClass:        "measurement",
+		Icon:              e.Icon,
+		Device: discoveryDevice{
+			Identifiers:   []string{node},
+			Connections:   [][2]string{{"mac", strings.ToLower(sensor.MacAddress)}},
+			Name:          name,
+			Model:         model,
+			SWVersion:     data.Firmware,
+			SuggestedArea: sensor.Group,
+		},
+	}
+	if e.Diagnostic {
+		result.EntityCategory = "diagnostic"
+	}
+
+	return result
+}
+
+func (p *Publisher) markAnnounced(key string) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.announced[key] {
+		return false
+	}
+	p.announced[key] = true
+	return true
+}
+
+func (p *Publisher) unmarkAnnounced(key string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	delete(p.announced, key)
+}
+
+// resetAnnounced makes sure the discovery messages are published again after reconnecting, in case the broker
+// has lost its retained messages.
+func (p *Publisher) resetAnnounced() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.announced = map[string]bool{}
+}
@@ -0,0 +1,243 @@
+// Package mqtt publishes the readings of the sensors to an MQTT broker, so that home automation systems can use
+// them without scraping the metrics.
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/anonymize"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+const (
+	// queueSize is the number of messages waiting to be published, further messages are dropped.
+	queueSize      = 100
+	connectTimeout = 10 * time.Second
+	publishTimeout = 10 * time.Second
+	// disconnectQuiesce is the time in milliseconds given to in-flight messages when shutting down.
+	disconnectQuiesce = 1000
+)
+
+// State is the payload published for every reading.
+type State struct {
+	Name       string `json:"name,omitempty"`
+	MacAddress string `json:"sensor"`
+	driver.Reading
+}
+
+type message struct {
+	topic   string
+	payload []byte
+	retain  bool
+	// time is the time of the reading contained in the message. It is zero for discovery messages.
+	time time.Time
+}
+
+// Publisher publishes readings to the broker.
+type Publisher struct {
+	log        logrus.FieldLogger
+	cfg        config.MQTTConfig
+	anonymizer *anonymize.Anonymizer
+	client     paho.Client
+	queue      chan message
+
+	lock sync.Mutex
+	// announced contains the values which have been announced to Home Assistant.
+	announced map[string]bool
+}
+
+// New creates a Publisher. The certificates used for TLS are read immediately. Sensors are replaced by their
+// pseudonyms if the anonymizer is set.
+func New(log logrus.FieldLogger, cfg config.MQTTConfig, anonymizer *anonymize.Anonymizer) (*Publisher, error) {
+	tlsConfig, err := newTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	clientID := cfg.ClientID
+	if clientID == "" {
+		hostname, _ := os.Hostname()
+		clientID = "flowercare-exporter-" + hostname
+	}
+
+	p := &Publisher{
+		log:        log,
+		cfg:        cfg,
+		anonymizer: anonymizer,
+		queue:      make(chan message, queueSize),
+		announced:  map[string]bool{},
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(clientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetTLSConfig(tlsConfig).
+		SetConnectTimeout(connectTimeout).
+		SetConnectRetry(true).
+		SetAutoReconnect(true).
+		SetOnConnectHandler(func(paho.Client) {
+			log.Infof("Connected to MQTT broker %s", cfg.Broker)
+			p.resetAnnounced()
+		}).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			log.Warnf("Lost connection to MQTT broker: %s", err)
+		})
+
+	p.client = paho.NewClient(opts)
+
+	return p, nil
+}
+
+func newTLSConfig(cfg config.MQTTTLSConfig) (*tls.Config, error) {
+	result := &tls.Config{
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		data, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("can not read MQTT CA file: %s", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in MQTT CA file: %s", cfg.CAFile)
+		}
+		result.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("can not load MQTT client certificate: %s", err)
+		}
+		result.Certificates = []tls.Certificate{cert}
+	}
+
+	return result, nil
+}
+
+// Topic returns the topic the readings of the sensor are published to.
+func Topic(template string, sensor config.Sensor) string {
+	name := sensor.Name
+	if name == "" {
+		name = sensor.MacAddress
+	}
+
+	return strings.NewReplacer(
+		"{name}", topicLevel(name),
+		"{mac}", topicLevel(sensor.MacAddress),
+	).Replace(template)
+}
+
+// topicLevel replaces the characters which have a special meaning in MQTT topics.
+func topicLevel(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '+', '#', ' ':
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// Add queues a reading for publishing. The values of sensors seen for the first time are announced to Home
+// Assistant if enabled. It can be used as an updater.Listener and does not block.
+func (p *Publisher) Add(sensor config.Sensor, data driver.Reading) {
+	sensor = p.anonymizer.Sensor(sensor)
+	if p.tooOld(data.Time, time.Now()) {
+		p.log.Debugf("Skipping reading of %q from %s, it is older than %s.", sensor, data.Time, p.cfg.MaxAge)
+		return
+	}
+
+	if p.cfg.HomeAssistant {
+		p.announce(sensor, data)
+	}
+
+	payload, err := json.Marshal(State{
+		Name:       sensor.Name,
+		MacAddress: sensor.MacAddress,
+		Reading:    data,
+	})
+	if err != nil {
+		p.log.Errorf("Error encoding reading of %q: %s", sensor, err)
+		return
+	}
+
+	p.enqueue(message{
+		topic:   Topic(p.cfg.Topic, sensor),
+		payload: payload,
+		retain:  p.cfg.Retain,
+		time:    data.Time,
+	})
+}
+
+// tooOld returns true if a reading should not be published anymore, because it is older than the maximum age.
+func (p *Publisher) tooOld(t, now time.Time) bool {
+	return p.cfg.MaxAge > 0 && !t.IsZero() && now.Sub(t) > p.cfg.MaxAge
+}
+
+// enqueue adds the message to the queue without blocking. It returns false if the queue is full.
+func (p *Publisher) enqueue(m message) bool {
+	select {
+	case p.queue <- m:
+		return true
+	default:
+		p.log.Warnf("Dropping message to %s, MQTT queue is full.", m.topic)
+		return false
+	}
+}
+
+// Start connects to the broker and starts publishing the queued readings. Connecting is retried in the
+// background if the broker is not reachable.
+func (p *Publisher) Start(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		p.client.Connect()
+		p.log.Debug("MQTT publisher ready.")
+		for {
+			select {
+			case <-ctx.Done():
+				p.log.Debug("Shutting down MQTT publisher.")
+				p.client.Disconnect(disconnectQuiesce)
+				return
+			case m := <-p.queue:
+				// Readings can get old while waiting for the connection to the broker.
+				if p.tooOld(m.time, time.Now()) {
+					p.log.Debugf("Skipping message to %s, the reading is older than %s.", m.topic, p.cfg.MaxAge)
+					continue
+				}
+
+				if err := p.publish(m); err != nil {
+					p.log.Errorf("Error publishing to %s: %s", m.topic, err)
+				}
+			}
+		}
+	}()
+}
+
+func (p *Publisher) publish(m message) error {
+	token := p.client.Publish(m.topic, byte(p.cfg.QoS), m.retain, m.payload)
+	if !token.WaitTimeout(publishTimeout) {
+		return errors.New("timeout")
+	}
+
+	return token.Error()
+}
@@ -0,0 +1,189 @@
+package notify
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+// States of a notification.
+const (
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+)
+
+// Alert is a condition of a sensor which needs attention.
+type Alert struct {
+	ID          string        `json:"id"`
+	Type        string        `json:"type"`
+	Description string        `json:"description"`
+	Sensor      config.Sensor `json:"sensor"`
+	Value       float64       `json:"value"`
+	Threshold   float64       `json:"threshold"`
+	Unit        string        `json:"unit"`
+	StartsAt    time.Time     `json:"startsAt"`
+	// EndsAt is zero while the alert is firing.
+	EndsAt         time.Time `json:"endsAt"`
+	Acknowledged   bool      `json:"acknowledged"`
+	AcknowledgedBy string    `json:"acknowledgedBy,omitempty"`
+	// Silenced is true while a silence suppresses the notifications of the alert.
+	Silenced bool `json:"silenced"`
+	// Escalation is the number of escalation steps which have been notified.
+	Escalation int `json:"escalation"`
+
+	// notified contains the names of the channels which have been notified about the alert.
+	notified map[string]bool
+}
+
+// rule checks one value of a sensor against a threshold.
+type rule struct {
+	Type        string
+	Description string
+	Unit        string
+	// Below is true if values below the threshold trigger the alert.
+	Below     bool
+	Value     func(o observation) *float64
+	Threshold func(s config.Sensor, cfg config.NotifyConfig) float64
+}
+
+// observation contains the values of a sensor checked by the rules.
+type observation struct {
+	Sensor  config.Sensor
+	Reading driver.Reading
+	Time    time.Time
+	// Depletion is the predicted time the battery is empty or zero if unknown.
+	Depletion time.Time
+	// WateringDue is the predicted time the moisture falls below the minimum or zero if unknown.
+	WateringDue time.Time
+	// Degradation contains the decline of the values attributed to the sensor by reason or nil if unknown.
+	Degradation map[string]float64
+}
+
+var rules = []rule{
+	{
+		Type:        "moisture_low",
+		Description: "soil moisture too low",
+		Unit:        "%",
+		Below:       true,
+		Value:       func(o observation) *float64 { return o.Reading.Moisture },
+		Threshold:   func(s config.Sensor, _ config.NotifyConfig) float64 { return float64(s.MinSoilMoist) },
+	},
+	{
+		Type:        "moisture_high",
+		Description: "soil moisture too high",
+		Unit:        "%",
+		Value:       func(o observation) *float64 { return o.Reading.Moisture },
+		Threshold:   func(s config.Sensor, _ config.NotifyConfig) float64 { return float64(s.MaxSoilMoist) },
+	},
+	{
+		Type:        "conductivity_low",
+		Description: "soil conductivity too low",
+		Unit:        "µS/cm",
+		Below:       true,
+		Value:       func(o observation) *float64 { return o.Reading.Conductivity },
+		Threshold:   func(s config.Sensor, _ config.NotifyConfig) float64 { return float64(s.MinSoilEc) },
+	},
+	{
+		Type:        "conductivity_high",
+		Description: "soil conductivity too high",
+		Unit:        "µS/cm",
+		Value:       func(o observation) *float64 { return o.Reading.Conductivity },
+		Threshold:   func(s config.Sensor, _ config.NotifyConfig) float64 { return float64(s.MaxSoilEc) },
+	},
+	{
+		Type:        "battery_low",
+		Description: "battery low",
+		Unit:        "%",
+		Below:       true,
+		Value:       func(o observation) *float64 { return o.Reading.Battery },
+		Threshold:   func(_ config.Sensor, cfg config.NotifyConfig) float64 { return cfg.BatteryThreshold },
+	},
+	{
+		Type:        "battery_depletion",
+		Description: "battery will be empty soon",
+		Unit:        "days",
+		Below:       true,
+		Value:       daysLeft,
+		Threshold:   func(_ config.Sensor, cfg config.NotifyConfig) float64 { return cfg.BatteryDepletionDays },
+	},
+	{
+		Type:        "watering_due",
+		Description: "plant needs to be watered soon",
+		Unit:        "hours",
+		Below:       true,
+		Value:       hoursUntilDry,
+		Threshold:   func(_ config.Sensor, cfg config.NotifyConfig) float64 { return cfg.WateringDueHours },
+	},
+	{
+		Type:        "conductivity_drift",
+		Description: "conductivity sensor might be corroded",
+		Unit:        "%/week",
+		Value:       func(o observation) *float64 { return degradation(o, "conductivity_drift") },
+		Threshold:   func(_ config.Sensor, cfg config.NotifyConfig) float64 { return cfg.DegradationPercent },
+	},
+	{
+		Type:        "light_dimming",
+		Description: "light sensor might need cleaning",
+		Unit:        "%/week",
+		Value:       func(o observation) *float64 { return degradation(o, "light_dimming") },
+		Threshold:   func(_ config.Sensor, cfg config.NotifyConfig) float64 { return cfg.DegradationPercent },
+	},
+}
+
+// daysLeft returns the number of days until the battery is predicted to be empty.
+func daysLeft(o observation) *float64 {
+	if o.Depletion.IsZero() {
+		return nil
+	}
+
+	days := math.Max(o.Depletion.Sub(o.Time).Hours()/24, 0)
+	return &days
+}
+
+// hoursUntilDry returns the number of hours until the moisture is predicted to fall below the minimum.
+func hoursUntilDry(o observation) *float64 {
+	if o.WateringDue.IsZero() {
+		return nil
+	}
+
+	hours := math.Max(o.WateringDue.Sub(o.Time).Hours(), 0)
+	return &hours
+}
+
+// degradation returns the decline of the values per week attributed to the sensor for the reason.
+func degradation(o observation, reason string) *float64 {
+	decline, ok := o.Degradation[reason]
+	if !ok {
+		return nil
+	}
+
+	return &decline
+}
+
+// check returns true if the reading violates the rule. ok is false if the rule can not be checked, because the
+// value is missing or no threshold is configured.
+func (r rule) check(o observation, cfg config.NotifyConfig) (value, threshold float64, violated, ok bool) {
+	v := r.Value(o)
+	threshold = r.Threshold(o.Sensor, cfg)
+	if v == nil || threshold <= 0 {
+		return 0, 0, false, false
+	}
+
+	if r.Below {
+		return *v, threshold, *v < threshold, true
+	}
+
+	return *v, threshold, *v > threshold, true
+}
+
+func alertID(macAddress, alertType string) string {
+	return SensorID(macAddress) + "-" + alertType
+}
+
+// SensorID returns the part of the alert IDs identifying the sensor.
+func SensorID(macAddress string) string {
+	return strings.ToLower(strings.ReplaceAll(macAddress, ":", ""))
+}
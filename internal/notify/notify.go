@@ -0,0 +1,358 @@
+// Package notify raises alerts when sensor values cross the thresholds of the plant and sends notifications
+// about them to the configured channels.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+	"github.com/xperimental/flowercare-exporter/internal/events"
+)
+
+const (
+	queueSize          = 100
+	sendTimeout        = 10 * time.Second
+	escalationInterval = 10 * time.Second
+)
+
+type channel struct {
+	config.NotifyChannel
+	template *template.Template
+}
+
+type delivery struct {
+	channel      *channel
+	notification Notification
+}
+
+// Manager keeps track of the active alerts and delivers the notifications.
+type Manager struct {
+	log      logrus.FieldLogger
+	cfg      config.NotifyConfig
+	client   *http.Client
+	channels map[string]*channel
+	events   *events.Log
+	queue    chan delivery
+
+	// BatteryDepletion returns the predicted depletion time of the battery of a sensor. The battery_depletion alert
+	// is only raised if it is set.
+	BatteryDepletion func(macAddress string) (time.Time, bool)
+	// WateringDue returns the time at which the moisture of a sensor is predicted to fall below the threshold. The
+	// watering_due alert is only raised if it is set.
+	WateringDue func(macAddress string, threshold float64) (time.Time, bool)
+	// Degradation returns the decline of the values of a sensor attributed to its degradation by reason. The
+	// conductivity_drift and light_dimming alerts are only raised if it is set.
+	Degradation func(macAddress string) (map[string]float64, bool)
+
+	lock     sync.Mutex
+	active   map[string]*Alert
+	silences map[string]Silence
+}
+
+// New creates a Manager sending notifications using the transport. Alerts are recorded in the event log.
+func New(log logrus.FieldLogger, cfg config.NotifyConfig, transport http.RoundTripper, eventLog *events.Log) (*Manager, error) {
+	defaultText := cfg.Template
+	if defaultText == "" {
+		defaultText = DefaultTemplate
+	}
+
+	m := &Manager{
+		log: log,
+		cfg: cfg,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   sendTimeout,
+		},
+		channels: map[string]*channel{},
+		events:   eventLog,
+		queue:    make(chan delivery, queueSize),
+		active:   map[string]*Alert{},
+		silences: map[string]Silence{},
+	}
+
+	for _, c := range cfg.Channels {
+		text := c.Template
+		if text == "" {
+			text = defaultText
+		}
+
+		t, err := parseTemplate(c.Name, text)
+		if err != nil {
+			return nil, fmt.Errorf("channel %q: can not parse template: %s", c.Name, err)
+		}
+
+		m.channels[c.Name] = &channel{
+			NotifyChannel: c,
+			template:      t,
+		}
+	}
+
+	return m, nil
+}
+
+// Observe checks a new reading of a sensor. It can be used as an updater.Listener.
+func (m *Manager) Observe(sensor config.Sensor, reading driver.Reading) {
+	now := time.Now()
+	o := observation{
+		Sensor:  sensor,
+		Reading: reading,
+		Time:    now,
+	}
+	if m.BatteryDepletion != nil {
+		if depletion, ok := m.BatteryDepletion(sensor.MacAddress); ok {
+			o.Depletion = depletion
+		}
+	}
+	if m.WateringDue != nil {
+		if due, ok := m.WateringDue(sensor.MacAddress, float64(sensor.MinSoilMoist)); ok {
+			o.WateringDue = due
+		}
+	}
+	if m.Degradation != nil {
+		if degradation, ok := m.Degradation(sensor.MacAddress); ok {
+			o.Degradation = degradation
+		}
+	}
+
+	for _, r := range rules {
+		value, threshold, violated, ok := r.check(o, m.cfg)
+		if !ok {
+			continue
+		}
+
+		id := alertID(sensor.MacAddress, r.Type)
+		m.lock.Lock()
+		alert, active := m.active[id]
+		switch {
+		case violated && !active:
+			alert = &Alert{
+				ID:          id,
+				Type:        r.Type,
+				Description: r.Description,
+				Sensor:      sensor,
+				Value:       value,
+				Threshold:   threshold,
+				Unit:        r.Unit,
+				StartsAt:    now,
+				notified:    map[string]bool{},
+			}
+			m.active[id] = alert
+			m.record(StateFiring, *alert)
+			m.escalate(alert, now)
+			m.lock.Unlock()
+		case !violated && active:
+			delete(m.active, id)
+			alert.Value = value
+			alert.EndsAt = now
+			m.record(StateResolved, *alert)
+			m.resolve(alert)
+			m.lock.Unlock()
+		case violated:
+			alert.Value = value
+			m.lock.Unlock()
+		default:
+			m.lock.Unlock()
+		}
+	}
+}
+
+// Alerts returns the currently active alerts, sorted by ID.
+func (m *Manager) Alerts() []Alert {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	now := time.Now()
+	result := make([]Alert, 0, len(m.active))
+	for _, a := range m.active {
+		alert := *a
+		alert.Silenced = m.silenced(a, now)
+		result = append(result, alert)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// Acknowledge marks an active alert as acknowledged, which stops further escalation.
+func (m *Manager) Acknowledge(id, by string) (Alert, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	alert, ok := m.active[id]
+	if !ok {
+		return Alert{}, ErrUnknownAlert
+	}
+
+	if !alert.Acknowledged {
+		alert.Acknowledged = true
+		alert.AcknowledgedBy = by
+		m.log.Infof("Alert %s acknowledged by %q.", alert.ID, by)
+		if m.events != nil {
+			m.events.Record(events.TypeAlert, alert.Sensor, fmt.Sprintf("%s acknowledged by %s", alert.Description, by))
+		}
+	}
+
+	return *alert, nil
+}
+
+// ErrUnknownAlert is returned when acknowledging an alert which is not active.
+var ErrUnknownAlert = errors.New("unknown alert")
+
+func (m *Manager) record(state string, alert Alert) {
+	m.log.Infof("Alert %s %s: %s", alert.ID, state, alert.Description)
+	if m.events != nil {
+		m.events.Record(events.TypeAlert, alert.Sensor, fmt.Sprintf("%s %s", alert.Description, state))
+	}
+}
+
+// escalate notifies the channels of all escalation steps which are due. Without an escalation policy all channels
+// are notified at once. Silenced alerts are escalated once the silence ends. Needs to be called with the lock held.
+func (m *Manager) escalate(alert *Alert, now time.Time) {
+	if m.silenced(alert, now) {
+		return
+	}
+
+	if len(m.cfg.Escalation) == 0 {
+		if alert.Escalation > 0 {
+			return
+		}
+
+		for name := range m.channels {
+			m.notifyChannel(name, StateFiring, alert)
+		}
+		alert.Escalation = 1
+		return
+	}
+
+	if alert.Acknowledged {
+		return
+	}
+
+	for alert.Escalation < len(m.cfg.Escalation) {
+		step := m.cfg.Escalation[alert.Escalation]
+		if now.Sub(alert.StartsAt) < step.After {
+			return
+		}
+
+		if alert.Escalation > 0 {
+			m.log.Infof("Escalating alert %s to %s.", alert.ID, strings.Join(step.Channels, ", "))
+		}
+		for _, name := range step.Channels {
+			m.notifyChannel(name, StateFiring, alert)
+		}
+		alert.Escalation++
+	}
+}
+
+// resolve notifies all channels which have been notified about the alert. Needs to be called with the lock held.
+func (m *Manager) resolve(alert *Alert) {
+	for name := range alert.notified {
+		m.notifyChannel(name, StateResolved, alert)
+	}
+}
+
+func (m *Manager) notifyChannel(name, state string, alert *Alert) {
+	c := m.channels[name]
+	if c.User != "" && !alert.Sensor.OwnedBy(c.User) {
+		return
+	}
+
+	if state == StateFiring {
+		if alert.notified[name] {
+			return
+		}
+		alert.notified[name] = true
+	}
+
+	m.enqueue(c, Notification{
+		State: state,
+		Alert: *alert,
+	})
+}
+
+func (m *Manager) escalateAll(now time.Time) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.pruneSilences(now)
+	for _, alert := range m.active {
+		m.escalate(alert, now)
+	}
+}
+
+func (m *Manager) enqueue(c *channel, n Notification) {
+	select {
+	case m.queue <- delivery{channel: c, notification: n}:
+	default:
+		m.log.Warnf("Notification queue full, dropping notification for %s to %q.", n.ID, c.Name)
+	}
+}
+
+// Start starts delivering the notifications.
+func (m *Manager) Start(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(escalationInterval)
+		defer ticker.Stop()
+
+		m.log.Debug("Notification sender ready.")
+		for {
+			select {
+			case <-ctx.Done():
+				m.log.Debug("Shutting down notification sender.")
+				return
+			case now := <-ticker.C:
+				m.escalateAll(now)
+			case d := <-m.queue:
+				if err := m.send(ctx, d); err != nil {
+					m.log.Errorf("Error sending notification for %s to %q: %s", d.notification.ID, d.channel.Name, err)
+				}
+			}
+		}
+	}()
+}
+
+func (m *Manager) send(ctx context.Context, d delivery) error {
+	body, err := render(d.channel.template, d.notification)
+	if err != nil {
+		return fmt.Errorf("can not render template: %s", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, d.channel.Method, d.channel.URL, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", d.channel.ContentType)
+	for k, v := range d.channel.Headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status: %s", res.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package notify
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/events"
+)
+
+// Silence suppresses the notifications of matching alerts until it ends.
+type Silence struct {
+	ID string `json:"id"`
+	// Sensor is the MAC address of the silenced sensor. All sensors are matched if it is empty.
+	Sensor string `json:"sensor,omitempty"`
+	// Type is the silenced alert type. All types are matched if it is empty.
+	Type      string    `json:"type,omitempty"`
+	StartsAt  time.Time `json:"startsAt"`
+	EndsAt    time.Time `json:"endsAt"`
+	CreatedBy string    `json:"createdBy"`
+	Comment   string    `json:"comment,omitempty"`
+}
+
+// ErrUnknownSilence is returned when removing a silence which does not exist.
+var ErrUnknownSilence = errors.New("unknown silence")
+
+// Matches returns true if the silence covers the alert at the provided time.
+func (s Silence) Matches(alert Alert, now time.Time) bool {
+	if now.Before(s.StartsAt) || !now.Before(s.EndsAt) {
+		return false
+	}
+
+	if s.Sensor != "" && !strings.EqualFold(s.Sensor, alert.Sensor.MacAddress) {
+		return false
+	}
+
+	return s.Type == "" || s.Type == alert.Type
+}
+
+// KnownType returns true if alerts of the type can be raised.
+func KnownType(alertType string) bool {
+	for _, r := range rules {
+		if r.Type == alertType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AddSilence adds a new silence. The ID and start time are set if they are empty.
+func (m *Manager) AddSilence(s Silence) (Silence, error) {
+	now := time.Now()
+	if s.StartsAt.IsZero() {
+		s.StartsAt = now
+	}
+
+	if !s.EndsAt.After(now) || !s.EndsAt.After(s.StartsAt) {
+		return Silence{}, errors.New("silence needs to end in the future")
+	}
+
+	if s.Type != "" && !KnownType(s.Type) {
+		return Silence{}, fmt.Errorf("unknown alert type: %s", s.Type)
+	}
+
+	if s.ID == "" {
+		id, err := newSilenceID()
+		if err != nil {
+			return Silence{}, err
+		}
+		s.ID = id
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.pruneSilences(now)
+	m.silences[s.ID] = s
+	m.log.Infof("Silence %s created by %q until %s: %s", s.ID, s.CreatedBy, s.EndsAt.Format(time.RFC3339), describeSilence(s))
+	m.recordSilence(fmt.Sprintf("silence %s created by %s until %s: %s", s.ID, s.CreatedBy, s.EndsAt.Format(time.RFC3339), describeSilence(s)))
+
+	return s, nil
+}
+
+// RemoveSilence ends a silence before its end time.
+func (m *Manager) RemoveSilence(id, by string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.pruneSilences(time.Now())
+	s, ok := m.silences[id]
+	if !ok {
+		return ErrUnknownSilence
+	}
+
+	delete(m.silences, id)
+	m.log.Infof("Silence %s removed by %q.", s.ID, by)
+	m.recordSilence(fmt.Sprintf("silence %s removed by %s: %s", s.ID, by, describeSilence(s)))
+
+	return nil
+}
+
+// Silences returns the silences which have not ended yet, sorted by their end time.
+func (m *Manager) Silences() []Silence {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.pruneSilences(time.Now())
+	result := make([]Silence, 0, len(m.silences))
+	for _, s := range m.silences {
+		result = append(result, s)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].EndsAt.Equal(result[j].EndsAt) {
+			return result[i].ID < result[j].ID
+		}
+		return result[i].EndsAt.Before(result[j].EndsAt)
+	})
+	return result
+}
+
+// silenced returns true if a silence covers the alert. Needs to be called with the lock held.
+func (m *Manager) silenced(alert *Alert, now time.Time) bool {
+	for _, s := range m.silences {
+		if s.Matches(*alert, now) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pruneSilences removes silences which have ended. Needs to be called with the lock held.
+func (m *Manager) pruneSilences(now time.Time) {
+	for id, s := range m.silences {
+		if !now.Before(s.EndsAt) {
+			delete(m.silences, id)
+		}
+	}
+}
+
+func (m *Manager) recordSilence(message string) {
+	if m.events == nil {
+		return
+	}
+
+	m.events.Record(events.TypeAlert, config.Sensor{}, message)
+}
+
+func describeSilence(s Silence) string {
+	sensor := s.Sensor
+	if sensor == "" {
+		sensor = "all sensors"
+	}
+
+	alertType := s.Type
+	if alertType == "" {
+		alertType = "all alerts"
+	}
+
+	return sensor + ", " + alertType
+}
+
+func newSilenceID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("can not create silence ID: %s", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
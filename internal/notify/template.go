@@ -0,0 +1,49 @@
+package notify
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"text/template"
+)
+
+// DefaultTemplate is used for channels without their own template.
+const DefaultTemplate = `{{ if eq .State "firing" -}}
+{{ .Sensor.Name }}: {{ .Description }} ({{ round .Value 1 }} {{ .Unit }}, threshold {{ round .Threshold 1 }} {{ .Unit }})
+{{- else -}}
+{{ .Sensor.Name }}: {{ .Description }} resolved ({{ round .Value 1 }} {{ .Unit }})
+{{- end }}`
+
+// Notification contains the data available in the templates.
+type Notification struct {
+	// State is either StateFiring or StateResolved.
+	State string
+	Alert
+}
+
+var templateFuncs = template.FuncMap{
+	// json encodes a value as JSON, which can be used to build JSON payloads for chat platforms.
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"round": func(v float64, digits int) float64 {
+		factor := math.Pow(10, float64(digits))
+		return math.Round(v*factor) / factor
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Parse(text)
+}
+
+func render(t *template.Template, n Notification) (string, error) {
+	var sb strings.Builder
+	if err := t.Execute(&sb, n); err != nil {
+		return "", err
+	}
+
+	return sb.String(), nil
+}
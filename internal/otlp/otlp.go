@@ -0,0 +1,308 @@
+// Package otlp exports the readings of the sensors as metrics to an OpenTelemetry collector using OTLP over HTTP or
+// gRPC, in parallel to the Prometheus endpoint.
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/anonymize"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+	"github.com/xperimental/flowercare-exporter/internal/egress"
+	"golang.org/x/net/http2"
+)
+
+const (
+	httpPath = "/v1/metrics"
+	grpcPath = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+	// maxResponseSize limits the size of responses read from the collector.
+	maxResponseSize = 64 << 10
+)
+
+// metric describes how a value of the readings is exported.
+type metric struct {
+	Name        string
+	Description string
+	Unit        string
+}
+
+// metrics contains the exported values by the name used in driver.FieldNames. The units follow the Unified Code for
+// Units of Measure used by OpenTelemetry.
+var metrics = map[string]metric{
+	"battery":                  {Name: "flowercare.battery", Description: "Battery level.", Unit: "%"},
+	"temperature":              {Name: "flowercare.temperature", Description: "Temperature.", Unit: "Cel"},
+	"moisture":                 {Name: "flowercare.moisture", Description: "Soil moisture.", Unit: "%"},
+	"light":                    {Name: "flowercare.light", Description: "Ambient light level.", Unit: "lx"},
+	"conductivity":             {Name: "flowercare.conductivity", Description: "Soil conductivity.", Unit: "uS/cm"},
+	"humidity":                 {Name: "flowercare.humidity", Description: "Relative air humidity.", Unit: "%"},
+	"battery_voltage":          {Name: "flowercare.battery.voltage", Description: "Battery voltage.", Unit: "V"},
+	"conductivity_compensated": {Name: "flowercare.conductivity.compensated", Description: "Soil conductivity compensated to the reference temperature.", Unit: "uS/cm"},
+	"rssi":                     {Name: "flowercare.rssi", Description: "Signal strength of the sensor.", Unit: "dBm"},
+}
+
+// Exporter sends the latest readings of all sensors to the collector in a fixed interval.
+type Exporter struct {
+	log    logrus.FieldLogger
+	cfg    config.OTLPConfig
+	client *http.Client
+	url    string
+
+	// Version is sent as version of the instrumentation scope.
+	Version string
+	Sensors func() []config.Sensor
+	Source  func(macAddress string) (driver.Reading, error)
+	// StaleDuration is the age after which readings are not exported anymore.
+	StaleDuration time.Duration
+	// Anonymizer replaces the identifying attributes of the sensors with pseudonyms if set.
+	Anonymizer *anonymize.Anonymizer
+}
+
+// New creates an Exporter. Connections to the collector need to be allowed by the egress policy.
+func New(log logrus.FieldLogger, cfg config.OTLPConfig, policy egress.Policy) *Exporter {
+	var base http.RoundTripper
+	target := cfg.Endpoint + httpPath
+	if cfg.Protocol == config.OTLPProtocolGRPC {
+		base = grpcTransport(cfg.Endpoint)
+		target = cfg.Endpoint + grpcPath
+	}
+
+	return &Exporter{
+		log: log,
+		cfg: cfg,
+		client: &http.Client{
+			Transport: policy.Transport(base),
+			Timeout:   cfg.Timeout,
+		},
+		url: target,
+	}
+}
+
+// grpcTransport returns a transport using HTTP/2, which gRPC needs. Endpoints using "http" use HTTP/2 without TLS.
+func grpcTransport(endpoint string) http.RoundTripper {
+	t := &http2.Transport{}
+	if u, err := url.Parse(endpoint); err == nil && u.Scheme == "http" {
+		t.AllowHTTP = true
+		t.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		}
+	}
+
+	return t
+}
+
+// Start starts exporting the readings.
+func (e *Exporter) Start(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(e.cfg.Interval)
+		defer ticker.Stop()
+
+		e.log.Debug("OTLP exporter ready.")
+		for {
+			select {
+			case <-ctx.Done():
+				e.log.Debug("Shutting down OTLP exporter.")
+				return
+			case <-ticker.C:
+			}
+
+			if err := e.export(ctx, time.Now()); err != nil && ctx.Err() == nil {
+				e.log.Errorf("Error exporting metrics to OpenTelemetry collector: %s", err)
+			}
+		}
+	}()
+}
+
+func (e *Exporter) export(ctx context.Context, now time.Time) error {
+	resources := e.resources(now)
+	if len(resources) == 0 {
+		return nil
+	}
+
+	body := encodeRequest(scope{
+		Name:    "github.com/xperimental/flowercare-exporter",
+		Version: e.Version,
+	}, resources)
+
+	var (
+		response []byte
+		err      error
+	)
+	if e.cfg.Protocol == config.OTLPProtocolGRPC {
+		response, err = e.sendGRPC(ctx, body)
+	} else {
+		response, err = e.sendHTTP(ctx, body)
+	}
+	if err != nil {
+		return err
+	}
+
+	partial, err := decodeResponse(response)
+	if err != nil {
+		return fmt.Errorf("can not decode response: %s", err)
+	}
+
+	if partial.RejectedDataPoints > 0 || partial.ErrorMessage != "" {
+		e.log.Warnf("OpenTelemetry collector rejected %d data points: %s", partial.RejectedDataPoints, partial.ErrorMessage)
+	}
+
+	return nil
+}
+
+// resources returns the current readings, one resource per sensor. Stale readings are left out.
+func (e *Exporter) resources(now time.Time) []resourceMetrics {
+	hostname, _ := os.Hostname()
+
+	var result []resourceMetrics
+	for _, s := range e.Sensors() {
+		data, err := e.Source(s.MacAddress)
+		if err != nil || now.Sub(data.Time) >= e.StaleDuration {
+			continue
+		}
+
+		driverName := s.Driver
+		if driverName == "" {
+			driverName = driver.Default
+		}
+
+		r := resourceMetrics{
+			Attributes: []attribute{
+				{Key: "service.name", Value: "flowercare-exporter"},
+				{Key: "host.name", Value: hostname},
+				{Key: "flowercare.sensor.mac_address", Value: e.Anonymizer.MAC(s.MacAddress)},
+				{Key: "flowercare.sensor.name", Value: e.Anonymizer.Name(s.Name)},
+				{Key: "flowercare.sensor.driver", Value: driverName},
+			},
+		}
+		if s.Group != "" {
+			r.Attributes = append(r.Attributes, attribute{Key: "flowercare.sensor.group", Value: s.Group})
+		}
+
+		for _, name := range driver.FieldNames {
+			v := *data.Field(name)
+			m, ok := metrics[name]
+			if v == nil || !ok {
+				continue
+			}
+
+			r.Gauges = append(r.Gauges, gauge{
+				Name:         m.Name,
+				Description:  m.Description,
+				Unit:         m.Unit,
+				Value:        *v,
+				TimeUnixNano: uint64(data.Time.UnixNano()),
+			})
+		}
+
+		if len(r.Gauges) > 0 {
+			result = append(result, r)
+		}
+	}
+
+	return result
+}
+
+func (e *Exporter) newRequest(ctx context.Context, body []byte, contentType string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("can not create request: %s", err)
+	}
+
+	for k, v := range e.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", contentType)
+	return req, nil
+}
+
+func (e *Exporter) sendHTTP(ctx context.Context, body []byte) ([]byte, error) {
+	req, err := e.newRequest(ctx, body, "application/x-protobuf")
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	response, err := io.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+
+	return response, nil
+}
+
+// sendGRPC sends the request as unary gRPC call. The message is prefixed with the uncompressed flag and its length.
+func (e *Exporter) sendGRPC(ctx context.Context, body []byte) ([]byte, error) {
+	framed := make([]byte, 5, 5+len(body))
+	binary.BigEndian.PutUint32(framed[1:], uint32(len(body)))
+	framed = append(framed, body...)
+
+	req, err := e.newRequest(ctx, framed, "application/grpc")
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("TE", "trailers")
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+
+	response, err := io.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	// Errors are usually sent in the trailers, but responses without a message can send them in the headers.
+	status, message := res.Trailer.Get("Grpc-Status"), res.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, message = res.Header.Get("Grpc-Status"), res.Header.Get("Grpc-Message")
+	}
+	if status == "" {
+		return nil, errors.New("response without gRPC status")
+	}
+
+	if code, err := strconv.Atoi(status); err != nil || code != 0 {
+		if unescaped, err := url.PathUnescape(message); err == nil {
+			message = unescaped
+		}
+		return nil, fmt.Errorf("gRPC status %s: %s", status, message)
+	}
+
+	if len(response) < 5 {
+		return nil, nil
+	}
+
+	return response[5:], nil
+}
@@ -0,0 +1,179 @@
+package otlp
+
+import (
+	"errors"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// attribute is a string attribute of a resource.
+type attribute struct {
+	Key   string
+	Value string
+}
+
+// gauge contains a single data point of a gauge.
+type gauge struct {
+	Name        string
+	Description string
+	Unit        string
+	Value       float64
+	// TimeUnixNano is the time of the reading the value belongs to.
+	TimeUnixNano uint64
+}
+
+// resourceMetrics contains the gauges of a sensor, which is described by the attributes of the resource.
+type resourceMetrics struct {
+	Attributes []attribute
+	Gauges     []gauge
+}
+
+// scope describes the exporter as source of the metrics.
+type scope struct {
+	Name    string
+	Version string
+}
+
+// encodeRequest encodes an ExportMetricsServiceRequest of the OTLP protocol (opentelemetry.proto.collector.metrics.v1)
+// containing one ResourceMetrics per sensor.
+func encodeRequest(sc scope, resources []resourceMetrics) []byte {
+	var b []byte
+	for _, r := range resources {
+		b = appendMessage(b, 1, encodeResourceMetrics(sc, r))
+	}
+
+	return b
+}
+
+func encodeResourceMetrics(sc scope, r resourceMetrics) []byte {
+	var resource []byte
+	for _, a := range r.Attributes {
+		resource = appendMessage(resource, 1, encodeKeyValue(a))
+	}
+
+	var scopeMetrics []byte
+	scopeMetrics = appendMessage(scopeMetrics, 1, encodeScope(sc))
+	for _, g := range r.Gauges {
+		scopeMetrics = appendMessage(scopeMetrics, 2, encodeGauge(g))
+	}
+
+	var b []byte
+	b = appendMessage(b, 1, resource)
+	b = appendMessage(b, 2, scopeMetrics)
+	return b
+}
+
+func encodeScope(sc scope) []byte {
+	var b []byte
+	b = appendString(b, 1, sc.Name)
+	b = appendString(b, 2, sc.Version)
+	return b
+}
+
+func encodeKeyValue(a attribute) []byte {
+	var value []byte
+	value = appendString(value, 1, a.Value)
+
+	var b []byte
+	b = appendString(b, 1, a.Key)
+	b = appendMessage(b, 2, value)
+	return b
+}
+
+func encodeGauge(g gauge) []byte {
+	var point []byte
+	point = protowire.AppendTag(point, 3, protowire.Fixed64Type)
+	point = protowire.AppendFixed64(point, g.TimeUnixNano)
+	point = protowire.AppendTag(point, 4, protowire.Fixed64Type)
+	point = protowire.AppendFixed64(point, math.Float64bits(g.Value))
+
+	var data []byte
+	data = appendMessage(data, 1, point)
+
+	var b []byte
+	b = appendString(b, 1, g.Name)
+	b = appendString(b, 2, g.Description)
+	b = appendString(b, 3, g.Unit)
+	b = appendMessage(b, 5, data)
+	return b
+}
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// partialSuccess contains the data points rejected by the receiver even though the request succeeded.
+type partialSuccess struct {
+	RejectedDataPoints int64
+	ErrorMessage       string
+}
+
+// decodeResponse decodes the partial success of an ExportMetricsServiceResponse.
+func decodeResponse(b []byte) (partialSuccess, error) {
+	var result partialSuccess
+	err := forEachField(b, func(num protowire.Number, typ protowire.Type, value []byte, varint uint64) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+
+		return forEachField(value, func(num protowire.Number, typ protowire.Type, value []byte, varint uint64) error {
+			switch {
+			case num == 1 && typ == protowire.VarintType:
+				result.RejectedDataPoints = int64(varint)
+			case num == 2 && typ == protowire.BytesType:
+				result.ErrorMessage = string(value)
+			}
+			return nil
+		})
+	})
+
+	return result, err
+}
+
+var errInvalidMessage = errors.New("invalid protobuf message")
+
+// forEachField calls fn for every field of a message. Length-delimited fields are passed as value, varints as
+// varint, other types are skipped.
+func forEachField(b []byte, fn func(num protowire.Number, typ protowire.Type, value []byte, varint uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return errInvalidMessage
+		}
+		b = b[n:]
+
+		var (
+			value  []byte
+			varint uint64
+		)
+		switch typ {
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			varint, n = protowire.ConsumeVarint(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return errInvalidMessage
+		}
+		b = b[n:]
+
+		if err := fn(num, typ, value, varint); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+// Package outputs runs the outputs sending the readings to other systems, like MQTT or InfluxDB, so that they can be
+// replaced using a new configuration while the exporter is running, without interrupting the collection.
+package outputs
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+	"github.com/xperimental/flowercare-exporter/internal/updater"
+)
+
+// Output is an output created for a configuration.
+type Output struct {
+	// Listener receives every reading. It is nil for outputs getting the current readings themselves.
+	Listener updater.Listener
+	Start    func(ctx context.Context, wg *sync.WaitGroup)
+}
+
+type running struct {
+	Config   interface{}
+	Listener updater.Listener
+	Cancel   context.CancelFunc
+	Done     *sync.WaitGroup
+}
+
+// Set contains the running outputs by name.
+type Set struct {
+	log logrus.FieldLogger
+
+	lock    sync.RWMutex
+	ctx     context.Context
+	outputs map[string]*running
+}
+
+// New creates an empty Set.
+func New(log logrus.FieldLogger) *Set {
+	return &Set{
+		log:     log,
+		ctx:     context.Background(),
+		outputs: map[string]*running{},
+	}
+}
+
+// Start sets the context the outputs are started with. All outputs are stopped when it is done. It needs to be
+// called before the first output is started.
+func (s *Set) Start(ctx context.Context, wg *sync.WaitGroup) {
+	s.lock.Lock()
+	s.ctx = ctx
+	s.lock.Unlock()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		<-ctx.Done()
+
+		s.lock.Lock()
+		current := s.outputs
+		s.outputs = map[string]*running{}
+		s.lock.Unlock()
+
+		// The outputs stop on their own, as their contexts are derived from ctx.
+		for _, r := range current {
+			r.Done.Wait()
+		}
+	}()
+}
+
+// Replace starts the output using cfg, unless it is already running with the same configuration. The output running
+// with the previous configuration is stopped first, after its replacement has been created successfully. A nil create
+// stops the output. It returns true if the output has been changed. Replace must not be called concurrently.
+func (s *Set) Replace(name string, cfg interface{}, create func() (Output, error)) (bool, error) {
+	s.lock.RLock()
+	previous, ok := s.outputs[name]
+	s.lock.RUnlock()
+
+	switch {
+	case create == nil && !ok:
+		return false, nil
+	case ok && create != nil && reflect.DeepEqual(previous.Config, cfg):
+		return false, nil
+	}
+
+	var (
+		output Output
+		next   *running
+		ctx    context.Context
+	)
+	if create != nil {
+		var err error
+		output, err = create()
+		if err != nil {
+			return false, err
+		}
+
+		next = &running{
+			Config:   cfg,
+			Listener: output.Listener,
+			Done:     &sync.WaitGroup{},
+		}
+	}
+
+	s.lock.Lock()
+	if next == nil {
+		delete(s.outputs, name)
+	} else {
+		ctx, next.Cancel = context.WithCancel(s.ctx)
+		s.outputs[name] = next
+	}
+	s.lock.Unlock()
+
+	// Stopping can take a while, as outputs try to send their remaining readings. New readings are queued by the
+	// replacement meanwhile. Both are not running at the same time, as brokers can reject two connections using the
+	// same client ID.
+	if ok {
+		s.log.Debugf("Stopping output %s.", name)
+		previous.Cancel()
+		previous.Done.Wait()
+	}
+
+	if next != nil {
+		output.Start(ctx, next.Done)
+	}
+
+	return true, nil
+}
+
+// Observe passes a reading to all running outputs. It can be used as an updater.Listener.
+func (s *Set) Observe(sensor config.Sensor, data driver.Reading) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, r := range s.outputs {
+		if r.Listener != nil {
+			r.Listener(sensor, data)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// Package photoperiod counts the hours per day during which the plants receive light.
+package photoperiod
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+// maxGap is the longest time between two readings which is still counted. Longer gaps, for example while the
+// sensor is out of range, are left out instead of being assumed to have the light level of the earlier reading.
+const maxGap = time.Hour
+
+// Day contains the photoperiod of a sensor.
+type Day struct {
+	// Today contains the time with light since midnight.
+	Today time.Duration
+	// Yesterday contains the time with light of the previous day. It is only valid if YesterdayComplete is set.
+	Yesterday time.Duration
+	// YesterdayComplete is set if the sensor has been observed from the start to the end of the previous day.
+	YesterdayComplete bool
+}
+
+type state struct {
+	// Since is the time of the first reading.
+	Since time.Time
+	Last  time.Time
+	Light bool
+	// Day is the midnight of the day Today belongs to.
+	Day       time.Time
+	Today     time.Duration
+	Yesterday time.Duration
+	// YesterdayKnown is set if Yesterday belongs to the day before Day.
+	YesterdayKnown bool
+}
+
+// Tracker sums up the time during which the light level of every sensor is above a threshold. The light level
+// of a reading is assumed to last until the next reading.
+type Tracker struct {
+	threshold float64
+	location  *time.Location
+
+	lock   sync.Mutex
+	states map[string]*state
+}
+
+// New creates a Tracker counting light levels of at least threshold lux. Days start at midnight in the location.
+func New(threshold float64, location *time.Location) *Tracker {
+	return &Tracker{
+		threshold: threshold,
+		location:  location,
+		states:    map[string]*state{},
+	}
+}
+
+// Observe records the light level of a reading. It can be used as an updater.Listener.
+func (t *Tracker) Observe(sensor config.Sensor, reading driver.Reading) {
+	if reading.Light == nil {
+		return
+	}
+
+	now := reading.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	key := strings.ToUpper(sensor.MacAddress)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	s, ok := t.states[key]
+	if !ok {
+		s = &state{
+			Since: now,
+			Day:   t.midnight(now),
+		}
+		t.states[key] = s
+	} else if !now.After(s.Last) {
+		return
+	}
+
+	if ok && s.Light && now.Sub(s.Last) <= maxGap {
+		t.add(s, s.Last, now)
+	}
+	t.rollover(s, t.midnight(now))
+
+	s.Last = now
+	s.Light = *reading.Light >= t.threshold
+}
+
+// Photoperiod returns the time with light of the sensor on the current and the previous day. It returns false
+// if the sensor has not reported a light level yet.
+func (t *Tracker) Photoperiod(macAddress string, now time.Time) (Day, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	current, ok := t.states[strings.ToUpper(macAddress)]
+	if !ok {
+		return Day{}, false
+	}
+
+	s := *current
+	t.rollover(&s, t.midnight(now))
+
+	yesterday := s.Day.AddDate(0, 0, -1)
+	return Day{
+		Today:             s.Today,
+		Yesterday:         s.Yesterday,
+		YesterdayComplete: s.YesterdayKnown && !s.Since.After(yesterday) && !s.Last.Before(s.Day.Add(-maxGap)),
+	}, true
+}
+
+// add counts the interval, splitting it at midnight.
+func (t *Tracker) add(s *state, start, end time.Time) {
+	for start.Before(end) {
+		day := t.midnight(start)
+		next := day.AddDate(0, 0, 1)
+		if next.After(end) {
+			next = end
+		}
+
+		t.rollover(s, day)
+		s.Today += next.Sub(start)
+		start = next
+	}
+}
+
+// rollover starts a new day if day is after the current day of the state.
+func (t *Tracker) rollover(s *state, day time.Time) {
+	if !day.After(s.Day) {
+		return
+	}
+
+	s.YesterdayKnown = s.Day.AddDate(0, 0, 1).Equal(day)
+	s.Yesterday = s.Today
+	if !s.YesterdayKnown {
+		s.Yesterday = 0
+	}
+	s.Day = day
+	s.Today = 0
+}
+
+func (t *Tracker) midnight(now time.Time) time.Time {
+	year, month, day := now.In(t.location).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.location)
+}
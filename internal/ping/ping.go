@@ -0,0 +1,106 @@
+// Package ping checks on startup which of the configured sensors are in range, by listening for their advertisements.
+// A sensor which is never heard usually has a mistyped MAC address or is too far away from the adapter.
+package ping
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ble/ble"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/xperimental/flowercare-exporter/internal/anonymize"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+)
+
+// Result contains the outcome of a ping for every sensor.
+type Result struct {
+	Sensors []config.Sensor
+	// Seen contains the strongest signal strength received from every sensor which has been heard, by upper-case MAC
+	// address.
+	Seen map[string]int
+}
+
+// Run scans for the advertisements of the sensors until all of them have been heard or the duration has passed.
+func Run(ctx context.Context, scan func(ctx context.Context, handler ble.AdvHandler) error, sensors []config.Sensor, duration time.Duration) (Result, error) {
+	result := Result{
+		Sensors: sensors,
+		Seen:    map[string]int{},
+	}
+
+	wanted := map[string]bool{}
+	for _, s := range sensors {
+		wanted[strings.ToUpper(s.MacAddress)] = true
+	}
+	if len(wanted) == 0 {
+		return result, nil
+	}
+
+	scanCtx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	var lock sync.Mutex
+	err := scan(scanCtx, func(a ble.Advertisement) {
+		macAddress := strings.ToUpper(a.Addr().String())
+		if !wanted[macAddress] {
+			return
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		if rssi, ok := result.Seen[macAddress]; !ok || a.RSSI() > rssi {
+			result.Seen[macAddress] = a.RSSI()
+		}
+		if len(result.Seen) == len(wanted) {
+			cancel()
+		}
+	})
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled) {
+		return result, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// Missing returns the sensors which have not been heard.
+func (r Result) Missing() []config.Sensor {
+	var result []config.Sensor
+	for _, s := range r.Sensors {
+		if _, ok := r.Seen[strings.ToUpper(s.MacAddress)]; !ok {
+			result = append(result, s)
+		}
+	}
+
+	return result
+}
+
+// Metric returns a metric telling for every sensor whether it has been heard during the ping.
+func (r Result) Metric(anonymizer *anonymize.Anonymizer) prometheus.Collector {
+	seen := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "flowercare_startup_ping_seen",
+		Help: "Contains 1 if the sensor has been heard during the ping on startup, 0 otherwise.",
+	}, []string{"macaddress", "name"})
+
+	for _, s := range r.Sensors {
+		value := 0.0
+		if _, ok := r.Seen[strings.ToUpper(s.MacAddress)]; ok {
+			value = 1
+		}
+
+		s = anonymizer.Sensor(s)
+		seen.WithLabelValues(s.MacAddress, s.Name).Set(value)
+	}
+
+	return seen
+}
@@ -0,0 +1,88 @@
+// Package pipeline builds the chain of steps processing every reading before it is stored and passed on to the
+// outputs of the exporter.
+//
+// The steps are taken from the registry of pkg/pipeline, to which this package adds the built-in steps. Custom
+// builds of the exporter can register their own steps there.
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+	pipelineapi "github.com/xperimental/flowercare-exporter/pkg/pipeline"
+)
+
+// Pipeline applies the configured steps to readings.
+type Pipeline struct {
+	names       []string
+	middlewares []pipelineapi.Middleware
+}
+
+// New creates a pipeline containing the configured steps in their order.
+func New(log logrus.FieldLogger, steps []config.PipelineStep) (*Pipeline, error) {
+	p := &Pipeline{}
+	for i, s := range steps {
+		step, err := pipelineapi.Get(s.Name)
+		if err != nil {
+			return nil, fmt.Errorf("step %d: %s", i, err)
+		}
+
+		m, err := step.New(log.WithField("step", s.Name), s.Options)
+		if err != nil {
+			return nil, fmt.Errorf("step %d (%s): %s", i, s.Name, err)
+		}
+
+		p.names = append(p.names, s.Name)
+		p.middlewares = append(p.middlewares, m)
+	}
+
+	return p, nil
+}
+
+// String returns the names of the steps in their order.
+func (p *Pipeline) String() string {
+	return strings.Join(p.names, " -> ")
+}
+
+// Then returns a handler passing every reading through all steps before calling the final handler. The final
+// handler receives the configuration of the sensor the reading was passed in with.
+func (p *Pipeline) Then(final func(config.Sensor, driver.Reading)) func(config.Sensor, driver.Reading) {
+	return func(sensor config.Sensor, reading driver.Reading) {
+		var h pipelineapi.Handler = func(_ pipelineapi.Sensor, r driver.Reading) {
+			final(sensor, r)
+		}
+		for i := len(p.middlewares) - 1; i >= 0; i-- {
+			h = p.middlewares[i](h)
+		}
+
+		h(stepSensor(sensor), reading)
+	}
+}
+
+// Process passes a single reading through all steps. It returns false if a step has dropped the reading.
+// If a step passes on more than one reading, the last one is returned.
+func (p *Pipeline) Process(sensor config.Sensor, reading driver.Reading) (driver.Reading, bool) {
+	var (
+		result driver.Reading
+		ok     bool
+	)
+	p.Then(func(_ config.Sensor, r driver.Reading) {
+		result = r
+		ok = true
+	})(sensor, reading)
+
+	return result, ok
+}
+
+// stepSensor returns the description of the sensor passed to the steps.
+func stepSensor(sensor config.Sensor) pipelineapi.Sensor {
+	return pipelineapi.Sensor{
+		MacAddress: sensor.MacAddress,
+		Name:       sensor.Name,
+		Driver:     sensor.Driver,
+		Quirks:     pipelineapi.Quirks(sensor.Quirks),
+	}
+}
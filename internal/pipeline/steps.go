@@ -0,0 +1,266 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+	"github.com/xperimental/flowercare-exporter/internal/quirks"
+	pipelineapi "github.com/xperimental/flowercare-exporter/pkg/pipeline"
+)
+
+// defaultRanges contains the values which can be measured by the supported devices. Values outside of them
+// are caused by transmission errors or broken sensors.
+var defaultRanges = map[string][2]float64{
+	"battery":         {0, 100},
+	"temperature":     {-40, 85},
+	"moisture":        {0, 100},
+	"light":           {0, 200000},
+	"conductivity":    {0, 20000},
+	"humidity":        {0, 100},
+	"battery_voltage": {0, 5},
+	// The compensated conductivity uses the same range as the conductivity it is calculated from.
+	"conductivity_compensated": {0, 20000},
+	"rssi":                     {-127, 20},
+}
+
+func init() {
+	pipelineapi.Register(pipelineapi.Step{
+		Name:        "validate",
+		Description: "Removes values outside of the range the devices can measure.",
+		New:         newValidate,
+	})
+	pipelineapi.Register(pipelineapi.Step{
+		Name:        "calibrate",
+		Description: "Applies the built-in quirks and the quirks of the sensor configuration.",
+		New:         newCalibrate,
+	})
+	pipelineapi.Register(pipelineapi.Step{
+		Name:        "smooth",
+		Description: "Smooths the values using an exponential moving average.",
+		New:         newSmooth,
+	})
+	pipelineapi.Register(pipelineapi.Step{
+		Name:        "derive",
+		Description: "Calculates the battery level from the battery voltage for devices which do not report it.",
+		New:         newDerive,
+	})
+	pipelineapi.Register(pipelineapi.Step{
+		Name:        "compensate",
+		Description: "Calculates the soil conductivity at a reference temperature from the measured conductivity and temperature.",
+		New:         newCompensate,
+	})
+}
+
+func parseOptions(options json.RawMessage, target interface{}) error {
+	if len(options) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(options, target); err != nil {
+		return fmt.Errorf("can not parse options: %s", err)
+	}
+
+	return nil
+}
+
+func checkNames(names []string) error {
+	for _, name := range names {
+		var r driver.Reading
+		if r.Field(name) == nil {
+			return fmt.Errorf("unknown value: %s", name)
+		}
+	}
+
+	return nil
+}
+
+type validateOptions struct {
+	// Ranges overrides the default range of values.
+	Ranges map[string][2]float64 `json:"ranges"`
+}
+
+func newValidate(log logrus.FieldLogger, options json.RawMessage) (pipelineapi.Middleware, error) {
+	var opts validateOptions
+	if err := parseOptions(options, &opts); err != nil {
+		return nil, err
+	}
+
+	ranges := map[string][2]float64{}
+	for name, r := range defaultRanges {
+		ranges[name] = r
+	}
+	for name, r := range opts.Ranges {
+		if err := checkNames([]string{name}); err != nil {
+			return nil, err
+		}
+
+		if r[0] > r[1] {
+			return nil, fmt.Errorf("minimum of %s is larger than maximum: %v > %v", name, r[0], r[1])
+		}
+		ranges[name] = r
+	}
+
+	return func(next pipelineapi.Handler) pipelineapi.Handler {
+		return func(sensor pipelineapi.Sensor, reading driver.Reading) {
+			for name, r := range ranges {
+				field := reading.Field(name)
+				if *field == nil {
+					continue
+				}
+
+				if v := **field; math.IsNaN(v) || v < r[0] || v > r[1] {
+					log.Debugf("Removing %s of %q outside of range: %v", name, sensor, v)
+					*field = nil
+				}
+			}
+
+			next(sensor, reading)
+		}
+	}, nil
+}
+
+func newCalibrate(_ logrus.FieldLogger, options json.RawMessage) (pipelineapi.Middleware, error) {
+	if len(options) != 0 {
+		return nil, errors.New("step has no options")
+	}
+
+	return func(next pipelineapi.Handler) pipelineapi.Handler {
+		return func(sensor pipelineapi.Sensor, reading driver.Reading) {
+			next(sensor, quirks.Apply(sensor, reading))
+		}
+	}, nil
+}
+
+type smoothOptions struct {
+	// Alpha is the weight of a new value, between zero (exclusive) and one.
+	Alpha float64 `json:"alpha"`
+	// Values contains the names of the smoothed values. All values are smoothed if it is empty.
+	Values []string `json:"values"`
+}
+
+func newSmooth(_ logrus.FieldLogger, options json.RawMessage) (pipelineapi.Middleware, error) {
+	opts := smoothOptions{
+		Alpha: 0.3,
+	}
+	if err := parseOptions(options, &opts); err != nil {
+		return nil, err
+	}
+
+	if opts.Alpha <= 0 || opts.Alpha > 1 {
+		return nil, fmt.Errorf("alpha needs to be larger than zero and at most one: %v", opts.Alpha)
+	}
+
+	if len(opts.Values) == 0 {
+		opts.Values = driver.FieldNames
+	}
+	if err := checkNames(opts.Values); err != nil {
+		return nil, err
+	}
+
+	var lock sync.Mutex
+	averages := map[string]map[string]float64{}
+
+	return func(next pipelineapi.Handler) pipelineapi.Handler {
+		return func(sensor pipelineapi.Sensor, reading driver.Reading) {
+			key := strings.ToUpper(sensor.MacAddress)
+
+			lock.Lock()
+			sensorAverages, ok := averages[key]
+			if !ok {
+				sensorAverages = map[string]float64{}
+				averages[key] = sensorAverages
+			}
+
+			for _, name := range opts.Values {
+				field := reading.Field(name)
+				if *field == nil {
+					continue
+				}
+
+				value := **field
+				if previous, ok := sensorAverages[name]; ok {
+					value = opts.Alpha*value + (1-opts.Alpha)*previous
+				}
+				sensorAverages[name] = value
+				*field = driver.Float(value)
+			}
+			lock.Unlock()
+
+			next(sensor, reading)
+		}
+	}, nil
+}
+
+type deriveOptions struct {
+	// BatteryMinVolts is the voltage of an empty battery.
+	BatteryMinVolts float64 `json:"battery_min_volts"`
+	// BatteryMaxVolts is the voltage of a full battery.
+	BatteryMaxVolts float64 `json:"battery_max_volts"`
+}
+
+func newDerive(_ logrus.FieldLogger, options json.RawMessage) (pipelineapi.Middleware, error) {
+	// Defaults for the CR2032 coin cells used by most sensors.
+	opts := deriveOptions{
+		BatteryMinVolts: 2.2,
+		BatteryMaxVolts: 3.0,
+	}
+	if err := parseOptions(options, &opts); err != nil {
+		return nil, err
+	}
+
+	if opts.BatteryMinVolts >= opts.BatteryMaxVolts {
+		return nil, fmt.Errorf("battery minimum voltage needs to be lower than the maximum: %v >= %v", opts.BatteryMinVolts, opts.BatteryMaxVolts)
+	}
+
+	return func(next pipelineapi.Handler) pipelineapi.Handler {
+		return func(sensor pipelineapi.Sensor, reading driver.Reading) {
+			if reading.Battery == nil && reading.BatteryVoltage != nil {
+				level := (*reading.BatteryVoltage - opts.BatteryMinVolts) / (opts.BatteryMaxVolts - opts.BatteryMinVolts) * 100
+				reading.Battery = driver.Float(math.Max(0, math.Min(100, level)))
+			}
+
+			next(sensor, reading)
+		}
+	}, nil
+}
+
+type compensateOptions struct {
+	// Coefficient is the relative change of the conductivity per degree celsius.
+	Coefficient float64 `json:"coefficient"`
+	// Reference is the temperature the conductivity is corrected to.
+	Reference float64 `json:"reference"`
+}
+
+func newCompensate(_ logrus.FieldLogger, options json.RawMessage) (pipelineapi.Middleware, error) {
+	// Defaults used by most EC meters: about 2% per degree, referenced to 25°C.
+	opts := compensateOptions{
+		Coefficient: 0.02,
+		Reference:   25,
+	}
+	if err := parseOptions(options, &opts); err != nil {
+		return nil, err
+	}
+
+	if opts.Coefficient <= 0 || opts.Coefficient >= 0.1 {
+		return nil, fmt.Errorf("coefficient needs to be larger than zero and smaller than 0.1: %v", opts.Coefficient)
+	}
+
+	return func(next pipelineapi.Handler) pipelineapi.Handler {
+		return func(sensor pipelineapi.Sensor, reading driver.Reading) {
+			if reading.Conductivity != nil && reading.Temperature != nil {
+				factor := 1 + opts.Coefficient*(*reading.Temperature-opts.Reference)
+				if factor > 0 {
+					reading.ConductivityCompensated = driver.Float(*reading.Conductivity / factor)
+				}
+			}
+
+			next(sensor, reading)
+		}
+	}, nil
+}
@@ -0,0 +1,150 @@
+// Package privsep starts a privileged worker process for the Bluetooth operations and drops the privileges
+// of the exporter process afterwards.
+package privsep
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+)
+
+const (
+	socketName    = "ble-worker.sock"
+	socketTimeout = 10 * time.Second
+)
+
+// Worker is a running worker process.
+type Worker struct {
+	Socket string
+
+	cmd  *exec.Cmd
+	dir  string
+	done chan struct{}
+}
+
+// StartWorker starts the current executable as BLE worker, which creates a socket owned by the unprivileged user.
+// The returned worker is terminated when the context is done.
+func StartWorker(ctx context.Context, log logrus.FieldLogger, cfg config.Config) (*Worker, error) {
+	uid, gid, err := lookupUser(cfg.Privsep.User)
+	if err != nil {
+		return nil, err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("can not find executable: %s", err)
+	}
+
+	dir, err := os.MkdirTemp("", "flowercare-exporter-")
+	if err != nil {
+		return nil, fmt.Errorf("can not create socket directory: %s", err)
+	}
+
+	if err := os.Chown(dir, uid, gid); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("can not change owner of socket directory: %s", err)
+	}
+
+	socket := filepath.Join(dir, socketName)
+	cmd := exec.Command(executable, cfg.WorkerArgs(socket, cfg.Privsep.User)...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("can not start worker: %s", err)
+	}
+
+	w := &Worker{
+		Socket: socket,
+		cmd:    cmd,
+		dir:    dir,
+		done:   make(chan struct{}),
+	}
+	go w.wait(ctx, log)
+
+	if err := w.waitForSocket(); err != nil {
+		w.cmd.Process.Kill()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Done is closed when the worker process has exited.
+func (w *Worker) Done() <-chan struct{} {
+	return w.done
+}
+
+func (w *Worker) wait(ctx context.Context, log logrus.FieldLogger) {
+	go func() {
+		select {
+		case <-ctx.Done():
+			w.cmd.Process.Signal(syscall.SIGTERM)
+		case <-w.done:
+		}
+	}()
+
+	err := w.cmd.Wait()
+	if ctx.Err() == nil {
+		log.Errorf("BLE worker exited: %v", err)
+	}
+
+	os.RemoveAll(w.dir)
+	close(w.done)
+}
+
+func (w *Worker) waitForSocket() error {
+	deadline := time.Now().Add(socketTimeout)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(w.Socket); err == nil {
+			return nil
+		}
+
+		select {
+		case <-w.done:
+			return errors.New("worker exited during startup")
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	return fmt.Errorf("worker did not create socket after %s", socketTimeout)
+}
+
+// ChownSocket changes the owner of the worker socket to the named user.
+func ChownSocket(path, username string) error {
+	uid, gid, err := lookupUser(username)
+	if err != nil {
+		return err
+	}
+
+	return os.Chown(path, uid, gid)
+}
+
+func lookupUser(username string) (uid, gid int, err error) {
+	u, err := user.Lookup(username)
+	if err != nil {
+		return 0, 0, fmt.Errorf("can not find user %q: %s", username, err)
+	}
+
+	uid, err = strconv.Atoi(u.Uid)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid uid %q: %s", u.Uid, err)
+	}
+
+	gid, err = strconv.Atoi(u.Gid)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid gid %q: %s", u.Gid, err)
+	}
+
+	return uid, gid, nil
+}
@@ -0,0 +1,30 @@
+//go:build !windows
+
+package privsep
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// DropPrivileges changes the group and user of the process to the named user.
+func DropPrivileges(username string) error {
+	uid, gid, err := lookupUser(username)
+	if err != nil {
+		return err
+	}
+
+	if err := syscall.Setgroups([]int{gid}); err != nil {
+		return fmt.Errorf("can not set groups: %s", err)
+	}
+
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("can not set group: %s", err)
+	}
+
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("can not set user: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,8 @@
+package privsep
+
+import "errors"
+
+// DropPrivileges is not supported on Windows.
+func DropPrivileges(username string) error {
+	return errors.New("dropping privileges is not supported on Windows")
+}
@@ -0,0 +1,86 @@
+// Package quirks corrects the values of devices with known firmware or model problems.
+//
+// The built-in table is applied automatically based on the driver and the firmware version reported by the
+// device. Each sensor can override the table using the quirks section of its configuration.
+package quirks
+
+import (
+	"strings"
+
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+	"github.com/xperimental/flowercare-exporter/pkg/pipeline"
+)
+
+// Quirk describes a correction needed for a group of devices.
+type Quirk struct {
+	// Driver selects the devices by the driver used to read them.
+	Driver string
+	// FirmwarePrefix selects the devices by the beginning of their firmware version. Empty matches all versions.
+	FirmwarePrefix string
+	// Description explains the problem, it is shown in debug logs.
+	Description string
+	// Scale contains factors applied to the values, by value name.
+	Scale map[string]float64
+	// IgnoreBattery drops the battery value, because the device does not report it correctly.
+	IgnoreBattery bool
+}
+
+// Table contains the known quirks. Only problems which have been confirmed for all devices matched by an entry are
+// added, corrections for single devices belong into the configuration of the sensor.
+var Table = []Quirk{}
+
+// Lookup returns the quirks from the table which apply to the sensor with the firmware.
+func Lookup(sensor pipeline.Sensor, firmware string) []Quirk {
+	name := sensor.Driver
+	if name == "" {
+		name = driver.Default
+	}
+
+	result := []Quirk{}
+	for _, q := range Table {
+		if q.Driver == name && strings.HasPrefix(firmware, q.FirmwarePrefix) {
+			result = append(result, q)
+		}
+	}
+
+	return result
+}
+
+// Apply returns a copy of the reading with all corrections for the sensor applied.
+func Apply(sensor pipeline.Sensor, reading driver.Reading) driver.Reading {
+	result := reading
+	overrides := sensor.Quirks
+
+	ignoreBattery := false
+	if !overrides.Disable {
+		for _, q := range Lookup(sensor, reading.Firmware) {
+			scale(&result, q.Scale)
+			ignoreBattery = ignoreBattery || q.IgnoreBattery
+		}
+	}
+
+	if overrides.IgnoreBattery != nil {
+		ignoreBattery = *overrides.IgnoreBattery
+	}
+
+	if ignoreBattery {
+		result.Battery = nil
+	}
+
+	scale(&result, overrides.Scale)
+	for name, offset := range overrides.Offset {
+		if field := result.Field(name); field != nil && *field != nil {
+			*field = driver.Float(**field + offset)
+		}
+	}
+
+	return result
+}
+
+func scale(r *driver.Reading, factors map[string]float64) {
+	for name, factor := range factors {
+		if field := r.Field(name); field != nil && *field != nil {
+			*field = driver.Float(**field * factor)
+		}
+	}
+}
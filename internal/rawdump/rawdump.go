@@ -0,0 +1,178 @@
+// Package rawdump writes the raw data received from the devices to files, so that the parsing of new firmware
+// versions can be diagnosed from dumps sent in by users.
+package rawdump
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ble/ble"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+// maxFileSize is the size after which a dump file is moved aside and a new one is started. Only one previous
+// file is kept.
+const maxFileSize = 1 << 20
+
+// Dumper appends hex dumps of raw data to one file per device. Every kind of data of a device is only dumped
+// once per interval. A nil Dumper does not dump anything.
+type Dumper struct {
+	dir      string
+	interval time.Duration
+
+	lock sync.Mutex
+	last map[string]time.Time
+}
+
+// New creates a Dumper writing to the directory, which is created if needed.
+func New(dir string, interval time.Duration) (*Dumper, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("can not create dump directory: %s", err)
+	}
+
+	return &Dumper{
+		dir:      dir,
+		interval: interval,
+		last:     map[string]time.Time{},
+	}, nil
+}
+
+// Advertisement dumps the service and manufacturer data of an advertisement. Only advertisements of devices
+// supported by one of the drivers are dumped.
+func (d *Dumper) Advertisement(a ble.Advertisement) {
+	if d == nil {
+		return
+	}
+
+	if _, ok := driver.Match(a); !ok {
+		return
+	}
+
+	macAddress := a.Addr().String()
+	details := fmt.Sprintf(" (rssi %d, name %q)", a.RSSI(), a.LocalName())
+	for _, s := range a.ServiceData() {
+		d.dump(macAddress, "advertisement service data "+s.UUID.String(), details, s.Data)
+	}
+	if data := a.ManufacturerData(); len(data) > 0 {
+		d.dump(macAddress, "advertisement manufacturer data", details, data)
+	}
+}
+
+// Device wraps a Bluetooth device, so that the data read from and written to the characteristics of the sensor
+// are dumped.
+func (d *Dumper) Device(device ble.Device, macAddress string) ble.Device {
+	if d == nil {
+		return device
+	}
+
+	return &dumpDevice{
+		Device:     device,
+		dumper:     d,
+		macAddress: macAddress,
+	}
+}
+
+func (d *Dumper) dump(macAddress, kind, details string, data []byte) {
+	now := time.Now()
+	key := strings.ToUpper(macAddress) + " " + kind
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if last, ok := d.last[key]; ok && now.Sub(last) < d.interval {
+		return
+	}
+	d.last[key] = now
+
+	// Errors are ignored, as the dumps are only a debugging aid.
+	d.write(macAddress, fmt.Sprintf("%s %s%s: %d bytes\n%s\n", now.UTC().Format(time.RFC3339), kind, details, len(data), hex.Dump(data)))
+}
+
+func (d *Dumper) write(macAddress, entry string) error {
+	name := filepath.Join(d.dir, strings.ToLower(strings.ReplaceAll(macAddress, ":", ""))+".txt")
+	if info, err := os.Stat(name); err == nil && info.Size()+int64(len(entry)) > maxFileSize {
+		if err := os.Rename(name, name+".1"); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(entry)
+	return err
+}
+
+type dumpDevice struct {
+	ble.Device
+	dumper     *Dumper
+	macAddress string
+}
+
+func (d *dumpDevice) Dial(ctx context.Context, addr ble.Addr) (ble.Client, error) {
+	c, err := d.Device.Dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dumpClient{
+		Client: c,
+		device: d,
+	}, nil
+}
+
+type dumpClient struct {
+	ble.Client
+	device *dumpDevice
+}
+
+func (c *dumpClient) dump(kind string, char *ble.Characteristic, data []byte) {
+	c.device.dumper.dump(c.device.macAddress, kind+" "+characteristicName(char), "", data)
+}
+
+func (c *dumpClient) ReadCharacteristic(char *ble.Characteristic) ([]byte, error) {
+	data, err := c.Client.ReadCharacteristic(char)
+	if err == nil {
+		c.dump("read", char, data)
+	}
+	return data, err
+}
+
+func (c *dumpClient) ReadLongCharacteristic(char *ble.Characteristic) ([]byte, error) {
+	data, err := c.Client.ReadLongCharacteristic(char)
+	if err == nil {
+		c.dump("read", char, data)
+	}
+	return data, err
+}
+
+func (c *dumpClient) WriteCharacteristic(char *ble.Characteristic, value []byte, noRsp bool) error {
+	c.dump("write", char, value)
+	return c.Client.WriteCharacteristic(char, value, noRsp)
+}
+
+func (c *dumpClient) Subscribe(char *ble.Characteristic, ind bool, h ble.NotificationHandler) error {
+	return c.Client.Subscribe(char, ind, func(data []byte) {
+		c.dump("notification", char, data)
+		h(data)
+	})
+}
+
+// characteristicName identifies the characteristic by its UUID or, if it has been accessed by handle only, by its
+// value handle.
+func characteristicName(c *ble.Characteristic) string {
+	if c.UUID != nil {
+		return c.UUID.String()
+	}
+
+	return fmt.Sprintf("handle %#04x", c.ValueHandle)
+}
@@ -0,0 +1,78 @@
+// Package readiness reports whether the exporter is ready to serve metrics, optionally only after a sensor has been
+// read successfully.
+package readiness
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+// Gate becomes ready after the first successful read of any sensor. A nil Gate is always ready.
+type Gate struct {
+	once  sync.Once
+	ready chan struct{}
+}
+
+// New creates a gate which is not ready yet.
+func New() *Gate {
+	return &Gate{
+		ready: make(chan struct{}),
+	}
+}
+
+// Observe can be used as listener of the updater. It marks the gate as ready.
+func (g *Gate) Observe(_ config.Sensor, _ driver.Reading) {
+	g.once.Do(func() {
+		close(g.ready)
+	})
+}
+
+// Ready returns true once a sensor has been read.
+func (g *Gate) Ready() bool {
+	if g == nil {
+		return true
+	}
+
+	select {
+	case <-g.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// Wait blocks until a sensor has been read, the timeout has passed or the context is done. It returns an error if
+// the gate is not ready.
+func (g *Gate) Wait(ctx context.Context, timeout time.Duration) error {
+	if g == nil {
+		return nil
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-g.ready:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("no sensor could be read within %s", timeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ServeHTTP implements http.Handler. It responds with 503 Service Unavailable as long as the gate is not ready.
+func (g *Gate) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !g.Ready() {
+		http.Error(w, "waiting for first successful read", http.StatusServiceUnavailable)
+		return
+	}
+
+	fmt.Fprintln(w, "Ready.")
+}
@@ -0,0 +1,195 @@
+// Package reload applies changes of the configured sensors without restarting the exporter.
+package reload
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/events"
+)
+
+// Provider contains the sensors which are currently collected.
+type Provider interface {
+	ConfiguredSensors() []config.Sensor
+	AddSensor(sensor config.Sensor)
+	RemoveSensor(macAddress string) bool
+	Refresh(macAddress string) error
+}
+
+// Scopes of a reload requested using HTTP.
+const (
+	ScopeSensors = "sensors"
+	ScopeOutputs = "outputs"
+)
+
+// Result summarizes the changes of a reload.
+type Result struct {
+	Added     int `json:"added"`
+	Changed   int `json:"changed"`
+	Removed   int `json:"removed"`
+	Unchanged int `json:"unchanged"`
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("%d added, %d changed, %d removed, %d unchanged", r.Added, r.Changed, r.Removed, r.Unchanged)
+}
+
+// Reloader reads the configured sensors again and updates the provider. The data of sensors which are still
+// configured is kept. Discovered sensors are only replaced if they have been configured in the meantime.
+type Reloader struct {
+	Log      logrus.FieldLogger
+	Load     func(log logrus.FieldLogger) ([]config.Sensor, error)
+	Provider Provider
+	// Events is optional.
+	Events *events.Log
+	// Outputs reads the configuration of the outputs again and replaces the changed outputs. It returns the names of
+	// the changed outputs. Reloading the outputs is not supported if it is nil.
+	Outputs func() ([]string, error)
+
+	lock sync.Mutex
+}
+
+// Reload reads the sensors and applies the differences to the provider. Nothing is changed if the sensors
+// can not be read.
+func (r *Reloader) Reload() (Result, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	sensors, err := r.Load(r.Log)
+	if err != nil {
+		r.Log.Errorf("Error reloading sensors: %s", err)
+		r.recordEvent(events.TypeReload, config.Sensor{}, "failed: "+err.Error())
+		return Result{}, err
+	}
+
+	current := map[string]config.Sensor{}
+	for _, s := range r.Provider.ConfiguredSensors() {
+		current[strings.ToUpper(s.MacAddress)] = s
+	}
+
+	var result Result
+	seen := map[string]bool{}
+	for _, s := range sensors {
+		key := strings.ToUpper(s.MacAddress)
+		seen[key] = true
+
+		existing, ok := current[key]
+		switch {
+		case !ok:
+			r.Provider.AddSensor(s)
+			r.Log.Infof("Added sensor %q.", s)
+			r.recordEvent(events.TypeSensorAdded, s, "added by reload")
+			if err := r.Provider.Refresh(s.MacAddress); err != nil {
+				r.Log.Debugf("Not refreshing new sensor: %s", err)
+			}
+			result.Added++
+		case !reflect.DeepEqual(existing, s):
+			if existing.MacAddress != s.MacAddress {
+				r.Provider.RemoveSensor(existing.MacAddress)
+			}
+			r.Provider.AddSensor(s)
+			r.Log.Infof("Updated sensor %q.", s)
+			result.Changed++
+		default:
+			result.Unchanged++
+		}
+	}
+
+	for key, s := range current {
+		if seen[key] || s.Discovered {
+			continue
+		}
+
+		if r.Provider.RemoveSensor(s.MacAddress) {
+			r.Log.Infof("Removed sensor %q.", s)
+			r.recordEvent(events.TypeSensorRemoved, s, "removed by reload")
+			result.Removed++
+		}
+	}
+
+	r.Log.Infof("Reloaded sensors: %s", result)
+	r.recordEvent(events.TypeReload, config.Sensor{}, result.String())
+	return result, nil
+}
+
+// ReloadOutputs reads the configuration of the outputs again and replaces the outputs whose settings changed. The
+// collection of the sensors is not interrupted. Nothing is changed if the configuration is invalid.
+func (r *Reloader) ReloadOutputs() ([]string, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.Outputs == nil {
+		return nil, errors.New("reloading outputs is not supported")
+	}
+
+	changed, err := r.Outputs()
+	if err != nil {
+		r.Log.Errorf("Error reloading outputs: %s", err)
+		r.recordEvent(events.TypeReload, config.Sensor{}, "outputs failed: "+err.Error())
+		return changed, err
+	}
+
+	message := "no outputs changed"
+	if len(changed) > 0 {
+		message = "replaced " + strings.Join(changed, ", ")
+	}
+	r.Log.Infof("Reloaded outputs: %s", message)
+	r.recordEvent(events.TypeReload, config.Sensor{}, "outputs: "+message)
+	return changed, nil
+}
+
+// ServeHTTP reloads the sensors on a POST request. The outputs are reloaded instead if the scope parameter is
+// "outputs".
+func (r *Reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch scope := req.URL.Query().Get("scope"); scope {
+	case "", ScopeSensors:
+	case ScopeOutputs:
+		r.serveOutputs(w)
+		return
+	default:
+		http.Error(w, fmt.Sprintf("unknown scope %q, needs to be %q or %q", scope, ScopeSensors, ScopeOutputs), http.StatusBadRequest)
+		return
+	}
+
+	result, err := r.Reload()
+	if err != nil {
+		http.Error(w, "error reloading sensors: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprintf(w, "Reloaded sensors: %s\n", result)
+}
+
+func (r *Reloader) serveOutputs(w http.ResponseWriter) {
+	changed, err := r.ReloadOutputs()
+	if err != nil {
+		http.Error(w, "error reloading outputs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(changed) == 0 {
+		fmt.Fprintln(w, "Reloaded outputs: no outputs changed")
+		return
+	}
+
+	fmt.Fprintf(w, "Reloaded outputs: replaced %s\n", strings.Join(changed, ", "))
+}
+
+func (r *Reloader) recordEvent(t events.Type, sensor config.Sensor, message string) {
+	if r.Events == nil {
+		return
+	}
+
+	r.Events.Record(t, sensor, message)
+}
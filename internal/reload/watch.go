@@ -0,0 +1,117 @@
+package reload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// Watcher reloads the sensors when sensor files are added to, changed in or removed from the sensor directory.
+type Watcher struct {
+	Log      logrus.FieldLogger
+	Reloader *Reloader
+	// Dir is the sensor directory. Only the JSON files directly in the directory are watched.
+	Dir string
+	// Debounce is the time waited after the last change before reloading, so that a file written in several steps or
+	// several files copied at once cause a single reload.
+	Debounce time.Duration
+	// Validate checks a changed sensor file before reloading. The sensors are not reloaded while a changed file is
+	// invalid, so that a file which is still being edited does not remove its sensor.
+	Validate func(fileName string) error
+}
+
+// Start watches the sensor directory until the context is done. It returns an error if the directory can not be
+// watched.
+func (w *Watcher) Start(ctx context.Context, wg *sync.WaitGroup) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("can not create watcher: %s", err)
+	}
+
+	if err := watcher.Add(w.Dir); err != nil {
+		watcher.Close()
+		return fmt.Errorf("can not watch %s: %s", w.Dir, err)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer watcher.Close()
+
+		timer := time.NewTimer(w.Debounce)
+		timer.Stop()
+		defer timer.Stop()
+
+		changed := map[string]bool{}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				if !isSensorFile(event.Name) || event.Op == fsnotify.Chmod {
+					continue
+				}
+
+				w.Log.Debugf("Sensor file changed: %s", event)
+				changed[event.Name] = true
+				timer.Reset(w.Debounce)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+
+				w.Log.Errorf("Error watching sensor directory: %s", err)
+			case <-timer.C:
+				w.apply(changed)
+				changed = map[string]bool{}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// apply reloads the sensors if all changed files which still exist are valid.
+func (w *Watcher) apply(changed map[string]bool) {
+	fileNames := make([]string, 0, len(changed))
+	for fileName := range changed {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+
+	for _, fileName := range fileNames {
+		if _, err := os.Stat(fileName); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		if err := w.Validate(fileName); err != nil {
+			w.Log.Warnf("Not reloading sensors, %s is invalid: %s", fileName, err)
+			return
+		}
+	}
+
+	w.Log.Infof("Reloading sensors after changes of %s.", strings.Join(fileNames, ", "))
+	if _, err := w.Reloader.Reload(); err != nil {
+		w.Log.Warn("Keeping the previous sensors.")
+	}
+}
+
+// isSensorFile returns true for the files read from the sensor directory. Temporary files used for replacing sensor
+// files atomically do not end in ".json" and are ignored.
+func isSensorFile(fileName string) bool {
+	return strings.HasSuffix(filepath.Base(fileName), ".json")
+}
@@ -0,0 +1,136 @@
+// Package resource limits and measures the memory used by the exporter.
+//
+// The exporter measures the memory it has obtained from the operating system and not yet returned, which is
+// close to its resident memory, so that the targets documented for small devices can be checked without
+// external tools.
+package resource
+
+import (
+	"context"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/collector"
+)
+
+const (
+	// measureInterval is the interval between two measurements of the memory used.
+	measureInterval = 30 * time.Second
+	// lowGCPercent is the garbage collection target used in low resource mode.
+	lowGCPercent = 50
+	mebibyte     = 1 << 20
+)
+
+var (
+	memoryDesc = prometheus.NewDesc(
+		collector.MetricPrefix+"exporter_memory_bytes",
+		"Memory obtained by the exporter from the operating system and not yet returned.",
+		nil, nil)
+	peakDesc = prometheus.NewDesc(
+		collector.MetricPrefix+"exporter_memory_peak_bytes",
+		"Highest memory used by the exporter since it has been started.",
+		nil, nil)
+	targetDesc = prometheus.NewDesc(
+		collector.MetricPrefix+"exporter_memory_target_bytes",
+		"Memory the exporter tries to stay below.",
+		nil, nil)
+)
+
+// Apply configures the Go runtime. A positive target in MiB sets a soft memory limit, so that garbage is
+// collected more often when the exporter gets close to it. In low resource mode garbage is also collected
+// earlier in general.
+func Apply(log logrus.FieldLogger, low bool, targetMiB int) {
+	if low {
+		debug.SetGCPercent(lowGCPercent)
+		log.Info("Low resource mode enabled.")
+	}
+
+	if targetMiB > 0 {
+		debug.SetMemoryLimit(int64(targetMiB) * mebibyte)
+		log.Infof("Memory target: %d MiB", targetMiB)
+	}
+}
+
+// Monitor measures the memory used by the exporter and warns when it exceeds the target.
+type Monitor struct {
+	Log logrus.FieldLogger
+	// Target is the memory in bytes the exporter should stay below. Zero disables the warning.
+	Target uint64
+
+	lock    sync.Mutex
+	current uint64
+	peak    uint64
+	over    bool
+}
+
+// Start starts measuring the memory periodically.
+func (m *Monitor) Start(ctx context.Context, wg *sync.WaitGroup) {
+	m.measure()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(measureInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.measure()
+			}
+		}
+	}()
+}
+
+func (m *Monitor) measure() {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	used := stats.Sys - stats.HeapReleased
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.current = used
+	if used > m.peak {
+		m.peak = used
+	}
+
+	if m.Target == 0 {
+		return
+	}
+
+	switch {
+	case used > m.Target && !m.over:
+		m.Log.Warnf("Memory used (%.1f MiB) is above the target of %.1f MiB.", float64(used)/mebibyte, float64(m.Target)/mebibyte)
+		m.over = true
+	case used <= m.Target && m.over:
+		m.Log.Infof("Memory used (%.1f MiB) is below the target again.", float64(used)/mebibyte)
+		m.over = false
+	}
+}
+
+// Describe implements prometheus.Collector
+func (m *Monitor) Describe(ch chan<- *prometheus.Desc) {
+	ch <- memoryDesc
+	ch <- peakDesc
+	ch <- targetDesc
+}
+
+// Collect implements prometheus.Collector
+func (m *Monitor) Collect(ch chan<- prometheus.Metric) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(memoryDesc, prometheus.GaugeValue, float64(m.current))
+	ch <- prometheus.MustNewConstMetric(peakDesc, prometheus.GaugeValue, float64(m.peak))
+	if m.Target > 0 {
+		ch <- prometheus.MustNewConstMetric(targetDesc, prometheus.GaugeValue, float64(m.Target))
+	}
+}
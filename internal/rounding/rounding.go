@@ -0,0 +1,86 @@
+// Package rounding reduces the precision of the values of readings, so that they can be shared publicly without
+// revealing the exact conditions at the location of the sensors.
+//
+// All methods can be called on a nil Rounder, in which case the values are returned unchanged.
+package rounding
+
+import (
+	"context"
+	"math"
+
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+// precision is the number of decimal places kept after rounding, which removes the floating point errors of
+// steps like 0.1.
+const precision = 1e9
+
+// Rounder rounds the values of readings to fixed steps.
+type Rounder struct {
+	steps map[string]float64
+}
+
+// New creates a Rounder using the steps by name of the value. Values without a step are not rounded.
+func New(steps map[string]float64) *Rounder {
+	return &Rounder{
+		steps: steps,
+	}
+}
+
+// Reading returns a copy of the reading with rounded values.
+func (r *Rounder) Reading(reading driver.Reading) driver.Reading {
+	if r == nil {
+		return reading
+	}
+
+	for name, step := range r.steps {
+		value := reading.Field(name)
+		if value == nil || *value == nil {
+			continue
+		}
+
+		*value = driver.Float(round(**value, step))
+	}
+
+	return reading
+}
+
+// Source wraps a function returning the readings of sensors, so that it returns rounded values.
+func (r *Rounder) Source(source func(macAddress string) (driver.Reading, error)) func(macAddress string) (driver.Reading, error) {
+	if r == nil {
+		return source
+	}
+
+	return func(macAddress string) (driver.Reading, error) {
+		reading, err := source(macAddress)
+		return r.Reading(reading), err
+	}
+}
+
+// Probe wraps a function reading sensors on demand, so that it returns rounded values.
+func (r *Rounder) Probe(probe func(ctx context.Context, macAddress string) (config.Sensor, driver.Reading, error)) func(ctx context.Context, macAddress string) (config.Sensor, driver.Reading, error) {
+	if r == nil {
+		return probe
+	}
+
+	return func(ctx context.Context, macAddress string) (config.Sensor, driver.Reading, error) {
+		sensor, reading, err := probe(ctx, macAddress)
+		return sensor, r.Reading(reading), err
+	}
+}
+
+// Listener wraps a function receiving new readings, so that it receives rounded values.
+func (r *Rounder) Listener(listener func(sensor config.Sensor, reading driver.Reading)) func(sensor config.Sensor, reading driver.Reading) {
+	if r == nil {
+		return listener
+	}
+
+	return func(sensor config.Sensor, reading driver.Reading) {
+		listener(sensor, r.Reading(reading))
+	}
+}
+
+func round(value, step float64) float64 {
+	return math.Round(math.Round(value/step)*step*precision) / precision
+}
@@ -0,0 +1,28 @@
+// Package sandbox restricts the exporter process using the security features of the operating system.
+//
+// The restrictions are applied on a best-effort basis: features not supported by the kernel are skipped with a
+// warning, so that the exporter keeps working on older systems.
+package sandbox
+
+import "github.com/sirupsen/logrus"
+
+// Paths contains the filesystem locations the process still needs access to after the sandbox is applied.
+type Paths struct {
+	// Read contains paths which can be read, including everything below directories.
+	Read []string
+	// Write contains paths which can be read and written, including everything below directories.
+	Write []string
+}
+
+// defaultReadPaths are needed for name resolution and TLS certificates.
+var defaultReadPaths = []string{
+	"/etc",
+	"/usr/share/ca-certificates",
+	"/usr/local/share/ca-certificates",
+}
+
+// Apply restricts the current process. Unsupported features are logged and skipped.
+func Apply(log logrus.FieldLogger, paths Paths) error {
+	paths.Read = append(paths.Read, defaultReadPaths...)
+	return apply(log, paths)
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package sandbox
+
+import "github.com/sirupsen/logrus"
+
+func apply(log logrus.FieldLogger, _ Paths) error {
+	log.Warn("Sandboxing is only supported on Linux.")
+	return nil
+}
@@ -0,0 +1,109 @@
+package scanner
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/xperimental/flowercare-exporter/internal/anonymize"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+)
+
+// LocalReceiver is the receiver of the advertisements received by the adapters of the exporter itself.
+const LocalReceiver = "local"
+
+// unknownRSSI is used for advertisements without signal strength, so that every other receiver is preferred.
+const unknownRSSI = -128
+
+// reception is the last accepted advertisement of a sensor.
+type reception struct {
+	Via  string
+	RSSI int
+	Time time.Time
+}
+
+// Receivers selects the receiver used for each sensor when several receivers, like the exporter and Bluetooth
+// proxies, hear the same sensor. The receiver with the best signal wins, others are only used if it has not heard
+// the sensor for the duration of the window. It also exports the reception statistics of every receiver.
+type Receivers struct {
+	window     time.Duration
+	anonymizer *anonymize.Anonymizer
+
+	lock     sync.Mutex
+	accepted map[string]reception
+
+	advertisements *prometheus.CounterVec
+	selected       *prometheus.CounterVec
+	rssi           *prometheus.GaugeVec
+}
+
+// NewReceivers creates Receivers using the window for switching to a receiver with a weaker signal. The sensors are
+// anonymized in the labels of the metrics if the anonymizer is set.
+func NewReceivers(window time.Duration, anonymizer *anonymize.Anonymizer) *Receivers {
+	labels := []string{"via", "macaddress", "name"}
+	return &Receivers{
+		window:     window,
+		anonymizer: anonymizer,
+		accepted:   map[string]reception{},
+		advertisements: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "flowercare_receiver_advertisements_total",
+			Help: "Number of advertisements of the sensor heard by the receiver.",
+		}, labels),
+		selected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "flowercare_receiver_readings_total",
+			Help: "Number of readings of the sensor taken from the advertisements heard by the receiver.",
+		}, labels),
+		rssi: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "flowercare_receiver_rssi_dbm",
+			Help: "Signal strength of the last advertisement of the sensor heard by the receiver in dBm.",
+		}, labels),
+	}
+}
+
+// Accept records an advertisement of the sensor and returns true if its reading should be used.
+func (r *Receivers) Accept(via string, sensor config.Sensor, rssi int, now time.Time) bool {
+	if r == nil {
+		return true
+	}
+
+	labels := r.anonymizer.Sensor(sensor)
+	r.advertisements.WithLabelValues(via, labels.MacAddress, labels.Name).Inc()
+	if rssi == 0 {
+		rssi = unknownRSSI
+	} else {
+		r.rssi.WithLabelValues(via, labels.MacAddress, labels.Name).Set(float64(rssi))
+	}
+
+	key := strings.ToUpper(sensor.MacAddress)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	last, ok := r.accepted[key]
+	if ok && last.Via != via && rssi <= last.RSSI && now.Sub(last.Time) < r.window {
+		return false
+	}
+
+	r.accepted[key] = reception{
+		Via:  via,
+		RSSI: rssi,
+		Time: now,
+	}
+	r.selected.WithLabelValues(via, labels.MacAddress, labels.Name).Inc()
+	return true
+}
+
+// Describe implements prometheus.Collector
+func (r *Receivers) Describe(ch chan<- *prometheus.Desc) {
+	r.advertisements.Describe(ch)
+	r.selected.Describe(ch)
+	r.rssi.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (r *Receivers) Collect(ch chan<- prometheus.Metric) {
+	r.advertisements.Collect(ch)
+	r.selected.Collect(ch)
+	r.rssi.Collect(ch)
+}
@@ -0,0 +1,138 @@
+// Package scanner listens for Bluetooth LE advertisements and decodes the data of sensors using passive drivers.
+// It can also discover Flower Care devices which are not configured yet.
+package scanner
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ble/ble"
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+// Scanner periodically scans for advertisements and passes decoded readings to a store function.
+type Scanner struct {
+	Log     logrus.FieldLogger
+	Config  config.ScanConfig
+	Scan    func(ctx context.Context, handler ble.AdvHandler) error
+	Sensors func() []config.Sensor
+	Store   func(sensor config.Sensor, reading driver.Reading)
+	// Discover is called with a new sensor for every unknown Flower Care device if set.
+	Discover func(sensor config.Sensor)
+	// Receivers selects the receiver of sensors heard by several receivers. All advertisements are used if nil.
+	Receivers *Receivers
+}
+
+// Start starts the scan loop.
+func (s *Scanner) Start(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(s.Config.Interval)
+		defer ticker.Stop()
+
+		s.Log.Debug("Scanner ready.")
+		for {
+			s.scan(ctx)
+
+			select {
+			case <-ctx.Done():
+				s.Log.Debug("Shutting down scanner.")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (s *Scanner) scan(ctx context.Context) {
+	sensors := map[string]config.Sensor{}
+	for _, sensor := range s.Sensors() {
+		sensors[strings.ToUpper(sensor.MacAddress)] = sensor
+	}
+
+	scanCtx, cancel := context.WithTimeout(ctx, s.Config.Duration)
+	defer cancel()
+
+	err := s.Scan(scanCtx, func(a ble.Advertisement) {
+		s.handleAdvertisement(sensors, LocalReceiver, a)
+	})
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled) {
+		s.Log.Errorf("Error during scan: %s", err)
+	}
+}
+
+// Handle decodes a single advertisement received outside of the scans, for example from a Bluetooth proxy. The
+// receiver is the name of the proxy.
+func (s *Scanner) Handle(via string, a ble.Advertisement) {
+	sensors := map[string]config.Sensor{}
+	for _, sensor := range s.Sensors() {
+		sensors[strings.ToUpper(sensor.MacAddress)] = sensor
+	}
+
+	s.handleAdvertisement(sensors, via, a)
+}
+
+func (s *Scanner) handleAdvertisement(sensors map[string]config.Sensor, via string, a ble.Advertisement) {
+	macAddress := strings.ToUpper(a.Addr().String())
+	sensor, ok := sensors[macAddress]
+	if !ok {
+		s.discover(sensors, macAddress, a)
+		return
+	}
+
+	if !sensor.Passive() {
+		return
+	}
+
+	d, err := driver.Get(sensor.Driver)
+	if err != nil {
+		return
+	}
+
+	reading, err := d.DecodeAdvertisement(a, sensor.DriverOptions())
+	if err != nil {
+		s.Log.Debugf("Can not decode advertisement of %q: %s", sensor, err)
+		return
+	}
+	if rssi := a.RSSI(); rssi != 0 {
+		reading.RSSI = driver.Float(float64(rssi))
+	}
+	reading.Via = via
+
+	if !s.Receivers.Accept(via, sensor, a.RSSI(), time.Now()) {
+		return
+	}
+
+	s.Store(sensor, reading)
+}
+
+// discover registers a device as a new sensor if it is a Flower Care device.
+func (s *Scanner) discover(sensors map[string]config.Sensor, macAddress string, a ble.Advertisement) {
+	if s.Discover == nil {
+		return
+	}
+
+	d, ok := driver.Match(a)
+	if !ok || d.Name != driver.Default {
+		return
+	}
+
+	sensor := config.Sensor{
+		Name:       macAddress,
+		MacAddress: macAddress,
+		Driver:     d.Name,
+		Discovered: true,
+	}
+	sensors[macAddress] = sensor
+
+	s.Log.Infof("Discovered sensor %s.", macAddress)
+	s.Discover(sensor)
+}
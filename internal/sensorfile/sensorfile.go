@@ -0,0 +1,288 @@
+// Package sensorfile writes sensors changed at runtime back to the sensor directory.
+//
+// Files are replaced atomically and the previous version is kept as a backup, so that a crash while writing
+// does not corrupt the configuration and changes can be rolled back. Optionally every change is committed to
+// the Git repository containing the directory.
+package sensorfile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/atomicfile"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+)
+
+const (
+	// BackupDir is the directory inside the sensor directory containing the previous versions of the files.
+	BackupDir = ".backup"
+
+	gitTimeout = 30 * time.Second
+)
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// Writer writes sensor files into a directory.
+type Writer struct {
+	Log logrus.FieldLogger
+	Dir string
+	// Backups is the number of previous versions kept per file.
+	Backups int
+	// GitCommit commits every change using git.
+	GitCommit bool
+
+	lock sync.Mutex
+}
+
+// Save writes the sensor to its file, which is created if the sensor has no file yet. Fields of an existing
+// file which are not part of the sensor, like the plant information, are kept.
+func (w *Writer) Save(sensor config.Sensor, author string) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	fileName, err := w.find(sensor.MacAddress)
+	if err != nil {
+		return err
+	}
+
+	fields := map[string]json.RawMessage{}
+	mode := os.FileMode(0o600)
+	action := "Update"
+	if fileName == "" {
+		fileName = w.newFileName(sensor)
+		action = "Add"
+	} else {
+		info, err := os.Stat(fileName)
+		if err != nil {
+			return err
+		}
+		mode = info.Mode().Perm()
+
+		existing, err := os.ReadFile(fileName)
+		if err != nil {
+			return err
+		}
+
+		if err := json.Unmarshal(existing, &fields); err != nil {
+			return fmt.Errorf("can not parse %s: %s", fileName, err)
+		}
+
+		if err := w.backup(fileName, false); err != nil {
+			return err
+		}
+	}
+
+	data, err := merge(fields, sensor)
+	if err != nil {
+		return err
+	}
+
+	if err := atomicfile.Write(fileName, data, mode); err != nil {
+		return err
+	}
+	w.Log.Infof("Wrote sensor %q to %s.", sensor, fileName)
+
+	w.commit(fileName, fmt.Sprintf("%s sensor %s\n\nChanged using the control API by %s.", action, sensor, author))
+	return nil
+}
+
+// Delete removes the file of a sensor. The file is kept as a backup. It is not an error if the sensor has
+// no file.
+func (w *Writer) Delete(macAddress, author string) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	fileName, err := w.find(macAddress)
+	if err != nil || fileName == "" {
+		return err
+	}
+
+	if err := w.backup(fileName, true); err != nil {
+		return err
+	}
+	w.Log.Infof("Removed sensor %s from %s.", macAddress, fileName)
+
+	w.commit(fileName, fmt.Sprintf("Remove sensor %s\n\nChanged using the control API by %s.", macAddress, author))
+	return nil
+}
+
+// Exists returns true if a file in the directory contains the sensor.
+func (w *Writer) Exists(macAddress string) (bool, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	fileName, err := w.find(macAddress)
+	return fileName != "", err
+}
+
+// find returns the file containing the sensor or an empty string if no file contains it.
+func (w *Writer) find(macAddress string) (string, error) {
+	entries, err := os.ReadDir(w.Dir)
+	if err != nil {
+		return "", err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		fileName := filepath.Join(w.Dir, entry.Name())
+		data, err := os.ReadFile(fileName)
+		if err != nil {
+			continue
+		}
+
+		var sensor config.Sensor
+		if err := json.Unmarshal(data, &sensor); err != nil {
+			continue
+		}
+
+		if strings.EqualFold(sensor.MacAddress, macAddress) {
+			return fileName, nil
+		}
+	}
+
+	return "", nil
+}
+
+// newFileName creates the name of the file for a new sensor based on its name or MAC address.
+func (w *Writer) newFileName(sensor config.Sensor) string {
+	base := strings.Trim(unsafeChars.ReplaceAllString(sensor.Name, "-"), "-")
+	if base == "" {
+		base = strings.ReplaceAll(sensor.MacAddress, ":", "")
+	}
+
+	fileName := filepath.Join(w.Dir, base+".json")
+	if _, err := os.Stat(fileName); err == nil {
+		fileName = filepath.Join(w.Dir, base+"-"+strings.ReplaceAll(sensor.MacAddress, ":", "")+".json")
+	}
+
+	return fileName
+}
+
+// backup copies the current version of the file into the backup directory, or moves it there if remove is set.
+// Only the configured number of backups is kept.
+func (w *Writer) backup(fileName string, remove bool) error {
+	dir := filepath.Join(w.Dir, BackupDir)
+	base := filepath.Base(fileName)
+
+	if w.Backups == 0 {
+		if remove {
+			return os.Remove(fileName)
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("can not create backup directory: %s", err)
+	}
+
+	target := filepath.Join(dir, base+"."+time.Now().UTC().Format("20060102T150405.000000000"))
+	if remove {
+		if err := os.Rename(fileName, target); err != nil {
+			return fmt.Errorf("can not move file to backup: %s", err)
+		}
+	} else {
+		data, err := os.ReadFile(fileName)
+		if err != nil {
+			return err
+		}
+
+		if err := atomicfile.Write(target, data, 0o600); err != nil {
+			return fmt.Errorf("can not write backup: %s", err)
+		}
+	}
+
+	backups, err := filepath.Glob(filepath.Join(dir, base+".*"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(backups)
+	for len(backups) > w.Backups {
+		if err := os.Remove(backups[0]); err != nil {
+			w.Log.Warnf("Can not remove old backup %s: %s", backups[0], err)
+		}
+		backups = backups[1:]
+	}
+
+	return nil
+}
+
+// commit adds the file to the Git repository and commits it. Errors are only logged, because the change has
+// already been written.
+func (w *Writer) commit(fileName, message string) {
+	if !w.GitCommit {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+
+	base := filepath.Base(fileName)
+	for _, args := range [][]string{
+		{"add", "--all", "--", base},
+		{"commit", "--quiet", "--message", message, "--", base},
+	} {
+		cmd := exec.CommandContext(ctx, "git", append([]string{"-C", w.Dir}, args...)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			w.Log.Errorf("Error running git %s: %s: %s", args[0], err, strings.TrimSpace(string(output)))
+			return
+		}
+	}
+}
+
+// merge replaces the fields of the sensor in the existing fields of a file. The parameters of the plant,
+// which are not part of the sensor, are kept.
+func merge(fields map[string]json.RawMessage, sensor config.Sensor) ([]byte, error) {
+	data, err := json.Marshal(sensor)
+	if err != nil {
+		return nil, err
+	}
+
+	var sensorFields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &sensorFields); err != nil {
+		return nil, err
+	}
+
+	for key, value := range sensorFields {
+		if key == "parameter" && fields[key] != nil {
+			merged, err := mergeObjects(fields[key], value)
+			if err != nil {
+				return nil, err
+			}
+			value = merged
+		}
+
+		fields[key] = value
+	}
+
+	return json.MarshalIndent(fields, "", "    ")
+}
+
+func mergeObjects(base, update json.RawMessage) (json.RawMessage, error) {
+	var baseFields, updateFields map[string]json.RawMessage
+	if err := json.Unmarshal(base, &baseFields); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(update, &updateFields); err != nil {
+		return nil, err
+	}
+
+	for key, value := range updateFields {
+		baseFields[key] = value
+	}
+
+	return json.Marshal(baseFields)
+}
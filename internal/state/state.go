@@ -0,0 +1,98 @@
+// Package state persists data of the exporter, which should survive restarts, in a JSON file.
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/atomicfile"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+	"github.com/xperimental/flowercare-exporter/internal/updater"
+)
+
+// saveInterval is the interval between saves of the state while the exporter is running.
+const saveInterval = time.Minute
+
+// State contains the persisted data.
+type State struct {
+	// Sensors contains the reliability statistics and recent errors by MAC address.
+	Sensors map[string]updater.SensorStats `json:"sensors"`
+	// Readings contains the latest reading of every sensor by MAC address.
+	Readings map[string]driver.Reading `json:"readings,omitempty"`
+}
+
+// Load reads the state from a file. A missing file results in an empty state.
+func Load(fileName string) (State, error) {
+	result := State{
+		Sensors:  map[string]updater.SensorStats{},
+		Readings: map[string]driver.Reading{},
+	}
+
+	data, err := os.ReadFile(fileName)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return result, nil
+	case err != nil:
+		return result, err
+	}
+
+	if err := json.Unmarshal(data, &result); err != nil {
+		return result, fmt.Errorf("can not parse state: %s", err)
+	}
+
+	return result, nil
+}
+
+// Save writes the state to a file. The file is replaced atomically, so that it is not corrupted if the exporter
+// is stopped while writing.
+func Save(fileName string, state State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.Write(fileName, data, 0o600)
+}
+
+// Saver periodically saves the current state and saves it a last time when the exporter shuts down.
+type Saver struct {
+	Log      logrus.FieldLogger
+	FileName string
+	Current  func() State
+}
+
+// Start starts saving the state.
+func (s *Saver) Start(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(saveInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				s.save()
+				s.Log.Debug("Saved state on shutdown.")
+				return
+			case <-ticker.C:
+				s.save()
+			}
+		}
+	}()
+}
+
+func (s *Saver) save() {
+	if err := Save(s.FileName, s.Current()); err != nil {
+		s.Log.Errorf("Error saving state to %q: %s", s.FileName, err)
+	}
+}
@@ -0,0 +1,224 @@
+// Package status renders the landing page of the exporter, a table of all sensors with their latest values and read
+// statistics, which helps with debugging without a Prometheus server at hand.
+package status
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/anonymize"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+	"github.com/xperimental/flowercare-exporter/internal/updater"
+)
+
+// timeFormat is used for all times shown on the page.
+const timeFormat = "2006-01-02 15:04:05"
+
+// value is a column of the table showing a value of the readings.
+type value struct {
+	Field  string
+	Name   string
+	Unit   string
+	Format string
+}
+
+var values = []value{
+	{Field: "temperature", Name: "Temperature", Unit: "°C", Format: "%.1f"},
+	{Field: "moisture", Name: "Moisture", Unit: "%", Format: "%.0f"},
+	{Field: "light", Name: "Light", Unit: "lx", Format: "%.0f"},
+	{Field: "conductivity", Name: "Conductivity", Unit: "µS/cm", Format: "%.0f"},
+	{Field: "humidity", Name: "Humidity", Unit: "%", Format: "%.0f"},
+}
+
+// row contains the formatted information of a sensor.
+type row struct {
+	Name        string
+	MacAddress  string
+	Group       string
+	Values      []string
+	LastRead    string
+	LastSuccess string
+	Age         string
+	Stale       bool
+	Battery     string
+	Errors      int
+	LastError   string
+}
+
+type page struct {
+	Version string
+	Now     string
+	Columns []value
+	Rows    []row
+}
+
+var pageTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Flowercare Exporter</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #cccccc; padding: 0.3em 0.6em; text-align: right; }
+th { background: #eeeeee; }
+td.name { text-align: left; }
+tr.stale td { color: #999999; }
+td.error { color: #b00020; text-align: left; }
+.mac { font-family: monospace; font-size: smaller; }
+</style>
+</head>
+<body>
+<h1>Flowercare Exporter</h1>
+<p>Version {{ .Version }} &middot; {{ .Now }} &middot; <a href="/metrics">Metrics</a> &middot; <a href="/heatmap.svg">Heatmap</a></p>
+{{- if .Rows }}
+<table>
+<tr>
+<th>Sensor</th>
+{{- range .Columns }}
+<th>{{ .Name }}</th>
+{{- end }}
+<th>Battery</th>
+<th>Last reading</th>
+<th>Age</th>
+<th>Last successful read</th>
+<th>Errors</th>
+<th>Last error</th>
+</tr>
+{{- range .Rows }}
+<tr{{ if .Stale }} class="stale"{{ end }}>
+<td class="name">{{ .Name }}{{ if .Group }} ({{ .Group }}){{ end }}<br><span class="mac">{{ .MacAddress }}</span></td>
+{{- range .Values }}
+<td>{{ . }}</td>
+{{- end }}
+<td>{{ .Battery }}</td>
+<td>{{ .LastRead }}</td>
+<td>{{ .Age }}{{ if .Stale }} (stale){{ end }}</td>
+<td>{{ .LastSuccess }}</td>
+<td>{{ .Errors }}</td>
+<td class="error">{{ .LastError }}</td>
+</tr>
+{{- end }}
+</table>
+{{- else }}
+<p>No sensors configured.</p>
+{{- end }}
+</body>
+</html>
+`))
+
+// Handler serves the landing page.
+type Handler struct {
+	Log     logrus.FieldLogger
+	Version string
+	Sensors func() []config.Sensor
+	Source  func(macAddress string) (driver.Reading, error)
+	// Stats returns the read statistics of the sensors read by the exporter.
+	Stats func() map[string]updater.SensorStats
+	// StaleDuration is the age after which the values of a sensor are shown as stale.
+	StaleDuration time.Duration
+	// Location is the time zone used for showing times.
+	Location *time.Location
+	// Anonymizer replaces the names and MAC addresses of the sensors with pseudonyms if set.
+	Anonymizer *anonymize.Anonymizer
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// The handler is registered for "/", which matches all paths without a more specific handler.
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	var b bytes.Buffer
+	if err := pageTemplate.Execute(&b, h.page(time.Now())); err != nil {
+		h.Log.Errorf("Error rendering status page: %s", err)
+		http.Error(w, "can not render status page", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	if _, err := w.Write(b.Bytes()); err != nil {
+		h.Log.Debugf("Error writing status page: %s", err)
+	}
+}
+
+func (h *Handler) page(now time.Time) page {
+	stats := h.Stats()
+	result := page{
+		Version: h.Version,
+		Now:     h.formatTime(now),
+		Columns: values,
+	}
+
+	for _, s := range h.Sensors() {
+		st := stats[s.MacAddress]
+		r := row{
+			Name:       h.Anonymizer.Name(s.Name),
+			MacAddress: h.Anonymizer.MAC(s.MacAddress),
+			Group:      s.Group,
+			Errors:     st.Errors,
+		}
+		if len(st.History) > 0 {
+			last := st.History[len(st.History)-1]
+			r.LastError = fmt.Sprintf("%s: %s", h.formatTime(last.Time), h.Anonymizer.String(last.Error, []config.Sensor{s}))
+		}
+
+		data, err := h.Source(s.MacAddress)
+		if err != nil || data.Time.IsZero() {
+			r.Values = make([]string, len(values))
+			r.LastRead = "never"
+			r.LastSuccess = h.formatTime(st.LastSuccess)
+			result.Rows = append(result.Rows, r)
+			continue
+		}
+
+		for _, v := range values {
+			r.Values = append(r.Values, formatValue(*data.Field(v.Field), v.Format, v.Unit))
+		}
+		r.Battery = formatValue(data.Battery, "%.0f", "%")
+		if data.Battery == nil {
+			r.Battery = formatValue(data.BatteryVoltage, "%.2f", "V")
+		}
+
+		age := now.Sub(data.Time)
+		r.LastRead = h.formatTime(data.Time)
+		r.Age = age.Truncate(time.Second).String()
+		r.Stale = age >= h.StaleDuration
+
+		// Sensors received from advertisements or edge exporters are not read by the exporter, so their last
+		// successful read is the time of the latest reading.
+		r.LastSuccess = h.formatTime(st.LastSuccess)
+		if st.LastSuccess.IsZero() {
+			r.LastSuccess = r.LastRead
+		}
+
+		result.Rows = append(result.Rows, r)
+	}
+
+	return result
+}
+
+func (h *Handler) formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+
+	return t.In(h.Location).Format(timeFormat)
+}
+
+func formatValue(v *float64, format, unit string) string {
+	if v == nil {
+		return ""
+	}
+
+	return fmt.Sprintf(format+" %s", *v, unit)
+}
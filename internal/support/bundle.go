@@ -0,0 +1,118 @@
+package support
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/xperimental/flowercare-exporter/internal/adapter"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/updater"
+)
+
+// Version contains information about the build of the exporter.
+type Version struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"goVersion"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+}
+
+// NewVersion returns the version information including the runtime.
+func NewVersion(version, commit, date string) Version {
+	return Version{
+		Version:   version,
+		Commit:    commit,
+		Date:      date,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+	}
+}
+
+// Report contains the state of a running exporter.
+type Report struct {
+	Time    time.Time             `json:"time"`
+	Version Version               `json:"version"`
+	Config  config.Config         `json:"config"`
+	Adapter adapter.Adapter       `json:"adapter"`
+	Errors  []updater.SensorError `json:"errors"`
+	Logs    []string              `json:"logs"`
+}
+
+// Bundle contains everything written to the support archive.
+type Bundle struct {
+	Version  Version
+	Adapters []adapter.Adapter
+	// Report is nil if the running exporter could not be reached.
+	Report *Report
+	// Notes contains problems which happened while collecting the information.
+	Notes []string
+}
+
+// archiveFile is a file in the archive. String content is written as is, everything else is encoded as JSON.
+type archiveFile struct {
+	Name    string
+	Content interface{}
+}
+
+// WriteArchive writes the bundle as a gzip-compressed tar archive.
+func (b Bundle) WriteArchive(w io.Writer, now time.Time) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	files := []archiveFile{
+		{Name: "version.json", Content: b.Version},
+		{Name: "adapters.json", Content: b.Adapters},
+	}
+	if b.Report != nil {
+		files = append(files,
+			archiveFile{Name: "exporter/version.json", Content: b.Report.Version},
+			archiveFile{Name: "exporter/config.json", Content: b.Report.Config},
+			archiveFile{Name: "exporter/adapter.json", Content: b.Report.Adapter},
+			archiveFile{Name: "exporter/errors.json", Content: b.Report.Errors},
+			archiveFile{Name: "exporter/logs.txt", Content: strings.Join(b.Report.Logs, "\n") + "\n"},
+		)
+	}
+	if len(b.Notes) > 0 {
+		files = append(files, archiveFile{Name: "notes.txt", Content: strings.Join(b.Notes, "\n") + "\n"})
+	}
+
+	for _, f := range files {
+		var content []byte
+		if text, ok := f.Content.(string); ok {
+			content = []byte(text)
+		} else {
+			var err error
+			content, err = json.MarshalIndent(f.Content, "", "  ")
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    "flowercare-bundle/" + f.Name,
+			Mode:    0o644,
+			Size:    int64(len(content)),
+			ModTime: now,
+		}); err != nil {
+			return err
+		}
+
+		if _, err := tw.Write(content); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
@@ -0,0 +1,271 @@
+// Package trend detects the gradual degradation of sensors from the values of several weeks.
+package trend
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+// Reasons for suggesting the maintenance of a sensor.
+const (
+	// ReasonConductivityDrift is a conductivity declining towards zero, usually caused by corroded electrodes.
+	ReasonConductivityDrift = "conductivity_drift"
+	// ReasonLightDimming is a declining light level, usually caused by dirt on the light sensor.
+	ReasonLightDimming = "light_dimming"
+)
+
+// Reasons contains all reasons for suggesting the maintenance of a sensor.
+var Reasons = []string{
+	ReasonConductivityDrift,
+	ReasonLightDimming,
+}
+
+const (
+	// minDays is the number of days with values needed for detecting a trend.
+	minDays = 14
+	// minFit is the minimum coefficient of determination of the fitted line. Sudden changes, like repotting the
+	// plant or moving the sensor, do not fit a line well and are not reported as degradation.
+	minFit = 0.6
+	// seasonalDecline is the decline of the light level in percent per week, which is attributed to the season
+	// if there are no other sensors in the group to compare with.
+	seasonalDecline = 5
+)
+
+// day contains the values of a sensor during one day.
+type day struct {
+	// Date is the midnight starting the day.
+	Date              time.Time
+	ConductivitySum   float64
+	ConductivityCount int
+	MoistureSum       float64
+	MoistureCount     int
+	// LightPeak is the highest light level of the day. Dirt reduces the peak, while the number of readings with
+	// light depends on the weather.
+	LightPeak  float64
+	LightCount int
+}
+
+type history struct {
+	Group string
+	Days  []day
+}
+
+// fit is a line fitted through daily values.
+type fit struct {
+	// PercentPerWeek is the change of the value per week relative to its mean.
+	PercentPerWeek float64
+	// R2 is the coefficient of determination of the line.
+	R2 float64
+}
+
+// Analyzer keeps daily values of every sensor and checks them for trends which are caused by a degrading sensor
+// instead of changes of the plant or its surroundings.
+type Analyzer struct {
+	window   time.Duration
+	location *time.Location
+
+	lock    sync.Mutex
+	sensors map[string]*history
+}
+
+// New creates an Analyzer using the daily values of the window. Days start at midnight in the location.
+func New(window time.Duration, location *time.Location) *Analyzer {
+	return &Analyzer{
+		window:   window,
+		location: location,
+		sensors:  map[string]*history{},
+	}
+}
+
+// Observe records the values of a reading. It can be used as an updater.Listener.
+func (a *Analyzer) Observe(sensor config.Sensor, reading driver.Reading) {
+	if reading.Conductivity == nil && reading.Moisture == nil && reading.Light == nil {
+		return
+	}
+
+	now := reading.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	key := strings.ToUpper(sensor.MacAddress)
+	date := a.midnight(now)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	h, ok := a.sensors[key]
+	if !ok {
+		h = &history{}
+		a.sensors[key] = h
+	}
+	h.Group = sensor.Group
+
+	if len(h.Days) == 0 || h.Days[len(h.Days)-1].Date.Before(date) {
+		h.Days = append(h.Days, day{
+			Date: date,
+		})
+	}
+	d := &h.Days[len(h.Days)-1]
+	if !d.Date.Equal(date) {
+		// Readings with an older timestamp than the current day are ignored.
+		return
+	}
+
+	if reading.Conductivity != nil {
+		d.ConductivitySum += *reading.Conductivity
+		d.ConductivityCount++
+	}
+	if reading.Moisture != nil {
+		d.MoistureSum += *reading.Moisture
+		d.MoistureCount++
+	}
+	if reading.Light != nil {
+		d.LightPeak = math.Max(d.LightPeak, *reading.Light)
+		d.LightCount++
+	}
+
+	start := 0
+	for start < len(h.Days) && now.Sub(h.Days[start].Date) > a.window {
+		start++
+	}
+	h.Days = h.Days[start:]
+}
+
+// Degradation returns the decline in percent per week of the values of the sensor, which is attributed to the
+// degradation of the sensor, by reason. Declines explained by changes of the plant or its surroundings are
+// returned as zero. It returns false if the values do not cover enough days yet.
+func (a *Analyzer) Degradation(macAddress string) (map[string]float64, bool) {
+	key := strings.ToUpper(macAddress)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	h, ok := a.sensors[key]
+	if !ok || len(h.Days) < minDays {
+		return nil, false
+	}
+
+	return map[string]float64{
+		ReasonConductivityDrift: conductivityDrift(h.Days),
+		ReasonLightDimming:      a.lightDimming(key, h),
+	}, true
+}
+
+// conductivityDrift returns the decline of the conductivity. The conductivity depends on the moisture of the soil,
+// so a decline is only attributed to the sensor if the moisture does not decline as well.
+func conductivityDrift(days []day) float64 {
+	conductivity, ok := fitDays(days, func(d day) (float64, bool) {
+		return d.ConductivitySum / float64(d.ConductivityCount), d.ConductivityCount > 0
+	})
+	if !ok || conductivity.PercentPerWeek >= 0 || conductivity.R2 < minFit {
+		return 0
+	}
+
+	moisture, ok := fitDays(days, func(d day) (float64, bool) {
+		return d.MoistureSum / float64(d.MoistureCount), d.MoistureCount > 0
+	})
+	if ok && moisture.PercentPerWeek <= conductivity.PercentPerWeek/2 {
+		return 0
+	}
+
+	return -conductivity.PercentPerWeek
+}
+
+// lightDimming returns the decline of the daily peak light level. Other sensors in the same group see the same
+// light, so the decline is only attributed to the sensor if their light level does not decline as well. Needs to
+// be called with the lock held.
+func (a *Analyzer) lightDimming(key string, h *history) float64 {
+	light, ok := fitDays(h.Days, lightPeak)
+	if !ok || light.PercentPerWeek >= 0 || light.R2 < minFit {
+		return 0
+	}
+
+	var peerSum float64
+	var peers int
+	for k, other := range a.sensors {
+		if k == key || h.Group == "" || other.Group != h.Group || len(other.Days) < minDays {
+			continue
+		}
+
+		if f, ok := fitDays(other.Days, lightPeak); ok {
+			peerSum += f.PercentPerWeek
+			peers++
+		}
+	}
+
+	switch {
+	case peers > 0 && peerSum/float64(peers) <= light.PercentPerWeek/2:
+		return 0
+	case peers == 0 && light.PercentPerWeek > -seasonalDecline:
+		return 0
+	}
+
+	return -light.PercentPerWeek
+}
+
+func lightPeak(d day) (float64, bool) {
+	return d.LightPeak, d.LightCount > 0
+}
+
+// fitDays fits a line through the daily values using least squares. It returns false if there are not enough
+// values or the mean of the values is not positive.
+func fitDays(days []day, value func(d day) (float64, bool)) (fit, bool) {
+	var xs, ys []float64
+	for _, d := range days {
+		y, ok := value(d)
+		if !ok {
+			continue
+		}
+
+		xs = append(xs, d.Date.Sub(days[0].Date).Hours()/24)
+		ys = append(ys, y)
+	}
+
+	if len(ys) < minDays {
+		return fit{}, false
+	}
+
+	n := float64(len(ys))
+	var sumX, sumY, sumXY, sumXX float64
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+		sumXY += xs[i] * ys[i]
+		sumXX += xs[i] * xs[i]
+	}
+
+	denominator := n*sumXX - sumX*sumX
+	mean := sumY / n
+	if denominator == 0 || mean <= 0 {
+		return fit{}, false
+	}
+
+	slope := (n*sumXY - sumX*sumY) / denominator
+	intercept := (sumY - slope*sumX) / n
+
+	var residual, total float64
+	for i := range xs {
+		residual += math.Pow(ys[i]-(intercept+slope*xs[i]), 2)
+		total += math.Pow(ys[i]-mean, 2)
+	}
+
+	r2 := 0.0
+	if total > 0 {
+		r2 = 1 - residual/total
+	}
+
+	return fit{
+		PercentPerWeek: slope * 7 / mean * 100,
+		R2:             r2,
+	}, true
+}
+
+func (a *Analyzer) midnight(t time.Time) time.Time {
+	t = t.In(a.location)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, a.location)
+}
@@ -4,30 +4,78 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand"
+	"runtime/debug"
 	"sort"
 	"sync"
 	"time"
 
 	"github.com/go-ble/ble"
-	"github.com/go-ble/ble/linux"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/adapter"
+	"github.com/xperimental/flowercare-exporter/internal/anonymize"
+	"github.com/xperimental/flowercare-exporter/internal/backend"
 	"github.com/xperimental/flowercare-exporter/internal/config"
-	"github.com/xperimental/flowercare-exporter/pkg/miflora"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+	"github.com/xperimental/flowercare-exporter/internal/logsample"
+	"github.com/xperimental/flowercare-exporter/internal/pipeline"
 )
 
 var (
 	updaterTickDuration = 10 * time.Second
 )
 
+// historyTimeout is the time allowed for downloading the history of a sensor. Reading every entry needs a
+// separate request to the sensor, so this takes much longer than reading the current values.
+const historyTimeout = 5 * time.Minute
+
+// maxErrorHistory is the number of errors kept per sensor.
+const maxErrorHistory = 20
+
 type data struct {
 	Info config.Sensor
-	Data *miflora.Data
+	Data *driver.Reading
+	// Remote is set for sensors whose data is provided using Store instead of being read locally.
+	Remote bool
+	Stats  SensorStats
+	// SlowRead is the time the slow parts of the data have last been read.
+	SlowRead time.Time
+}
+
+// SensorError contains an error which happened while reading a sensor.
+type SensorError struct {
+	Sensor config.Sensor `json:"sensor"`
+	Time   time.Time     `json:"time"`
+	Error  string        `json:"error"`
+}
+
+// SensorStats contains the reliability statistics and recent errors of a sensor read by this exporter.
+// They can be persisted using Stats and Restore to keep them across restarts.
+type SensorStats struct {
+	Reads             int       `json:"reads"`
+	Errors            int       `json:"errors"`
+	ConsecutiveErrors int       `json:"consecutiveErrors"`
+	LastSuccess       time.Time `json:"lastSuccess"`
+	// History contains the most recent errors, oldest first.
+	History []SensorError `json:"history"`
 }
 
 type queueItem struct {
 	Sensor    config.Sensor
 	Time      time.Time
 	LastRetry time.Duration
+	// Parts restricts the read to the parts of the data which failed previously. Empty reads all parts.
+	Parts []string
+}
+
+// ScheduledRead is a read of a sensor waiting in the queue. It can be passed to another exporter using Schedule and
+// RestoreSchedule.
+type ScheduledRead struct {
+	Time time.Time `json:"time"`
+	// LastRetry is the delay before the read if it is a retry.
+	LastRetry time.Duration `json:"lastRetry,omitempty"`
+	Parts     []string      `json:"parts,omitempty"`
 }
 
 // Updater can be used to get data from a set of Miflora sensors and cache that data temporarily.
@@ -36,101 +84,760 @@ type Updater struct {
 	refreshTimeout time.Duration
 	retryConfig    config.RetryConfig
 
-	deviceName string
-	device     ble.Device
+	backend backend.Backend
 
 	queueLock sync.RWMutex
 	queue     map[string]queueItem
+	// inFlight contains the sensors which are currently being read, so that they are not read twice at once.
+	inFlight map[string]bool
+	// maxConcurrent is the maximum number of sensors read at the same time.
+	maxConcurrent int
+	// spread is the time the reads of UpdateAll are spread across. Zero reads all sensors at once.
+	spread time.Duration
+	// jitter is the maximum random delay added to the reads of UpdateAll.
+	jitter time.Duration
+	random *rand.Rand
 
 	dataLock sync.RWMutex
 	dataMap  map[string]*data
+
+	listenersLock    sync.RWMutex
+	listeners        []Listener
+	errorListeners   []ErrorListener
+	connectListeners []ConnectListener
+
+	pipeline *pipeline.Pipeline
+	// anonymizer replaces the MAC addresses and names in the labels of the metrics, if set.
+	anonymizer *anonymize.Anonymizer
+	// slowInterval is the interval in which the slow parts of the data are read. Zero reads them with every read.
+	slowInterval time.Duration
+
+	// restored contains the statistics of sensors which have not been added yet.
+	restored map[string]SensorStats
+	// restoredReadings contains the latest readings of sensors which have not been added yet.
+	restoredReadings map[string]driver.Reading
+
+	errorLog          *logsample.Sampler
+	partialReads      *prometheus.CounterVec
+	readErrors        *prometheus.CounterVec
+	reads             *prometheus.CounterVec
+	consecutiveErrors *prometheus.GaugeVec
+	panics            *prometheus.CounterVec
+	connectAttempts   *prometheus.CounterVec
+	connectFailures   *prometheus.CounterVec
+	connectTimeouts   *prometheus.CounterVec
 }
 
-// New creates a new Updater using the specified Bluetooth device.
-func New(log logrus.FieldLogger, deviceName string, refreshTimeout time.Duration, retryConfig config.RetryConfig) (*Updater, error) {
-	device, err := linux.NewDeviceWithName(deviceName)
-	if err != nil {
-		return nil, err
-	}
+// Listener is called after new data has been read from a sensor.
+type Listener func(sensor config.Sensor, data driver.Reading)
+
+// ErrorListener is called after reading a sensor failed.
+type ErrorListener func(sensor config.Sensor, err error)
+
+// ConnectListener is called after every attempt to read a sensor by connecting to it. The duration covers the
+// whole attempt. Connected is false if no connection could be established.
+type ConnectListener func(sensor config.Sensor, duration time.Duration, connected bool)
 
+// New creates a new Updater using the specified backend for Bluetooth operations. If backend is nil,
+// the updater can only be fed using Store. Identical read errors are only logged once per errorLogWindow.
+func New(log logrus.FieldLogger, backend backend.Backend, refreshTimeout time.Duration, retryConfig config.RetryConfig, errorLogWindow time.Duration) *Updater {
 	return &Updater{
-		log:            log,
-		refreshTimeout: refreshTimeout,
-		retryConfig:    retryConfig,
-		deviceName:     deviceName,
-		device:         device,
-		queue:          map[string]queueItem{},
-		dataMap:        map[string]*data{},
-	}, nil
+		log:              log,
+		refreshTimeout:   refreshTimeout,
+		retryConfig:      retryConfig,
+		backend:          backend,
+		queue:            map[string]queueItem{},
+		inFlight:         map[string]bool{},
+		maxConcurrent:    1,
+		random:           rand.New(rand.NewSource(time.Now().UnixNano())),
+		dataMap:          map[string]*data{},
+		restored:         map[string]SensorStats{},
+		restoredReadings: map[string]driver.Reading{},
+		errorLog:         logsample.New(log, errorLogWindow),
+		readErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "flowercare_read_errors_total",
+			Help: "Number of failed reads, including partial reads.",
+		}, []string{"macaddress", "name"}),
+		reads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "flowercare_reads_total",
+			Help: "Number of attempted reads, including failed reads.",
+		}, []string{"macaddress", "name"}),
+		consecutiveErrors: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "flowercare_consecutive_read_errors",
+			Help: "Number of failed reads since the last successful read.",
+		}, []string{"macaddress", "name"}),
+		partialReads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "flowercare_partial_reads_total",
+			Help: "Number of reads where only some parts of the data could be read, by failed part.",
+		}, []string{"macaddress", "name", "part"}),
+		panics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "flowercare_collector_panics_total",
+			Help: "Number of panics recovered while collecting the data of a sensor.",
+		}, []string{"macaddress", "name"}),
+		connectAttempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "flowercare_connect_attempts_total",
+			Help: "Number of attempts to connect to the sensor.",
+		}, []string{"macaddress", "name"}),
+		connectFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "flowercare_connect_failures_total",
+			Help: "Number of attempts where no connection to the sensor could be established, excluding timeouts.",
+		}, []string{"macaddress", "name"}),
+		connectTimeouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "flowercare_connect_timeouts_total",
+			Help: "Number of attempts where the sensor did not respond within the refresh timeout.",
+		}, []string{"macaddress", "name"}),
+	}
+}
+
+// Adapter returns the Bluetooth adapter used by the updater.
+func (u *Updater) Adapter() adapter.Adapter {
+	if u.backend == nil {
+		return adapter.Adapter{}
+	}
+
+	return u.backend.Adapter()
 }
 
-// AddSensor adds a sensor to the updater.
+// Scan passes all advertisements received until the context is done to the handler.
+func (u *Updater) Scan(ctx context.Context, handler ble.AdvHandler) error {
+	if u.backend == nil {
+		return errors.New("no bluetooth device available")
+	}
+
+	return u.backend.Scan(ctx, handler)
+}
+
+// Describe implements prometheus.Collector
+func (u *Updater) Describe(ch chan<- *prometheus.Desc) {
+	u.partialReads.Describe(ch)
+	u.readErrors.Describe(ch)
+	u.reads.Describe(ch)
+	u.consecutiveErrors.Describe(ch)
+	u.panics.Describe(ch)
+	u.connectAttempts.Describe(ch)
+	u.connectFailures.Describe(ch)
+	u.connectTimeouts.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (u *Updater) Collect(ch chan<- prometheus.Metric) {
+	u.partialReads.Collect(ch)
+	u.readErrors.Collect(ch)
+	u.reads.Collect(ch)
+	u.consecutiveErrors.Collect(ch)
+	u.panics.Collect(ch)
+	u.connectAttempts.Collect(ch)
+	u.connectFailures.Collect(ch)
+	u.connectTimeouts.Collect(ch)
+}
+
+// AddSensor adds a sensor to the updater. If the sensor is already registered, its configuration is replaced
+// and the data read so far is kept.
 func (u *Updater) AddSensor(sensor config.Sensor) {
 	u.dataLock.Lock()
 	defer u.dataLock.Unlock()
 
+	if d, ok := u.dataMap[sensor.MacAddress]; ok {
+		u.log.Debugf("Updating sensor %q", sensor)
+		if d.Info.Name != sensor.Name {
+			// The series using the old name would be exported next to the new ones otherwise.
+			u.deleteSeries(d.Info)
+		}
+		d.Info = sensor
+		d.Remote = false
+
+		u.queueLock.Lock()
+		if item, ok := u.queue[sensor.MacAddress]; ok {
+			item.Sensor = sensor
+			u.queue[sensor.MacAddress] = item
+		}
+		u.queueLock.Unlock()
+		return
+	}
+
 	u.log.Debugf("Adding sensor %q", sensor)
-	u.dataMap[sensor.MacAddress] = &data{
+	d := &data{
 		Info: sensor,
 	}
+	if stats, ok := u.restored[sensor.MacAddress]; ok {
+		delete(u.restored, sensor.MacAddress)
+		d.Stats = stats
+		u.reads.WithLabelValues(u.labels(sensor)...).Add(float64(stats.Reads))
+		u.readErrors.WithLabelValues(u.labels(sensor)...).Add(float64(stats.Errors))
+		u.consecutiveErrors.WithLabelValues(u.labels(sensor)...).Set(float64(stats.ConsecutiveErrors))
+	}
+	d.Data = u.takeRestoredReading(sensor.MacAddress)
+	u.dataMap[sensor.MacAddress] = d
+}
+
+// Restore sets the statistics of sensors, for example after a restart. It needs to be called before the sensors
+// are added.
+func (u *Updater) Restore(stats map[string]SensorStats) {
+	u.dataLock.Lock()
+	defer u.dataLock.Unlock()
+
+	for macAddress, s := range stats {
+		u.restored[macAddress] = s
+	}
+}
+
+// RestoreReadings sets the latest readings of sensors, for example after a restart, so that they can be used until
+// the sensors have been read again. It needs to be called before the sensors are added.
+func (u *Updater) RestoreReadings(readings map[string]driver.Reading) {
+	u.dataLock.Lock()
+	defer u.dataLock.Unlock()
+
+	for macAddress, r := range readings {
+		u.restoredReadings[macAddress] = r
+	}
+}
+
+// Readings returns the latest readings of all sensors.
+func (u *Updater) Readings() map[string]driver.Reading {
+	u.dataLock.RLock()
+	defer u.dataLock.RUnlock()
+
+	result := map[string]driver.Reading{}
+	for macAddress, d := range u.dataMap {
+		if d.Data != nil {
+			result[macAddress] = *d.Data
+		}
+	}
+
+	return result
+}
+
+// takeRestoredReading returns the restored reading of a sensor which is added and forgets it. It returns nil if
+// there is none. The caller needs to hold dataLock.
+func (u *Updater) takeRestoredReading(macAddress string) *driver.Reading {
+	r, ok := u.restoredReadings[macAddress]
+	if !ok {
+		return nil
+	}
+
+	delete(u.restoredReadings, macAddress)
+	return &r
+}
+
+// Schedule returns the reads waiting in the queue by MAC address.
+func (u *Updater) Schedule() map[string]ScheduledRead {
+	u.queueLock.RLock()
+	defer u.queueLock.RUnlock()
+
+	result := make(map[string]ScheduledRead, len(u.queue))
+	for macAddress, item := range u.queue {
+		result[macAddress] = ScheduledRead{
+			Time:      item.Time,
+			LastRetry: item.LastRetry,
+			Parts:     item.Parts,
+		}
+	}
+
+	return result
+}
+
+// RestoreSchedule queues the reads waiting in the queue of another exporter, so that the sensors are read when they
+// would have been read by it. Reads of sensors which are not read locally are ignored. It needs to be called after
+// the sensors are added.
+func (u *Updater) RestoreSchedule(schedule map[string]ScheduledRead) {
+	sensors := u.getLocalSensors()
+
+	u.queueLock.Lock()
+	defer u.queueLock.Unlock()
+
+	for _, s := range sensors {
+		read, ok := schedule[s.MacAddress]
+		if !ok {
+			continue
+		}
+
+		u.queue[s.MacAddress] = queueItem{
+			Sensor:    s,
+			Time:      read.Time,
+			LastRetry: read.LastRetry,
+			Parts:     read.Parts,
+		}
+	}
+}
+
+// Stats returns the statistics of all sensors which have been read by this exporter.
+func (u *Updater) Stats() map[string]SensorStats {
+	u.dataLock.RLock()
+	defer u.dataLock.RUnlock()
+
+	result := map[string]SensorStats{}
+	for macAddress, d := range u.dataMap {
+		if d.Stats.Reads == 0 {
+			continue
+		}
+
+		stats := d.Stats
+		stats.History = append([]SensorError{}, d.Stats.History...)
+		result[macAddress] = stats
+	}
+
+	return result
+}
+
+// RemoveSensor removes a sensor from the updater. It returns false if the sensor was not registered.
+func (u *Updater) RemoveSensor(macAddress string) bool {
+	u.dataLock.Lock()
+	d, ok := u.dataMap[macAddress]
+	delete(u.dataMap, macAddress)
+	u.dataLock.Unlock()
+
+	u.queueLock.Lock()
+	delete(u.queue, macAddress)
+	u.queueLock.Unlock()
+
+	if ok {
+		u.deleteSeries(d.Info)
+		u.log.Debugf("Removed sensor %q", macAddress)
+	}
+
+	return ok
+}
+
+// Refresh schedules an immediate update of a sensor which is read locally.
+func (u *Updater) Refresh(macAddress string) error {
+	u.dataLock.RLock()
+	d, ok := u.dataMap[macAddress]
+	u.dataLock.RUnlock()
+
+	switch {
+	case !ok:
+		return fmt.Errorf("no sensor with MAC address registered: %s", macAddress)
+	case d.Remote || d.Info.Passive():
+		return fmt.Errorf("sensor is not read by this exporter: %s", macAddress)
+	}
+
+	u.scheduleUpdate(d.Info)
+	return nil
+}
+
+// Probe reads a sensor on demand, independent of the schedule of the regular reads. Sensors which have not been
+// added are read using the default driver and named after their MAC address. The reading is processed by the pipeline, but not stored.
+func (u *Updater) Probe(ctx context.Context, macAddress string) (config.Sensor, driver.Reading, error) {
+	u.dataLock.RLock()
+	d, ok := u.dataMap[macAddress]
+	u.dataLock.RUnlock()
+
+	sensor := config.Sensor{
+		Name:       macAddress,
+		MacAddress: macAddress,
+	}
+	if ok {
+		sensor = d.Info
+	}
+
+	switch {
+	case ok && (d.Remote || d.Info.Passive()):
+		return sensor, driver.Reading{}, fmt.Errorf("sensor is not read by this exporter: %s", macAddress)
+	case u.backend == nil:
+		return sensor, driver.Reading{}, errors.New("no bluetooth device available")
+	}
+
+	data, err := u.backend.Read(ctx, sensor, sensor.DriverOptions())
+	u.recordConnect(ctx, sensor, err)
+
+	var partial *driver.PartialError
+	if err != nil && !errors.As(err, &partial) {
+		return sensor, driver.Reading{}, fmt.Errorf("can not read data: %s", err)
+	}
+
+	if u.pipeline != nil {
+		processed, ok := u.pipeline.Process(sensor, data)
+		if !ok {
+			return sensor, driver.Reading{}, errors.New("reading was dropped by the pipeline")
+		}
+		data = processed
+	}
+
+	return sensor, data, nil
+}
+
+// History reads at most limit of the values stored on a sensor which is read locally. All values are read if limit
+// is zero. The values are returned as stored on the sensor, without running them through the pipeline.
+func (u *Updater) History(ctx context.Context, macAddress string, limit int) ([]driver.Reading, error) {
+	u.dataLock.RLock()
+	d, ok := u.dataMap[macAddress]
+	u.dataLock.RUnlock()
+
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("no sensor with MAC address registered: %s", macAddress)
+	case d.Remote || d.Info.Passive():
+		return nil, fmt.Errorf("sensor is not read by this exporter: %s", macAddress)
+	case u.backend == nil:
+		return nil, errors.New("no bluetooth device available")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, historyTimeout)
+	defer cancel()
+
+	return u.backend.History(ctx, d.Info, limit)
+}
+
+// SetPipeline sets the pipeline processing the readings of sensors read by the updater. Without a pipeline
+// the readings are used unchanged. It needs to be called before Start.
+func (u *Updater) SetPipeline(p *pipeline.Pipeline) {
+	u.pipeline = p
+}
+
+// SetAnonymizer sets the anonymizer used for the labels of the metrics. It needs to be called before Start and
+// before the statistics are restored.
+func (u *Updater) SetAnonymizer(a *anonymize.Anonymizer) {
+	u.anonymizer = a
+}
+
+// labels returns the label values identifying the sensor in the metrics.
+func (u *Updater) labels(sensor config.Sensor) []string {
+	s := u.anonymizer.Sensor(sensor)
+	return []string{s.MacAddress, s.Name}
+}
+
+// deleteSeries removes the series of the sensor from the metrics.
+func (u *Updater) deleteSeries(sensor config.Sensor) {
+	labels := prometheus.Labels{"macaddress": u.labels(sensor)[0]}
+	for _, vec := range []interface {
+		DeletePartialMatch(labels prometheus.Labels) int
+	}{
+		u.partialReads,
+		u.readErrors,
+		u.reads,
+		u.consecutiveErrors,
+		u.panics,
+		u.connectAttempts,
+		u.connectFailures,
+		u.connectTimeouts,
+	} {
+		vec.DeletePartialMatch(labels)
+	}
+}
+
+// SetSlowInterval sets the interval in which the parts of the data changing slowly, like the firmware version and
+// the battery level, are read. They are read with every read if the interval is zero.
+func (u *Updater) SetSlowInterval(interval time.Duration) {
+	u.slowInterval = interval
+}
+
+// SetMaxConcurrentReads sets the maximum number of sensors read at the same time. It needs to be called before Start.
+// Reads using the same adapter still wait for each other in the backend.
+func (u *Updater) SetMaxConcurrentReads(n int) {
+	if n < 1 {
+		n = 1
+	}
+	u.maxConcurrent = n
+}
+
+// SetSpread sets the time the reads of UpdateAll are spread across and the maximum random delay added to every read,
+// so that not all sensors are connected to at the same time. It needs to be called before Start.
+func (u *Updater) SetSpread(spread, jitter time.Duration) {
+	u.spread = spread
+	u.jitter = jitter
+}
+
+// AddListener registers a function which is called every time new data has been read from a sensor.
+func (u *Updater) AddListener(l Listener) {
+	u.listenersLock.Lock()
+	defer u.listenersLock.Unlock()
+
+	u.listeners = append(u.listeners, l)
+}
+
+// AddErrorListener registers a function which is called every time reading a sensor failed.
+func (u *Updater) AddErrorListener(l ErrorListener) {
+	u.listenersLock.Lock()
+	defer u.listenersLock.Unlock()
+
+	u.errorListeners = append(u.errorListeners, l)
+}
+
+// AddConnectListener registers a function which is called after every attempt to read a sensor by connecting to it.
+func (u *Updater) AddConnectListener(l ConnectListener) {
+	u.listenersLock.Lock()
+	defer u.listenersLock.Unlock()
+
+	u.connectListeners = append(u.connectListeners, l)
+}
+
+// Sensors returns the currently registered sensors sorted by MAC address.
+func (u *Updater) Sensors() []config.Sensor {
+	sensors := u.getSensors()
+	sort.Slice(sensors, func(i, j int) bool {
+		return sensors[i].MacAddress < sensors[j].MacAddress
+	})
+
+	return sensors
+}
+
+// ConfiguredSensors returns the sensors which have been added to the updater, leaving out the sensors only known
+// from data provided using Store.
+func (u *Updater) ConfiguredSensors() []config.Sensor {
+	u.dataLock.RLock()
+	defer u.dataLock.RUnlock()
+
+	result := []config.Sensor{}
+	for _, d := range u.dataMap {
+		if d.Remote {
+			continue
+		}
+
+		result = append(result, d.Info)
+	}
+
+	return result
+}
+
+// Store sets the data of a sensor, which has been read by other means, for example from advertisements or by an
+// edge exporter. Values missing from the new data are kept from the previous data.
+// The sensor is registered with the updater if it is not known yet. A panic while processing the data is recorded as
+// error of the sensor.
+func (u *Updater) Store(sensor config.Sensor, sensorData driver.Reading) {
+	if err := u.store(sensor, sensorData); err != nil {
+		u.recordError(sensor, err, time.Now())
+	}
+}
+
+func (u *Updater) store(sensor config.Sensor, sensorData driver.Reading) (err error) {
+	defer u.recoverPanic(sensor, &err)
+
+	sensorData = u.setData(sensor, sensorData)
+	u.notifyListeners(sensor, sensorData)
+	return nil
+}
+
+// setData saves the data of a remote sensor and returns it merged with the previous data.
+func (u *Updater) setData(sensor config.Sensor, sensorData driver.Reading) driver.Reading {
+	u.dataLock.Lock()
+	defer u.dataLock.Unlock()
+
+	d, ok := u.dataMap[sensor.MacAddress]
+	if !ok {
+		u.log.Debugf("Adding sensor %q", sensor)
+		d = &data{
+			Remote: true,
+			Data:   u.takeRestoredReading(sensor.MacAddress),
+		}
+		u.dataMap[sensor.MacAddress] = d
+	}
+	if d.Data != nil {
+		sensorData = sensorData.Merge(*d.Data)
+	}
+	d.Info = sensor
+	d.Data = &sensorData
+	return sensorData
 }
 
 // GetData returns the latest data available for the sensor identified by its MAC address.
-func (u *Updater) GetData(macAddress string) (miflora.Data, error) {
+func (u *Updater) GetData(macAddress string) (driver.Reading, error) {
 	u.dataLock.RLock()
 	defer u.dataLock.RUnlock()
 
 	d, ok := u.dataMap[macAddress]
 	if !ok {
-		return miflora.Data{}, fmt.Errorf("no sensor with MAC address registered: %s", macAddress)
+		return driver.Reading{}, fmt.Errorf("no sensor with MAC address registered: %s", macAddress)
 	}
 
 	if d.Data == nil {
-		return miflora.Data{}, errors.New("no data available")
+		return driver.Reading{}, errors.New("no data available")
 	}
 
 	return *d.Data, nil
 }
 
-// Start starts the updater queue. It will periodically check if it needs to update data of one or more sensors.
+// Start starts the updater queue. It will periodically check if it needs to update data of one or more sensors. Up
+// to the maximum number of concurrent reads are started at once.
 func (u *Updater) Start(ctx context.Context, wg *sync.WaitGroup) {
 	wg.Add(1)
 
 	go func() {
 		defer wg.Done()
 
+		slots := make(chan struct{}, u.maxConcurrent)
+		reads := &sync.WaitGroup{}
+		defer reads.Wait()
+
 		ticker := time.NewTicker(updaterTickDuration)
+		defer ticker.Stop()
 		for {
 			select {
 			case <-ctx.Done():
 				u.log.Debug("Shutting down updater.")
 				return
 			case now := <-ticker.C:
-				next, ok := u.getNextQueueItem(now)
-				if !ok {
-					continue
-				}
-				u.log.Debugf("Queue item: %#v", next)
-
-				err := u.updateSensor(ctx, next.Sensor)
-				if err != nil {
-					u.log.Errorf("Error updating sensor %q: %s", next, err)
-					u.retryItem(next, now)
-				}
+				u.errorLog.Flush(now)
+				u.dispatch(ctx, now, slots, reads)
 			}
 		}
 	}()
 }
 
-// UpdateAll schedules an update for all registered sensors.
+// dispatch starts the reads which are due, as long as a slot for a concurrent read is free.
+func (u *Updater) dispatch(ctx context.Context, now time.Time, slots chan struct{}, reads *sync.WaitGroup) {
+	for {
+		select {
+		case slots <- struct{}{}:
+		default:
+			return
+		}
+
+		next, ok := u.getNextQueueItem(now)
+		if !ok {
+			<-slots
+			return
+		}
+		u.log.Debugf("Queue item: %#v", next)
+
+		reads.Add(1)
+		go func() {
+			defer reads.Done()
+			defer func() { <-slots }()
+
+			u.read(ctx, next, now)
+		}()
+	}
+}
+
+// read collects the sensor of the queue item and schedules a retry if it fails.
+func (u *Updater) read(ctx context.Context, item queueItem, now time.Time) {
+	defer u.finishRead(item.Sensor.MacAddress)
+
+	err := u.collect(ctx, item)
+	var partial *driver.PartialError
+	switch {
+	case err == nil:
+		u.recordSuccess(item.Sensor, now)
+	case errors.As(err, &partial):
+		u.errorLog.Log(logrus.WarnLevel, item.Sensor.MacAddress, fmt.Sprintf("Partial read of sensor %q: %s", item.Sensor, err), now)
+		u.recordError(item.Sensor, err, now)
+		item.Parts = partial.Failed
+		u.retryItem(item, now)
+	case err != nil:
+		u.errorLog.Log(logrus.ErrorLevel, item.Sensor.MacAddress, fmt.Sprintf("Error updating sensor %q: %s", item.Sensor, err), now)
+		u.recordError(item.Sensor, err, now)
+		item.Parts = nil
+		u.retryItem(item, now)
+	}
+}
+
+// finishRead allows the sensor to be read again.
+func (u *Updater) finishRead(macAddress string) {
+	u.queueLock.Lock()
+	defer u.queueLock.Unlock()
+
+	delete(u.inFlight, macAddress)
+}
+
+// Errors returns the recent errors of all sensors, sorted by MAC address and time.
+func (u *Updater) Errors() []SensorError {
+	u.dataLock.RLock()
+	defer u.dataLock.RUnlock()
+
+	result := []SensorError{}
+	for _, d := range u.dataMap {
+		result = append(result, d.Stats.History...)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Sensor.MacAddress == result[j].Sensor.MacAddress {
+			return result[i].Time.Before(result[j].Time)
+		}
+		return result[i].Sensor.MacAddress < result[j].Sensor.MacAddress
+	})
+	return result
+}
+
+func (u *Updater) recordSuccess(sensor config.Sensor, now time.Time) {
+	u.dataLock.Lock()
+	defer u.dataLock.Unlock()
+
+	d, ok := u.dataMap[sensor.MacAddress]
+	if !ok {
+		return
+	}
+
+	u.reads.WithLabelValues(u.labels(sensor)...).Inc()
+	u.consecutiveErrors.WithLabelValues(u.labels(sensor)...).Set(0)
+	d.Stats.Reads++
+	d.Stats.ConsecutiveErrors = 0
+	d.Stats.LastSuccess = now
+}
+
+func (u *Updater) recordError(sensor config.Sensor, err error, now time.Time) {
+	u.notifyErrorListeners(sensor, err)
+
+	u.dataLock.Lock()
+	defer u.dataLock.Unlock()
+
+	d, ok := u.dataMap[sensor.MacAddress]
+	if !ok {
+		return
+	}
+
+	d.Stats.Reads++
+	d.Stats.Errors++
+	d.Stats.ConsecutiveErrors++
+	d.Stats.History = append(d.Stats.History, SensorError{
+		Sensor: sensor.Redacted(),
+		Time:   now,
+		Error:  err.Error(),
+	})
+	if len(d.Stats.History) > maxErrorHistory {
+		d.Stats.History = d.Stats.History[len(d.Stats.History)-maxErrorHistory:]
+	}
+
+	u.reads.WithLabelValues(u.labels(sensor)...).Inc()
+	u.readErrors.WithLabelValues(u.labels(sensor)...).Inc()
+	u.consecutiveErrors.WithLabelValues(u.labels(sensor)...).Set(float64(d.Stats.ConsecutiveErrors))
+}
+
+// UpdateAll schedules an update for all registered sensors. The reads are spread evenly across the spread set using
+// SetSpread, in order of the MAC addresses, so that every sensor keeps its place in the interval. All reads are
+// scheduled within the spread, even with the jitter added.
 func (u *Updater) UpdateAll(now time.Time) {
-	sensors := u.getSensors()
+	sensors := u.getLocalSensors()
+	sort.Slice(sensors, func(i, j int) bool {
+		return sensors[i].MacAddress < sensors[j].MacAddress
+	})
 
-	for _, s := range sensors {
-		u.scheduleUpdate(s)
+	u.queueLock.Lock()
+	defer u.queueLock.Unlock()
+
+	for i, s := range sensors {
+		offset := u.spread * time.Duration(i) / time.Duration(len(sensors))
+		if u.jitter > 0 {
+			offset += time.Duration(u.random.Int63n(int64(u.jitter)))
+		}
+		if u.spread > 0 {
+			// The read needs to be due before the next call, which would replace it otherwise. The last sensors
+			// wrap around to the start of the interval instead.
+			offset %= u.spread
+		}
+
+		u.queue[s.MacAddress] = queueItem{
+			Sensor: s,
+			Time:   now.Add(offset),
+		}
 	}
 }
 
+func (u *Updater) getLocalSensors() []config.Sensor {
+	u.dataLock.RLock()
+	defer u.dataLock.RUnlock()
+
+	result := []config.Sensor{}
+	for _, d := range u.dataMap {
+		if d.Remote || d.Info.Passive() {
+			continue
+		}
+
+		result = append(result, d.Info)
+	}
+
+	return result
+}
+
 func (u *Updater) getSensors() []config.Sensor {
 	u.dataLock.RLock()
 	defer u.dataLock.RUnlock()
@@ -154,8 +861,15 @@ func (u *Updater) getNextQueueItem(now time.Time) (queueItem, bool) {
 
 	items := []queueItem{}
 	for _, i := range u.queue {
+		if u.inFlight[i.Sensor.MacAddress] {
+			continue
+		}
+
 		items = append(items, i)
 	}
+	if len(items) == 0 {
+		return queueItem{}, false
+	}
 
 	sort.Slice(items, func(i, j int) bool {
 		return items[i].Time.Before(items[j].Time)
@@ -169,7 +883,8 @@ func (u *Updater) getNextQueueItem(now time.Time) (queueItem, bool) {
 	}
 
 	delete(u.queue, next.Sensor.MacAddress)
-	return items[0], true
+	u.inFlight[next.Sensor.MacAddress] = true
+	return next, true
 }
 
 func (u *Updater) scheduleUpdate(sensor config.Sensor) {
@@ -183,7 +898,28 @@ func (u *Updater) scheduleUpdate(sensor config.Sensor) {
 	}
 }
 
-func (u *Updater) updateSensor(ctx context.Context, sensor config.Sensor) error {
+// collect updates the sensor. A panic while reading or processing the data is recovered and returned as error, so
+// that a single misbehaving sensor does not stop the collection of the other sensors.
+func (u *Updater) collect(ctx context.Context, item queueItem) (err error) {
+	defer u.recoverPanic(item.Sensor, &err)
+
+	return u.updateSensor(ctx, item)
+}
+
+// recoverPanic needs to be deferred. It recovers a panic and sets the error, so that the sensor is marked as failed.
+func (u *Updater) recoverPanic(sensor config.Sensor, err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	u.panics.WithLabelValues(u.labels(sensor)...).Inc()
+	u.log.Errorf("Recovered panic while collecting sensor %q: %v\n%s", sensor, r, debug.Stack())
+	*err = fmt.Errorf("panic: %v", r)
+}
+
+func (u *Updater) updateSensor(ctx context.Context, item queueItem) error {
+	sensor := item.Sensor
 	defer func(start time.Time) {
 		elapsed := time.Since(start)
 		u.log.Debugf("Updating %q took %s.", sensor, elapsed)
@@ -192,18 +928,172 @@ func (u *Updater) updateSensor(ctx context.Context, sensor config.Sensor) error
 	ctx, cancel := context.WithTimeout(ctx, u.refreshTimeout)
 	defer cancel()
 
-	u.log.Debugf("Reading data for %q on %q", sensor.MacAddress, u.deviceName)
-	data, err := miflora.ReadData(ctx, u.log, u.device, sensor.MacAddress)
+	if u.backend == nil {
+		return errors.New("no bluetooth device available")
+	}
+
+	opts := sensor.DriverOptions()
+	opts.Parts = item.Parts
+	if len(opts.Parts) == 0 {
+		opts.Parts = u.regularParts(sensor, time.Now())
+	}
+
+	start := time.Now()
+	data, readErr := u.backend.Read(ctx, sensor, opts)
+	u.recordConnect(ctx, sensor, readErr)
+
+	// Panics of the driver are recovered by the backend, possibly in the worker process.
+	var panicked *driver.PanicError
+	if errors.As(readErr, &panicked) {
+		u.panics.WithLabelValues(u.labels(sensor)...).Inc()
+	}
+	u.notifyConnectListeners(sensor, time.Since(start), readErr)
+
+	var partial *driver.PartialError
+	if readErr != nil && !errors.As(readErr, &partial) {
+		return fmt.Errorf("can not read data: %s", readErr)
+	}
+
+	if partial != nil {
+		for _, part := range partial.Failed {
+			u.partialReads.WithLabelValues(append(u.labels(sensor), part)...).Inc()
+		}
+	}
+	if d, err := driver.Get(sensor.Driver); err == nil && d.HasSlowParts(opts.Parts) && (partial == nil || !d.HasSlowParts(partial.Failed)) {
+		u.setSlowRead(sensor, data.Time)
+	}
+	if u.pipeline != nil {
+		processed, ok := u.pipeline.Process(sensor, data)
+		if !ok {
+			u.log.Debugf("Reading of %q was dropped by the pipeline.", sensor)
+			return readErr
+		}
+		data = processed
+	}
+
+	// The values kept from the previous read keep their time, unless the values which are not slow have been read.
+	fresh := true
+	if d, err := driver.Get(sensor.Driver); err == nil {
+		var failed []string
+		if partial != nil {
+			failed = partial.Failed
+		}
+		fresh = d.ReadFastParts(opts.Parts, failed)
+	}
+
+	data, ok := u.setReading(sensor, data, partial != nil || len(opts.Parts) > 0, !fresh)
+	if !ok {
+		u.log.Debugf("Sensor %q was removed during update.", sensor)
+		return nil
+	}
+
+	u.notifyListeners(sensor, data)
+	return readErr
+}
+
+// recordConnect updates the connection metrics of the sensor using the result of a read.
+func (u *Updater) recordConnect(ctx context.Context, sensor config.Sensor, err error) {
+	u.connectAttempts.WithLabelValues(u.labels(sensor)...).Inc()
+	if err == nil {
+		return
+	}
+
+	var connect *driver.ConnectError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		u.connectTimeouts.WithLabelValues(u.labels(sensor)...).Inc()
+	case errors.As(err, &connect):
+		u.connectFailures.WithLabelValues(u.labels(sensor)...).Inc()
+	}
+}
+
+// regularParts returns the parts of a regular read of the sensor. The slow parts are left out if they have been read
+// within the slow interval. All parts are read if the driver does not support reading parts.
+func (u *Updater) regularParts(sensor config.Sensor, now time.Time) []string {
+	if u.slowInterval <= 0 {
+		return nil
+	}
+
+	d, err := driver.Get(sensor.Driver)
 	if err != nil {
-		return fmt.Errorf("can not read data: %s", err)
+		return nil
+	}
+
+	fast := d.FastParts()
+	if len(fast) == 0 {
+		return nil
 	}
 
+	u.dataLock.RLock()
+	defer u.dataLock.RUnlock()
+
+	item, ok := u.dataMap[sensor.MacAddress]
+	if !ok || item.SlowRead.IsZero() || now.Sub(item.SlowRead) >= u.slowInterval {
+		return nil
+	}
+
+	return fast
+}
+
+func (u *Updater) setSlowRead(sensor config.Sensor, now time.Time) {
 	u.dataLock.Lock()
 	defer u.dataLock.Unlock()
 
-	mapItem := u.dataMap[sensor.MacAddress]
+	if item, ok := u.dataMap[sensor.MacAddress]; ok {
+		item.SlowRead = now
+	}
+}
+
+// setReading saves the data read from a sensor and returns it merged with the previous data if only some parts have
+// been read. The merged data keeps the time of the previous data if keepTime is set, which is the case if only slow
+// parts have been read. It returns false if the sensor has been removed in the meantime.
+func (u *Updater) setReading(sensor config.Sensor, data driver.Reading, merge, keepTime bool) (driver.Reading, bool) {
+	u.dataLock.Lock()
+	defer u.dataLock.Unlock()
+
+	mapItem, ok := u.dataMap[sensor.MacAddress]
+	if !ok {
+		return driver.Reading{}, false
+	}
+	if mapItem.Data != nil && merge {
+		// Only some parts have been read, keep the other values from the previous read.
+		merged := data.Merge(*mapItem.Data)
+		if keepTime {
+			merged.Time = mapItem.Data.Time
+		}
+		data = merged
+	}
 	mapItem.Data = &data
-	return nil
+	return data, true
+}
+
+func (u *Updater) notifyListeners(sensor config.Sensor, data driver.Reading) {
+	u.listenersLock.RLock()
+	defer u.listenersLock.RUnlock()
+
+	for _, l := range u.listeners {
+		l(sensor, data)
+	}
+}
+
+func (u *Updater) notifyConnectListeners(sensor config.Sensor, duration time.Duration, err error) {
+	u.listenersLock.RLock()
+	defer u.listenersLock.RUnlock()
+
+	var connect *driver.ConnectError
+	connected := !errors.As(err, &connect)
+	for _, l := range u.connectListeners {
+		l(sensor, duration, connected)
+	}
+}
+
+func (u *Updater) notifyErrorListeners(sensor config.Sensor, err error) {
+	u.listenersLock.RLock()
+	defer u.listenersLock.RUnlock()
+
+	for _, l := range u.errorListeners {
+		l(sensor, err)
+	}
 }
 
 func (u *Updater) retryItem(item queueItem, now time.Time) {
@@ -226,5 +1116,6 @@ func (u *Updater) retryItem(item queueItem, now time.Time) {
 		Sensor:    item.Sensor,
 		Time:      now.Add(retryAfter),
 		LastRetry: retryAfter,
+		Parts:     item.Parts,
 	}
 }
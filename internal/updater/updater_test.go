@@ -0,0 +1,49 @@
+package updater
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+)
+
+func TestUpdateAllSpread(t *testing.T) {
+	const (
+		interval = 5 * time.Minute
+		jitter   = 15 * time.Second
+		sensors  = 30
+		cycles   = 100
+	)
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	u := New(log, nil, time.Minute, config.RetryConfig{}, 0)
+	u.random = rand.New(rand.NewSource(1))
+	u.SetSpread(interval, jitter)
+	for i := 0; i < sensors; i++ {
+		u.AddSensor(config.Sensor{
+			MacAddress: fmt.Sprintf("C4:7C:8D:6A:00:%02X", i),
+		})
+	}
+
+	// A read scheduled after the next call of UpdateAll would be replaced before it is due, skipping the sensor.
+	start := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	for cycle := 0; cycle < cycles; cycle++ {
+		now := start.Add(time.Duration(cycle) * interval)
+		u.UpdateAll(now)
+
+		if len(u.queue) != sensors {
+			t.Fatalf("got %d queued sensors, want %d", len(u.queue), sensors)
+		}
+		for mac, item := range u.queue {
+			if offset := item.Time.Sub(now); offset < 0 || offset >= interval {
+				t.Errorf("cycle %d: read of %s scheduled at %s, want within %s", cycle, mac, offset, interval)
+			}
+		}
+	}
+}
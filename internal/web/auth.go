@@ -0,0 +1,114 @@
+package web
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Authenticator requires a password or token for accessing the endpoints.
+type Authenticator struct {
+	users     map[string]string
+	token     string
+	exempt    []string
+	protected []string
+
+	lock sync.Mutex
+	// verified contains the hashes of the credentials which have been checked successfully before, as checking a
+	// bcrypt hash takes too long for doing it on every scrape.
+	verified map[[32]byte]bool
+}
+
+// NewAuthenticator creates an Authenticator. Requests for paths starting with one of the exempt prefixes are
+// passed on without checking, for endpoints with their own authentication. Paths starting with one of the protected
+// prefixes are checked even if they are covered by an exempt prefix.
+func NewAuthenticator(cfg config.WebConfig, exempt, protected []string) *Authenticator {
+	return &Authenticator{
+		users:     cfg.BasicAuthUsers,
+		token:     cfg.BearerToken,
+		exempt:    exempt,
+		protected: protected,
+		verified:  map[[32]byte]bool{},
+	}
+}
+
+// Handler returns a handler checking the credentials of the requests before passing them to the next handler.
+func (a *Authenticator) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.isExempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !a.allowed(r) {
+			if len(a.users) > 0 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="flowercare-exporter"`)
+			} else {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *Authenticator) isExempt(path string) bool {
+	for _, prefix := range a.protected {
+		if strings.HasPrefix(path, prefix) {
+			return false
+		}
+	}
+
+	for _, prefix := range a.exempt {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a *Authenticator) allowed(r *http.Request) bool {
+	if user, password, ok := r.BasicAuth(); ok {
+		return a.checkPassword(user, password)
+	}
+
+	value := r.Header.Get("Authorization")
+	if a.token == "" || !strings.HasPrefix(value, "Bearer ") {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(value, "Bearer ")), []byte(a.token)) == 1
+}
+
+func (a *Authenticator) checkPassword(user, password string) bool {
+	hash, ok := a.users[user]
+	if !ok {
+		return false
+	}
+
+	key := sha256.Sum256([]byte(user + "\x00" + password + "\x00" + hash))
+
+	a.lock.Lock()
+	verified := a.verified[key]
+	a.lock.Unlock()
+	if verified {
+		return true
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return false
+	}
+
+	a.lock.Lock()
+	a.verified[key] = true
+	a.lock.Unlock()
+	return true
+}
@@ -0,0 +1,34 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// LifecycleHandler passes the requests to next if the lifecycle endpoints, which reload or stop the exporter, are
+// enabled. Otherwise they are rejected like Prometheus does.
+func LifecycleHandler(enabled bool, next http.Handler) http.Handler {
+	if enabled {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Lifecycle API is not enabled.", http.StatusForbidden)
+	})
+}
+
+// QuitHandler calls quit on a POST or PUT request, which shuts down the exporter gracefully. Repeated requests are
+// answered, but quit is only called once.
+func QuitHandler(quit func()) http.Handler {
+	var once sync.Once
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodPut {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		fmt.Fprintln(w, "Requesting termination... Goodbye!")
+		once.Do(quit)
+	})
+}
@@ -0,0 +1,109 @@
+// Package web contains the TLS setup and authentication of the HTTP server of the exporter.
+package web
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/xperimental/flowercare-exporter/internal/config"
+)
+
+// certificate loads the certificate again when its files change, for example when it is renewed by certbot or
+// cert-manager.
+type certificate struct {
+	certFile string
+	keyFile  string
+
+	lock    sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+}
+
+func (c *certificate) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certInfo, err := os.Stat(c.certFile)
+	if err != nil {
+		return c.current(err)
+	}
+
+	keyInfo, err := os.Stat(c.keyFile)
+	if err != nil {
+		return c.current(err)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.cert != nil && certInfo.ModTime().Equal(c.certMod) && keyInfo.ModTime().Equal(c.keyMod) {
+		return c.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		// While the files are being replaced, the certificate and key might not match yet.
+		if c.cert != nil {
+			return c.cert, nil
+		}
+		return nil, err
+	}
+
+	c.cert = &cert
+	c.certMod = certInfo.ModTime()
+	c.keyMod = keyInfo.ModTime()
+	return c.cert, nil
+}
+
+// current returns the certificate loaded before, so that connections still work while the files are replaced.
+func (c *certificate) current(err error) (*tls.Certificate, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.cert != nil {
+		return c.cert, nil
+	}
+
+	return nil, err
+}
+
+// TLSConfig creates the TLS configuration of the server. The certificate is loaded right away, so that errors are
+// reported on startup instead of on the first connection.
+func TLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	cert := &certificate{
+		certFile: cfg.CertFile,
+		keyFile:  cfg.KeyFile,
+	}
+	if _, err := cert.get(nil); err != nil {
+		return nil, fmt.Errorf("can not load certificate: %s", err)
+	}
+
+	result := &tls.Config{
+		GetCertificate: cert.get,
+		ClientAuth:     cfg.ClientAuth(),
+		MinVersion:     cfg.Version(cfg.MinVersion),
+		MaxVersion:     cfg.Version(cfg.MaxVersion),
+		CipherSuites:   cfg.CipherSuiteIDs(),
+	}
+	if result.MinVersion == 0 {
+		result.MinVersion = tls.VersionTLS12
+	}
+
+	if cfg.ClientCAFile != "" {
+		data, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("can not read client CA file: %s", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.New("client CA file contains no certificates")
+		}
+		result.ClientCAs = pool
+	}
+
+	return result, nil
+}
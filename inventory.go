@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/inventory"
+	"github.com/xperimental/flowercare-exporter/pkg/apiclient"
+)
+
+const inventoryCommand = "inventory"
+
+// runInventory writes the sensors and endpoints of the running exporter to stdout.
+func runInventory(args []string) {
+	cfg, err := config.ParseInventory(args)
+	if err != nil {
+		log.Fatalf("Error in inventory configuration: %s", err)
+	}
+
+	sensors, err := apiclient.New(cfg.URL, cfg.Token).Sensors(context.Background())
+	if err != nil {
+		log.Fatalf("Error getting sensors from exporter: %s", err)
+	}
+
+	inv := inventory.New(cfg.URL, sensors)
+	if cfg.Format == "terraform" {
+		err = inv.WriteTerraform(os.Stdout)
+	} else {
+		err = inv.WriteJSON(os.Stdout)
+	}
+	if err != nil {
+		log.Fatalf("Error writing inventory: %s", err)
+	}
+}
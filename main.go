@@ -2,9 +2,15 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -12,9 +18,49 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/adapter"
+	"github.com/xperimental/flowercare-exporter/internal/anonymize"
+	"github.com/xperimental/flowercare-exporter/internal/api"
+	"github.com/xperimental/flowercare-exporter/internal/auth"
+	"github.com/xperimental/flowercare-exporter/internal/backend"
+	"github.com/xperimental/flowercare-exporter/internal/backfill"
+	"github.com/xperimental/flowercare-exporter/internal/battery"
 	"github.com/xperimental/flowercare-exporter/internal/collector"
 	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/distribution"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+	"github.com/xperimental/flowercare-exporter/internal/edge"
+	"github.com/xperimental/flowercare-exporter/internal/energy"
+	"github.com/xperimental/flowercare-exporter/internal/esphome"
+	"github.com/xperimental/flowercare-exporter/internal/events"
+	"github.com/xperimental/flowercare-exporter/internal/extremes"
+	"github.com/xperimental/flowercare-exporter/internal/feature"
+	"github.com/xperimental/flowercare-exporter/internal/forecast"
+	"github.com/xperimental/flowercare-exporter/internal/grafana"
+	"github.com/xperimental/flowercare-exporter/internal/handoff"
+	"github.com/xperimental/flowercare-exporter/internal/heatmap"
+	"github.com/xperimental/flowercare-exporter/internal/logging"
+	"github.com/xperimental/flowercare-exporter/internal/mqtt"
+	"github.com/xperimental/flowercare-exporter/internal/notify"
+	"github.com/xperimental/flowercare-exporter/internal/outputs"
+	"github.com/xperimental/flowercare-exporter/internal/photoperiod"
+	"github.com/xperimental/flowercare-exporter/internal/ping"
+	"github.com/xperimental/flowercare-exporter/internal/pipeline"
+	"github.com/xperimental/flowercare-exporter/internal/privsep"
+	"github.com/xperimental/flowercare-exporter/internal/rawdump"
+	"github.com/xperimental/flowercare-exporter/internal/readiness"
+	"github.com/xperimental/flowercare-exporter/internal/reload"
+	"github.com/xperimental/flowercare-exporter/internal/resource"
+	"github.com/xperimental/flowercare-exporter/internal/rounding"
+	"github.com/xperimental/flowercare-exporter/internal/sandbox"
+	"github.com/xperimental/flowercare-exporter/internal/scanner"
+	"github.com/xperimental/flowercare-exporter/internal/sensorfile"
+	"github.com/xperimental/flowercare-exporter/internal/state"
+	"github.com/xperimental/flowercare-exporter/internal/status"
+	"github.com/xperimental/flowercare-exporter/internal/support"
+	"github.com/xperimental/flowercare-exporter/internal/trend"
 	"github.com/xperimental/flowercare-exporter/internal/updater"
+	"github.com/xperimental/flowercare-exporter/internal/web"
 )
 
 var (
@@ -35,34 +81,337 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case workerCommand:
+			runWorker(os.Args[2:])
+			return
+		case blinkCommand:
+			runBlink(os.Args[2:])
+			return
+		case bundleCommand:
+			runBundle(os.Args[2:])
+			return
+		case checkConfigCommand:
+			runCheckConfig(os.Args[2:])
+			return
+		case historyCommand:
+			runHistory(os.Args[2:])
+			return
+		case inventoryCommand:
+			runInventory(os.Args[2:])
+			return
+		case readCommand:
+			runRead(os.Args[2:])
+			return
+		case scanCommand:
+			runScan(os.Args[2:])
+			return
+		case serviceCommand:
+			runService(os.Args[2:])
+			return
+		}
+	}
+
+	runExporter()
+}
+
+// runExporter runs the exporter until it receives a shutdown signal or stop is closed.
+func runExporter() {
+	logBuffer := support.NewLogBuffer(logBufferSize)
+	log.AddHook(logBuffer)
+	// The arguments are kept for reading the configuration of the outputs again.
+	args := os.Args[1:]
+
 	config, err := config.Parse(log)
 	if err != nil {
 		log.Fatalf("Error in configuration: %s", err)
 	}
 
-	log.SetLevel(logrus.Level(config.LogLevel))
-	log.Infof("Bluetooth Device: %s", config.Device)
+	// A running exporter is expected when taking over from it, the PID file is checked again once it has stopped.
+	if config.PIDFile != "" && config.Handoff.Socket == "" {
+		if err := checkPIDFile(config.PIDFile); err != nil {
+			log.Fatalf("Error in PID file: %s", err)
+		}
+	}
+
+	if config.Daemon && !isDaemon() {
+		daemonize(config.LogFile)
+	}
+
+	if config.LogFile != "" {
+		logFile, err := os.OpenFile(config.LogFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			log.Fatalf("Error opening log file: %s", err)
+		}
+		defer logFile.Close()
+		log.SetOutput(logFile)
+	}
+
+	loggers := logging.New(log, config.LogLevel.Levels)
+	log.Infof("Bluetooth Device: %s", strings.Join(config.Devices, ", "))
+	resource.Apply(log, config.Resources.Low, config.Resources.MemoryTargetMiB)
+
+	logEgress(config)
+	for _, name := range config.Features.Names() {
+		log.Warnf("Experimental feature enabled: %s", name)
+	}
+	for _, w := range config.Lint() {
+		log.Warn(w)
+	}
+
+	readingPipeline, err := pipeline.New(loggers.For(logging.ModuleScheduler), config.Pipeline.Steps)
+	if err != nil {
+		log.Fatalf("Error creating pipeline: %s", err)
+	}
+	log.Infof("Pipeline: %s", readingPipeline)
+
+	// The running exporter needs to release the adapter before it can be used.
+	var handedOff *handoff.State
+	if config.Handoff.Socket != "" {
+		handedOff = takeOver(config.Handoff)
+	}
+
+	deviceNames := config.Devices
+	if len(config.Sensors) == 0 && !config.Discover && !config.Probe.Enabled {
+		log.Info("No local sensors configured, not using Bluetooth.")
+		deviceNames = nil
+	}
+
+	wg := &sync.WaitGroup{}
+	ctx, cancel := context.WithCancel(context.Background())
 
-	provider, err := updater.New(log, config.Device, config.RefreshTimeout, config.Retry)
+	b, err := createBackend(ctx, cancel, loggers.For(logging.ModuleBLE), config, deviceNames)
 	if err != nil {
 		log.Fatalf("Error creating device: %s", err)
 	}
 
+	provider := updater.New(loggers.For(logging.ModuleScheduler), b, config.RefreshTimeout, config.Retry, config.ErrorLogWindow)
+	provider.SetPipeline(readingPipeline)
+	provider.SetSlowInterval(config.FirmwareInterval)
+	provider.SetMaxConcurrentReads(config.ConcurrentReads)
+	var spread time.Duration
+	if config.RefreshSpread {
+		spread = config.RefreshDuration
+	}
+	provider.SetSpread(spread, config.RefreshJitter)
+
+	var anonymizer *anonymize.Anonymizer
+	if config.Anonymize.Enabled {
+		anonymizer = anonymize.New(config.Anonymize.Key)
+		log.SetFormatter(&anonymize.Formatter{
+			Base:       log.Formatter,
+			Anonymizer: anonymizer,
+			Sensors:    provider.Sensors,
+		})
+	}
+	provider.SetAnonymizer(anonymizer)
+
+	if config.StateFile != "" {
+		current, err := state.Load(config.StateFile)
+		if err != nil {
+			log.Fatalf("Error loading state: %s", err)
+		}
+		provider.Restore(current.Sensors)
+		provider.RestoreReadings(current.Readings)
+	}
+	if handedOff != nil {
+		provider.Restore(handedOff.Sensors)
+		provider.RestoreReadings(handedOff.Readings)
+	}
+
+	var handoffServer *handoff.Server
+	if config.Handoff.Socket != "" {
+		handoffServer, err = handoff.Listen(log, config.Handoff.Socket, cancel)
+		if err != nil {
+			log.Fatalf("Error creating handoff socket: %s", err)
+		}
+	}
+
+	// The publisher is created before applying the sandbox, because it reads the certificates.
+	var publisher *mqtt.Publisher
+	if config.MQTT.Broker != "" {
+		publisher, err = mqtt.New(loggers.For(logging.ModuleMQTT), config.MQTT, anonymizer)
+		if err != nil {
+			log.Fatalf("Error creating MQTT publisher: %s", err)
+		}
+	}
+
+	if config.Sandbox {
+		paths := sandbox.Paths{}
+		if config.SensorDir != "" {
+			paths.Read = append(paths.Read, config.SensorDir)
+		}
+		if config.ConfigFile != "" {
+			paths.Read = append(paths.Read, config.ConfigFile)
+		}
+		if config.StateFile != "" {
+			paths.Write = append(paths.Write, filepath.Dir(config.StateFile))
+		}
+		if config.API.WriteSensors {
+			paths.Write = append(paths.Write, config.SensorDir)
+		}
+		if config.PIDFile != "" {
+			paths.Write = append(paths.Write, filepath.Dir(config.PIDFile))
+		}
+		if config.Dump.Dir != "" {
+			paths.Write = append(paths.Write, config.Dump.Dir)
+		}
+		if config.Handoff.Socket != "" {
+			paths.Write = append(paths.Write, filepath.Dir(config.Handoff.Socket))
+		}
+
+		if err := sandbox.Apply(log, paths); err != nil {
+			log.Fatalf("Error applying sandbox: %s", err)
+		}
+	}
+
 	for _, s := range config.Sensors {
 		log.Infof("Sensor: %s", s)
 		provider.AddSensor(s)
 	}
+	firstRefresh := time.Now()
+	if handedOff != nil {
+		provider.RestoreSchedule(handedOff.Schedule)
+		firstRefresh = handedOff.NextRefresh
+	}
+
+	eventLog := events.NewLog(config.EventLogSize)
+	recordEvents(provider, eventLog, config.Scan.Interval)
+	detector := events.NewDetector(eventLog, config.WateringThreshold)
+	provider.AddListener(detector.Observe)
+
+	var annotator *grafana.Annotator
+	if config.Grafana.URL != "" {
+		annotator, err = grafana.New(loggers.For(logging.ModuleGrafana), config.Grafana, config.Egress.Transport(nil), anonymizer)
+		if err != nil {
+			log.Fatalf("Error creating Grafana annotations: %s", err)
+		}
+		eventLog.Subscribe(annotator.Add)
+	}
+
+	var batteryDepletion func(macAddress string) (time.Time, bool)
+	if config.BatteryWindow > 0 {
+		predictor := battery.New(config.BatteryWindow)
+		provider.AddListener(predictor.Observe)
+		batteryDepletion = predictor.Depletion
+	}
+
+	if config.EnergyEstimate {
+		estimator := energy.New(provider.ConfiguredSensors, anonymizer)
+		provider.AddConnectListener(estimator.Observe)
+		if err := prometheus.Register(estimator); err != nil {
+			log.Fatalf("Failed to register energy metrics: %s", err)
+		}
+	}
+
+	var (
+		moistureForecast func(macAddress string, horizon time.Duration) (float64, bool)
+		wateringDue      func(macAddress string, threshold float64) (time.Time, bool)
+		dryRate          func(macAddress string) (float64, bool)
+	)
+	if config.ForecastWindow > 0 {
+		model := forecast.New(config.ForecastWindow, config.WateringThreshold)
+		provider.AddListener(model.Observe)
+		moistureForecast = model.Forecast
+		wateringDue = model.DryTime
+		dryRate = func(macAddress string) (float64, bool) {
+			return model.DryRate(macAddress, config.DryRateWindow)
+		}
+	}
+
+	var photoperiodHours func(macAddress string, now time.Time) (photoperiod.Day, bool)
+	if config.PhotoperiodLux > 0 {
+		tracker := photoperiod.New(config.PhotoperiodLux, config.Location)
+		provider.AddListener(tracker.Observe)
+		photoperiodHours = tracker.Photoperiod
+	}
+
+	if len(config.Histograms) > 0 {
+		recorder := distribution.New(config.Histograms, config.Location, anonymizer)
+		provider.AddListener(recorder.Observe)
+		if err := prometheus.Register(recorder); err != nil {
+			log.Fatalf("Failed to register histogram metrics: %s", err)
+		}
+	}
+
+	var degradation func(macAddress string) (map[string]float64, bool)
+	if config.TrendWindow > 0 {
+		analyzer := trend.New(config.TrendWindow, config.Location)
+		provider.AddListener(analyzer.Observe)
+		degradation = analyzer.Degradation
+	}
 
+	var minMax func(macAddress string, now time.Time) (map[string]extremes.Range, bool)
+	if config.ExtremesWindow > 0 {
+		tracker := extremes.New(config.ExtremesWindow)
+		provider.AddListener(tracker.Observe)
+		minMax = tracker.Extremes
+	}
+
+	rounders := newOutputRounders(config)
 	c := &collector.Flowercare{
-		Log:           log,
-		Source:        provider.GetData,
-		Sensors:       config.Sensors,
-		StaleDuration: config.StaleDuration,
+		Log:              loggers.For(logging.ModuleCollector),
+		Source:           rounders.Metrics.Source(provider.GetData),
+		Sensors:          provider.Sensors,
+		StaleDuration:    config.StaleDuration,
+		StaleDurations:   config.StaleDurations,
+		LegacyLabels:     config.LegacyLabels,
+		Discovery:        config.Discover,
+		Anonymizer:       anonymizer,
+		BatteryDepletion: batteryDepletion,
+		MoistureForecast: moistureForecast,
+		ForecastHorizons: config.ForecastHorizons,
+		WateringDue:      wateringDue,
+		DryRate:          dryRate,
+		Watering:         detector.Watering,
+		Photoperiod:      photoperiodHours,
+		Degradation:      degradation,
+		Extremes:         minMax,
+		Units:            config.Units,
+		Compat:           config.Compat,
 	}
 	if err := prometheus.Register(c); err != nil {
 		log.Fatalf("Failed to register collector: %s", err)
 	}
 
+	if err := prometheus.Register(provider); err != nil {
+		log.Fatalf("Failed to register updater metrics: %s", err)
+	}
+
+	selectedAdapters := []adapter.Adapter{provider.Adapter()}
+	if pool, ok := b.(*backend.Pool); ok {
+		selectedAdapters = pool.Adapters()
+		if err := prometheus.Register(pool); err != nil {
+			log.Fatalf("Failed to register adapter health metrics: %s", err)
+		}
+	}
+
+	adapterCollector := &adapter.Collector{
+		Log:      loggers.For(logging.ModuleCollector),
+		Selected: selectedAdapters,
+	}
+	if err := prometheus.Register(adapterCollector); err != nil {
+		log.Fatalf("Failed to register adapter metrics: %s", err)
+	}
+
+	memoryMonitor := &resource.Monitor{
+		Log:    log,
+		Target: uint64(config.Resources.MemoryTargetMiB) << 20,
+	}
+	if err := prometheus.Register(memoryMonitor); err != nil {
+		log.Fatalf("Failed to register memory metrics: %s", err)
+	}
+
+	summary := newSummary(config, selectedAdapters)
+	summary.log()
+	if err := prometheus.Register(summary.metric()); err != nil {
+		log.Fatalf("Failed to register config summary metric: %s", err)
+	}
+	if err := prometheus.Register(deprecationMetric(config.Deprecations)); err != nil {
+		log.Fatalf("Failed to register deprecation metric: %s", err)
+	}
+
 	versionMetric := prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: collector.MetricPrefix + "build_info",
 		Help: "Contains build information as labels. Value set to 1.",
@@ -75,51 +424,619 @@ func main() {
 	versionMetric.Set(1)
 	prometheus.MustRegister(versionMetric)
 
-	http.Handle("/metrics", promhttp.Handler())
-	http.Handle("/", http.RedirectHandler("/metrics", http.StatusFound))
+	http.Handle("/metrics", collector.CacheHandler(promhttp.Handler(), c.LastRead, config.RefreshDuration, config.Web.AuthEnabled() || config.Web.TLS.ClientCAFile != ""))
+	http.Handle("/", &status.Handler{
+		Log:           loggers.For(logging.ModuleHTTP),
+		Version:       version,
+		Sensors:       provider.Sensors,
+		Source:        provider.GetData,
+		Stats:         provider.Stats,
+		StaleDuration: config.StaleDuration,
+		Location:      config.Location,
+		Anonymizer:    anonymizer,
+	})
+	http.Handle("/heatmap.svg", &heatmap.Handler{
+		Log:           loggers.For(logging.ModuleHTTP),
+		Sensors:       provider.Sensors,
+		Source:        rounders.Heatmap.Source(provider.GetData),
+		StaleDuration: config.StaleDuration,
+		Anonymizer:    anonymizer,
+	})
+
+	if config.Probe.Enabled {
+		log.Infof("Reading sensors on demand using /probe with a timeout of %s.", config.Probe.Timeout)
+		http.Handle("/probe", c.ProbeHandler(rounders.Metrics.Probe(provider.Probe), config.Probe.Timeout))
+	}
+
+	if config.Edge.Aggregator {
+		log.Info("Accepting readings from edge exporters.")
+		// The readings have been processed by the pipeline of the edge exporter, which pushes them together with its
+		// configuration of the sensor. Processing them again would apply the quirks of the sensor twice.
+		edge.NewAggregator(loggers.For(logging.ModuleHTTP), provider.Store).Register(http.DefaultServeMux)
+	}
+
+	var notifier *notify.Manager
+	if config.Notify.File != "" {
+		notifier, err = notify.New(loggers.For(logging.ModuleNotify), config.Notify, config.Egress.Transport(nil), eventLog)
+		if err != nil {
+			log.Fatalf("Error creating notifications: %s", err)
+		}
+		notifier.BatteryDepletion = batteryDepletion
+		notifier.WateringDue = wateringDue
+		notifier.Degradation = degradation
+	}
+
+	if config.API.Enabled {
+		log.Infof("Control API enabled with %d tokens.", len(config.API.Tokens))
+		a := api.New(loggers.For(logging.ModuleHTTP), provider, config.API.Tokens, anonymizer)
+		a.Events = eventLog
+		if notifier != nil {
+			a.Alerts = notifier
+		}
+		if config.API.OIDC.Issuer != "" || config.API.ProxyAuth.UserHeader != "" {
+			a.Authenticate = auth.New(loggers.For(logging.ModuleHTTP), config.API, config.Egress.Transport(nil)).Authenticate
+		}
+		if config.API.WriteSensors {
+			a.Writer = &sensorfile.Writer{
+				Log:       loggers.For(logging.ModuleHTTP),
+				Dir:       config.SensorDir,
+				Backups:   config.API.Backups,
+				GitCommit: config.API.GitCommit,
+			}
+		}
+		a.Support = func() support.Report {
+			return supportReport(config, provider, logBuffer, anonymizer)
+		}
+		if config.Features.Enabled(feature.HistoryDownload) {
+			a.History = provider.History
+		}
+		a.Register(http.DefaultServeMux)
+	}
+
+	// The outputs are started after the sensors, but can already be reloaded.
+	outputSet := outputs.New(log)
+	outputSet.Start(ctx, wg)
+	factory := &outputFactory{
+		Loggers:       loggers,
+		Egress:        config.Egress,
+		Anonymizer:    anonymizer,
+		Rounders:      rounders,
+		Provider:      provider,
+		StaleDuration: config.StaleDuration,
+	}
+
+	reloader := &reload.Reloader{
+		Log:      log,
+		Load:     config.LoadSensors,
+		Provider: provider,
+		Events:   eventLog,
+		Outputs: func() ([]string, error) {
+			return factory.reload(outputSet, args)
+		},
+	}
+	quit := make(chan struct{})
+	http.Handle("/-/reload", web.LifecycleHandler(config.Web.EnableLifecycle, reloader))
+	http.Handle("/-/quit", web.LifecycleHandler(config.Web.EnableLifecycle, web.QuitHandler(func() {
+		close(quit)
+	})))
+
+	var readyGate *readiness.Gate
+	if config.WaitForFirstRead > 0 {
+		readyGate = readiness.New()
+		provider.AddListener(readyGate.Observe)
+	}
+	http.Handle("/-/ready", readyGate)
 
+	listener, err := net.Listen("tcp", config.ListenAddr)
+	if err != nil {
+		log.Fatalf("Error listening on %s: %s", config.ListenAddr, err)
+	}
+
+	scheme := "HTTP"
+	if config.Web.TLS.Enabled() {
+		tlsConfig, err := web.TLSConfig(config.Web.TLS)
+		if err != nil {
+			log.Fatalf("Error setting up HTTPS: %s", err)
+		}
+		listener = tls.NewListener(listener, tlsConfig)
+		scheme = "HTTPS"
+	}
+
+	// Requests use the context of the exporter, so that reads started by requests are stopped on shutdown.
+	server := &http.Server{
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+	if config.Web.AuthEnabled() {
+		// The control API checks its own tokens.
+		server.Handler = web.NewAuthenticator(config.Web, []string{api.Prefix}, []string{edge.PathPrefix}).Handler(http.DefaultServeMux)
+	}
 	go func() {
-		log.Infof("Listen on %s...", config.ListenAddr)
-		log.Fatal(http.ListenAndServe(config.ListenAddr, nil))
+		log.Infof("Listen on %s using %s...", config.ListenAddr, scheme)
+		if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
 	}()
 
-	wg := &sync.WaitGroup{}
-	ctx, cancel := context.WithCancel(context.Background())
-
-	startSignalHandler(ctx, wg, cancel)
-	startScheduleLoop(ctx, wg, config, provider)
+	startSignalHandler(ctx, wg, cancel, quit)
+	startReloadHandler(ctx, wg, reloader)
+	if config.WatchSensorDir {
+		watcher := &reload.Watcher{
+			Log:      log,
+			Reloader: reloader,
+			Dir:      config.SensorDir,
+			Debounce: config.WatchDebounce,
+			Validate: config.CheckSensorFile,
+		}
+		if err := watcher.Start(ctx, wg); err != nil {
+			log.Fatalf("Error watching sensor directory: %s", err)
+		}
+		log.Infof("Watching sensor directory %s for changes.", config.SensorDir)
+	}
+	startupPing(ctx, config, provider, anonymizer)
+	scheduledRefresh := startScheduleLoop(ctx, wg, config, provider, firstRefresh)
 	provider.Start(ctx, wg)
+	memoryMonitor.Start(ctx, wg)
+	adapterCollector.Start(ctx, wg)
+	if handoffServer != nil {
+		handoffServer.Start(ctx, wg)
+	}
+
+	if config.StateFile != "" {
+		saver := &state.Saver{
+			Log:      log,
+			FileName: config.StateFile,
+			Current: func() state.State {
+				return state.State{
+					Sensors:  provider.Stats(),
+					Readings: provider.Readings(),
+				}
+			},
+		}
+		saver.Start(ctx, wg)
+	}
+
+	s := &scanner.Scanner{
+		Log:     loggers.For(logging.ModuleBLE),
+		Config:  config.Scan,
+		Scan:    provider.Scan,
+		Sensors: provider.Sensors,
+		Store:   readingPipeline.Then(provider.Store),
+	}
+	if config.Discover {
+		log.Infof("Discovering new sensors every %s.", config.Scan.Interval)
+		s.Discover = addDiscovered(provider, eventLog)
+	}
+	if config.ESPHome.Enabled() {
+		// Sensors can be heard by the exporter and several proxies, the local scans repeat every scan interval.
+		s.Receivers = scanner.NewReceivers(config.Scan.Interval, anonymizer)
+		if err := prometheus.Register(s.Receivers); err != nil {
+			log.Fatalf("Failed to register receiver metrics: %s", err)
+		}
+	}
+	if hasPassiveSensors(config.Sensors) || config.Discover {
+		s.Start(ctx, wg)
+	}
+
+	if config.ESPHome.Enabled() {
+		log.Infof("Receiving advertisements from ESPHome Bluetooth proxies.")
+		proxies := esphome.New(loggers.For(logging.ModuleBLE), config.ESPHome, config.Egress)
+		proxies.Handler = s.Handle
+		if err := prometheus.Register(proxies); err != nil {
+			log.Fatalf("Failed to register ESPHome proxy metrics: %s", err)
+		}
+		proxies.Start(ctx, wg)
+	}
+
+	if config.Edge.PushURL != "" {
+		log.Infof("Pushing readings to aggregator %s as %q", config.Edge.PushURL, config.Edge.NodeID)
+		pusher := edge.NewPusher(loggers.For(logging.ModulePush), config.Edge, config.Egress.Transport(nil))
+		provider.AddListener(pusher.Add)
+		pusher.Start(ctx, wg)
+	}
+
+	provider.AddListener(outputSet.Observe)
+	if _, err := factory.apply(outputSet, config, publisher); err != nil {
+		log.Fatalf("Error starting outputs: %s", err)
+	}
+
+	if annotator != nil {
+		log.Infof("Posting annotations to Grafana at %s", config.Grafana.URL)
+		annotator.Start(ctx, wg)
+	}
+
+	if config.Backfill.URL != "" {
+		log.Infof("Backfilling gaps of at least %s to %s", config.Backfill.MinGap, config.Backfill.URL)
+		backfiller := backfill.New(loggers.For(logging.ModuleBackfill), config.Backfill, config.Egress.Transport(nil), provider.History, c.ReadingMetrics)
+		backfiller.Restore(lastSuccess(provider.Stats()))
+		provider.AddListener(backfiller.Observe)
+		backfiller.Start(ctx, wg)
+	}
+
+	if notifier != nil {
+		log.Infof("Sending notifications to %d channels.", len(config.Notify.Channels))
+		provider.AddListener(notifier.Observe)
+		notifier.Start(ctx, wg)
+	}
+
+	waitForFirstRead(ctx, config, readyGate)
+
+	if config.PIDFile != "" {
+		if err := writePIDFile(config.PIDFile); err != nil {
+			log.Fatalf("Error writing PID file: %s", err)
+		}
+		defer removePIDFile(config.PIDFile)
+	}
 
 	log.Info("Exporter is started.")
-	wg.Wait()
+	notifyReady()
+	<-ctx.Done()
+	shutdown(config.ShutdownTimeout, server, wg, b)
+	if handoffServer != nil {
+		handOff(handoffServer, provider, scheduledRefresh())
+	}
 	log.Info("Shutdown complete.")
 }
 
-func startSignalHandler(ctx context.Context, wg *sync.WaitGroup, cancel func()) {
+// shutdown stops the exporter after its context has been cancelled. The HTTP server finishes the current responses,
+// the background tasks stop their in-flight reads and the Bluetooth adapter is closed, so that it is not left
+// connected to a sensor. Whatever did not finish within the timeout is abandoned.
+func shutdown(timeout time.Duration, server *http.Server, wg *sync.WaitGroup, b backend.Backend) {
+	log.Infof("Shutting down, waiting at most %s...", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Warnf("Not all HTTP responses could be finished: %s", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Warnf("Background tasks did not finish within %s.", timeout)
+	}
+
+	if b == nil {
+		return
+	}
+
+	if err := b.Close(); err != nil {
+		log.Warnf("Error closing Bluetooth adapter: %s", err)
+	}
+}
+
+// outputRounders contains the Rounder of every output supporting rounding. It is nil for outputs keeping the full
+// precision.
+type outputRounders struct {
+	Metrics *rounding.Rounder
+	Heatmap *rounding.Rounder
+	MQTT    *rounding.Rounder
+}
+
+func newOutputRounders(cfg config.Config) outputRounders {
+	rounderFor := func(output string) *rounding.Rounder {
+		if !cfg.Rounding.Applies(output) {
+			return nil
+		}
+
+		return rounding.New(cfg.Rounding.Steps)
+	}
+
+	return outputRounders{
+		Metrics: rounderFor(config.RoundingMetrics),
+		Heatmap: rounderFor(config.RoundingHeatmap),
+		MQTT:    rounderFor(config.RoundingMQTT),
+	}
+}
+
+// lastSuccess returns the time of the last successful read of every sensor.
+func lastSuccess(stats map[string]updater.SensorStats) map[string]time.Time {
+	result := make(map[string]time.Time, len(stats))
+	for macAddress, s := range stats {
+		result[macAddress] = s.LastSuccess
+	}
+
+	return result
+}
+
+// waitForFirstRead delays the start until a sensor has been read if configured. If no sensor can be read in time, the
+// exporter exits or continues not being ready, depending on the configuration.
+func waitForFirstRead(ctx context.Context, cfg config.Config, gate *readiness.Gate) {
+	if gate == nil {
+		return
+	}
+
+	log.Infof("Waiting up to %s for the first successful read.", cfg.WaitForFirstRead)
+	err := gate.Wait(ctx, cfg.WaitForFirstRead)
+	switch {
+	case err == nil:
+		log.Info("First sensor has been read.")
+	case ctx.Err() != nil:
+	case cfg.WaitForFirstReadExit:
+		log.Fatalf("Exporter is not ready: %s", err)
+	default:
+		log.Errorf("Exporter is not ready: %s. Check the permissions of the Bluetooth adapter.", err)
+	}
+}
+
+// startupPing checks whether the configured sensors are in range before they are read for the first time, if configured.
+// Missing sensors are logged and exported as metric, or make the exporter exit, depending on the configuration.
+func startupPing(ctx context.Context, cfg config.Config, provider *updater.Updater, anonymizer *anonymize.Anonymizer) {
+	if cfg.StartupPing == 0 || len(cfg.Sensors) == 0 {
+		return
+	}
+
+	log.Infof("Checking that %d sensors are in range for up to %s...", len(cfg.Sensors), cfg.StartupPing)
+	result, err := ping.Run(ctx, provider.Scan, cfg.Sensors, cfg.StartupPing)
+	switch {
+	case ctx.Err() != nil:
+		return
+	case err != nil:
+		log.Errorf("Error during startup ping: %s", err)
+		return
+	}
+
+	if err := prometheus.Register(result.Metric(anonymizer)); err != nil {
+		log.Fatalf("Failed to register startup ping metrics: %s", err)
+	}
+
+	missing := result.Missing()
+	for _, s := range missing {
+		log.Warnf("Sensor %s has not been heard during the startup ping. Check its MAC address and its distance to the adapter.", s)
+	}
+
+	switch {
+	case len(missing) == 0:
+		log.Infof("All %d sensors are in range.", len(cfg.Sensors))
+	case cfg.RequireAllSensors:
+		log.Fatalf("%d of %d sensors have not been heard during the startup ping.", len(missing), len(cfg.Sensors))
+	}
+}
+
+// takeOver stops the exporter listening on the handoff socket, if there is one, and returns its state.
+func takeOver(cfg config.HandoffConfig) *handoff.State {
+	log.Infof("Taking over from running exporter using %s...", cfg.Socket)
+	state, ok, err := handoff.Take(cfg.Socket, cfg.Timeout)
+	switch {
+	case !ok && err != nil:
+		log.Fatalf("Error taking over from running exporter: %s", err)
+	case !ok:
+		log.Info("No running exporter found.")
+		return nil
+	case err != nil:
+		log.Warnf("Running exporter has been stopped, but its state could not be taken over: %s", err)
+		return nil
+	}
+
+	log.Infof("Took over the readings of %d sensors from the running exporter.", len(state.Readings))
+	return &state
+}
+
+// handOff passes the state to a new exporter after this exporter has been stopped, if one is taking over.
+func handOff(server *handoff.Server, provider *updater.Updater, next time.Time) {
+	err := server.Send(handoff.State{
+		Sensors:     provider.Stats(),
+		Readings:    provider.Readings(),
+		Schedule:    provider.Schedule(),
+		NextRefresh: next,
+	})
+	if err != nil {
+		log.Errorf("Error passing state to new exporter: %s", err)
+	}
+}
+
+func supportReport(cfg config.Config, provider *updater.Updater, logBuffer *support.LogBuffer, anonymizer *anonymize.Anonymizer) support.Report {
+	cfg.Sensors = provider.Sensors()
+	cfg = cfg.Redacted()
+	for i, s := range cfg.Sensors {
+		cfg.Sensors[i] = anonymizer.Sensor(s)
+	}
+
+	sensorErrors := provider.Errors()
+	for i, e := range sensorErrors {
+		sensorErrors[i].Sensor = anonymizer.Sensor(e.Sensor.Redacted())
+		sensorErrors[i].Error = anonymizer.String(e.Error, provider.Sensors())
+	}
+
+	return support.Report{
+		Time:    time.Now(),
+		Version: support.NewVersion(version, commit, date),
+		Config:  cfg,
+		Adapter: provider.Adapter(),
+		Errors:  sensorErrors,
+		Logs:    logBuffer.Lines(),
+	}
+}
+
+// recordEvents adds the reads and failures of the updater to the event log. Reads of a sensor are only recorded
+// once per interval, so that sensors sending advertisements do not push out all other events.
+func recordEvents(provider *updater.Updater, eventLog *events.Log, readInterval time.Duration) {
+	provider.AddListener(func(sensor config.Sensor, _ driver.Reading) {
+		eventLog.RecordThrottled(events.TypeRead, sensor, "", readInterval)
+	})
+	provider.AddErrorListener(func(sensor config.Sensor, err error) {
+		eventLog.Record(events.TypeFailure, sensor, err.Error())
+	})
+}
+
+// addDiscovered returns a function registering sensors found by the scanner and reading them right away.
+func addDiscovered(provider *updater.Updater, eventLog *events.Log) func(config.Sensor) {
+	return func(sensor config.Sensor) {
+		provider.AddSensor(sensor)
+		eventLog.Record(events.TypeSensorAdded, sensor, "discovered by scan")
+		if err := provider.Refresh(sensor.MacAddress); err != nil {
+			log.Debugf("Not refreshing discovered sensor: %s", err)
+		}
+	}
+}
+
+// logEgress reports the outbound connections configured, so that users can audit them.
+func logEgress(cfg config.Config) {
+	destinations := cfg.EgressDestinations()
+	switch {
+	case cfg.Egress.Disabled:
+		log.Info("Outbound connections are disabled.")
+	case len(destinations) == 0:
+		log.Info("No outbound connections configured.")
+	default:
+		for _, d := range destinations {
+			log.Infof("Outbound connection: %s", d)
+		}
+	}
+
+	if len(cfg.Egress.Allow) > 0 {
+		log.Infof("Egress allowlist: %s", strings.Join(cfg.Egress.Allow, ", "))
+	}
+}
+
+// createBackend returns the backend used for Bluetooth operations. Depending on the configuration this is either
+// a local adapter, an already running worker or a worker started by this process before dropping privileges.
+func createBackend(ctx context.Context, cancel func(), bleLog logrus.FieldLogger, cfg config.Config, deviceNames []string) (backend.Backend, error) {
+	switch {
+	case cfg.Privsep.WorkerSocket != "":
+		log.Infof("Using BLE worker at %s", cfg.Privsep.WorkerSocket)
+		return backend.Dial(cfg.Privsep.WorkerSocket)
+	case cfg.Privsep.User != "":
+		worker, err := privsep.StartWorker(ctx, bleLog, cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		go func() {
+			<-worker.Done()
+			cancel()
+		}()
+
+		if err := privsep.DropPrivileges(cfg.Privsep.User); err != nil {
+			return nil, err
+		}
+		log.Infof("Running as user %q, BLE worker at %s", cfg.Privsep.User, worker.Socket)
+
+		return backend.Dial(worker.Socket)
+	case len(deviceNames) == 1:
+		dumper, err := newDumper(cfg.Dump)
+		if err != nil {
+			return nil, err
+		}
+
+		return backend.NewLocal(bleLog, deviceNames[0], cfg.BLE, dumper)
+	case len(deviceNames) > 1:
+		dumper, err := newDumper(cfg.Dump)
+		if err != nil {
+			return nil, err
+		}
+
+		backends := make([]backend.Backend, 0, len(deviceNames))
+		for _, name := range deviceNames {
+			local, err := backend.NewLocal(bleLog.WithField("adapter", name), name, cfg.BLE, dumper)
+			if err != nil {
+				for _, b := range backends {
+					b.Close()
+				}
+				return nil, fmt.Errorf("adapter %s: %s", name, err)
+			}
+			backends = append(backends, local)
+		}
+
+		return backend.NewPool(bleLog, backends), nil
+	default:
+		return nil, nil
+	}
+}
+
+// newDumper returns the dumper writing the raw data of the devices to files or nil if dumping is disabled.
+func newDumper(cfg config.DumpConfig) (*rawdump.Dumper, error) {
+	if cfg.Dir == "" {
+		return nil, nil
+	}
+
+	log.Warnf("Writing raw data of the devices to %s", cfg.Dir)
+	return rawdump.New(cfg.Dir, cfg.Interval)
+}
+
+// startSignalHandler cancels the context on a shutdown signal, a stop request of the service manager or when quit is
+// closed.
+func startSignalHandler(ctx context.Context, wg *sync.WaitGroup, cancel func(), quit <-chan struct{}) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 
-		sigCh := make(chan os.Signal)
+		sigCh := make(chan os.Signal, 1)
 		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 
 		log.Debug("Signal handler ready.")
-		<-sigCh
-		log.Debug("Got shutdown signal.")
+		select {
+		case <-sigCh:
+			log.Debug("Got shutdown signal.")
+		case <-stop:
+			log.Debug("Got stop request from service manager.")
+		case <-quit:
+			log.Info("Got quit request.")
+		case <-ctx.Done():
+			// Stopped by other means, for example by a new exporter taking over.
+		}
 		signal.Reset()
 		cancel()
 	}()
 }
 
-func startScheduleLoop(ctx context.Context, wg *sync.WaitGroup, cfg config.Config, provider *updater.Updater) {
+func startReloadHandler(ctx context.Context, wg *sync.WaitGroup, reloader *reload.Reloader) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGHUP)
+		defer signal.Stop(sigCh)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sigCh:
+				log.Info("Got reload signal.")
+				if _, err := reloader.Reload(); err != nil {
+					log.Warn("Keeping the previous sensors.")
+				}
+			}
+		}
+	}()
+}
+
+// startScheduleLoop schedules all sensors for reading at first and then every refresh duration. The first refresh is
+// delayed after taking over from another exporter, which has read the sensors already. It returns a function
+// returning the time of the next refresh.
+func startScheduleLoop(ctx context.Context, wg *sync.WaitGroup, cfg config.Config, provider *updater.Updater, first time.Time) func() time.Time {
 	wg.Add(1)
 
-	refresher := time.NewTicker(cfg.RefreshDuration)
-	provider.UpdateAll(time.Now())
+	now := time.Now()
+	if first.Before(now) {
+		first = now
+	}
 
 	go func() {
 		defer wg.Done()
 
+		if delay := first.Sub(now); delay > 0 {
+			log.Infof("Continuing the schedule of the previous exporter, refreshing all sensors in %s.", delay.Round(time.Second))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+		}
+
+		refresher := time.NewTicker(cfg.RefreshDuration)
+		defer refresher.Stop()
+		provider.UpdateAll(time.Now())
+
 		log.Debug("Schedule loop ready.")
 		for {
 			select {
@@ -132,4 +1049,27 @@ func startScheduleLoop(ctx context.Context, wg *sync.WaitGroup, cfg config.Confi
 			}
 		}
 	}()
+
+	return func() time.Time {
+		return nextRefresh(first, cfg.RefreshDuration, time.Now())
+	}
+}
+
+// nextRefresh returns the first refresh after now, for refreshes starting at first and repeating every interval.
+func nextRefresh(first time.Time, interval time.Duration, now time.Time) time.Time {
+	if now.Before(first) {
+		return first
+	}
+
+	return first.Add((now.Sub(first)/interval + 1) * interval)
+}
+
+func hasPassiveSensors(sensors []config.Sensor) bool {
+	for _, s := range sensors {
+		if s.Passive() {
+			return true
+		}
+	}
+
+	return false
 }
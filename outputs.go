@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/xperimental/flowercare-exporter/internal/anonymize"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/egress"
+	"github.com/xperimental/flowercare-exporter/internal/influxdb"
+	"github.com/xperimental/flowercare-exporter/internal/logging"
+	"github.com/xperimental/flowercare-exporter/internal/mqtt"
+	"github.com/xperimental/flowercare-exporter/internal/otlp"
+	"github.com/xperimental/flowercare-exporter/internal/outputs"
+	"github.com/xperimental/flowercare-exporter/internal/updater"
+)
+
+// Names of the outputs which can be reloaded.
+const (
+	outputMQTT     = "mqtt"
+	outputInfluxDB = "influxdb"
+	outputOTLP     = "otlp"
+)
+
+// outputFactory creates the outputs which can be replaced by reloading their configuration. Settings which are not
+// part of the configuration of an output, like the egress policy, are kept from the start of the exporter.
+type outputFactory struct {
+	Loggers       *logging.Loggers
+	Egress        egress.Policy
+	Anonymizer    *anonymize.Anonymizer
+	Rounders      outputRounders
+	Provider      *updater.Updater
+	StaleDuration time.Duration
+}
+
+// apply starts the outputs of the configuration and replaces those whose settings changed. The MQTT publisher is
+// used instead of creating a new one if set, as it needs to read its certificates before the sandbox is applied. It
+// returns the names of the changed outputs.
+func (f *outputFactory) apply(set *outputs.Set, cfg config.Config, publisher *mqtt.Publisher) ([]string, error) {
+	var changed []string
+	replace := func(name string, outputConfig interface{}, enabled bool, create func() (outputs.Output, error)) error {
+		if !enabled {
+			create = nil
+		}
+
+		ok, err := set.Replace(name, outputConfig, create)
+		if err != nil {
+			return fmt.Errorf("can not create %s output: %s", name, err)
+		}
+
+		if ok {
+			changed = append(changed, name)
+		}
+		return nil
+	}
+
+	if err := replace(outputInfluxDB, cfg.InfluxDB, cfg.InfluxDB.URL != "", func() (outputs.Output, error) {
+		log.Infof("Writing readings to InfluxDB bucket %q at %s", cfg.InfluxDB.Bucket, cfg.InfluxDB.URL)
+		writer := influxdb.New(f.Loggers.For(logging.ModuleInfluxDB), cfg.InfluxDB, f.Egress.Transport(nil), f.Anonymizer)
+		return outputs.Output{
+			Listener: writer.Add,
+			Start:    writer.Start,
+		}, nil
+	}); err != nil {
+		return changed, err
+	}
+
+	if err := replace(outputOTLP, cfg.OTLP, cfg.OTLP.Endpoint != "", func() (outputs.Output, error) {
+		log.Infof("Exporting metrics to OpenTelemetry collector %s using %s every %s", cfg.OTLP.Endpoint, cfg.OTLP.Protocol, cfg.OTLP.Interval)
+		exporter := otlp.New(f.Loggers.For(logging.ModuleOTLP), cfg.OTLP, f.Egress)
+		exporter.Version = version
+		exporter.Sensors = f.Provider.Sensors
+		exporter.Source = f.Rounders.Metrics.Source(f.Provider.GetData)
+		exporter.StaleDuration = f.StaleDuration
+		exporter.Anonymizer = f.Anonymizer
+		return outputs.Output{
+			Start: exporter.Start,
+		}, nil
+	}); err != nil {
+		return changed, err
+	}
+
+	if err := replace(outputMQTT, cfg.MQTT, cfg.MQTT.Broker != "", func() (outputs.Output, error) {
+		p := publisher
+		if p == nil {
+			var err error
+			p, err = mqtt.New(f.Loggers.For(logging.ModuleMQTT), cfg.MQTT, f.Anonymizer)
+			if err != nil {
+				return outputs.Output{}, err
+			}
+		}
+
+		log.Infof("Publishing readings to MQTT broker %s", cfg.MQTT.Broker)
+		return outputs.Output{
+			Listener: f.Rounders.MQTT.Listener(p.Add),
+			Start:    p.Start,
+		}, nil
+	}); err != nil {
+		return changed, err
+	}
+
+	return changed, nil
+}
+
+// reload reads the configuration again from the arguments and files and applies the settings of the outputs.
+func (f *outputFactory) reload(set *outputs.Set, args []string) ([]string, error) {
+	cfg, err := config.ParseArgs(log, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.apply(set, cfg, nil)
+}
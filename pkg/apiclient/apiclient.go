@@ -0,0 +1,280 @@
+// Package apiclient provides a client for the control API of the exporter, which can be used by companion tools
+// for listing sensors, getting their readings, triggering reads and managing silences.
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Prefix is the path prefix of all API endpoints.
+	Prefix = "/api/v1/"
+
+	sensorsPath  = Prefix + "sensors"
+	eventsPath   = Prefix + "events"
+	alertsPath   = Prefix + "alerts"
+	silencesPath = Prefix + "silences"
+	// SupportPath is the path of the support report.
+	SupportPath = Prefix + "support"
+
+	defaultTimeout = 10 * time.Second
+)
+
+// StatusError is returned when the exporter responds with an unexpected status.
+type StatusError struct {
+	StatusCode int
+	// Message contains the error message sent by the exporter.
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("unexpected status: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+
+	return fmt.Sprintf("unexpected status: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Client calls the control API of an exporter.
+type Client struct {
+	baseURL string
+	token   string
+
+	// HTTPClient is used for the requests. It defaults to a client with a timeout of ten seconds.
+	HTTPClient *http.Client
+}
+
+// New creates a client for the exporter at the base URL, for example "http://localhost:9294". The token is sent
+// with every request and needs the scope required by the endpoints used.
+func New(baseURL, token string) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		HTTPClient: &http.Client{
+			Timeout: defaultTimeout,
+		},
+	}
+}
+
+// Sensors lists all sensors together with their latest readings.
+func (c *Client) Sensors(ctx context.Context) ([]SensorStatus, error) {
+	var result []SensorStatus
+	if err := c.do(ctx, http.MethodGet, sensorsPath, nil, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Sensor returns a single sensor together with its latest reading.
+func (c *Client) Sensor(ctx context.Context, macAddress string) (SensorStatus, error) {
+	var result SensorStatus
+	if err := c.do(ctx, http.MethodGet, sensorPath(macAddress), nil, &result); err != nil {
+		return SensorStatus{}, err
+	}
+
+	return result, nil
+}
+
+// Reading returns the latest reading of a sensor.
+func (c *Client) Reading(ctx context.Context, macAddress string) (Reading, error) {
+	status, err := c.Sensor(ctx, macAddress)
+	if err != nil {
+		return Reading{}, err
+	}
+
+	if status.Data == nil {
+		return Reading{}, fmt.Errorf("no data for sensor %s: %s", macAddress, status.Error)
+	}
+
+	return *status.Data, nil
+}
+
+// AddSensor adds a sensor. It needs a token with the admin scope.
+func (c *Client) AddSensor(ctx context.Context, sensor Sensor) (SensorStatus, error) {
+	var result SensorStatus
+	if err := c.do(ctx, http.MethodPost, sensorsPath, sensor, &result); err != nil {
+		return SensorStatus{}, err
+	}
+
+	return result, nil
+}
+
+// RemoveSensor removes a sensor. It needs a token with the admin scope.
+func (c *Client) RemoveSensor(ctx context.Context, macAddress string) error {
+	return c.do(ctx, http.MethodDelete, sensorPath(macAddress), nil, nil)
+}
+
+// Refresh triggers a read of the sensor. The read is done asynchronously, the new values can be fetched using
+// Reading afterwards. It needs a token with the trigger scope.
+func (c *Client) Refresh(ctx context.Context, macAddress string) error {
+	return c.do(ctx, http.MethodPost, sensorPath(macAddress)+"/refresh", nil, nil)
+}
+
+// History downloads the values stored on a sensor, at most limit entries starting with the most recent one. Zero
+// returns all entries. It needs a token with the trigger scope and the history-download feature enabled on the
+// exporter. Reading the whole history of a sensor can take several minutes, longer than the default timeout of the
+// HTTPClient.
+func (c *Client) History(ctx context.Context, macAddress string, limit int) ([]Reading, error) {
+	var result []Reading
+	if err := c.do(ctx, http.MethodGet, historyPath(macAddress, "json", limit), nil, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// HistoryCSV works like History, but writes the values to w as CSV, as formatted by the exporter.
+func (c *Client) HistoryCSV(ctx context.Context, macAddress string, limit int, w io.Writer) error {
+	return c.do(ctx, http.MethodGet, historyPath(macAddress, "csv", limit), nil, w)
+}
+
+func historyPath(macAddress, format string, limit int) string {
+	query := url.Values{}
+	query.Set("format", format)
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	return sensorPath(macAddress) + "/history?" + query.Encode()
+}
+
+// Events lists the recent events, newest first. The events can be restricted to some types and limited to a
+// number of events. Zero returns all events.
+func (c *Client) Events(ctx context.Context, types []string, limit int) ([]Event, error) {
+	query := url.Values{}
+	if len(types) > 0 {
+		query.Set("type", strings.Join(types, ","))
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	path := eventsPath
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var result []Event
+	if err := c.do(ctx, http.MethodGet, path, nil, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Alerts lists the active alerts.
+func (c *Client) Alerts(ctx context.Context) ([]Alert, error) {
+	var result []Alert
+	if err := c.do(ctx, http.MethodGet, alertsPath, nil, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Acknowledge acknowledges an alert. It needs a token with the trigger scope.
+func (c *Client) Acknowledge(ctx context.Context, id string) (Alert, error) {
+	var result Alert
+	if err := c.do(ctx, http.MethodPost, alertsPath+"/"+url.PathEscape(id)+"/ack", nil, &result); err != nil {
+		return Alert{}, err
+	}
+
+	return result, nil
+}
+
+// Silences lists the silences.
+func (c *Client) Silences(ctx context.Context) ([]Silence, error) {
+	var result []Silence
+	if err := c.do(ctx, http.MethodGet, silencesPath, nil, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// AddSilence creates a silence. It needs a token with the trigger scope.
+func (c *Client) AddSilence(ctx context.Context, req SilenceRequest) (Silence, error) {
+	var result Silence
+	if err := c.do(ctx, http.MethodPost, silencesPath, req, &result); err != nil {
+		return Silence{}, err
+	}
+
+	return result, nil
+}
+
+// RemoveSilence removes a silence. It needs a token with the trigger scope.
+func (c *Client) RemoveSilence(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, silencesPath+"/"+url.PathEscape(id), nil, nil)
+}
+
+// Support fetches the support report of the exporter into the result. It needs a token with the admin scope.
+func (c *Client) Support(ctx context.Context, result interface{}) error {
+	return c.do(ctx, http.MethodGet, SupportPath, nil, result)
+}
+
+func sensorPath(macAddress string) string {
+	return sensorsPath + "/" + url.PathEscape(macAddress)
+}
+
+// do sends the request with the body encoded as JSON and decodes the response into the result, if both are set.
+// If the result is an io.Writer, the response is copied to it unchanged.
+func (c *Client) do(ctx context.Context, method, path string, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("can not encode request: %s", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return &StatusError{
+			StatusCode: res.StatusCode,
+			Message:    strings.TrimSpace(string(message)),
+		}
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	if w, ok := result.(io.Writer); ok {
+		_, err := io.Copy(w, res.Body)
+		return err
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(result); err != nil {
+		return fmt.Errorf("can not decode response: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package apiclient
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Sensor contains the configuration of a sensor, using the same fields as the sensor JSON files.
+type Sensor struct {
+	Name       string `json:"name"`
+	MacAddress string `json:"sensor"`
+	Type       string `json:"type,omitempty"`
+	Driver     string `json:"driver,omitempty"`
+	Key        string `json:"key,omitempty"`
+	Group      string `json:"group,omitempty"`
+	// Quirks contains the per-sensor corrections, which are passed on unchanged.
+	Quirks         json.RawMessage `json:"quirks,omitempty"`
+	Placement      string          `json:"placement,omitempty"`
+	Mode           string          `json:"mode,omitempty"`
+	Species        string          `json:"pid,omitempty"`
+	ScientificName string          `json:"display_pid,omitempty"`
+	CommonName     string          `json:"common_name,omitempty"`
+	Position       *Position       `json:"position,omitempty"`
+	Owners         []string        `json:"owners,omitempty"`
+	Parameter      Parameter       `json:"parameter"`
+}
+
+// Position is the location of a sensor on a floor or greenhouse plan.
+type Position struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Parameter contains the ranges configured for the plant.
+type Parameter struct {
+	MaxSoilMoist int `json:"max_soil_moist"`
+	MinSoilMoist int `json:"min_soil_moist"`
+	MaxSoilEc    int `json:"max_soil_ec"`
+	MinSoilEc    int `json:"min_soil_ec"`
+	MaxLightLux  int `json:"max_light_lux"`
+	MinLightLux  int `json:"min_light_lux"`
+}
+
+// Reading contains the values read from a sensor. Values which are not supported by a device are nil.
+type Reading struct {
+	Time                    time.Time `json:"time"`
+	Firmware                string    `json:"firmware,omitempty"`
+	Battery                 *float64  `json:"battery,omitempty"`
+	Temperature             *float64  `json:"temperature,omitempty"`
+	Moisture                *float64  `json:"moisture,omitempty"`
+	Light                   *float64  `json:"light,omitempty"`
+	Conductivity            *float64  `json:"conductivity,omitempty"`
+	Humidity                *float64  `json:"humidity,omitempty"`
+	BatteryVoltage          *float64  `json:"batteryVoltage,omitempty"`
+	ConductivityCompensated *float64  `json:"conductivityCompensated,omitempty"`
+	RSSI                    *float64  `json:"rssi,omitempty"`
+	Via                     string    `json:"via,omitempty"`
+}
+
+// SensorStatus contains a sensor and its latest data. Error is set if no data is available.
+type SensorStatus struct {
+	Sensor Sensor   `json:"sensor"`
+	Data   *Reading `json:"data,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// Event is an entry of the event log of the exporter.
+type Event struct {
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+	// Sensor is nil for events not related to a sensor.
+	Sensor  *Sensor `json:"sensor,omitempty"`
+	Message string  `json:"message,omitempty"`
+}
+
+// Alert is raised when a value of a sensor crosses a threshold.
+type Alert struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	Description string    `json:"description"`
+	Sensor      Sensor    `json:"sensor"`
+	Value       float64   `json:"value"`
+	Threshold   float64   `json:"threshold"`
+	Unit        string    `json:"unit"`
+	StartsAt    time.Time `json:"startsAt"`
+	// EndsAt is zero while the alert is firing.
+	EndsAt         time.Time `json:"endsAt"`
+	Acknowledged   bool      `json:"acknowledged"`
+	AcknowledgedBy string    `json:"acknowledgedBy,omitempty"`
+	Silenced       bool      `json:"silenced"`
+	Escalation     int       `json:"escalation"`
+}
+
+// Silence suppresses the notifications of matching alerts.
+type Silence struct {
+	ID string `json:"id"`
+	// Sensor is the MAC address of the silenced sensor. All sensors are matched if it is empty.
+	Sensor string `json:"sensor,omitempty"`
+	// Type is the silenced alert type. All types are matched if it is empty.
+	Type      string    `json:"type,omitempty"`
+	StartsAt  time.Time `json:"startsAt"`
+	EndsAt    time.Time `json:"endsAt"`
+	CreatedBy string    `json:"createdBy"`
+	Comment   string    `json:"comment,omitempty"`
+}
+
+// SilenceRequest is used for creating a silence. Either the duration or the end time needs to be set.
+type SilenceRequest struct {
+	Sensor   string    `json:"sensor,omitempty"`
+	Type     string    `json:"type,omitempty"`
+	Duration string    `json:"duration,omitempty"`
+	EndsAt   time.Time `json:"endsAt,omitempty"`
+	Comment  string    `json:"comment,omitempty"`
+}
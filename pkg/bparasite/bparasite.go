@@ -0,0 +1,80 @@
+// Package bparasite decodes the advertisements sent by b-parasite open-hardware soil sensors.
+//
+// This implements version 2 of the custom advertisement protocol, which is sent as service data of the
+// Environmental Sensing service. Firmware using BTHome instead is handled by the bthome package.
+package bparasite
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/go-ble/ble"
+)
+
+const (
+	protocolVersion = 2
+	minLength       = 16
+	lightLength     = 18
+	flagLight       = 0x01
+)
+
+// ServiceUUID is the UUID of the service data containing the measurements.
+var ServiceUUID = ble.UUID16(0x181a)
+
+// Data contains the values sent by the sensor.
+type Data struct {
+	Counter        byte
+	BatteryVoltage float64
+	Temperature    float64
+	Humidity       float64
+	Moisture       float64
+	HasLight       bool
+	Light          uint16
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (d *Data) UnmarshalBinary(data []byte) error {
+	// VF CC BB BB TT TT HH HH MM MM AA AA AA AA AA AA [LL LL]
+	if len(data) < minLength {
+		return fmt.Errorf("data not long enough: %d < %d", len(data), minLength)
+	}
+
+	if version := data[0] >> 4; version != protocolVersion {
+		return fmt.Errorf("unsupported protocol version: %d", version)
+	}
+
+	d.HasLight = data[0]&flagLight != 0
+	if d.HasLight && len(data) < lightLength {
+		return fmt.Errorf("data not long enough for light value: %d < %d", len(data), lightLength)
+	}
+
+	d.Counter = data[1] & 0x0f
+	d.BatteryVoltage = float64(binary.BigEndian.Uint16(data[2:])) / 1000
+	d.Temperature = float64(int16(binary.BigEndian.Uint16(data[4:]))) / 100
+	d.Humidity = float64(binary.BigEndian.Uint16(data[6:])) * 100 / 0xffff
+	d.Moisture = float64(binary.BigEndian.Uint16(data[8:])) * 100 / 0xffff
+
+	if d.HasLight {
+		d.Light = binary.BigEndian.Uint16(data[16:])
+	}
+
+	return nil
+}
+
+// Decode extracts the data from the advertisement of a sensor.
+func Decode(a ble.Advertisement) (Data, error) {
+	for _, s := range a.ServiceData() {
+		if !s.UUID.Equal(ServiceUUID) {
+			continue
+		}
+
+		var d Data
+		if err := d.UnmarshalBinary(s.Data); err != nil {
+			return Data{}, err
+		}
+
+		return d, nil
+	}
+
+	return Data{}, fmt.Errorf("advertisement contains no service data %s", ServiceUUID)
+}
@@ -0,0 +1,23 @@
+package bparasite
+
+import "testing"
+
+func FuzzData(f *testing.F) {
+	f.Add([]byte{0x21, 0x0a, 0x0b, 0xb8, 0x09, 0xc4, 0x80, 0x00, 0x40, 0x00, 0xf0, 0xca, 0x1e, 0x0b, 0x30, 0x9c, 0x01, 0xf4})
+	f.Add([]byte{0x20, 0x0b, 0x0b, 0xb8, 0x09, 0xc4, 0x80, 0x00, 0x40, 0x00, 0xf0, 0xca, 0x1e, 0x0b, 0x30, 0x9c})
+	f.Add([]byte{0x21, 0x0c, 0x0b, 0xb8, 0x09, 0xc4, 0x80, 0x00, 0x40, 0x00, 0xf0, 0xca, 0x1e, 0x0b, 0x30, 0x9c})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var d Data
+		if err := d.UnmarshalBinary(data); err != nil {
+			return
+		}
+
+		if d.Moisture < 0 || d.Moisture > 100 {
+			t.Errorf("moisture out of range: %f", d.Moisture)
+		}
+		if d.Humidity < 0 || d.Humidity > 100 {
+			t.Errorf("humidity out of range: %f", d.Humidity)
+		}
+	})
+}
@@ -0,0 +1,298 @@
+// Package bthome decodes advertisements using the BTHome v2 format, including encrypted payloads.
+//
+// See https://bthome.io/format/ for the specification.
+package bthome
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/go-ble/ble"
+)
+
+const (
+	flagEncrypted    = 0x01
+	flagTriggerBased = 0x04
+	versionShift     = 5
+	supportedVersion = 2
+
+	counterLength = 4
+	micLength     = 4
+	keyLength     = 16
+)
+
+var (
+	// ServiceUUID is the UUID of the service data containing BTHome payloads.
+	ServiceUUID = ble.UUID16(0xfcd2)
+
+	// ErrMissingKey is returned when an encrypted payload is received, but no key has been provided.
+	ErrMissingKey = errors.New("payload is encrypted but no key provided")
+)
+
+// Measurement contains a single value contained in a packet.
+type Measurement struct {
+	ObjectID byte
+	Name     string
+	Value    float64
+}
+
+// Packet contains the decoded contents of a BTHome advertisement.
+type Packet struct {
+	Encrypted    bool
+	TriggerBased bool
+	Counter      uint32
+	Measurements []Measurement
+}
+
+// Value returns the first measurement with the specified name.
+func (p Packet) Value(name string) (float64, bool) {
+	for _, m := range p.Measurements {
+		if m.Name == name {
+			return m.Value, true
+		}
+	}
+
+	return 0, false
+}
+
+type objectType struct {
+	Name   string
+	Size   int
+	Signed bool
+	Factor float64
+}
+
+// Object types which are known to the decoder. Every object needs to be known to be able to continue parsing.
+var objectTypes = map[byte]objectType{
+	0x00: {"packet_id", 1, false, 1},
+	0x01: {"battery", 1, false, 1},
+	0x02: {"temperature", 2, true, 0.01},
+	0x03: {"humidity", 2, false, 0.01},
+	0x04: {"pressure", 3, false, 0.01},
+	0x05: {"illuminance", 3, false, 0.01},
+	0x06: {"mass_kg", 2, false, 0.01},
+	0x07: {"mass_lb", 2, false, 0.01},
+	0x08: {"dewpoint", 2, true, 0.01},
+	0x09: {"count", 1, false, 1},
+	0x0a: {"energy", 3, false, 0.001},
+	0x0b: {"power", 3, false, 0.01},
+	0x0c: {"voltage", 2, false, 0.001},
+	0x0d: {"pm2_5", 2, false, 1},
+	0x0e: {"pm10", 2, false, 1},
+	0x0f: {"generic_boolean", 1, false, 1},
+	0x10: {"power_on", 1, false, 1},
+	0x11: {"opening", 1, false, 1},
+	0x12: {"co2", 2, false, 1},
+	0x13: {"tvoc", 2, false, 1},
+	0x14: {"moisture", 2, false, 0.01},
+	0x15: {"battery_low", 1, false, 1},
+	0x16: {"battery_charging", 1, false, 1},
+	0x17: {"carbon_monoxide", 1, false, 1},
+	0x18: {"cold", 1, false, 1},
+	0x19: {"connectivity", 1, false, 1},
+	0x1a: {"door", 1, false, 1},
+	0x1b: {"garage_door", 1, false, 1},
+	0x1c: {"gas", 1, false, 1},
+	0x1d: {"heat", 1, false, 1},
+	0x1e: {"light", 1, false, 1},
+	0x1f: {"lock", 1, false, 1},
+	0x20: {"moisture_binary", 1, false, 1},
+	0x21: {"motion", 1, false, 1},
+	0x22: {"moving", 1, false, 1},
+	0x23: {"occupancy", 1, false, 1},
+	0x24: {"plug", 1, false, 1},
+	0x25: {"presence", 1, false, 1},
+	0x26: {"problem", 1, false, 1},
+	0x27: {"running", 1, false, 1},
+	0x28: {"safety", 1, false, 1},
+	0x29: {"smoke", 1, false, 1},
+	0x2a: {"sound", 1, false, 1},
+	0x2b: {"tamper", 1, false, 1},
+	0x2c: {"vibration", 1, false, 1},
+	0x2d: {"window", 1, false, 1},
+	0x2e: {"humidity", 1, false, 1},
+	0x2f: {"moisture", 1, false, 1},
+	0x3a: {"button", 1, false, 1},
+	0x3c: {"dimmer", 2, false, 1},
+	0x3d: {"count", 2, false, 1},
+	0x3e: {"count", 4, false, 1},
+	0x3f: {"rotation", 2, true, 0.1},
+	0x40: {"distance_mm", 2, false, 1},
+	0x41: {"distance_m", 2, false, 0.1},
+	0x42: {"duration", 3, false, 0.001},
+	0x43: {"current", 2, false, 0.001},
+	0x44: {"speed", 2, false, 0.01},
+	0x45: {"temperature", 2, true, 0.1},
+	0x46: {"uv_index", 1, false, 0.1},
+	0x47: {"volume_l", 2, false, 0.1},
+	0x48: {"volume_ml", 2, false, 1},
+	0x49: {"volume_flow_rate", 2, false, 0.001},
+	0x4a: {"voltage", 2, false, 0.1},
+	0x4b: {"gas", 3, false, 0.001},
+	0x4c: {"gas", 4, false, 0.001},
+	0x4d: {"energy", 4, false, 0.001},
+	0x4e: {"volume", 4, false, 0.001},
+	0x4f: {"water", 4, false, 0.001},
+	0x50: {"timestamp", 4, false, 1},
+	0x51: {"acceleration", 2, false, 0.001},
+	0x52: {"gyroscope", 2, false, 0.001},
+	0x55: {"volume_storage", 4, false, 0.001},
+	0x56: {"conductivity", 2, false, 1},
+	0x57: {"temperature", 1, true, 1},
+	0x58: {"temperature", 1, true, 0.35},
+	0x59: {"count", 1, true, 1},
+	0x5a: {"count", 2, true, 1},
+	0x5b: {"count", 4, true, 1},
+	0x5c: {"power", 4, true, 0.01},
+	0x5d: {"current", 2, true, 0.001},
+	0x5e: {"direction", 2, false, 0.01},
+	0x5f: {"precipitation", 2, false, 0.1},
+	0x60: {"channel", 1, false, 1},
+	0xf0: {"device_type_id", 2, false, 1},
+	0xf1: {"firmware_version", 4, false, 1},
+	0xf2: {"firmware_version", 3, false, 1},
+}
+
+// Object types with a variable length, which is contained in the first byte of the value.
+const (
+	objectText = 0x53
+	objectRaw  = 0x54
+)
+
+// Decode extracts the BTHome packet from an advertisement. The key is only needed for encrypted payloads.
+func Decode(a ble.Advertisement, key []byte) (Packet, error) {
+	for _, s := range a.ServiceData() {
+		if !s.UUID.Equal(ServiceUUID) {
+			continue
+		}
+
+		mac, err := net.ParseMAC(a.Addr().String())
+		if err != nil {
+			return Packet{}, fmt.Errorf("can not parse address: %s", err)
+		}
+
+		return Parse(mac, s.Data, key)
+	}
+
+	return Packet{}, fmt.Errorf("advertisement contains no service data %s", ServiceUUID)
+}
+
+// Parse decodes the service data sent by the device with the specified MAC address.
+func Parse(mac []byte, data []byte, key []byte) (Packet, error) {
+	if len(data) < 1 {
+		return Packet{}, errors.New("empty payload")
+	}
+
+	info := data[0]
+	if version := info >> versionShift; version != supportedVersion {
+		return Packet{}, fmt.Errorf("unsupported BTHome version: %d", version)
+	}
+
+	packet := Packet{
+		Encrypted:    info&flagEncrypted != 0,
+		TriggerBased: info&flagTriggerBased != 0,
+	}
+
+	payload := data[1:]
+	if packet.Encrypted {
+		if len(key) == 0 {
+			return Packet{}, ErrMissingKey
+		}
+
+		counter, plain, err := decrypt(mac, info, payload, key)
+		if err != nil {
+			return Packet{}, err
+		}
+		packet.Counter = counter
+		payload = plain
+	}
+
+	measurements, err := parseObjects(payload)
+	packet.Measurements = measurements
+	return packet, err
+}
+
+func parseObjects(payload []byte) ([]Measurement, error) {
+	result := []Measurement{}
+	for pos := 0; pos < len(payload); {
+		id := payload[pos]
+		pos++
+
+		if id == objectText || id == objectRaw {
+			if pos >= len(payload) {
+				return result, fmt.Errorf("missing length of object 0x%02x", id)
+			}
+			length := int(payload[pos])
+			pos++
+			if pos+length > len(payload) {
+				return result, fmt.Errorf("object 0x%02x truncated: need %d bytes, have %d", id, length, len(payload)-pos)
+			}
+			pos += length
+			continue
+		}
+
+		t, ok := objectTypes[id]
+		if !ok {
+			return result, fmt.Errorf("unknown object id: 0x%02x", id)
+		}
+
+		if pos+t.Size > len(payload) {
+			return result, fmt.Errorf("object 0x%02x truncated: need %d bytes, have %d", id, t.Size, len(payload)-pos)
+		}
+
+		result = append(result, Measurement{
+			ObjectID: id,
+			Name:     t.Name,
+			Value:    readValue(payload[pos:pos+t.Size], t.Signed) * t.Factor,
+		})
+		pos += t.Size
+	}
+
+	return result, nil
+}
+
+func readValue(raw []byte, signed bool) float64 {
+	var value uint64
+	for i := len(raw) - 1; i >= 0; i-- {
+		value = value<<8 | uint64(raw[i])
+	}
+
+	if !signed {
+		return float64(value)
+	}
+
+	shift := 64 - 8*len(raw)
+	return float64(int64(value<<shift) >> shift)
+}
+
+func decrypt(mac []byte, info byte, payload []byte, key []byte) (uint32, []byte, error) {
+	if len(key) != keyLength {
+		return 0, nil, fmt.Errorf("invalid key length: %d != %d", len(key), keyLength)
+	}
+
+	if len(mac) != 6 {
+		return 0, nil, fmt.Errorf("invalid MAC address length: %d", len(mac))
+	}
+
+	if len(payload) < counterLength+micLength {
+		return 0, nil, fmt.Errorf("encrypted payload too short: %d", len(payload))
+	}
+
+	cipherText := payload[:len(payload)-counterLength-micLength]
+	counter := payload[len(cipherText) : len(cipherText)+counterLength]
+	mic := payload[len(payload)-micLength:]
+
+	nonce := make([]byte, 0, 13)
+	nonce = append(nonce, mac...)
+	nonce = append(nonce, 0xd2, 0xfc, info)
+	nonce = append(nonce, counter...)
+
+	plain, err := decryptCCM(key, nonce, cipherText, mic)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return binary.LittleEndian.Uint32(counter), plain, nil
+}
@@ -0,0 +1,94 @@
+package bthome
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseEncrypted(t *testing.T) {
+	// Example of the BTHome specification: temperature 25.06 °C and humidity 50.55 % encrypted using the counter
+	// 0x33221100.
+	data := mustDecodeHex("41a47266c95f730011223378237214")
+
+	for _, tc := range []struct {
+		desc    string
+		mac     []byte
+		data    []byte
+		key     []byte
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			mac:  fuzzMAC,
+			data: data,
+			key:  fuzzKey,
+		},
+		{
+			desc:    "wrong key",
+			mac:     fuzzMAC,
+			data:    data,
+			key:     mustDecodeHex("231d39c1d7cc1ab1aee224cd096db933"),
+			wantErr: true,
+		},
+		{
+			desc:    "wrong address",
+			mac:     []byte{0x54, 0x48, 0xe6, 0x8f, 0x80, 0xa6},
+			data:    data,
+			key:     fuzzKey,
+			wantErr: true,
+		},
+		{
+			desc:    "modified ciphertext",
+			mac:     fuzzMAC,
+			data:    mustDecodeHex("41a47266c95f740011223378237214"),
+			key:     fuzzKey,
+			wantErr: true,
+		},
+		{
+			desc:    "modified mic",
+			mac:     fuzzMAC,
+			data:    mustDecodeHex("41a47266c95f730011223378237215"),
+			key:     fuzzKey,
+			wantErr: true,
+		},
+		{
+			desc:    "short key",
+			mac:     fuzzMAC,
+			data:    data,
+			key:     fuzzKey[:15],
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			packet, err := Parse(tc.mac, tc.data, tc.key)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("got packet %#v, want error", packet)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %q", err)
+			}
+
+			if !packet.Encrypted {
+				t.Error("packet not marked as encrypted")
+			}
+			if packet.Counter != 0x33221100 {
+				t.Errorf("got counter 0x%08x, want 0x33221100", packet.Counter)
+			}
+			for name, want := range map[string]float64{
+				"temperature": 25.06,
+				"humidity":    50.55,
+			} {
+				value, ok := packet.Value(name)
+				switch {
+				case !ok:
+					t.Errorf("%s missing", name)
+				case math.Abs(value-want) > 0.001:
+					t.Errorf("got %s %v, want %v", name, value, want)
+				}
+			}
+		})
+	}
+}
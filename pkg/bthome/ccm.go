@@ -0,0 +1,72 @@
+package bthome
+
+import (
+	"crypto/aes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+)
+
+// decryptCCM decrypts and authenticates a message using AES-CCM as described in RFC 3610.
+// It only supports what is needed for BTHome: a 13 byte nonce, no additional data and a tag of the length of mic.
+func decryptCCM(key, nonce, cipherText, mic []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("can not create cipher: %s", err)
+	}
+
+	const lengthSize = 2
+	if len(nonce) != aes.BlockSize-1-lengthSize {
+		return nil, fmt.Errorf("invalid nonce length: %d", len(nonce))
+	}
+
+	if len(cipherText) > 0xffff {
+		return nil, fmt.Errorf("message too long: %d", len(cipherText))
+	}
+
+	counterBlock := func(i int) []byte {
+		b := make([]byte, aes.BlockSize)
+		b[0] = lengthSize - 1
+		copy(b[1:], nonce)
+		b[aes.BlockSize-2] = byte(i >> 8)
+		b[aes.BlockSize-1] = byte(i)
+		return b
+	}
+
+	stream := make([]byte, aes.BlockSize)
+	plain := make([]byte, len(cipherText))
+	for i := 0; i*aes.BlockSize < len(cipherText); i++ {
+		block.Encrypt(stream, counterBlock(i+1))
+
+		start := i * aes.BlockSize
+		for j := 0; j < aes.BlockSize && start+j < len(cipherText); j++ {
+			plain[start+j] = cipherText[start+j] ^ stream[j]
+		}
+	}
+
+	mac := make([]byte, aes.BlockSize)
+	mac[0] = byte(((len(mic)-2)/2)<<3) | (lengthSize - 1)
+	copy(mac[1:], nonce)
+	mac[aes.BlockSize-2] = byte(len(plain) >> 8)
+	mac[aes.BlockSize-1] = byte(len(plain))
+	block.Encrypt(mac, mac)
+
+	for i := 0; i < len(plain); i += aes.BlockSize {
+		for j := 0; j < aes.BlockSize && i+j < len(plain); j++ {
+			mac[j] ^= plain[i+j]
+		}
+		block.Encrypt(mac, mac)
+	}
+
+	block.Encrypt(stream, counterBlock(0))
+	expected := make([]byte, len(mic))
+	for i := range expected {
+		expected[i] = mac[i] ^ stream[i]
+	}
+
+	if subtle.ConstantTimeCompare(expected, mic) != 1 {
+		return nil, errors.New("message authentication failed")
+	}
+
+	return plain, nil
+}
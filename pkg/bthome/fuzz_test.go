@@ -0,0 +1,45 @@
+package bthome
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+var (
+	fuzzMAC = []byte{0x54, 0x48, 0xe6, 0x8f, 0x80, 0xa5}
+	fuzzKey = mustDecodeHex("231d39c1d7cc1ab1aee224cd096db932")
+)
+
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
+
+func FuzzParse(f *testing.F) {
+	// Battery and temperature.
+	f.Add([]byte{0x40, 0x01, 0x61, 0x02, 0xca, 0x09}, false)
+	// Text and raw objects followed by moisture and conductivity.
+	f.Add([]byte{0x40, 0x53, 0x02, 'h', 'i', 0x54, 0x01, 0xff, 0x14, 0x34, 0x12, 0x56, 0x2c, 0x01}, false)
+	// Unknown object after humidity.
+	f.Add([]byte{0x40, 0x2e, 0x32, 0xfe, 0x01}, false)
+	// Encrypted temperature and humidity.
+	f.Add(mustDecodeHex("41a47266c95f730011223378237214"), true)
+
+	f.Fuzz(func(t *testing.T, data []byte, useKey bool) {
+		var key []byte
+		if useKey {
+			key = fuzzKey
+		}
+
+		packet, _ := Parse(fuzzMAC, data, key)
+		for _, m := range packet.Measurements {
+			if m.Name == "" {
+				t.Errorf("measurement without name: %#v", m)
+			}
+		}
+	})
+}
@@ -0,0 +1,170 @@
+// Package flowerpower provides a function to read data from Parrot Flower Power sensors using Bluetooth LE.
+//
+// The sensors report raw ADC values, which are converted using the calibration curves published with the
+// official SDK. Light is reported as photosynthetically active radiation and converted to an approximate
+// lux value for sunlight.
+package flowerpower
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/go-ble/ble"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// LiveServiceUUID is the UUID of the service providing the live measurements.
+	LiveServiceUUID = ble.MustParse("39e1fa00-84a8-11e2-afba-0002a5d5c51b")
+
+	sunlightUUID     = ble.MustParse("39e1fa01-84a8-11e2-afba-0002a5d5c51b")
+	conductivityUUID = ble.MustParse("39e1fa02-84a8-11e2-afba-0002a5d5c51b")
+	airTempUUID      = ble.MustParse("39e1fa04-84a8-11e2-afba-0002a5d5c51b")
+	moistureUUID     = ble.MustParse("39e1fa05-84a8-11e2-afba-0002a5d5c51b")
+
+	batteryServiceUUID = ble.UUID16(0x180f)
+	batteryLevelUUID   = ble.UUID16(0x2a19)
+	deviceInfoUUID     = ble.UUID16(0x180a)
+	firmwareUUID       = ble.UUID16(0x2a26)
+)
+
+const (
+	// Conversion factor from PAR in µmol/m²/s to lux for sunlight.
+	factorParToLux = 54
+	// Maximum raw conductivity value, which corresponds to 10 mS/cm.
+	maxRawConductivity = 1771
+)
+
+// Data contains the data read from the sensor as well as a timestamp.
+type Data struct {
+	Time         time.Time
+	Firmware     string
+	Battery      byte
+	Temperature  float64
+	Moisture     float64
+	Light        float64
+	Conductivity float64
+}
+
+// ConvertTemperature converts the raw temperature value to degrees celsius.
+func ConvertTemperature(raw uint16) float64 {
+	x := float64(raw)
+	t := 0.00000003044*math.Pow(x, 3) - 0.00008038*math.Pow(x, 2) + 0.1149*x - 30.45
+	return clamp(t, -10, 55)
+}
+
+// ConvertMoisture converts the raw soil moisture value to volumetric water content in percent.
+func ConvertMoisture(raw uint16) float64 {
+	x := float64(raw)
+	m := 11.4293 + (0.0000000010698*math.Pow(x, 4) - 0.00000152538*math.Pow(x, 3) + 0.000866976*math.Pow(x, 2) - 0.169422*x)
+	vwc := 100 * (0.0000045*math.Pow(m, 3) - 0.00055*math.Pow(m, 2) + 0.0292*m - 0.053)
+	return clamp(vwc, 0, 60)
+}
+
+// ConvertLight converts the raw sunlight value to an approximate value in lux.
+func ConvertLight(raw uint16) float64 {
+	if raw == 0 {
+		return 0
+	}
+
+	par := 192773.17 * math.Pow(float64(raw), -1.0606619)
+	return par * factorParToLux
+}
+
+// ConvertConductivity converts the raw conductivity value to µS/cm.
+func ConvertConductivity(raw uint16) float64 {
+	return float64(raw) * 10000 / maxRawConductivity
+}
+
+func clamp(v, min, max float64) float64 {
+	return math.Max(min, math.Min(max, v))
+}
+
+// ParseLive converts the raw values of the live service. Every value is a 16 bit number, longer values are
+// truncated.
+func ParseLive(sunlight, conductivity, temperature, moisture []byte) (Data, error) {
+	raw := map[string]uint16{}
+	for _, v := range []struct {
+		Name  string
+		Value []byte
+	}{
+		{"sunlight", sunlight},
+		{"conductivity", conductivity},
+		{"temperature", temperature},
+		{"moisture", moisture},
+	} {
+		if len(v.Value) < 2 {
+			return Data{}, fmt.Errorf("value of %s too short: %d", v.Name, len(v.Value))
+		}
+		raw[v.Name] = binary.LittleEndian.Uint16(v.Value)
+	}
+
+	return Data{
+		Temperature:  ConvertTemperature(raw["temperature"]),
+		Moisture:     ConvertMoisture(raw["moisture"]),
+		Light:        ConvertLight(raw["sunlight"]),
+		Conductivity: ConvertConductivity(raw["conductivity"]),
+	}, nil
+}
+
+// ReadData uses a Bluetooth LE device to read data from the sensor identified using the MAC address.
+func ReadData(ctx context.Context, log logrus.FieldLogger, device ble.Device, macAddress string) (Data, error) {
+	c, err := device.Dial(ctx, ble.NewAddr(macAddress))
+	if err != nil {
+		return Data{}, fmt.Errorf("error dialing: %s", err)
+	}
+	defer c.CancelConnection()
+
+	profile, err := c.DiscoverProfile(true)
+	if err != nil {
+		return Data{}, fmt.Errorf("error discovering profile: %s", err)
+	}
+
+	values := map[string][]byte{}
+	for _, u := range []ble.UUID{sunlightUUID, conductivityUUID, airTempUUID, moistureUUID} {
+		value, err := readCharacteristic(c, profile, u)
+		if err != nil {
+			return Data{}, err
+		}
+		values[u.String()] = value
+	}
+	log.Debugf("Raw values of %q: %x", macAddress, values)
+
+	data, err := ParseLive(values[sunlightUUID.String()], values[conductivityUUID.String()], values[airTempUUID.String()], values[moistureUUID.String()])
+	if err != nil {
+		return Data{}, err
+	}
+	data.Time = time.Now()
+
+	if battery, err := readCharacteristic(c, profile, batteryLevelUUID); err == nil && len(battery) > 0 {
+		data.Battery = battery[0]
+	} else {
+		log.Debugf("Can not read battery level of %q: %v", macAddress, err)
+	}
+
+	if firmware, err := readCharacteristic(c, profile, firmwareUUID); err == nil {
+		data.Firmware = strings.ToValidUTF8(strings.TrimRight(string(firmware), "\x00"), "")
+	} else {
+		log.Debugf("Can not read firmware of %q: %s", macAddress, err)
+	}
+
+	return data, nil
+}
+
+func readCharacteristic(c ble.Client, profile *ble.Profile, u ble.UUID) ([]byte, error) {
+	characteristic := profile.FindCharacteristic(ble.NewCharacteristic(u))
+	if characteristic == nil {
+		return nil, fmt.Errorf("characteristic %s not found", u)
+	}
+
+	value, err := c.ReadCharacteristic(characteristic)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %s", u, err)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,30 @@
+package flowerpower
+
+import (
+	"math"
+	"testing"
+)
+
+func FuzzParseLive(f *testing.F) {
+	f.Add([]byte{0x20, 0x03}, []byte{0x2c, 0x01}, []byte{0x8c, 0x02}, []byte{0x90, 0x01})
+	f.Add([]byte{0x00, 0x00}, []byte{0xff, 0xff}, []byte{0xff, 0xff}, []byte{0x00, 0x00, 0x00})
+	f.Add([]byte{0x01}, []byte{}, []byte(nil), []byte{0x01, 0x02})
+
+	f.Fuzz(func(t *testing.T, sunlight, conductivity, temperature, moisture []byte) {
+		data, err := ParseLive(sunlight, conductivity, temperature, moisture)
+		if err != nil {
+			return
+		}
+
+		for name, v := range map[string]float64{
+			"temperature":  data.Temperature,
+			"moisture":     data.Moisture,
+			"light":        data.Light,
+			"conductivity": data.Conductivity,
+		} {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				t.Errorf("%s is not a number: %f", name, v)
+			}
+		}
+	})
+}
@@ -0,0 +1,149 @@
+package miflora
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/go-ble/ble"
+)
+
+// Flags of the frame control field of a MiBeacon.
+const (
+	beaconEncrypted  = 0x0008
+	beaconMAC        = 0x0010
+	beaconCapability = 0x0020
+	beaconObject     = 0x0040
+
+	capabilityIO = 0x20
+)
+
+// ProductID is the product ID of the sensors in their MiBeacons. Other Xiaomi devices use the same service UUID.
+const ProductID = 0x0098
+
+// Types of the objects contained in a MiBeacon.
+const (
+	objectTemperature  = 0x1004
+	objectLight        = 0x1007
+	objectMoisture     = 0x1008
+	objectConductivity = 0x1009
+	objectBattery      = 0x100a
+)
+
+// Beacon contains the values of a MiBeacon advertisement. The sensors only send one value per advertisement,
+// values not contained in the advertisement are nil.
+type Beacon struct {
+	ProductID    uint16
+	Counter      byte
+	Temperature  *float64
+	Light        *uint32
+	Moisture     *byte
+	Conductivity *uint16
+	Battery      *byte
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (b *Beacon) UnmarshalBinary(data []byte) error {
+	// FC FC PP PP CC [MM MM MM MM MM MM] [CA [IO IO]] [TT TT LL VV...]
+	if len(data) < 5 {
+		return fmt.Errorf("data not long enough: %d < 5", len(data))
+	}
+
+	frameControl := binary.LittleEndian.Uint16(data)
+	if frameControl&beaconEncrypted != 0 {
+		return errors.New("encrypted beacons are not supported")
+	}
+
+	b.ProductID = binary.LittleEndian.Uint16(data[2:])
+	b.Counter = data[4]
+	data = data[5:]
+
+	if frameControl&beaconMAC != 0 {
+		if len(data) < 6 {
+			return errors.New("data not long enough for MAC address")
+		}
+		data = data[6:]
+	}
+
+	if frameControl&beaconCapability != 0 {
+		if len(data) < 1 {
+			return errors.New("data not long enough for capabilities")
+		}
+		capability := data[0]
+		data = data[1:]
+
+		if capability&capabilityIO != 0 {
+			if len(data) < 2 {
+				return errors.New("data not long enough for IO capabilities")
+			}
+			data = data[2:]
+		}
+	}
+
+	if frameControl&beaconObject == 0 {
+		return nil
+	}
+
+	if len(data) < 3 {
+		return errors.New("data not long enough for object")
+	}
+	objectType := binary.LittleEndian.Uint16(data)
+	length := int(data[2])
+	value := data[3:]
+	if len(value) < length {
+		return fmt.Errorf("object not long enough: %d < %d", len(value), length)
+	}
+
+	return b.parseObject(objectType, value[:length])
+}
+
+func (b *Beacon) parseObject(objectType uint16, value []byte) error {
+	minLength := map[uint16]int{
+		objectTemperature:  2,
+		objectLight:        3,
+		objectMoisture:     1,
+		objectConductivity: 2,
+		objectBattery:      1,
+	}[objectType]
+	if len(value) < minLength {
+		return fmt.Errorf("value of object %#04x not long enough: %d < %d", objectType, len(value), minLength)
+	}
+
+	switch objectType {
+	case objectTemperature:
+		temperature := float64(int16(binary.LittleEndian.Uint16(value))) / 10
+		b.Temperature = &temperature
+	case objectLight:
+		light := uint32(value[0]) | uint32(value[1])<<8 | uint32(value[2])<<16
+		b.Light = &light
+	case objectMoisture:
+		moisture := value[0]
+		b.Moisture = &moisture
+	case objectConductivity:
+		conductivity := binary.LittleEndian.Uint16(value)
+		b.Conductivity = &conductivity
+	case objectBattery:
+		battery := value[0]
+		b.Battery = &battery
+	}
+
+	return nil
+}
+
+// DecodeBeacon extracts the MiBeacon from the advertisement of a sensor.
+func DecodeBeacon(a ble.Advertisement) (Beacon, error) {
+	for _, s := range a.ServiceData() {
+		if !s.UUID.Equal(ServiceUUID) {
+			continue
+		}
+
+		var b Beacon
+		if err := b.UnmarshalBinary(s.Data); err != nil {
+			return Beacon{}, err
+		}
+
+		return b, nil
+	}
+
+	return Beacon{}, fmt.Errorf("advertisement contains no service data %s", ServiceUUID)
+}
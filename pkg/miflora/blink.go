@@ -0,0 +1,33 @@
+package miflora
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-ble/ble"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// modeCharacteristic is also used for enabling the realtime reading.
+	modeCharacteristic = realtimeReadingCharacteristic
+	blinkValue         = []byte{0xFD, 0xFF}
+)
+
+// Blink makes the LED of the sensor identified using the MAC address blink, so that the sensor can be found among
+// others.
+func Blink(ctx context.Context, log logrus.FieldLogger, device ble.Device, macAddress string) error {
+	addr := ble.NewAddr(macAddress)
+	c, err := device.Dial(ctx, addr)
+	if err != nil {
+		return fmt.Errorf("error dialing: %s", err)
+	}
+	defer c.CancelConnection()
+
+	log.Debugf("Blinking LED of %q", macAddress)
+	if err := c.WriteCharacteristic(modeCharacteristic, blinkValue, false); err != nil {
+		return fmt.Errorf("can not blink LED: %s", err)
+	}
+
+	return nil
+}
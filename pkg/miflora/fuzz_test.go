@@ -0,0 +1,80 @@
+package miflora
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func FuzzFirmware(f *testing.F) {
+	f.Add([]byte{0x5a, 0x2b, '3', '.', '2', '.', '1'})
+	f.Add([]byte{0x64, 0x00, '3', '.', '3', '.', '5', 0x00, 0x00})
+	f.Add([]byte{0x01, 0x02})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var firmware Firmware
+		if err := firmware.UnmarshalBinary(data); err != nil {
+			return
+		}
+
+		if !utf8.ValidString(firmware.Version) {
+			t.Errorf("version is not valid UTF-8: %q", firmware.Version)
+		}
+	})
+}
+
+func FuzzSensors(f *testing.F) {
+	f.Add([]byte{0xd7, 0x00, 0x00, 0xb0, 0x04, 0x00, 0x00, 0x1e, 0xf4, 0x01, 0x02, 0x3c, 0x00, 0x00, 0x00, 0x00})
+	f.Add([]byte{0xff, 0xff, 0x00, 0xff, 0xff, 0x00, 0x00, 0xff, 0xff, 0xff})
+	f.Add([]byte{0xd7, 0x00, 0x00})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var sensors Sensors
+		if err := sensors.UnmarshalBinary(data); err != nil {
+			return
+		}
+
+		if sensors.Temperature < -3276.8 || sensors.Temperature > 3276.7 {
+			t.Errorf("temperature out of range: %f", sensors.Temperature)
+		}
+	})
+}
+
+func FuzzBeacon(f *testing.F) {
+	// Temperature, light, moisture, conductivity and battery objects with MAC address and capabilities.
+	f.Add([]byte{0x71, 0x20, 0x98, 0x00, 0x12, 0x02, 0x00, 0x00, 0x8d, 0x7c, 0xc4, 0x0d, 0x04, 0x10, 0x02, 0xd7, 0x00})
+	f.Add([]byte{0x71, 0x20, 0x98, 0x00, 0x13, 0x02, 0x00, 0x00, 0x8d, 0x7c, 0xc4, 0x0d, 0x07, 0x10, 0x03, 0xb0, 0x04, 0x00})
+	f.Add([]byte{0x71, 0x20, 0x98, 0x00, 0x14, 0x02, 0x00, 0x00, 0x8d, 0x7c, 0xc4, 0x0d, 0x08, 0x10, 0x01, 0x1e})
+	f.Add([]byte{0x71, 0x20, 0x98, 0x00, 0x15, 0x02, 0x00, 0x00, 0x8d, 0x7c, 0xc4, 0x0d, 0x09, 0x10, 0x02, 0xf4, 0x01})
+	f.Add([]byte{0x71, 0x20, 0x98, 0x00, 0x16, 0x02, 0x00, 0x00, 0x8d, 0x7c, 0xc4, 0x0d, 0x0a, 0x10, 0x01, 0x5a})
+	// Capabilities with IO capabilities, without object.
+	f.Add([]byte{0x31, 0x20, 0x98, 0x00, 0x17, 0x02, 0x00, 0x00, 0x8d, 0x7c, 0xc4, 0x2d, 0x01, 0x00})
+	// Encrypted.
+	f.Add([]byte{0x58, 0x20, 0x98, 0x00, 0x18})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var b Beacon
+		if err := b.UnmarshalBinary(data); err != nil {
+			return
+		}
+
+		if b.Light != nil && *b.Light > 0xffffff {
+			t.Errorf("light out of range: %d", *b.Light)
+		}
+	})
+}
+
+func FuzzHistoryEntry(f *testing.F) {
+	f.Add([]byte{0x10, 0x0e, 0x00, 0x00, 0xd7, 0x00, 0x00, 0xb0, 0x04, 0x00, 0x00, 0x1e, 0xf4, 0x01, 0x00, 0x00})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var entry HistoryEntry
+		if err := entry.UnmarshalBinary(data); err != nil {
+			return
+		}
+
+		if entry.Light > 0xffffff {
+			t.Errorf("light out of range: %d", entry.Light)
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package miflora
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/go-ble/ble"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	historyControlCharacteristic = &ble.Characteristic{
+		ValueHandle: 0x3e,
+	}
+	historyDataCharacteristic = &ble.Characteristic{
+		ValueHandle: 0x3c,
+	}
+	deviceTimeCharacteristic = &ble.Characteristic{
+		ValueHandle: 0x41,
+	}
+	historyInitValue = []byte{0xA0, 0x00, 0x00}
+)
+
+// historyEntryCommand is written to the history control characteristic to select the entry with the index.
+const historyEntryCommand = 0xA1
+
+// HistoryEntry contains the values the sensor has stored for one hour.
+type HistoryEntry struct {
+	// DeviceTime is the number of seconds since the sensor has been started.
+	DeviceTime uint32
+	// Time is the wall clock time of the entry, calculated from the current device time.
+	Time         time.Time
+	Temperature  float64
+	Moisture     byte
+	Light        uint32
+	Conductivity uint16
+}
+
+// historyEntryLength is the length of the data containing all values of a history entry. The sensors send 16
+// bytes, the remaining bytes are unknown and ignored.
+const historyEntryLength = 14
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. The Time of the entry is not set.
+func (e *HistoryEntry) UnmarshalBinary(data []byte) error {
+	// DD DD DD DD TT TT ?? LL LL LL ?? MM CC CC [?? ??]
+	if len(data) < historyEntryLength {
+		return fmt.Errorf("data not long enough: %d < %d", len(data), historyEntryLength)
+	}
+
+	e.DeviceTime = binary.LittleEndian.Uint32(data)
+	e.Temperature = float64(int16(binary.LittleEndian.Uint16(data[4:]))) / 10
+	e.Light = uint32(data[7]) | uint32(data[8])<<8 | uint32(data[9])<<16
+	e.Moisture = data[11]
+	e.Conductivity = binary.LittleEndian.Uint16(data[12:])
+	return nil
+}
+
+// ParseHistoryCount returns the number of stored entries from the data read after switching to history mode.
+func ParseHistoryCount(data []byte) (int, error) {
+	if len(data) < 2 {
+		return 0, fmt.Errorf("data not long enough: %d < 2", len(data))
+	}
+
+	return int(binary.LittleEndian.Uint16(data)), nil
+}
+
+// ParseDeviceTime returns the number of seconds since the sensor has been started.
+func ParseDeviceTime(data []byte) (uint32, error) {
+	if len(data) < 4 {
+		return 0, fmt.Errorf("data not long enough: %d < 4", len(data))
+	}
+
+	return binary.LittleEndian.Uint32(data), nil
+}
+
+// ReadHistory reads the hourly values stored on the sensor. At most limit entries are read, starting with the most
+// recent one. All entries are read if limit is zero. The entries are not removed from the sensor.
+func ReadHistory(ctx context.Context, log logrus.FieldLogger, device ble.Device, macAddress string, limit int) ([]HistoryEntry, error) {
+	addr := ble.NewAddr(macAddress)
+	c, err := device.Dial(ctx, addr)
+	if err != nil {
+		return nil, fmt.Errorf("error dialing: %s", err)
+	}
+	defer c.CancelConnection()
+
+	if err := c.WriteCharacteristic(historyControlCharacteristic, historyInitValue, false); err != nil {
+		return nil, fmt.Errorf("can not enable history mode: %s", err)
+	}
+
+	countRaw, err := c.ReadCharacteristic(historyDataCharacteristic)
+	if err != nil {
+		return nil, fmt.Errorf("error reading history length: %s", err)
+	}
+
+	count, err := ParseHistoryCount(countRaw)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing history length: %s", err)
+	}
+
+	deviceTimeRaw, err := c.ReadCharacteristic(deviceTimeCharacteristic)
+	if err != nil {
+		return nil, fmt.Errorf("error reading device time: %s", err)
+	}
+	now := time.Now()
+
+	deviceTime, err := ParseDeviceTime(deviceTimeRaw)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing device time: %s", err)
+	}
+	start := now.Add(-time.Duration(deviceTime) * time.Second)
+
+	if limit > 0 && limit < count {
+		count = limit
+	}
+	log.Debugf("Reading %d history entries of %q", count, macAddress)
+
+	entries := make([]HistoryEntry, 0, count)
+	for i := 0; i < count; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		command := []byte{historyEntryCommand, byte(i), byte(i >> 8)}
+		if err := c.WriteCharacteristic(historyControlCharacteristic, command, false); err != nil {
+			return nil, fmt.Errorf("can not select history entry %d: %s", i, err)
+		}
+
+		entryRaw, err := c.ReadCharacteristic(historyDataCharacteristic)
+		if err != nil {
+			return nil, fmt.Errorf("error reading history entry %d: %s", i, err)
+		}
+
+		var entry HistoryEntry
+		if err := entry.UnmarshalBinary(entryRaw); err != nil {
+			return nil, fmt.Errorf("error parsing history entry %d: %s", i, err)
+		}
+		entry.Time = start.Add(time.Duration(entry.DeviceTime) * time.Second)
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
@@ -2,10 +2,12 @@
 package miflora
 
 import (
-	"bytes"
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/go-ble/ble"
@@ -13,6 +15,9 @@ import (
 )
 
 var (
+	// ServiceUUID is the UUID of the Xiaomi service included in the advertisements of the sensors.
+	ServiceUUID = ble.UUID16(0xfe95)
+
 	firmwareCharacteristic = &ble.Characteristic{
 		ValueHandle: 0x38,
 	}
@@ -40,15 +45,22 @@ type Firmware struct {
 
 // UnmarshalBinary implements encoding.BinaryUnmarshaler.
 func (f *Firmware) UnmarshalBinary(data []byte) error {
+	// BB ?? VV VV VV VV VV
 	if len(data) < 3 {
 		return fmt.Errorf("data not long enough: %d < 3", len(data))
 	}
 
 	f.Battery = data[0]
-	f.Version = string(data[2:])
+	f.Version = sanitizeVersion(data[2:])
 	return nil
 }
 
+// sanitizeVersion converts the version to a string usable as label value. Some firmware versions pad the version
+// with null bytes.
+func sanitizeVersion(data []byte) string {
+	return strings.ToValidUTF8(strings.TrimRight(string(data), "\x00"), "")
+}
+
 // Sensors contains the sensor data.
 type Sensors struct {
 	Temperature  float64
@@ -57,74 +69,131 @@ type Sensors struct {
 	Conductivity uint16
 }
 
+// sensorsLength is the length of the data containing all values. The sensors send 16 bytes, the remaining
+// bytes are unknown and ignored.
+const sensorsLength = 10
+
 // UnmarshalBinary implements encoding.BinaryUnmarshaler.
 func (s *Sensors) UnmarshalBinary(data []byte) error {
-	// TT TT ?? LL LL ?? ?? MM CC CC ?? ?? ?? ?? ?? ??
-	if len(data) != 16 {
-		return fmt.Errorf("invalid data length: %d != 10", len(data))
+	// TT TT ?? LL LL ?? ?? MM CC CC [?? ?? ?? ?? ?? ??]
+	if len(data) < sensorsLength {
+		return fmt.Errorf("data not long enough: %d < %d", len(data), sensorsLength)
 	}
 
-	p := bytes.NewBuffer(data)
-	var t int16
+	s.Temperature = float64(int16(binary.LittleEndian.Uint16(data))) / 10
+	s.Light = binary.LittleEndian.Uint16(data[3:])
+	s.Moisture = data[7]
+	s.Conductivity = binary.LittleEndian.Uint16(data[8:])
+	return nil
+}
 
-	if err := binary.Read(p, binary.LittleEndian, &t); err != nil {
-		return fmt.Errorf("error reading data: %s", err)
-	}
+// Parts of the sensor data, which are read using separate characteristics.
+const (
+	PartFirmware = "firmware"
+	PartSensors  = "sensors"
+)
 
-	p.Next(1)
-	if err := binary.Read(p, binary.LittleEndian, &s.Light); err != nil {
-		return fmt.Errorf("error reading data: %s", err)
-	}
+// PartialError is returned when some of the requested parts could not be read.
+// The data returned together with the error contains the parts which have been read successfully.
+type PartialError struct {
+	Failed map[string]error
+}
 
-	p.Next(2)
-	if err := binary.Read(p, binary.LittleEndian, &s.Moisture); err != nil {
-		return fmt.Errorf("error reading data: %s", err)
-	}
-	if err := binary.Read(p, binary.LittleEndian, &s.Conductivity); err != nil {
-		return fmt.Errorf("error reading data: %s", err)
+func (e *PartialError) Error() string {
+	parts := make([]string, 0, len(e.Failed))
+	for part, err := range e.Failed {
+		parts = append(parts, fmt.Sprintf("%s: %s", part, err))
 	}
+	sort.Strings(parts)
 
-	s.Temperature = float64(t) / 10
-	return nil
+	return fmt.Sprintf("partial read: %s", strings.Join(parts, ", "))
 }
 
 // ReadData uses a Bluetooth LE device to read data from the sensor identified using the MAC address.
 func ReadData(ctx context.Context, log logrus.FieldLogger, device ble.Device, macAddress string) (Data, error) {
+	return ReadParts(ctx, log, device, macAddress, PartFirmware, PartSensors)
+}
+
+// ReadParts reads only the specified parts of the data from the sensor. If at least one part could be read,
+// failures of the other parts are reported using a PartialError.
+func ReadParts(ctx context.Context, log logrus.FieldLogger, device ble.Device, macAddress string, parts ...string) (Data, error) {
 	addr := ble.NewAddr(macAddress)
 	c, err := device.Dial(ctx, addr)
 	if err != nil {
 		return Data{}, fmt.Errorf("error dialing: %s", err)
 	}
 
+	data := Data{
+		Time: time.Now(),
+	}
+	failed := map[string]error{}
+	for _, part := range parts {
+		var err error
+		switch part {
+		case PartFirmware:
+			data.Firmware, err = readFirmware(c)
+			log.Debugf("Firmware of %q: %#v", macAddress, data.Firmware)
+		case PartSensors:
+			data.Sensors, err = readSensors(c)
+			log.Debugf("Sensors of %q: %#v", macAddress, data.Sensors)
+		default:
+			err = fmt.Errorf("unknown part: %s", part)
+		}
+
+		if err != nil {
+			failed[part] = err
+		}
+	}
+
+	switch {
+	case len(failed) == 0:
+		return data, nil
+	case len(failed) == len(parts):
+		return Data{}, (&PartialError{Failed: failed}).all()
+	default:
+		return data, &PartialError{Failed: failed}
+	}
+}
+
+// all returns an error describing the failure of all parts.
+func (e *PartialError) all() error {
+	parts := make([]string, 0, len(e.Failed))
+	for part, err := range e.Failed {
+		parts = append(parts, fmt.Sprintf("error reading %s: %s", part, err))
+	}
+	sort.Strings(parts)
+
+	return errors.New(strings.Join(parts, ", "))
+}
+
+func readFirmware(c ble.Client) (Firmware, error) {
 	firmwareRaw, err := c.ReadCharacteristic(firmwareCharacteristic)
 	if err != nil {
-		return Data{}, fmt.Errorf("error reading firmware info: %s", err)
+		return Firmware{}, fmt.Errorf("error reading firmware info: %s", err)
 	}
 
 	var firmware Firmware
 	if err := firmware.UnmarshalBinary(firmwareRaw); err != nil {
-		return Data{}, fmt.Errorf("error parsing firmware info: %s", err)
+		return Firmware{}, fmt.Errorf("error parsing firmware info: %s", err)
 	}
-	log.Debugf("Firmware of %q: %#v", macAddress, firmware)
 
+	return firmware, nil
+}
+
+func readSensors(c ble.Client) (Sensors, error) {
 	if err := c.WriteCharacteristic(realtimeReadingCharacteristic, realtimeReadingValue, false); err != nil {
-		return Data{}, fmt.Errorf("can not enable realtime reading: %s", err)
+		return Sensors{}, fmt.Errorf("can not enable realtime reading: %s", err)
 	}
 
 	sensorsRaw, err := c.ReadCharacteristic(sensorCharacteristic)
 	if err != nil {
-		return Data{}, fmt.Errorf("error reading sensor data: %s", err)
+		return Sensors{}, fmt.Errorf("error reading sensor data: %s", err)
 	}
 
 	var sensors Sensors
 	if err := sensors.UnmarshalBinary(sensorsRaw); err != nil {
-		return Data{}, fmt.Errorf("error parsing sensor data: %s", err)
+		return Sensors{}, fmt.Errorf("error parsing sensor data: %s", err)
 	}
-	log.Debugf("Sensors of %q: %#v", macAddress, sensors)
 
-	return Data{
-		Time:     time.Now(),
-		Firmware: firmware,
-		Sensors:  sensors,
-	}, nil
+	return sensors, nil
 }
@@ -0,0 +1,110 @@
+// Package pipeline contains the registry of the steps processing every reading of the exporter before it is stored
+// and passed on to its outputs.
+//
+// Each step is a middleware wrapping the next step of the chain. It can change the reading, drop it by not
+// calling the next step or keep state between readings, for example for smoothing. The steps and their order
+// are selected in the pipeline configuration. Additional steps can be added to the registry using Register,
+// so that custom builds of the exporter can use their own processing.
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Sensor describes the sensor a reading has been taken from.
+type Sensor struct {
+	MacAddress string
+	Name       string
+	// Driver is the name of the driver reading the sensor. It is empty for the default driver.
+	Driver string
+	// Quirks contains the corrections configured for the sensor.
+	Quirks Quirks
+}
+
+// Quirks contains per-sensor corrections, which override the built-in quirk table.
+type Quirks struct {
+	// Disable turns off the built-in corrections for this sensor.
+	Disable bool
+	// Scale contains factors applied to the values, by value name.
+	Scale map[string]float64
+	// Offset contains offsets added to the values after scaling, by value name.
+	Offset map[string]float64
+	// IgnoreBattery drops the battery values of the sensor, overriding the built-in table if set.
+	IgnoreBattery *bool
+}
+
+func (s Sensor) String() string {
+	if s.Name == "" {
+		return s.MacAddress
+	}
+
+	return fmt.Sprintf("%s (%s)", s.Name, s.MacAddress)
+}
+
+// Handler receives a reading of a sensor.
+type Handler func(sensor Sensor, reading Reading)
+
+// Middleware wraps the next handler of the chain.
+type Middleware func(next Handler) Handler
+
+// Step describes a processing step which can be used in the pipeline.
+type Step struct {
+	// Name is used to select the step in the pipeline configuration.
+	Name string
+	// Description explains what the step does.
+	Description string
+	// New creates an instance of the step using the options from the configuration, which can be empty.
+	// Every use of the step in the pipeline gets its own instance.
+	New func(log logrus.FieldLogger, options json.RawMessage) (Middleware, error)
+}
+
+var (
+	registryLock sync.RWMutex
+	registry     = map[string]Step{}
+)
+
+// Register adds a step to the registry. It panics if a step with the same name is already registered.
+func Register(s Step) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	if _, ok := registry[s.Name]; ok {
+		panic(fmt.Sprintf("pipeline step already registered: %s", s.Name))
+	}
+
+	registry[s.Name] = s
+}
+
+// Get returns the step with the specified name.
+func Get(name string) (Step, error) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	s, ok := registry[name]
+	if !ok {
+		return Step{}, fmt.Errorf("unknown pipeline step: %s", name)
+	}
+
+	return s, nil
+}
+
+// All returns all registered steps sorted by name.
+func All() []Step {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	result := make([]Step, 0, len(registry))
+	for _, s := range registry {
+		result = append(result, s)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
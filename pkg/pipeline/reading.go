@@ -0,0 +1,88 @@
+package pipeline
+
+import "time"
+
+// Reading contains the values read from a sensor. Values which are not supported by a device are nil.
+type Reading struct {
+	Time         time.Time `json:"time"`
+	Firmware     string    `json:"firmware,omitempty"`
+	Battery      *float64  `json:"battery,omitempty"`
+	Temperature  *float64  `json:"temperature,omitempty"`
+	Moisture     *float64  `json:"moisture,omitempty"`
+	Light        *float64  `json:"light,omitempty"`
+	Conductivity *float64  `json:"conductivity,omitempty"`
+	// Humidity contains the relative air humidity in percent.
+	Humidity *float64 `json:"humidity,omitempty"`
+	// BatteryVoltage is reported by devices which do not calculate a battery percentage themselves.
+	BatteryVoltage *float64 `json:"batteryVoltage,omitempty"`
+	// ConductivityCompensated contains the conductivity corrected to the reference temperature. It is not read
+	// from devices but calculated by the compensate step of the pipeline.
+	ConductivityCompensated *float64 `json:"conductivityCompensated,omitempty"`
+	// RSSI contains the signal strength in dBm, observed while connecting to the device or receiving its
+	// advertisement.
+	RSSI *float64 `json:"rssi,omitempty"`
+	// Via is the receiver of the advertisement the reading was decoded from. It is empty for readings taken by
+	// connecting to the device.
+	Via string `json:"via,omitempty"`
+}
+
+// FieldNames contains the names of all values of a Reading, as accepted by Field.
+var FieldNames = []string{
+	"battery",
+	"temperature",
+	"moisture",
+	"light",
+	"conductivity",
+	"humidity",
+	"battery_voltage",
+	"conductivity_compensated",
+	"rssi",
+}
+
+// Field returns a pointer to the value with the specified name or nil if the name is unknown.
+func (r *Reading) Field(name string) **float64 {
+	switch name {
+	case "battery":
+		return &r.Battery
+	case "temperature":
+		return &r.Temperature
+	case "moisture":
+		return &r.Moisture
+	case "light":
+		return &r.Light
+	case "conductivity":
+		return &r.Conductivity
+	case "humidity":
+		return &r.Humidity
+	case "battery_voltage":
+		return &r.BatteryVoltage
+	case "conductivity_compensated":
+		return &r.ConductivityCompensated
+	case "rssi":
+		return &r.RSSI
+	default:
+		return nil
+	}
+}
+
+// Merge returns a copy of the reading in which values missing from r are taken from previous.
+// This is used for devices which only send a part of their values in each advertisement.
+func (r Reading) Merge(previous Reading) Reading {
+	result := r
+	if result.Firmware == "" {
+		result.Firmware = previous.Firmware
+	}
+
+	for _, name := range FieldNames {
+		if target := result.Field(name); *target == nil {
+			*target = *previous.Field(name)
+		}
+	}
+
+	return result
+}
+
+// Float returns a pointer to a copy of the value.
+func Float(v float64) *float64 {
+	return &v
+}
@@ -0,0 +1,23 @@
+package switchbot
+
+import "testing"
+
+func FuzzParse(f *testing.F) {
+	// Meter: 22.5 °C, 50 %.
+	f.Add([]byte{0x54, 0x00, 0x64, 0x05, 0x96, 0x32}, []byte(nil))
+	// Meter Plus with negative temperature.
+	f.Add([]byte{0x69, 0x00, 0x5a, 0x03, 0x05, 0x28}, []byte(nil))
+	// Outdoor meter with values in the manufacturer data.
+	f.Add([]byte{0x77, 0x00, 0x64}, []byte{0x69, 0x09, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff, 0x00, 0x00, 0x05, 0x96, 0x32})
+
+	f.Fuzz(func(t *testing.T, service, manufacturer []byte) {
+		data, err := Parse(service, manufacturer)
+		if err != nil {
+			return
+		}
+
+		if data.Humidity < 0 || data.Humidity > 127 {
+			t.Errorf("humidity out of range: %f", data.Humidity)
+		}
+	})
+}
@@ -0,0 +1,103 @@
+// Package switchbot decodes the advertisements sent by SwitchBot Meter and Outdoor Meter thermo-hygrometers.
+package switchbot
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/go-ble/ble"
+)
+
+const (
+	// CompanyID is the Bluetooth SIG company identifier of SwitchBot used in manufacturer data.
+	CompanyID = 0x0969
+
+	// ModelMeter identifies the SwitchBot Meter and Meter Plus.
+	ModelMeter byte = 'T'
+	// ModelMeterPlus identifies the newer revision of the SwitchBot Meter Plus.
+	ModelMeterPlus byte = 'i'
+	// ModelOutdoorMeter identifies the SwitchBot Indoor/Outdoor Thermo-Hygrometer.
+	ModelOutdoorMeter byte = 'w'
+)
+
+var (
+	// ServiceUUIDs contains the UUIDs of the service data sent by SwitchBot devices.
+	ServiceUUIDs = []ble.UUID{
+		ble.UUID16(0x0d00),
+		ble.UUID16(0xfd3d),
+	}
+)
+
+// Data contains the values sent by the device.
+type Data struct {
+	Model       byte
+	Battery     byte
+	Temperature float64
+	Humidity    float64
+}
+
+// Decode extracts the data from the advertisement of a SwitchBot Meter.
+func Decode(a ble.Advertisement) (Data, error) {
+	service, ok := serviceData(a)
+	if !ok {
+		return Data{}, fmt.Errorf("advertisement contains no SwitchBot service data")
+	}
+
+	return Parse(service, a.ManufacturerData())
+}
+
+// Parse decodes the service data and manufacturer data of an advertisement. Bytes following the known values
+// are ignored.
+func Parse(service, manufacturer []byte) (Data, error) {
+	if len(service) < 3 {
+		return Data{}, fmt.Errorf("service data not long enough: %d < 3", len(service))
+	}
+
+	data := Data{
+		Model:   service[0] & 0x7f,
+		Battery: service[2] & 0x7f,
+	}
+
+	var values []byte
+	switch data.Model {
+	case ModelMeter, ModelMeterPlus:
+		if len(service) < 6 {
+			return Data{}, fmt.Errorf("service data not long enough: %d < 6", len(service))
+		}
+		values = service[3:6]
+	case ModelOutdoorMeter:
+		// The outdoor meter sends its values as part of the manufacturer data: company ID, MAC and values.
+		if len(manufacturer) < 13 || binary.LittleEndian.Uint16(manufacturer) != CompanyID {
+			return Data{}, fmt.Errorf("manufacturer data missing or too short: %d", len(manufacturer))
+		}
+		values = manufacturer[10:13]
+	default:
+		return Data{}, fmt.Errorf("unsupported model: 0x%02x", data.Model)
+	}
+
+	data.Temperature, data.Humidity = decodeValues(values)
+	return data, nil
+}
+
+// decodeValues decodes the three bytes containing temperature and humidity.
+func decodeValues(b []byte) (float64, float64) {
+	temperature := float64(b[1]&0x7f) + float64(b[0]&0x0f)/10
+	if b[1]&0x80 == 0 {
+		temperature = -temperature
+	}
+
+	humidity := float64(b[2] & 0x7f)
+	return temperature, humidity
+}
+
+func serviceData(a ble.Advertisement) ([]byte, bool) {
+	for _, s := range a.ServiceData() {
+		for _, u := range ServiceUUIDs {
+			if s.UUID.Equal(u) {
+				return s.Data, true
+			}
+		}
+	}
+
+	return nil, false
+}
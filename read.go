@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/xperimental/flowercare-exporter/internal/backend"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+)
+
+const readCommand = "read"
+
+// readUnits contains the units of the values shown by the read command, by the name used in driver.FieldNames.
+var readUnits = map[string]string{
+	"battery":                  "%",
+	"temperature":              "°C",
+	"moisture":                 "%",
+	"light":                    "lx",
+	"conductivity":             "µS/cm",
+	"humidity":                 "%",
+	"battery_voltage":          "V",
+	"conductivity_compensated": "µS/cm",
+	"rssi":                     "dBm",
+}
+
+// runRead connects to a single sensor, writes its current values to stdout and exits. It does not need a running
+// exporter, but the adapter can not be used by an exporter at the same time.
+func runRead(args []string) {
+	cfg, err := config.ParseRead(args)
+	if err != nil {
+		log.Fatalf("Error in read configuration: %s", err)
+	}
+
+	b, err := commandBackend(cfg.WorkerSocket, cfg.Device, cfg.BLE)
+	if err != nil {
+		log.Fatalf("Error creating device: %s", err)
+	}
+	defer b.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+
+	reading, err := b.Read(ctx, cfg.Sensor, cfg.Sensor.DriverOptions())
+	var partial *driver.PartialError
+	switch {
+	case errors.As(err, &partial):
+		log.Warnf("Only some values could be read: %s", err)
+	case err != nil:
+		b.Close()
+		log.Fatalf("Error reading sensor %s: %s", cfg.Sensor.MacAddress, err)
+	}
+
+	if cfg.Format == "json" {
+		err = writeReadingJSON(os.Stdout, reading)
+	} else {
+		err = writeReadingTable(os.Stdout, reading)
+	}
+	if err != nil {
+		log.Fatalf("Error writing reading: %s", err)
+	}
+}
+
+// commandBackend returns the backend used by commands accessing sensors without a running exporter. The worker is
+// used if its socket is set, otherwise the adapter is used directly.
+func commandBackend(workerSocket, device string, bleConfig config.BLEConfig) (backend.Backend, error) {
+	if workerSocket != "" {
+		return backend.Dial(workerSocket)
+	}
+
+	return backend.NewLocal(log, device, bleConfig, nil)
+}
+
+func writeReadingJSON(w io.Writer, reading driver.Reading) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(reading)
+}
+
+// writeReadingTable writes one line per value. Values the sensor does not provide are left out.
+func writeReadingTable(w io.Writer, reading driver.Reading) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "time\t%s\n", reading.Time.Format(time.RFC3339))
+	if reading.Firmware != "" {
+		fmt.Fprintf(tw, "firmware\t%s\n", reading.Firmware)
+	}
+
+	for _, name := range driver.FieldNames {
+		v := *reading.Field(name)
+		if v == nil {
+			continue
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", name, strconv.FormatFloat(*v, 'f', -1, 64), readUnits[name])
+	}
+
+	return tw.Flush()
+}
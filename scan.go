@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-ble/ble"
+	"github.com/xperimental/flowercare-exporter/internal/backend"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/driver"
+	"github.com/xperimental/flowercare-exporter/internal/sensorfile"
+)
+
+const scanCommand = "scan"
+
+// foundDevice is a device found by the scan command.
+type foundDevice struct {
+	MacAddress string `json:"macAddress"`
+	// Name is the local name sent by the device.
+	Name   string `json:"name,omitempty"`
+	Driver string `json:"driver"`
+	// RSSI is the strongest signal received from the device.
+	RSSI     int    `json:"rssi"`
+	Firmware string `json:"firmware,omitempty"`
+	// Passive is set for devices which are read from their advertisements, so their firmware is not read.
+	Passive bool `json:"passive"`
+}
+
+// Sensor returns the configuration of the device as sensor, named after its MAC address like discovered sensors.
+func (d foundDevice) Sensor() config.Sensor {
+	s := config.Sensor{
+		Name:       d.MacAddress,
+		MacAddress: d.MacAddress,
+	}
+	if d.Driver != driver.Default {
+		s.Driver = d.Driver
+	}
+
+	return s
+}
+
+// runScan scans for devices supported by one of the drivers and writes them to stdout. The found devices can also be
+// added to a sensor directory.
+func runScan(args []string) {
+	cfg, err := config.ParseScan(args)
+	if err != nil {
+		log.Fatalf("Error in scan configuration: %s", err)
+	}
+
+	b, err := commandBackend(cfg.WorkerSocket, cfg.Device, cfg.BLE)
+	if err != nil {
+		log.Fatalf("Error creating device: %s", err)
+	}
+	defer b.Close()
+
+	log.Infof("Scanning for %s...", cfg.Duration)
+	devices, err := scanDevices(b, cfg.Duration)
+	if err != nil {
+		b.Close()
+		log.Fatalf("Error during scan: %s", err)
+	}
+
+	if cfg.Firmware {
+		readFirmware(b, devices, cfg.ReadTimeout)
+	}
+
+	if cfg.Format == "json" {
+		err = writeDevicesJSON(os.Stdout, devices)
+	} else {
+		err = writeDevicesTable(os.Stdout, devices)
+	}
+	if err != nil {
+		b.Close()
+		log.Fatalf("Error writing devices: %s", err)
+	}
+
+	if cfg.SensorDir != "" {
+		if err := writeFoundSensors(cfg.SensorDir, devices); err != nil {
+			b.Close()
+			log.Fatalf("Error writing sensors: %s", err)
+		}
+	}
+}
+
+// scanDevices returns the devices matched by a driver which were heard during the scan, sorted by MAC address.
+func scanDevices(b backend.Backend, duration time.Duration) ([]foundDevice, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	var lock sync.Mutex
+	found := map[string]*foundDevice{}
+	err := b.Scan(ctx, func(a ble.Advertisement) {
+		d, ok := driver.Match(a)
+		if !ok {
+			return
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		macAddress := strings.ToUpper(a.Addr().String())
+		device, ok := found[macAddress]
+		if !ok {
+			device = &foundDevice{
+				MacAddress: macAddress,
+				Driver:     d.Name,
+				RSSI:       a.RSSI(),
+				Passive:    d.Read == nil,
+			}
+			found[macAddress] = device
+		}
+
+		if name := a.LocalName(); name != "" {
+			device.Name = name
+		}
+		if a.RSSI() > device.RSSI {
+			device.RSSI = a.RSSI()
+		}
+	})
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled) {
+		return nil, err
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	result := make([]foundDevice, 0, len(found))
+	for _, d := range found {
+		result = append(result, *d)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].MacAddress < result[j].MacAddress
+	})
+
+	return result, nil
+}
+
+// readFirmware connects to the devices, one at a time, and sets their firmware version. Only the slow parts of the
+// data containing the firmware are read if the driver supports it. Devices which can not be read are logged.
+func readFirmware(b backend.Backend, devices []foundDevice, timeout time.Duration) {
+	for i, device := range devices {
+		if device.Passive {
+			continue
+		}
+
+		d, err := driver.Get(device.Driver)
+		if err != nil {
+			continue
+		}
+
+		log.Infof("Reading firmware of %s...", device.MacAddress)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		reading, err := b.Read(ctx, device.Sensor(), driver.Options{
+			Parts: d.SlowParts,
+		})
+		cancel()
+
+		var partial *driver.PartialError
+		if err != nil && !errors.As(err, &partial) {
+			log.Warnf("Can not read firmware of %s: %s", device.MacAddress, err)
+			continue
+		}
+
+		devices[i].Firmware = reading.Firmware
+	}
+}
+
+func writeDevicesJSON(w io.Writer, devices []foundDevice) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(devices)
+}
+
+func writeDevicesTable(w io.Writer, devices []foundDevice) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "MAC ADDRESS\tNAME\tDRIVER\tRSSI\tFIRMWARE")
+	for _, d := range devices {
+		firmware := d.Firmware
+		switch {
+		case d.Passive:
+			firmware = "passive"
+		case firmware == "":
+			firmware = "-"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d dBm\t%s\n", d.MacAddress, d.Name, d.Driver, d.RSSI, firmware)
+	}
+
+	return tw.Flush()
+}
+
+// writeFoundSensors writes the devices which are not in the sensor directory yet to new files.
+func writeFoundSensors(dir string, devices []foundDevice) error {
+	writer := &sensorfile.Writer{
+		Log: log,
+		Dir: dir,
+	}
+
+	for _, d := range devices {
+		exists, err := writer.Exists(d.MacAddress)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			log.Infof("Sensor %s is already in %s.", d.MacAddress, dir)
+			continue
+		}
+
+		if err := writer.Save(d.Sensor(), "the scan command"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+#!/bin/sh
+# Runs the integration tests against two virtual Bluetooth LE controllers created by the emulator of bluez. Needs
+# root, the hci_vhci kernel module and btvirt, which is part of the bluez sources (emulator/btvirt) and packaged as
+# bluez-test-tools or bluez-tests by some distributions. Arguments are passed to "go test".
+set -eu
+
+GO=${GO:-go}
+
+if ! command -v btvirt >/dev/null; then
+	echo "btvirt not found, it is part of the bluez emulator." >&2
+	exit 1
+fi
+
+modprobe hci_vhci 2>/dev/null || true
+
+controllers() {
+	ls /sys/class/bluetooth 2>/dev/null | grep -E '^hci[0-9]+$' | sort || true
+}
+
+before=$(controllers)
+btvirt -L -l2 &
+btvirt_pid=$!
+trap 'kill "$btvirt_pid" 2>/dev/null || true' EXIT INT TERM
+
+new=""
+for _ in $(seq 50); do
+	new=$(controllers | grep -vxF "$before" || true)
+	if [ "$(echo "$new" | grep -c hci)" -ge 2 ]; then
+		break
+	fi
+	sleep 0.1
+done
+
+set -- $new "$@"
+if [ $# -lt 2 ] || ! echo "$1$2" | grep -q '^hci[0-9]*hci[0-9]*$'; then
+	echo "btvirt did not create two controllers." >&2
+	exit 1
+fi
+central=$1
+peripheral=$2
+shift 2
+
+# The exporter and the emulated sensor use the controllers exclusively, bluetoothd must not power them on.
+if command -v btmgmt >/dev/null; then
+	btmgmt --index "${central#hci}" power off >/dev/null 2>&1 || true
+	btmgmt --index "${peripheral#hci}" power off >/dev/null 2>&1 || true
+fi
+
+echo "Exporter uses $central, emulated sensor uses $peripheral."
+FLOWERCARE_INTEGRATION_CENTRAL=$central FLOWERCARE_INTEGRATION_PERIPHERAL=$peripheral \
+	"$GO" test -tags integration -count=1 -v ./internal/integration/ "$@"
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+)
+
+const (
+	serviceCommand = "service"
+
+	serviceName        = "flowercare-exporter"
+	serviceDisplayName = "Flowercare Exporter"
+	serviceDescription = "Prometheus exporter for plant sensors."
+)
+
+// stop is closed by the service manager to shut down the exporter.
+var stop = make(chan struct{})
+
+// runService registers the exporter with the service manager of the operating system or runs it as a service.
+func runService(args []string) {
+	if len(args) == 0 {
+		log.Fatalf("Usage: %s service install|uninstall|run [flags]", os.Args[0])
+	}
+
+	switch args[0] {
+	case "install":
+		executable, err := os.Executable()
+		if err != nil {
+			log.Fatalf("Can not find executable: %s", err)
+		}
+
+		if err := installService(executable, args[1:]); err != nil {
+			log.Fatalf("Error installing service: %s", err)
+		}
+		log.Infof("Installed service %q.", serviceName)
+	case "uninstall":
+		if err := uninstallService(); err != nil {
+			log.Fatalf("Error uninstalling service: %s", err)
+		}
+		log.Infof("Uninstalled service %q.", serviceName)
+	case "run":
+		// The exporter parses its flags from the command line.
+		os.Args = append([]string{os.Args[0]}, args[1:]...)
+		if err := runAsService(runExporter); err != nil {
+			log.Fatalf("Error running service: %s", err)
+		}
+	default:
+		log.Fatalf("Unknown service command: %s", args[0])
+	}
+}
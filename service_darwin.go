@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+const launchdLabel = "io.github.xperimental.flowercare-exporter"
+
+var plistTemplate = template.Must(template.New("plist").Funcs(template.FuncMap{
+	"xml": template.HTMLEscapeString,
+}).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+    <key>Label</key>
+    <string>{{ xml .Label }}</string>
+    <key>ProgramArguments</key>
+    <array>
+{{- range .Arguments }}
+        <string>{{ xml . }}</string>
+{{- end }}
+    </array>
+    <key>WorkingDirectory</key>
+    <string>{{ xml .WorkingDirectory }}</string>
+    <key>RunAtLoad</key>
+    <true/>
+    <key>KeepAlive</key>
+    <true/>
+    <key>StandardOutPath</key>
+    <string>{{ xml .LogFile }}</string>
+    <key>StandardErrorPath</key>
+    <string>{{ xml .LogFile }}</string>
+</dict>
+</plist>
+`))
+
+// plistPath returns the path of the launchd agent of the current user.
+func plistPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, "Library", "LaunchAgents", launchdLabel+".plist"), nil
+}
+
+// installService registers the exporter as launchd agent of the current user and starts it. The current
+// directory is used as working directory, so that relative paths in the flags keep working.
+func installService(executable string, args []string) error {
+	path, err := plistPath()
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("agent already exists: %s", path)
+	}
+
+	workingDirectory, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+
+	var plist strings.Builder
+	if err := plistTemplate.Execute(&plist, struct {
+		Label            string
+		Arguments        []string
+		WorkingDirectory string
+		LogFile          string
+	}{
+		Label:            launchdLabel,
+		Arguments:        append([]string{executable, serviceCommand, "run"}, args...),
+		WorkingDirectory: workingDirectory,
+		LogFile:          filepath.Join(home, "Library", "Logs", serviceName+".log"),
+	}); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, []byte(plist.String()), 0o644); err != nil {
+		return err
+	}
+
+	return launchctl("load", "-w", path)
+}
+
+// uninstallService stops the launchd agent and removes it.
+func uninstallService() error {
+	path, err := plistPath()
+	if err != nil {
+		return err
+	}
+
+	if err := launchctl("unload", "-w", path); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+func launchctl(args ...string) error {
+	output, err := exec.Command("launchctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("launchctl %s failed: %s: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// runAsService runs the exporter. launchd stops it using SIGTERM, which is handled like on the command line.
+func runAsService(run func()) error {
+	run()
+	return nil
+}
@@ -0,0 +1,20 @@
+//go:build !windows && !darwin
+
+package main
+
+import "errors"
+
+var errServiceUnsupported = errors.New("installing a service is only supported on Windows and macOS, use the init system of your distribution instead")
+
+func installService(_ string, _ []string) error {
+	return errServiceUnsupported
+}
+
+func uninstallService() error {
+	return errServiceUnsupported
+}
+
+func runAsService(run func()) error {
+	run()
+	return nil
+}
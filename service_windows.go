@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// installService registers the exporter as a Windows service, which is started automatically, and starts it.
+func installService(executable string, args []string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("can not connect to service manager: %s", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return fmt.Errorf("service %q already exists", serviceName)
+	}
+
+	s, err := m.CreateService(serviceName, executable, mgr.Config{
+		DisplayName: serviceDisplayName,
+		Description: serviceDescription,
+		StartType:   mgr.StartAutomatic,
+	}, append([]string{serviceCommand, "run"}, args...)...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if err := eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		s.Delete()
+		return fmt.Errorf("can not register event log source: %s", err)
+	}
+
+	return s.Start()
+}
+
+// uninstallService stops the service and removes it.
+func uninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("can not connect to service manager: %s", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %q is not installed", serviceName)
+	}
+	defer s.Close()
+
+	// The service might not be running.
+	s.Control(svc.Stop)
+
+	if err := s.Delete(); err != nil {
+		return err
+	}
+
+	return eventlog.Remove(serviceName)
+}
+
+// runAsService runs the exporter under the control of the service manager and logs to the event log. It runs
+// the exporter directly if the process has not been started by the service manager.
+func runAsService(run func()) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return err
+	}
+
+	if !isService {
+		run()
+		return nil
+	}
+
+	events, err := eventlog.Open(serviceName)
+	if err != nil {
+		return fmt.Errorf("can not open event log: %s", err)
+	}
+	defer events.Close()
+	log.AddHook(&eventLogHook{events: events})
+
+	return svc.Run(serviceName, &serviceHandler{run: run})
+}
+
+type serviceHandler struct {
+	run func()
+}
+
+// Execute implements svc.Handler
+func (h *serviceHandler) Execute(_ []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.run()
+	}()
+
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case <-done:
+			return false, 0
+		case r := <-requests:
+			switch r.Cmd {
+			case svc.Interrogate:
+				status <- r.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				close(stop)
+				<-done
+				return false, 0
+			}
+		}
+	}
+}
+
+// eventLogHook writes the log messages to the Windows event log.
+type eventLogHook struct {
+	events *eventlog.Log
+}
+
+func (h *eventLogHook) Levels() []logrus.Level {
+	return []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel, logrus.WarnLevel, logrus.InfoLevel}
+}
+
+func (h *eventLogHook) Fire(entry *logrus.Entry) error {
+	message, err := entry.String()
+	if err != nil {
+		return err
+	}
+
+	switch entry.Level {
+	case logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel:
+		return h.events.Error(1, message)
+	case logrus.WarnLevel:
+		return h.events.Warning(1, message)
+	default:
+		return h.events.Info(1, message)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/xperimental/flowercare-exporter/internal/adapter"
+	"github.com/xperimental/flowercare-exporter/internal/collector"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+)
+
+// summary describes the configuration of a running instance.
+type summary struct {
+	Adapter  string
+	Backend  string
+	Sensors  int
+	Outputs  []string
+	Features []string
+}
+
+func newSummary(cfg config.Config, selected []adapter.Adapter) summary {
+	var names []string
+	for _, a := range selected {
+		if a.KernelName != "" {
+			names = append(names, a.KernelName)
+		}
+	}
+
+	s := summary{
+		Adapter: strings.Join(names, ","),
+		Backend: backendKind(cfg),
+		Sensors: len(cfg.Sensors),
+		Outputs: []string{"metrics"},
+	}
+
+	if cfg.Edge.PushURL != "" {
+		s.Outputs = append(s.Outputs, "edge-push")
+	}
+	if cfg.Edge.Aggregator {
+		s.Outputs = append(s.Outputs, "aggregator")
+	}
+	if cfg.API.Enabled {
+		s.Outputs = append(s.Outputs, "api")
+	}
+	if len(cfg.Notify.Channels) > 0 {
+		s.Outputs = append(s.Outputs, "notify")
+	}
+	if cfg.Grafana.URL != "" {
+		s.Outputs = append(s.Outputs, "grafana")
+	}
+	if cfg.MQTT.Broker != "" {
+		s.Outputs = append(s.Outputs, "mqtt")
+	}
+	if cfg.InfluxDB.URL != "" {
+		s.Outputs = append(s.Outputs, "influxdb")
+	}
+	if cfg.OTLP.Endpoint != "" {
+		s.Outputs = append(s.Outputs, "otlp")
+	}
+	if cfg.Backfill.URL != "" {
+		s.Outputs = append(s.Outputs, "backfill")
+	}
+	if cfg.Probe.Enabled {
+		s.Outputs = append(s.Outputs, "probe")
+	}
+
+	for _, f := range []struct {
+		Name    string
+		Enabled bool
+	}{
+		{Name: "anonymize", Enabled: cfg.Anonymize.Enabled},
+		{Name: "api-oidc", Enabled: cfg.API.Enabled && cfg.API.OIDC.Issuer != ""},
+		{Name: "api-proxy-auth", Enabled: cfg.API.Enabled && cfg.API.ProxyAuth.UserHeader != ""},
+		{Name: "client-certificates", Enabled: cfg.Web.TLS.ClientCAFile != ""},
+		{Name: "discover", Enabled: cfg.Discover},
+		{Name: "histograms", Enabled: len(cfg.Histograms) > 0},
+		{Name: "https", Enabled: cfg.Web.TLS.Enabled()},
+		{Name: "energy-estimate", Enabled: cfg.EnergyEstimate},
+		{Name: "handoff", Enabled: cfg.Handoff.Socket != ""},
+		{Name: "homeassistant", Enabled: cfg.MQTT.Broker != "" && cfg.MQTT.HomeAssistant},
+		{Name: "legacy-labels", Enabled: cfg.LegacyLabels},
+		{Name: "compat", Enabled: cfg.Compat != ""},
+		{Name: "lifecycle", Enabled: cfg.Web.EnableLifecycle},
+		{Name: "low-resource", Enabled: cfg.Resources.Low},
+		{Name: "max-age", Enabled: (cfg.MQTT.Broker != "" && cfg.MQTT.MaxAge > 0) || (cfg.Edge.PushURL != "" && cfg.Edge.MaxAge > 0) || (cfg.InfluxDB.URL != "" && cfg.InfluxDB.MaxAge > 0)},
+		{Name: "passive-scan", Enabled: hasPassiveSensors(cfg.Sensors)},
+		{Name: "rounding", Enabled: len(cfg.Rounding.Steps) > 0},
+		{Name: "metric-units", Enabled: cfg.Units.Changed()},
+		{Name: "watch-sensordir", Enabled: cfg.WatchSensorDir},
+		{Name: "concurrent-reads", Enabled: cfg.ConcurrentReads > 1},
+		{Name: "refresh-spread", Enabled: cfg.RefreshSpread || cfg.RefreshJitter > 0},
+		{Name: "sandbox", Enabled: cfg.Sandbox},
+		{Name: "startup-ping", Enabled: cfg.StartupPing > 0},
+		{Name: "no-egress", Enabled: cfg.Egress.Disabled},
+		{Name: "wait-for-first-read", Enabled: cfg.WaitForFirstRead > 0},
+		{Name: "web-auth", Enabled: cfg.Web.AuthEnabled()},
+	} {
+		if f.Enabled {
+			s.Features = append(s.Features, f.Name)
+		}
+	}
+	for _, name := range cfg.Features.Names() {
+		s.Features = append(s.Features, "experimental:"+name)
+	}
+	sort.Strings(s.Features)
+
+	return s
+}
+
+// backendKind returns how the Bluetooth operations are done, mirroring the decision in createBackend.
+func backendKind(cfg config.Config) string {
+	switch {
+	case cfg.Privsep.WorkerSocket != "":
+		return "worker"
+	case cfg.Privsep.User != "":
+		return "privsep"
+	case len(cfg.Sensors) > 0 || cfg.Discover:
+		return "local"
+	default:
+		return "none"
+	}
+}
+
+func (s summary) log() {
+	log.Infof("Adapter: %s, backend: %s, sensors: %d", valueOrNone(s.Adapter), s.Backend, s.Sensors)
+	log.Infof("Outputs: %s", strings.Join(s.Outputs, ", "))
+	log.Infof("Features: %s", valueOrNone(strings.Join(s.Features, ", ")))
+}
+
+func valueOrNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+
+	return value
+}
+
+// metric returns an info metric containing the summary as labels.
+func (s summary) metric() prometheus.Collector {
+	g := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: collector.MetricPrefix + "exporter_config_info",
+		Help: "Contains a summary of the configuration of the exporter as labels. Value set to 1.",
+		ConstLabels: prometheus.Labels{
+			"adapter":  s.Adapter,
+			"backend":  s.Backend,
+			"sensors":  strconv.Itoa(s.Sensors),
+			"outputs":  strings.Join(s.Outputs, ","),
+			"features": strings.Join(s.Features, ","),
+		},
+	})
+	g.Set(1)
+
+	return g
+}
+
+// deprecationMetric returns a metric containing the deprecated settings in use, so that they can be found before
+// upgrading to a version removing them.
+func deprecationMetric(deprecations []config.Deprecation) prometheus.Collector {
+	g := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: collector.MetricPrefix + "deprecated_config_in_use",
+		Help: "Contains a deprecated setting in use and its replacement as labels. Value set to 1.",
+	}, []string{"setting", "replacement"})
+	for _, d := range deprecations {
+		g.WithLabelValues(d.Setting, d.Replacement).Set(1)
+	}
+
+	return g
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xperimental/flowercare-exporter/internal/backend"
+	"github.com/xperimental/flowercare-exporter/internal/config"
+	"github.com/xperimental/flowercare-exporter/internal/privsep"
+	"github.com/xperimental/flowercare-exporter/internal/sandbox"
+)
+
+const workerCommand = "ble-worker"
+
+// runWorker runs the process holding the Bluetooth adapter, which serves requests on a unix socket.
+func runWorker(args []string) {
+	cfg, err := config.ParseWorker(args)
+	if err != nil {
+		log.Fatalf("Error in worker configuration: %s", err)
+	}
+	log.SetLevel(logrus.Level(cfg.LogLevel))
+
+	dumper, err := newDumper(cfg.Dump)
+	if err != nil {
+		log.Fatalf("Error setting up raw dumps: %s", err)
+	}
+
+	local, err := backend.NewLocal(log, cfg.Device, cfg.BLE, dumper)
+	if err != nil {
+		log.Fatalf("Error creating device: %s", err)
+	}
+	defer local.Close()
+
+	// The socket is created using a temporary name and only moved to its final path after the owner was changed,
+	// so that the exporter does not try to connect too early.
+	tmpSocket := cfg.Socket + ".tmp"
+	os.Remove(tmpSocket)
+	listener, err := net.Listen("unix", tmpSocket)
+	if err != nil {
+		log.Fatalf("Error creating socket: %s", err)
+	}
+
+	if cfg.SocketUser != "" {
+		if err := privsep.ChownSocket(tmpSocket, cfg.SocketUser); err != nil {
+			log.Fatalf("Error changing owner of socket: %s", err)
+		}
+	}
+
+	if err := os.Rename(tmpSocket, cfg.Socket); err != nil {
+		log.Fatalf("Error moving socket: %s", err)
+	}
+
+	if cfg.Sandbox {
+		paths := sandbox.Paths{
+			Write: []string{filepath.Dir(cfg.Socket)},
+		}
+		if cfg.Dump.Dir != "" {
+			paths.Write = append(paths.Write, cfg.Dump.Dir)
+		}
+
+		if err := sandbox.Apply(log, paths); err != nil {
+			log.Fatalf("Error applying sandbox: %s", err)
+		}
+	}
+
+	go func() {
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+		<-sigCh
+		log.Debug("Worker got shutdown signal.")
+		listener.Close()
+	}()
+
+	log.Infof("BLE worker listening on %s", cfg.Socket)
+	if err := backend.Serve(log, listener, local); err != nil {
+		log.Debugf("Worker stopped serving: %s", err)
+	}
+	os.Remove(cfg.Socket)
+}